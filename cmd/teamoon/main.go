@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/exec"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/spf13/cobra"
@@ -16,10 +19,14 @@ import (
 	"github.com/JuanVilla424/teamoon/internal/dashboard"
 	"github.com/JuanVilla424/teamoon/internal/engine"
 	"github.com/JuanVilla424/teamoon/internal/logs"
+	"github.com/JuanVilla424/teamoon/internal/metrics"
 	"github.com/JuanVilla424/teamoon/internal/onboarding"
 	"github.com/JuanVilla424/teamoon/internal/pathutil"
+	"github.com/JuanVilla424/teamoon/internal/plan"
 	"github.com/JuanVilla424/teamoon/internal/queue"
+	"github.com/JuanVilla424/teamoon/internal/tokens"
 	"github.com/JuanVilla424/teamoon/internal/web"
+	"github.com/JuanVilla424/teamoon/internal/webhook"
 )
 
 var (
@@ -41,6 +48,16 @@ func main() {
 		Use:     "teamoon",
 		Short:   "AI-powered task autopilot",
 		Version: version,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return fmt.Errorf("config: %w", err)
+			}
+			if err := queue.Init(cfg.TaskBackend); err != nil {
+				return fmt.Errorf("task backend: %w", err)
+			}
+			return nil
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg, err := config.Load()
 			if err != nil {
@@ -59,6 +76,10 @@ func main() {
 				log.SetOutput(f)
 			}
 
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			webhook.Start(ctx, cfg)
+
 			m := dashboard.NewModel(cfg, engineMgr, logBuf)
 			p := tea.NewProgram(m, tea.WithAltScreen())
 			if _, err := p.Run(); err != nil {
@@ -77,22 +98,64 @@ func main() {
 	var taskProject string
 	var taskPriority string
 
+	var taskParent int
 	taskAddCmd := &cobra.Command{
 		Use:   "add [description]",
 		Short: "Add a new task",
 		Args:  cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			desc := args[0]
+			if taskParent != 0 {
+				if _, err := queue.GetTask(taskParent); err != nil {
+					return err
+				}
+			}
 			t, err := queue.Add(taskProject, desc, taskPriority)
 			if err != nil {
 				return err
 			}
+			queue.RecordAction(t.ID, queue.ActorCLI, "created")
+			if taskParent != 0 {
+				if t, err = queue.SetParent(t.ID, taskParent); err != nil {
+					return err
+				}
+			}
 			fmt.Printf("Task #%d added: [%s] %s — %s\n", t.ID, t.Priority, t.Project, t.Description)
 			return nil
 		},
 	}
 	taskAddCmd.Flags().StringVarP(&taskProject, "project", "p", "", "Project name")
 	taskAddCmd.Flags().StringVarP(&taskPriority, "priority", "r", "med", "Priority: high, med, low")
+	taskAddCmd.Flags().IntVar(&taskParent, "parent", 0, "Add as a subtask of this epic")
+
+	taskParentCmd := &cobra.Command{
+		Use:   "parent [id] [epic-id]",
+		Short: "Move a task under an epic; epic 0 detaches it",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseTaskID(args[0])
+			if err != nil {
+				return err
+			}
+			parent := 0
+			if args[1] != "0" {
+				if parent, err = parseTaskID(args[1]); err != nil {
+					return err
+				}
+			}
+			if _, err := queue.SetParent(id, parent); err != nil {
+				return err
+			}
+			if parent == 0 {
+				queue.RecordAction(id, queue.ActorCLI, "detached from epic")
+				fmt.Printf("Task #%d detached from its epic\n", id)
+			} else {
+				queue.RecordAction(id, queue.ActorCLI, fmt.Sprintf("moved under #%d", parent))
+				fmt.Printf("Task #%d moved under #%d\n", id, parent)
+			}
+			return nil
+		},
+	}
 
 	taskDoneCmd := &cobra.Command{
 		Use:   "done [id]",
@@ -106,30 +169,448 @@ func main() {
 			if err := queue.MarkDone(id); err != nil {
 				return err
 			}
+			queue.RecordAction(id, queue.ActorCLI, "marked done")
 			fmt.Printf("Task #%d marked as done\n", id)
 			return nil
 		},
 	}
 
+	var listStates, listQuery, listFilter string
+	var listTree bool
 	taskListCmd := &cobra.Command{
 		Use:   "list",
 		Short: "List pending tasks",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			tasks, err := queue.ListPending()
-			if err != nil {
-				return err
+			raw := listQuery
+			if listFilter != "" {
+				saved, err := queue.GetFilter(listFilter)
+				if err != nil {
+					return err
+				}
+				raw = saved.Query + " " + raw
+			}
+			if listStates != "" {
+				raw += " state:" + listStates
+			}
+			var tasks []queue.Task
+			if strings.TrimSpace(raw) != "" {
+				q, err := queue.ParseQuery(raw)
+				if err != nil {
+					return fmt.Errorf("query: %w", err)
+				}
+				if tasks, err = queue.Search(q); err != nil {
+					return err
+				}
+			} else {
+				var err error
+				if tasks, err = queue.ListPending(); err != nil {
+					return err
+				}
 			}
 			if len(tasks) == 0 {
 				fmt.Println("No pending tasks")
 				return nil
 			}
+			all, err := queue.ListAll()
+			if err != nil {
+				return err
+			}
+			children := queue.ChildIndex(all)
+			line := func(t queue.Task, indent string) {
+				desc := t.Description
+				switch queue.EffectiveState(t) {
+				case queue.StateAwaitingApproval:
+					desc += "  (plan awaiting approval)"
+				case queue.StateInReview:
+					desc += fmt.Sprintf("  (in review: %s)", t.PRURL)
+				case queue.StateFailed:
+					desc += fmt.Sprintf("  (failed: %s)", t.FailReason)
+				case queue.StateBlocked:
+					desc += fmt.Sprintf("  (blocked: %s)", t.HeldReason)
+				}
+				if len(t.Labels) > 0 {
+					desc += "  [" + strings.Join(t.Labels, " ") + "]"
+				}
+				if len(children[t.ID]) > 0 {
+					r := queue.RollupOf(t.ID, children)
+					desc += fmt.Sprintf("  (epic: %d/%d done, %s)", r.Done, r.Total, r.State)
+				}
+				fmt.Printf("%s#%-3d [%-4s] %-20s %s\n", indent, t.ID, t.Priority, t.Project, desc)
+			}
+			if !listTree {
+				for _, t := range tasks {
+					line(t, "")
+				}
+				return nil
+			}
+			listed := make(map[int]bool, len(tasks))
+			for _, t := range tasks {
+				listed[t.ID] = true
+			}
+			var walk func(t queue.Task, depth int)
+			walk = func(t queue.Task, depth int) {
+				indent := ""
+				if depth > 0 {
+					indent = strings.Repeat("   ", depth-1) + "└─ "
+				}
+				line(t, indent)
+				for _, c := range children[t.ID] {
+					if listed[c.ID] {
+						walk(c, depth+1)
+					}
+				}
+			}
 			for _, t := range tasks {
-				fmt.Printf("#%-3d [%-4s] %-20s %s\n", t.ID, t.Priority, t.Project, t.Description)
+				if !listed[t.ParentID] {
+					walk(t, 0)
+				}
 			}
 			return nil
 		},
 	}
 
+	taskListCmd.Flags().StringVar(&listStates, "state", "", "Only list tasks in these states (comma-separated)")
+	taskListCmd.Flags().StringVarP(&listQuery, "query", "q", "", `Search query, e.g. "project:api label:security state:failed timeout"`)
+	taskListCmd.Flags().StringVar(&listFilter, "filter", "", "Start from a saved filter")
+	taskListCmd.Flags().BoolVar(&listTree, "tree", false, "Show subtasks indented under their epics")
+
+	taskLabelCmd := &cobra.Command{
+		Use:   "label [id] [labels...]",
+		Short: "Replace a task's labels; no labels clears them",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseTaskID(args[0])
+			if err != nil {
+				return err
+			}
+			var labels []string
+			for _, a := range args[1:] {
+				labels = append(labels, strings.Split(a, ",")...)
+			}
+			t, err := queue.SetLabels(id, labels)
+			if err != nil {
+				return err
+			}
+			queue.RecordAction(id, queue.ActorCLI, "labels "+strings.Join(t.Labels, ","))
+			fmt.Printf("Task #%d labels: %s\n", id, strings.Join(t.Labels, ", "))
+			return nil
+		},
+	}
+
+	filterCmd := &cobra.Command{
+		Use:   "filter",
+		Short: "Manage saved task filters",
+	}
+	filterListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List saved filters",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filters, err := queue.ListFilters()
+			if err != nil {
+				return err
+			}
+			if len(filters) == 0 {
+				fmt.Println("No saved filters")
+				return nil
+			}
+			for _, f := range filters {
+				fmt.Printf("  %-20s %s\n", f.Name, f.Query)
+			}
+			return nil
+		},
+	}
+	filterSaveCmd := &cobra.Command{
+		Use:   "save [name] [query]",
+		Short: "Save a query under a name",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := queue.SaveFilter(args[0], strings.Join(args[1:], " "))
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Filter %q saved: %s\n", f.Name, f.Query)
+			return nil
+		},
+	}
+	filterDeleteCmd := &cobra.Command{
+		Use:   "delete [name]",
+		Short: "Delete a saved filter",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := queue.DeleteFilter(args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("Filter %q deleted\n", args[0])
+			return nil
+		},
+	}
+	filterCmd.AddCommand(filterListCmd, filterSaveCmd, filterDeleteCmd)
+
+	taskRetryCmd := &cobra.Command{
+		Use:   "retry [id]",
+		Short: "Send a failed or blocked task back to the queue",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseTaskID(args[0])
+			if err != nil {
+				return err
+			}
+			t, err := queue.Retry(id)
+			if err != nil {
+				return err
+			}
+			queue.RecordAction(id, queue.ActorCLI, "retry")
+			fmt.Printf("Task #%d is %s again\n", id, queue.EffectiveState(t))
+			return nil
+		},
+	}
+
+	taskEventsCmd := &cobra.Command{
+		Use:   "events [id]",
+		Short: "Show a task's activity timeline",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseTaskID(args[0])
+			if err != nil {
+				return err
+			}
+			events, err := queue.LoadEvents(id)
+			if err != nil {
+				return err
+			}
+			if len(events) == 0 {
+				fmt.Printf("Task #%d has no recorded events\n", id)
+				return nil
+			}
+			for _, e := range events {
+				actor := e.Actor
+				if actor == "" {
+					actor = "-"
+				}
+				fmt.Printf("  %s  %-9s %-12s %s\n", e.Time.Format("2006-01-02 15:04:05"), actor, e.Kind, queue.DescribeEvent(e))
+			}
+			if f := queue.Flow(events); f.Lead > 0 {
+				fmt.Printf("Lead time %s, cycle time %s\n", f.Lead.Round(time.Second), f.Cycle.Round(time.Second))
+			}
+			return nil
+		},
+	}
+
+	taskApproveCmd := &cobra.Command{
+		Use:   "approve [id]",
+		Short: "Approve a plan awaiting review so autopilot runs it",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseTaskID(args[0])
+			if err != nil {
+				return err
+			}
+			if err := engine.ApprovePlan(id); err != nil {
+				return err
+			}
+			queue.RecordAction(id, queue.ActorCLI, "plan approved")
+			fmt.Printf("Task #%d plan approved\n", id)
+			return nil
+		},
+	}
+
+	taskRejectCmd := &cobra.Command{
+		Use:   "reject [id] [feedback]",
+		Short: "Reject a plan awaiting review and replan with the feedback",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseTaskID(args[0])
+			if err != nil {
+				return err
+			}
+			feedback := strings.Join(args[1:], " ")
+			if err := engine.RejectPlan(id, feedback); err != nil {
+				return err
+			}
+			queue.RecordAction(id, queue.ActorCLI, "plan rejected: "+feedback)
+			fmt.Printf("Task #%d plan rejected; it will be replanned\n", id)
+			return nil
+		},
+	}
+
+	var editFile string
+	taskEditCmd := &cobra.Command{
+		Use:   "edit [id]",
+		Short: "Edit the plan of a planned or awaiting-approval task",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseTaskID(args[0])
+			if err != nil {
+				return err
+			}
+			cfg, err := config.Load()
+			if err != nil {
+				return fmt.Errorf("config: %w", err)
+			}
+			path := editFile
+			if path == "" {
+				content, err := os.ReadFile(plan.PlanPath(id))
+				if err != nil {
+					return fmt.Errorf("task #%d has no plan: %w", id, err)
+				}
+				f, err := os.CreateTemp("", fmt.Sprintf("teamoon-plan-%d-*.md", id))
+				if err != nil {
+					return err
+				}
+				path = f.Name()
+				defer os.Remove(path)
+				f.Write(content)
+				f.Close()
+				if err := runEditor(path); err != nil {
+					return fmt.Errorf("editor: %w", err)
+				}
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			report, err := engine.EditPlan(cfg, id, string(content))
+			for _, is := range append(report.Errors, report.Warnings...) {
+				fmt.Printf("  %s %s: %s\n", is.Severity, is.Code, is.Message)
+			}
+			if err != nil {
+				return err
+			}
+			queue.RecordAction(id, queue.ActorCLI, "plan edited")
+			fmt.Printf("Task #%d plan updated\n", id)
+			return nil
+		},
+	}
+	taskEditCmd.Flags().StringVarP(&editFile, "file", "f", "", "Read the new plan from a file instead of opening $EDITOR")
+
+	taskRequireApprovalCmd := &cobra.Command{
+		Use:   "require-approval [id] [on|off|inherit]",
+		Short: "Override whether a task's plan needs approval before autopilot runs it",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseTaskID(args[0])
+			if err != nil {
+				return err
+			}
+			var require *bool
+			switch args[1] {
+			case "on", "off":
+				v := args[1] == "on"
+				require = &v
+			case "inherit":
+			default:
+				return fmt.Errorf("expected on, off or inherit, got %q", args[1])
+			}
+			if err := queue.SetRequirePlanApproval(id, require); err != nil {
+				return err
+			}
+			queue.RecordAction(id, queue.ActorCLI, "plan approval "+args[1])
+			fmt.Printf("Task #%d plan approval: %s\n", id, args[1])
+			return nil
+		},
+	}
+
+	taskCheckpointsCmd := &cobra.Command{
+		Use:   "checkpoints [id]",
+		Short: "List the git checkpoints recorded for a task",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseTaskID(args[0])
+			if err != nil {
+				return err
+			}
+			cfg, err := config.Load()
+			if err != nil {
+				return fmt.Errorf("config: %w", err)
+			}
+			cps, err := engine.ListCheckpoints(cfg, id)
+			if err != nil {
+				return err
+			}
+			if len(cps) == 0 {
+				fmt.Printf("Task #%d has no checkpoints\n", id)
+				return nil
+			}
+			for _, cp := range cps {
+				fmt.Printf("  %-8s %s  %s  %s\n", cp.Name, cp.Commit[:min(len(cp.Commit), 10)], cp.Time.Format("2006-01-02 15:04"), cp.Dir)
+			}
+			return nil
+		},
+	}
+
+	taskRevertStepCmd := &cobra.Command{
+		Use:   "revert-step [id] [step]",
+		Short: "Undo a step and every step after it, then resume from that step",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseTaskID(args[0])
+			if err != nil {
+				return err
+			}
+			var step int
+			if _, err := fmt.Sscanf(args[1], "%d", &step); err != nil || step < 1 {
+				return fmt.Errorf("invalid step %q", args[1])
+			}
+			cfg, err := config.Load()
+			if err != nil {
+				return fmt.Errorf("config: %w", err)
+			}
+			if err := engine.RevertStep(cfg, id, step); err != nil {
+				return err
+			}
+			queue.RecordAction(id, queue.ActorCLI, fmt.Sprintf("Reverted to checkpoint before step %d", step))
+			fmt.Printf("Task #%d reverted to before step %d\n", id, step)
+			return nil
+		},
+	}
+
+	taskRestoreCmd := &cobra.Command{
+		Use:   "restore [id]",
+		Short: "Discard all of a task's changes, restoring the pre-task state",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseTaskID(args[0])
+			if err != nil {
+				return err
+			}
+			cfg, err := config.Load()
+			if err != nil {
+				return fmt.Errorf("config: %w", err)
+			}
+			if err := engine.RestoreTask(cfg, id); err != nil {
+				return err
+			}
+			queue.RecordAction(id, queue.ActorCLI, "Restored pre-task state")
+			fmt.Printf("Task #%d restored to its pre-task state\n", id)
+			return nil
+		},
+	}
+
+	taskMigrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Move tasks.json into the SQLite task store and switch to it",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return fmt.Errorf("config: %w", err)
+			}
+			if cfg.TaskBackend == queue.BackendSQLite {
+				fmt.Println("Task backend is already sqlite")
+				return nil
+			}
+			n, err := queue.MigrateToSQLite()
+			if err != nil {
+				return err
+			}
+			cfg.TaskBackend = queue.BackendSQLite
+			if err := config.Save(cfg); err != nil {
+				return fmt.Errorf("save: %w", err)
+			}
+			fmt.Printf("Migrated %d tasks to sqlite (tasks.json kept as tasks.json.migrated)\n", n)
+			return nil
+		},
+	}
+
 	serveCmd := &cobra.Command{
 		Use:   "serve",
 		Short: "Run web server only (no TUI)",
@@ -197,12 +678,157 @@ func main() {
 		},
 	}
 
+	var pricingDays int
+	var pricingInit bool
+	pricingCmd := &cobra.Command{
+		Use:   "pricing",
+		Short: "Show model pricing coverage for recent sessions",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if pricingInit {
+				path, err := metrics.WriteDefaultPricing()
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Default pricing written to %s\n", path)
+				return nil
+			}
+			cfg, err := config.Load()
+			if err != nil {
+				return fmt.Errorf("config: %w", err)
+			}
+			table := metrics.Pricing()
+			source := "embedded defaults"
+			if _, err := os.Stat(metrics.PricingPath()); err == nil {
+				source = metrics.PricingPath()
+			}
+			fmt.Printf("Pricing table v%d (%s) from %s, %d entries\n\n", table.Version, table.Updated, source, len(table.Models))
+
+			seen, err := metrics.ModelsSeen(cfg.ClaudeDir, time.Now().AddDate(0, 0, -pricingDays))
+			if err != nil {
+				return err
+			}
+			if len(seen) == 0 {
+				fmt.Printf("No model usage in the last %d days\n", pricingDays)
+				return nil
+			}
+			missing := 0
+			for _, m := range seen {
+				entry := m.Matched
+				if !m.Priced {
+					entry = "NO PRICE (billed as " + m.Matched + ")"
+					missing++
+				}
+				fmt.Printf("%-34s %7d req %12d in %10d out  %s\n", m.Model, m.Requests, m.Input, m.Output, entry)
+			}
+			if missing > 0 {
+				fmt.Printf("\n%d model(s) have no price entry; add them to %s\n", missing, metrics.PricingPath())
+			}
+			return nil
+		},
+	}
+	pricingCmd.Flags().IntVar(&pricingDays, "days", 7, "How many days of sessions to scan")
+	pricingCmd.Flags().BoolVar(&pricingInit, "init", false, "Write the default pricing table to the config dir for editing")
+
+	tokenCmd := &cobra.Command{
+		Use:   "token",
+		Short: "Manage API tokens for scripts and bots",
+	}
+	var tokenScope, tokenExpires string
+	tokenCreateCmd := &cobra.Command{
+		Use:   "create [name]",
+		Short: "Create an API token and print it once",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ttl, err := tokens.ParseTTL(tokenExpires)
+			if err != nil {
+				return err
+			}
+			t, secret, err := tokens.Create(args[0], tokenScope, ttl)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Token %q created (#%d, scope %s)\n", t.Name, t.ID, t.Scope)
+			if t.ExpiresAt != nil {
+				fmt.Printf("Expires %s\n", t.ExpiresAt.Format("2006-01-02 15:04"))
+			}
+			fmt.Printf("\n  %s\n\nSend it as \"Authorization: Bearer <token>\". It will not be shown again.\n", secret)
+			return nil
+		},
+	}
+	tokenCreateCmd.Flags().StringVar(&tokenScope, "scope", tokens.ScopeRead, "Token scope: "+strings.Join(tokens.Scopes, ", "))
+	tokenCreateCmd.Flags().StringVar(&tokenExpires, "expires", "", "Lifetime such as 30d or 12h; empty never expires")
+	tokenListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List API tokens",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			list, err := tokens.List()
+			if err != nil {
+				return err
+			}
+			if len(list) == 0 {
+				fmt.Println("No API tokens")
+				return nil
+			}
+			stamp := func(t *time.Time, none string) string {
+				if t == nil {
+					return none
+				}
+				return t.Format("2006-01-02 15:04")
+			}
+			fmt.Printf("  %-4s %-20s %-12s %-14s %-17s %-17s %s\n", "ID", "NAME", "SCOPE", "PREFIX", "CREATED", "EXPIRES", "LAST USED")
+			for _, t := range list {
+				expires := stamp(t.ExpiresAt, "never")
+				if t.Expired(time.Now()) {
+					expires += " (expired)"
+				}
+				fmt.Printf("  %-4d %-20s %-12s %-14s %-17s %-17s %s\n", t.ID, t.Name, t.Scope, t.Prefix, stamp(&t.CreatedAt, ""), expires, stamp(t.LastUsedAt, "never"))
+			}
+			return nil
+		},
+	}
+	tokenRevokeCmd := &cobra.Command{
+		Use:   "revoke [name|id]",
+		Short: "Revoke an API token",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			t, err := tokens.Revoke(args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Token %q revoked\n", t.Name)
+			return nil
+		},
+	}
+	tokenCmd.AddCommand(tokenCreateCmd, tokenListCmd, tokenRevokeCmd)
+
 	rootCmd.PersistentFlags().BoolVar(&debugFlag, "debug", false, "Enable debug logging")
 
-	taskCmd.AddCommand(taskAddCmd, taskDoneCmd, taskListCmd)
-	rootCmd.AddCommand(taskCmd, serveCmd, initCmd, setPasswordCmd)
+	taskCmd.AddCommand(taskAddCmd, taskDoneCmd, taskListCmd, taskParentCmd, taskLabelCmd, filterCmd, taskRetryCmd, taskEventsCmd, taskApproveCmd, taskRejectCmd, taskEditCmd, taskRequireApprovalCmd, taskCheckpointsCmd, taskRevertStepCmd, taskRestoreCmd, taskMigrateCmd)
+	rootCmd.AddCommand(taskCmd, serveCmd, initCmd, setPasswordCmd, pricingCmd, tokenCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
 	}
 }
+
+func parseTaskID(arg string) (int, error) {
+	var id int
+	if _, err := fmt.Sscanf(arg, "%d", &id); err != nil {
+		return 0, fmt.Errorf("invalid task ID: %s", arg)
+	}
+	return id, nil
+}
+
+// runEditor opens path in $VISUAL or $EDITOR (vi if neither is set).
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	c := exec.Command("sh", "-c", editor+` "$1"`, "sh", path)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return c.Run()
+}
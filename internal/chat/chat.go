@@ -4,10 +4,10 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
-	"sync"
 	"time"
 
 	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/persist"
 )
 
 const maxMessages = 50
@@ -24,7 +24,7 @@ type chatStore struct {
 	Messages []Message `json:"messages"`
 }
 
-var storeMu sync.Mutex
+var storeMu = persist.NewMutex(chatPath)
 
 func chatPath() string {
 	return filepath.Join(config.ConfigDir(), "chat.json")
@@ -52,7 +52,7 @@ func save(store chatStore) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(chatPath(), data, 0644)
+	return persist.WriteFile(chatPath(), data, 0644)
 }
 
 func LoadHistory() ([]Message, error) {
@@ -2,9 +2,12 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/JuanVilla424/teamoon/internal/persist"
 )
 
 type SkeletonStep struct {
@@ -57,6 +60,54 @@ type SpawnConfig struct {
 	PlanTimeoutMin  int    `json:"plan_timeout_min"`   // 0 = use default (15 min)
 	PlanMaxTurns    int    `json:"plan_max_turns"`     // 0 = unlimited (no --max-turns flag)
 	MaxPlanAttempts int    `json:"max_plan_attempts"`  // 0 falls back to default of 3
+	Runtime         string `json:"runtime,omitempty"`  // agent runtime; "" = claude
+	// Retry overrides the retry policy per failure class; see RetryPolicyFor.
+	Retry map[string]RetryPolicy `json:"retry,omitempty"`
+}
+
+// Failure classes a failed step spawn is sorted into; keys of SpawnConfig.Retry.
+const (
+	FailureRateLimit = "rate_limit" // rate limited or API overloaded
+	FailureTimeout   = "timeout"    // hit spawn.step_timeout_min
+	FailureDenied    = "denied"     // a tool call was denied
+	FailureToolError = "tool_error" // tool calls or verify checks failed
+	FailureGaveUp    = "gave_up"    // the agent stopped without finishing
+)
+
+// RetryPolicy says how a step that failed with a given class is retried.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts, the first included. For rate
+	// limits it caps how many times the step waits for a reset instead.
+	MaxAttempts int `json:"max_attempts"`
+	// BackoffSec is the wait before the first retry, doubled on each further
+	// one. Rate limits wait for the announced reset and fall back to this.
+	BackoffSec int `json:"backoff_sec"`
+	// Recovery runs the failure-analysis prompt before retrying.
+	Recovery bool `json:"recovery"`
+}
+
+// DefaultRetryPolicies returns the policy of every failure class.
+func DefaultRetryPolicies() map[string]RetryPolicy {
+	return map[string]RetryPolicy{
+		FailureRateLimit: {MaxAttempts: 5, BackoffSec: 300},
+		FailureTimeout:   {MaxAttempts: 2},
+		FailureDenied:    {MaxAttempts: 3, Recovery: true},
+		FailureToolError: {MaxAttempts: 3, Recovery: true},
+		FailureGaveUp:    {MaxAttempts: 3, Recovery: true},
+	}
+}
+
+// RetryPolicyFor returns the retry policy for a failure class, preferring
+// spawn.retry over the defaults. Unknown classes are treated as gave_up.
+func RetryPolicyFor(cfg Config, class string) RetryPolicy {
+	if p, ok := cfg.Spawn.Retry[class]; ok && p.MaxAttempts > 0 {
+		return p
+	}
+	defaults := DefaultRetryPolicies()
+	if p, ok := defaults[class]; ok {
+		return p
+	}
+	return defaults[FailureGaveUp]
 }
 
 type SkeletonConfig struct {
@@ -93,6 +144,195 @@ func SkeletonFor(cfg Config, project string) SkeletonConfig {
 	return cfg.Skeleton
 }
 
+// Values for WorktreeConfig.OnComplete.
+const (
+	WorktreeOnCompleteMerge = "merge"
+	WorktreeOnCompletePR    = "pr"
+)
+
+// WorktreeConfig isolates each running task in its own git worktree on
+// branch teamoon/task-<id>, delivered to BaseBranch when the task completes.
+type WorktreeConfig struct {
+	Enabled    bool   `json:"enabled"`
+	BaseBranch string `json:"base_branch"`
+	OnComplete string `json:"on_complete"` // "merge" (default) or "pr"
+	// Projects overrides OnComplete per project.
+	Projects map[string]string `json:"projects,omitempty"`
+	// ReviewPollMin is how often open task PRs are checked, in minutes.
+	ReviewPollMin int `json:"review_poll_min,omitempty"`
+}
+
+// DeliveryFor returns how a project's completed tasks are delivered:
+// WorktreeOnCompleteMerge or WorktreeOnCompletePR.
+func DeliveryFor(cfg Config, project string) string {
+	if mode, ok := cfg.Worktrees.Projects[project]; ok && mode != "" {
+		return mode
+	}
+	if cfg.Worktrees.OnComplete == WorktreeOnCompletePR {
+		return WorktreeOnCompletePR
+	}
+	return WorktreeOnCompleteMerge
+}
+
+// Values for CheckpointConfig.OnFailure.
+const (
+	CheckpointOnFailureKeep         = "keep"
+	CheckpointOnFailureRollbackStep = "rollback_step"
+	CheckpointOnFailureRollbackTask = "rollback_task"
+)
+
+// CheckpointConfig snapshots the working tree into a git ref before every
+// step that may write, so a failed task can be rolled back.
+type CheckpointConfig struct {
+	Enabled   bool   `json:"enabled"`
+	OnFailure string `json:"on_failure"` // "rollback_step" (default), "rollback_task" or "keep"
+}
+
+// BudgetConfig caps agent spend, measured from the spend ledger. A zero
+// value disables that cap.
+type BudgetConfig struct {
+	DailyUSD      float64                  `json:"daily_usd"`
+	MonthlyUSD    float64                  `json:"monthly_usd"`
+	TaskMaxTokens int                      `json:"task_max_tokens"` // input + output tokens per task
+	Projects      map[string]ProjectBudget `json:"projects,omitempty"`
+}
+
+// ProjectBudget caps spend for a single project.
+type ProjectBudget struct {
+	DailyUSD      float64 `json:"daily_usd"`
+	MonthlyUSD    float64 `json:"monthly_usd"`
+	TaskMaxTokens int     `json:"task_max_tokens"` // overrides the global per-task cap when set
+}
+
+// ApprovalConfig makes autopilot wait for a human to approve each generated
+// plan before running it.
+type ApprovalConfig struct {
+	RequirePlanApproval bool            `json:"require_plan_approval"`
+	Projects            map[string]bool `json:"projects,omitempty"` // per-project override of RequirePlanApproval
+}
+
+// WebhookConfig lists the endpoints that task and autopilot events are
+// delivered to. Failed deliveries are retried from a persistent outbox.
+type WebhookConfig struct {
+	Endpoints   []WebhookEndpoint `json:"endpoints,omitempty"`
+	MaxAttempts int               `json:"max_attempts,omitempty"` // deliveries per event; 0 = 8
+	BaseURL     string            `json:"base_url,omitempty"`     // web UI address for task links; "" = http://localhost:<web_port>
+	// QuietHours applies to chat endpoints (every format but json) that
+	// have no quiet hours of their own.
+	QuietHours *QuietHours `json:"quiet_hours,omitempty"`
+}
+
+// Values for WebhookEndpoint.Format.
+const (
+	WebhookFormatJSON    = "json"
+	WebhookFormatSlack   = "slack"
+	WebhookFormatDiscord = "discord"
+	WebhookFormatMatrix  = "matrix"
+	WebhookFormatNtfy    = "ntfy"
+)
+
+// WebhookEndpoint is one webhook receiver.
+type WebhookEndpoint struct {
+	Name     string   `json:"name"`
+	URL      string   `json:"url"`
+	Format   string   `json:"format,omitempty"` // "json" (default), "slack", "discord", "matrix" or "ntfy"
+	Secret   string   `json:"secret,omitempty"` // HMAC-SHA256 signing key; empty = unsigned
+	Token    string   `json:"token,omitempty"`  // matrix access token or ntfy bearer token
+	Events   []string `json:"events,omitempty"` // empty = every event; "task_*" matches by prefix
+	Projects []string `json:"projects,omitempty"`
+	Disabled bool     `json:"disabled,omitempty"`
+	// QuietHours holds non-urgent events until the window ends.
+	QuietHours *QuietHours `json:"quiet_hours,omitempty"`
+}
+
+// QuietHours is a daily window, in local time, during which notifications
+// are held back. A window whose end is before its start spans midnight.
+type QuietHours struct {
+	Start  string   `json:"start"`            // "22:00"
+	End    string   `json:"end"`              // "07:00"
+	Urgent []string `json:"urgent,omitempty"` // events sent anyway, e.g. "task_failed"
+}
+
+// Wants reports whether the endpoint subscribes to event.
+func (e WebhookEndpoint) Wants(event string) bool {
+	if e.Disabled || e.URL == "" {
+		return false
+	}
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, f := range e.Events {
+		if f == event || f == "*" || (strings.HasSuffix(f, "*") && strings.HasPrefix(event, strings.TrimSuffix(f, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// ForProject reports whether the endpoint routes events of project. Events
+// that belong to no project go to every endpoint.
+func (e WebhookEndpoint) ForProject(project string) bool {
+	if len(e.Projects) == 0 || project == "" {
+		return true
+	}
+	for _, p := range e.Projects {
+		if p == project {
+			return true
+		}
+	}
+	return false
+}
+
+// QuietHoursFor returns the quiet hours that apply to ep, or nil.
+func QuietHoursFor(cfg Config, ep WebhookEndpoint) *QuietHours {
+	if ep.QuietHours != nil {
+		return ep.QuietHours
+	}
+	if ep.Format != "" && ep.Format != WebhookFormatJSON {
+		return cfg.Webhooks.QuietHours
+	}
+	return nil
+}
+
+// WebBaseURL is the address notifications link to.
+func WebBaseURL(cfg Config) string {
+	if cfg.Webhooks.BaseURL != "" {
+		return strings.TrimRight(cfg.Webhooks.BaseURL, "/")
+	}
+	host := cfg.WebHost
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return fmt.Sprintf("http://%s:%d", host, cfg.WebPort)
+}
+
+// WebhookEndpoints returns the configured endpoints. The legacy WebhookURL
+// is kept as an unsigned endpoint named "default" receiving every event.
+func WebhookEndpoints(cfg Config) []WebhookEndpoint {
+	out := append([]WebhookEndpoint(nil), cfg.Webhooks.Endpoints...)
+	if cfg.WebhookURL != "" {
+		out = append(out, WebhookEndpoint{Name: "default", URL: cfg.WebhookURL})
+	}
+	return out
+}
+
+// Values for UsageConfig.Provider.
+const (
+	UsageProviderExpect = "expect"
+	UsageProviderLocal  = "local"
+	UsageProviderRemote = "remote"
+)
+
+// UsageConfig selects where the session and weekly usage percentages that
+// drive the guardrails come from.
+type UsageConfig struct {
+	Provider      string `json:"provider,omitempty"`       // "expect" (default), "local" or "remote"
+	URL           string `json:"url,omitempty"`            // remote: http(s) URL or file path serving usage JSON
+	SessionTokens int    `json:"session_tokens,omitempty"` // local: input + output tokens allowed per session window
+	WeeklyTokens  int    `json:"weekly_tokens,omitempty"`  // local: input + output tokens allowed per rolling week
+	SessionHours  int    `json:"session_hours,omitempty"`  // local: session window length; 0 = 5
+}
+
 type Config struct {
 	ProjectsDir        string                `json:"projects_dir"`
 	ClaudeDir          string                `json:"claude_dir"`
@@ -103,6 +343,7 @@ type Config struct {
 	WebHost            string                `json:"web_host"`
 	WebPassword        string                `json:"web_password"`
 	WebhookURL         string                `json:"webhook_url,omitempty"`
+	Webhooks           WebhookConfig         `json:"webhooks"`
 	Spawn              SpawnConfig                    `json:"spawn"`
 	Skeleton           SkeletonConfig                 `json:"skeleton"`
 	ProjectSkeletons   map[string]SkeletonConfig      `json:"project_skeletons,omitempty"`
@@ -114,6 +355,12 @@ type Config struct {
 	LogRetentionDays   int                            `json:"log_retention_days"`
 	SudoEnabled        bool                           `json:"sudo_enabled,omitempty"`
 	PhaseHints         map[string]string              `json:"phase_hints,omitempty"`
+	TaskBackend        string                         `json:"task_backend,omitempty"` // "json" (default) or "sqlite"
+	Worktrees          WorktreeConfig                 `json:"worktrees"`
+	Checkpoints        CheckpointConfig               `json:"checkpoints"`
+	Budget             BudgetConfig                   `json:"budget"`
+	Usage              UsageConfig                    `json:"usage"`
+	Approval           ApprovalConfig                 `json:"approval"`
 }
 
 // DefaultPhaseHints returns descriptions for each skeleton phase.
@@ -150,6 +397,8 @@ func DefaultConfig() Config {
 		SourceDir:          filepath.Join(home, "Projects", "teamoon"),
 		LogRetentionDays:   20,
 		PhaseHints:         DefaultPhaseHints(),
+		Worktrees:          WorktreeConfig{Enabled: true, BaseBranch: "dev", OnComplete: WorktreeOnCompleteMerge},
+		Checkpoints:        CheckpointConfig{Enabled: true, OnFailure: CheckpointOnFailureRollbackStep},
 	}
 }
 
@@ -205,7 +454,7 @@ func Save(cfg Config) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(filepath.Join(dir, "config.json"), data, 0644)
+	return persist.WriteFile(filepath.Join(dir, "config.json"), data, 0644)
 }
 
 // ReadGlobalMCPServers reads MCP servers from ~/.claude/settings.json.
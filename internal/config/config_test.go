@@ -390,3 +390,65 @@ func TestDefaultSkeleton(t *testing.T) {
 		t.Error("Config.Skeleton.WebSearch should default to true")
 	}
 }
+
+func TestDeliveryFor(t *testing.T) {
+	cfg := DefaultConfig()
+	if got := DeliveryFor(cfg, "api"); got != WorktreeOnCompleteMerge {
+		t.Errorf("default delivery = %q", got)
+	}
+	cfg.Worktrees.Projects = map[string]string{"api": WorktreeOnCompletePR}
+	if got := DeliveryFor(cfg, "api"); got != WorktreeOnCompletePR {
+		t.Errorf("project override = %q", got)
+	}
+	cfg.Worktrees.OnComplete = WorktreeOnCompletePR
+	cfg.Worktrees.Projects["web"] = WorktreeOnCompleteMerge
+	if got := DeliveryFor(cfg, "web"); got != WorktreeOnCompleteMerge {
+		t.Errorf("project override of global pr = %q", got)
+	}
+	if got := DeliveryFor(cfg, "cli"); got != WorktreeOnCompletePR {
+		t.Errorf("global pr = %q", got)
+	}
+}
+
+func TestRetryPolicyFor(t *testing.T) {
+	cfg := DefaultConfig()
+	if got := RetryPolicyFor(cfg, FailureRateLimit); got.MaxAttempts != 5 || got.Recovery {
+		t.Errorf("default rate_limit = %+v", got)
+	}
+	if got := RetryPolicyFor(cfg, "bogus"); got != RetryPolicyFor(cfg, FailureGaveUp) {
+		t.Errorf("unknown class = %+v", got)
+	}
+	cfg.Spawn.Retry = map[string]RetryPolicy{
+		FailureTimeout: {MaxAttempts: 4, BackoffSec: 60},
+		FailureDenied:  {},
+	}
+	if got := RetryPolicyFor(cfg, FailureTimeout); got.MaxAttempts != 4 || got.BackoffSec != 60 {
+		t.Errorf("override = %+v", got)
+	}
+	if got := RetryPolicyFor(cfg, FailureDenied); got.MaxAttempts != 3 || !got.Recovery {
+		t.Errorf("empty override should fall back to the default, got %+v", got)
+	}
+}
+
+func TestWebhookEndpoints(t *testing.T) {
+	ep := WebhookEndpoint{Name: "ci", URL: "https://ci", Events: []string{"task_*", "job_finished"}}
+	for event, want := range map[string]bool{"task_done": true, "job_finished": true, "plan_ready": false} {
+		if got := ep.Wants(event); got != want {
+			t.Errorf("Wants(%s) = %v", event, got)
+		}
+	}
+	if (WebhookEndpoint{URL: "https://x"}).Wants("anything") != true {
+		t.Error("an endpoint without filters should get every event")
+	}
+	if (WebhookEndpoint{URL: "https://x", Disabled: true}).Wants("task_done") {
+		t.Error("disabled endpoint should get nothing")
+	}
+
+	cfg := DefaultConfig()
+	cfg.Webhooks.Endpoints = []WebhookEndpoint{ep}
+	cfg.WebhookURL = "https://legacy"
+	eps := WebhookEndpoints(cfg)
+	if len(eps) != 2 || eps[1].Name != "default" || eps[1].URL != "https://legacy" {
+		t.Errorf("endpoints = %+v", eps)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/JuanVilla424/teamoon/internal/engine"
 	"github.com/JuanVilla424/teamoon/internal/logs"
 	"github.com/JuanVilla424/teamoon/internal/metrics"
+	"github.com/JuanVilla424/teamoon/internal/plan"
 	"github.com/JuanVilla424/teamoon/internal/projects"
 	"github.com/JuanVilla424/teamoon/internal/queue"
 )
@@ -25,6 +26,7 @@ type Model struct {
 	session    metrics.SessionContext
 	projects   []projects.Project
 	tasks      []queue.Task
+	projSpend  map[string]metrics.SpendTotals
 	planModel  string
 	execModel  string
 	effort     string
@@ -38,6 +40,13 @@ type Model struct {
 	inputMode     bool
 	inputBuffer   string
 	inputPriority string
+	// Queue search: allTasks is the unfiltered list, tasks what the panel shows
+	allTasks      []queue.Task
+	queueQuery    string
+	queueFilter   string // saved filter name, "" when typed by hand
+	queryInput    bool
+	queryBuffer   string
+	queryErr      string
 	width      int
 	height     int
 	ready      bool
@@ -55,6 +64,12 @@ type Model struct {
 	planLines    []string
 	planTaskID   int
 	planScroll   int
+	planMode     string // "" (active plan), "history", "revision" or "diff"
+	planHistory  plan.History
+	planRevCur   int
+	planStatus   string
+	planInput    bool   // typing reject feedback
+	planFeedback string
 
 	// Generating plan indicator
 	generatingPlan   bool
@@ -131,6 +146,7 @@ type dataMsg struct {
 	session  metrics.SessionContext
 	projects []projects.Project
 	tasks    []queue.Task
+	spend    map[string]metrics.SpendTotals
 	err      error
 }
 
@@ -159,6 +175,7 @@ func fetchData(cfg config.Config) tea.Cmd {
 		session := metrics.ScanActiveSession(cfg.ClaudeDir, cfg.ContextLimit)
 		projs := projects.Scan(cfg.ProjectsDir)
 		tasks, _ := queue.ListActive()
+		spend, _ := metrics.SpendByProject()
 		return dataMsg{
 			today:    today,
 			week:     week,
@@ -166,6 +183,7 @@ func fetchData(cfg config.Config) tea.Cmd {
 			session:  session,
 			projects: projs,
 			tasks:    tasks,
+			spend:    spend,
 			err:      err,
 		}
 	}
@@ -1,7 +1,7 @@
 package dashboard
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -10,16 +10,25 @@ import (
 
 	tea "github.com/charmbracelet/bubbletea"
 
+	"github.com/JuanVilla424/teamoon/internal/config"
 	"github.com/JuanVilla424/teamoon/internal/engine"
 	"github.com/JuanVilla424/teamoon/internal/logs"
 	"github.com/JuanVilla424/teamoon/internal/metrics"
 	"github.com/JuanVilla424/teamoon/internal/plan"
+	"github.com/JuanVilla424/teamoon/internal/plangen"
 	"github.com/JuanVilla424/teamoon/internal/projects"
 	"github.com/JuanVilla424/teamoon/internal/queue"
 )
 
 type taskDoneMsg struct{ err error }
 
+// planEditedMsg is sent when the external editor opened on a plan exits.
+type planEditedMsg struct {
+	taskID int
+	path   string
+	err    error
+}
+
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
@@ -32,13 +41,18 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if m.showMenu {
 			return m.handleMenuKey(msg)
 		}
+		if m.queryInput {
+			return m.handleQueryKey(msg)
+		}
 		return m.handleMainKey(msg)
 
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
 		m.ready = true
-		if m.showPlan && m.planContent != "" {
+		if m.showPlan && m.planMode == "history" {
+			m.planLines = m.historyLines()
+		} else if m.showPlan && m.planMode != "diff" && m.planContent != "" {
 			m.planLines = renderMarkdownLines(m.planContent, m.width-8)
 		}
 
@@ -68,10 +82,16 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case engine.PlanGeneratedMsg:
 		m.generatingPlan = false
 		if msg.Err != nil {
+			queue.UpdateState(msg.TaskID, queue.StatePending)
 			m.logBuf.Add(newLogEntry(msg.TaskID, "", "Plan generation failed: "+msg.Err.Error(), 3))
 			m.logEntries = m.logBuf.Snapshot()
 		} else {
-			plan.SavePlan(msg.TaskID, msg.Content)
+			if _, err := plan.SavePlanRevision(msg.TaskID, msg.Content, msg.Meta); err != nil {
+				queue.UpdateState(msg.TaskID, queue.StatePending)
+				m.logBuf.Add(newLogEntry(msg.TaskID, "", "Saving plan failed: "+err.Error(), 3))
+				m.logEntries = m.logBuf.Snapshot()
+				return m, fetchData(m.cfg)
+			}
 			queue.SetPlanFile(msg.TaskID, plan.PlanPath(msg.TaskID))
 			m.logBuf.Add(newLogEntry(msg.TaskID, "", "Plan generated", 1))
 			m.logEntries = m.logBuf.Snapshot()
@@ -81,6 +101,9 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case taskDoneMsg:
 		return m, fetchData(m.cfg)
 
+	case planEditedMsg:
+		return m.handlePlanEdited(msg)
+
 	case taskAddMsg:
 		if msg.err != nil {
 			m.menuStatus = fmt.Sprintf("Error: %v", msg.err)
@@ -120,15 +143,11 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.month = msg.month
 		m.session = msg.session
 		m.projects = msg.projects
-		m.tasks = msg.tasks
+		m.allTasks = msg.tasks
+		m.applyQuery()
+		m.projSpend = msg.spend
 		m.err = msg.err
 		m.cost = metrics.CalculateCost(m.today, m.week, m.month)
-		if m.cursor >= len(m.tasks) && len(m.tasks) > 0 {
-			m.cursor = len(m.tasks) - 1
-		}
-		if len(m.tasks) == 0 {
-			m.cursor = 0
-		}
 		if m.projCursor >= len(m.projects) && len(m.projects) > 0 {
 			m.projCursor = len(m.projects) - 1
 		}
@@ -194,6 +213,12 @@ func (m Model) handleMainKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			return m, tea.Quit
 		case key == "r":
 			return m, fetchData(m.cfg)
+		case key == "/":
+			m.queryInput = true
+			m.queryBuffer = m.queueQuery
+			m.queryErr = ""
+		case key == "f":
+			m.cycleSavedFilter()
 		case key == "a":
 			return m.handleAutopilotKey()
 		case key == "p":
@@ -207,6 +232,9 @@ func (m Model) handleMainKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 				id := t.ID
 				return m, func() tea.Msg {
 					err := queue.MarkDone(id)
+					if err == nil {
+						queue.RecordAction(id, queue.ActorTUI, "marked done")
+					}
 					return taskDoneMsg{err: err}
 				}
 			}
@@ -216,20 +244,21 @@ func (m Model) handleMainKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 				if m.engineMgr.IsRunning(t.ID) {
 					m.engineMgr.Stop(t.ID)
 				}
-				if t.PlanFile != "" {
-					os.Remove(t.PlanFile)
-				}
 				id := t.ID
 				return m, func() tea.Msg {
+					plan.RetirePlan(id, "replan requested")
 					queue.ResetPlan(id)
+					queue.RecordAction(id, queue.ActorTUI, "replan")
 					return refreshMsg{}
 				}
 			}
 		case key == "e":
 			if m.focus == "queue" && len(m.tasks) > 0 && m.cursor < len(m.tasks) {
-				id := m.tasks[m.cursor].ID
+				id, cfg := m.tasks[m.cursor].ID, m.cfg
 				return m, func() tea.Msg {
 					queue.Archive(id)
+					engine.DiscardWorkspaces(cfg, id)
+					queue.RecordAction(id, queue.ActorTUI, "archived")
 					return taskDoneMsg{}
 				}
 			}
@@ -238,6 +267,81 @@ func (m Model) handleMainKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+func (m Model) handleQueryKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.queryInput = false
+		m.queryBuffer = ""
+	case tea.KeyEnter:
+		if _, err := queue.ParseQuery(m.queryBuffer); err != nil {
+			m.queryErr = err.Error()
+			return m, nil
+		}
+		m.queryInput = false
+		m.queueQuery = strings.TrimSpace(m.queryBuffer)
+		m.queueFilter = ""
+		m.queryBuffer = ""
+		m.applyQuery()
+	case tea.KeyBackspace:
+		if len(m.queryBuffer) > 0 {
+			runes := []rune(m.queryBuffer)
+			m.queryBuffer = string(runes[:len(runes)-1])
+		}
+	case tea.KeySpace:
+		m.queryBuffer += " "
+	case tea.KeyRunes:
+		m.queryBuffer += string(msg.Runes)
+	}
+	return m, nil
+}
+
+// cycleSavedFilter switches the queue to the next saved filter, wrapping
+// around to no filter after the last one.
+func (m *Model) cycleSavedFilter() {
+	filters, err := queue.ListFilters()
+	if err != nil {
+		m.queryErr = err.Error()
+		return
+	}
+	next := 0
+	for i, f := range filters {
+		if f.Name == m.queueFilter {
+			next = i + 1
+		}
+	}
+	m.queryErr = ""
+	if next >= len(filters) {
+		m.queueFilter, m.queueQuery = "", ""
+	} else {
+		m.queueFilter, m.queueQuery = filters[next].Name, filters[next].Query
+	}
+	m.applyQuery()
+}
+
+// applyQuery refilters allTasks with the active queue query.
+func (m *Model) applyQuery() {
+	m.tasks = m.allTasks
+	if m.queueQuery != "" {
+		q, err := queue.ParseQuery(m.queueQuery)
+		if err != nil {
+			m.queryErr = err.Error()
+		} else {
+			m.tasks = nil
+			for _, t := range m.allTasks {
+				if q.Match(t) {
+					m.tasks = append(m.tasks, t)
+				}
+			}
+		}
+	}
+	if m.cursor >= len(m.tasks) && len(m.tasks) > 0 {
+		m.cursor = len(m.tasks) - 1
+	}
+	if len(m.tasks) == 0 {
+		m.cursor = 0
+	}
+}
+
 func (m Model) handleAutopilotKey() (tea.Model, tea.Cmd) {
 	if m.focus != "queue" || len(m.tasks) == 0 || m.cursor >= len(m.tasks) {
 		return m, nil
@@ -253,12 +357,26 @@ func (m Model) handleAutopilotKey() (tea.Model, tea.Cmd) {
 		}
 		m.generatingPlan = true
 		m.generatingTaskID = t.ID
+		queue.RecordAction(t.ID, queue.ActorTUI, "plan")
+		queue.UpdateState(t.ID, queue.StatePlanning)
 		return m, m.generatePlan(t)
 
 	case queue.StatePlanned:
+		queue.RecordAction(t.ID, queue.ActorTUI, "run")
 		return m, m.startAutopilot(t)
 
+	case queue.StateFailed, queue.StateBlocked:
+		if _, err := queue.Retry(t.ID); err != nil {
+			m.logBuf.Add(newLogEntry(t.ID, t.Project, "Retry failed: "+err.Error(), 3))
+		} else {
+			queue.RecordAction(t.ID, queue.ActorTUI, "retry")
+			m.logBuf.Add(newLogEntry(t.ID, t.Project, "Task retried", 1))
+		}
+		m.logEntries = m.logBuf.Snapshot()
+		return m, fetchData(m.cfg)
+
 	case queue.StateRunning:
+		queue.RecordAction(t.ID, queue.ActorTUI, "stop")
 		m.engineMgr.Stop(t.ID)
 		queue.UpdateState(t.ID, queue.StatePlanned)
 		return m, fetchData(m.cfg)
@@ -274,27 +392,301 @@ func (m Model) handleViewPlan() (tea.Model, tea.Cmd) {
 	}
 
 	t := m.tasks[m.cursor]
+	m.planTaskID = t.ID
+	m.planStatus = ""
 	if plan.PlanExists(t.ID) {
 		content, err := os.ReadFile(plan.PlanPath(t.ID))
 		if err == nil {
 			raw := string(content)
 			m.showPlan = true
+			m.planMode = ""
 			m.planContent = raw
 			m.planLines = renderMarkdownLines(raw, m.width-8)
-			m.planTaskID = t.ID
 			m.planScroll = 0
 		}
+	} else if h, err := plan.LoadHistory(t.ID); err == nil && len(h.Revisions) > 0 {
+		// Replanned: no active plan, but earlier revisions can still be restored.
+		m.showPlan = true
+		m = m.openPlanHistory()
+	}
+	return m, nil
+}
+
+// openPlanHistory switches the plan overlay to the revision list, with the
+// cursor on the active revision.
+func (m Model) openPlanHistory() Model {
+	h, err := plan.LoadHistory(m.planTaskID)
+	if err != nil {
+		m.planStatus = fmt.Sprintf("Error: %v", err)
+		return m
+	}
+	m.planHistory = h
+	m.planMode = "history"
+	m.planRevCur = len(h.Revisions) - 1
+	for i, r := range h.Revisions {
+		if r.Number == h.Active {
+			m.planRevCur = i
+		}
+	}
+	m.planLines = m.historyLines()
+	m.planScroll = 0
+	return m.followRevCursor()
+}
+
+// followRevCursor scrolls the revision list so the cursor (two lines per
+// revision) stays visible.
+func (m Model) followRevCursor() Model {
+	maxShow := m.height - 6
+	if maxShow < 5 {
+		maxShow = 5
+	}
+	line := m.planRevCur * 2
+	if line < m.planScroll {
+		m.planScroll = line
+	}
+	if line+2 > m.planScroll+maxShow {
+		m.planScroll = line + 2 - maxShow
+	}
+	return m
+}
+
+func (m Model) handlePlanHistoryKey(k string) (tea.Model, tea.Cmd) {
+	revs := m.planHistory.Revisions
+	switch k {
+	case "esc", "q":
+		m.showPlan = false
+		m.planMode = ""
+		m.planScroll = 0
+		return m, nil
+	case "down", "j":
+		if m.planRevCur < len(revs)-1 {
+			m.planRevCur++
+		}
+	case "up", "k":
+		if m.planRevCur > 0 {
+			m.planRevCur--
+		}
+	}
+	if len(revs) == 0 {
+		return m, nil
+	}
+	sel := revs[m.planRevCur]
+	m.planStatus = ""
+
+	switch k {
+	case "enter":
+		content, err := plan.LoadRevision(m.planTaskID, sel.Number)
+		if err != nil {
+			m.planStatus = fmt.Sprintf("Error: %v", err)
+			break
+		}
+		m.planMode = "revision"
+		m.planContent = content
+		m.planLines = renderMarkdownLines(content, m.width-8)
+		m.planScroll = 0
+		return m, nil
+	case "d":
+		// Diff against the active revision, or the previous one when the
+		// selection is itself active.
+		other := m.planHistory.Active
+		if other == sel.Number || other == 0 {
+			other = 0
+			if m.planRevCur > 0 {
+				other = revs[m.planRevCur-1].Number
+			}
+		}
+		if other == 0 {
+			m.planStatus = "Nothing to diff against"
+			break
+		}
+		a, b := min(other, sel.Number), max(other, sel.Number)
+		diff, err := plan.DiffRevisions(m.planTaskID, a, b)
+		if err != nil {
+			m.planStatus = fmt.Sprintf("Error: %v", err)
+			break
+		}
+		if diff == "" {
+			m.planStatus = fmt.Sprintf("Revisions %d and %d are identical", a, b)
+			break
+		}
+		m.planMode = "diff"
+		m.planLines = diffViewLines(diff)
+		m.planScroll = 0
+		return m, nil
+	case "r", "p":
+		if m.engineMgr.IsRunning(m.planTaskID) {
+			m.planStatus = "Task is running — stop it before restoring a plan"
+			break
+		}
+		pin := k == "p"
+		if err := plan.RestoreRevision(m.planTaskID, sel.Number, pin); err != nil {
+			m.planStatus = fmt.Sprintf("Error: %v", err)
+			break
+		}
+		queue.SetPlanFile(m.planTaskID, plan.PlanPath(m.planTaskID))
+		m = m.openPlanHistory()
+		if pin {
+			m.planStatus = fmt.Sprintf("Revision %d restored and pinned", sel.Number)
+		} else {
+			m.planStatus = fmt.Sprintf("Revision %d restored", sel.Number)
+		}
+		return m, fetchData(m.cfg)
+	case "u":
+		if err := plan.SetPinned(m.planTaskID, false); err != nil {
+			m.planStatus = fmt.Sprintf("Error: %v", err)
+			break
+		}
+		m = m.openPlanHistory()
+		m.planStatus = "Plan unpinned"
+		return m, nil
+	}
+	m.planLines = m.historyLines()
+	return m.followRevCursor(), nil
+}
+
+// planAwaiting reports whether the task shown in the plan overlay is held
+// for plan approval.
+func (m Model) planAwaiting() bool {
+	for _, t := range m.tasks {
+		if t.ID == m.planTaskID {
+			return queue.EffectiveState(t) == queue.StateAwaitingApproval
+		}
+	}
+	return false
+}
+
+func (m Model) handlePlanFeedbackKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.planInput = false
+		m.planFeedback = ""
+	case tea.KeyEnter:
+		if strings.TrimSpace(m.planFeedback) == "" {
+			return m, nil
+		}
+		m.planInput = false
+		if err := engine.RejectPlan(m.planTaskID, m.planFeedback); err != nil {
+			m.planStatus = fmt.Sprintf("Error: %v", err)
+			return m, nil
+		}
+		queue.RecordAction(m.planTaskID, queue.ActorTUI, "plan rejected: "+m.planFeedback)
+		m.logBuf.Add(newLogEntry(m.planTaskID, "", "Plan rejected: "+m.planFeedback, 2))
+		m.logEntries = m.logBuf.Snapshot()
+		m.planFeedback = ""
+		m.showPlan = false
+		return m, fetchData(m.cfg)
+	case tea.KeyBackspace:
+		if r := []rune(m.planFeedback); len(r) > 0 {
+			m.planFeedback = string(r[:len(r)-1])
+		}
+	case tea.KeySpace:
+		m.planFeedback += " "
+	case tea.KeyRunes:
+		m.planFeedback += string(msg.Runes)
 	}
 	return m, nil
 }
 
+// editPlan opens the active plan in $EDITOR; the result is applied as a
+// reviewer edit when the editor exits.
+func (m Model) editPlan() (tea.Model, tea.Cmd) {
+	content, err := os.ReadFile(plan.PlanPath(m.planTaskID))
+	if err != nil {
+		m.planStatus = fmt.Sprintf("Error: %v", err)
+		return m, nil
+	}
+	f, err := os.CreateTemp("", fmt.Sprintf("teamoon-plan-%d-*.md", m.planTaskID))
+	if err != nil {
+		m.planStatus = fmt.Sprintf("Error: %v", err)
+		return m, nil
+	}
+	f.Write(content)
+	f.Close()
+	id, path := m.planTaskID, f.Name()
+	return m, tea.ExecProcess(editorCommand(path), func(err error) tea.Msg {
+		return planEditedMsg{taskID: id, path: path, err: err}
+	})
+}
+
+func (m Model) handlePlanEdited(msg planEditedMsg) (tea.Model, tea.Cmd) {
+	defer os.Remove(msg.path)
+	if msg.err != nil {
+		m.planStatus = fmt.Sprintf("Editor failed: %v", msg.err)
+		return m, nil
+	}
+	content, err := os.ReadFile(msg.path)
+	if err != nil {
+		m.planStatus = fmt.Sprintf("Error: %v", err)
+		return m, nil
+	}
+	if _, err := engine.EditPlan(m.cfg, msg.taskID, string(content)); err != nil {
+		m.planStatus = fmt.Sprintf("Edit rejected: %v", err)
+		return m, nil
+	}
+	queue.RecordAction(msg.taskID, queue.ActorTUI, "plan edited")
+	m.planStatus = "Plan updated"
+	m.planContent = string(content)
+	m.planLines = renderMarkdownLines(m.planContent, m.width-8)
+	return m, fetchData(m.cfg)
+}
+
+func editorCommand(path string) *exec.Cmd {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	return exec.Command("sh", "-c", editor+` "$1"`, "sh", path)
+}
+
 func (m Model) handlePlanKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.planInput {
+		return m.handlePlanFeedbackKey(msg)
+	}
 	k := msg.String()
+	if m.planMode == "history" {
+		return m.handlePlanHistoryKey(k)
+	}
+	if m.planMode == "" && m.planAwaiting() {
+		switch k {
+		case "a":
+			if err := engine.ApprovePlan(m.planTaskID); err != nil {
+				m.planStatus = fmt.Sprintf("Error: %v", err)
+				return m, nil
+			}
+			queue.RecordAction(m.planTaskID, queue.ActorTUI, "plan approved")
+			m.logBuf.Add(newLogEntry(m.planTaskID, "", "Plan approved", 1))
+			m.logEntries = m.logBuf.Snapshot()
+			m.showPlan = false
+			return m, fetchData(m.cfg)
+		case "x":
+			m.planInput = true
+			m.planFeedback = ""
+			return m, nil
+		}
+	}
 	switch k {
+	case "e":
+		if m.planMode == "" {
+			return m.editPlan()
+		}
 	case "esc", "q":
+		if m.planMode != "" {
+			cur := m.planRevCur
+			m = m.openPlanHistory()
+			m.planRevCur = cur
+			m.planLines = m.historyLines()
+			return m.followRevCursor(), nil
+		}
 		m.showPlan = false
 		m.planScroll = 0
 		return m, nil
+	case "h":
+		if m.planMode == "" {
+			return m.openPlanHistory(), nil
+		}
 	case "down", "j":
 		m.planScroll++
 	case "up", "k":
@@ -345,9 +737,79 @@ func (m Model) handleViewDetail() (tea.Model, tea.Cmd) {
 	if t.PlanFile != "" {
 		lines = append(lines, fmt.Sprintf("  Plan: %s", t.PlanFile))
 	}
+	if len(t.Labels) > 0 {
+		lines = append(lines, fmt.Sprintf("  Labels: %s", strings.Join(t.Labels, ", ")))
+	}
+	if t.ParentID != 0 {
+		lines = append(lines, fmt.Sprintf("  Epic: #%d", t.ParentID))
+	}
+	if all, err := queue.ListAll(); err == nil {
+		if children := queue.ChildIndex(all); len(children[t.ID]) > 0 {
+			r := queue.RollupOf(t.ID, children)
+			lines = append(lines, fmt.Sprintf("  Subtasks: %d/%d done (%s)", r.Done, r.Total, r.State))
+			for _, c := range children[t.ID] {
+				lines = append(lines, fmt.Sprintf("    #%d [%s] %s", c.ID, queue.EffectiveState(c), strings.SplitN(c.Description, "\n", 2)[0]))
+			}
+		}
+	}
 	if t.FailReason != "" {
 		lines = append(lines, fmt.Sprintf("  Fail: %s", t.FailReason))
 	}
+	if len(t.DependsOn) > 0 {
+		lines = append(lines, fmt.Sprintf("  Depends on: %v", t.DependsOn))
+	}
+	if t.HeldReason != "" {
+		lines = append(lines, fmt.Sprintf("  Held: %s", t.HeldReason))
+	}
+	if t.PRURL != "" {
+		lines = append(lines, fmt.Sprintf("  PR #%d: %s", t.PRNumber, t.PRURL))
+	}
+	if spend, err := metrics.SpendForTask(t.ID); err == nil && spend.Total.Spawns > 0 {
+		lines = append(lines, "")
+		lines = append(lines, "  ── Cost ──")
+		lines = append(lines, "")
+		for _, s := range spend.Steps {
+			label := string(s.Kind)
+			if s.Step > 0 {
+				label = fmt.Sprintf("step %d", s.Step)
+				if s.Kind != metrics.SpendStep {
+					label += " " + string(s.Kind)
+				}
+			}
+			lines = append(lines, "  "+formatSpendLine(label, s.SpendTotals))
+		}
+		lines = append(lines, "  "+formatSpendLine("total", spend.Total))
+	}
+	if diffs, err := queue.LoadStepDiffs(t.ID); err == nil && len(diffs) > 0 {
+		lines = append(lines, "")
+		lines = append(lines, "  ── Changes ──")
+		for _, d := range diffs {
+			lines = append(lines, renderMarkdownLines(fmt.Sprintf("### Step %d: %s", d.Step, d.Title), m.width-8)...)
+			if strings.TrimSpace(d.Patch) == "" {
+				lines = append(lines, "  "+mdDimStyle.Render("no changes"))
+				continue
+			}
+			for _, l := range strings.Split(strings.TrimRight(d.Stat, "\n"), "\n") {
+				lines = append(lines, "  "+mdDimStyle.Render(l))
+			}
+			lines = append(lines, "")
+			lines = append(lines, diffViewLines(d.Patch)...)
+			if d.Truncated {
+				lines = append(lines, "  "+mdDimStyle.Render("[patch truncated]"))
+			}
+		}
+	}
+	if events, err := queue.LoadEvents(t.ID); err == nil && len(events) > 0 {
+		lines = append(lines, "")
+		lines = append(lines, "  ── Activity ──")
+		lines = append(lines, "")
+		if f := queue.Flow(events); f.Lead > 0 {
+			lines = append(lines, fmt.Sprintf("  Lead time %s    Cycle time %s", f.Lead.Round(time.Second), f.Cycle.Round(time.Second)))
+		}
+		for _, e := range events {
+			lines = append(lines, fmt.Sprintf("  %s  %-9s %s", e.Time.Format("01-02 15:04:05"), e.Actor, queue.DescribeEvent(e)))
+		}
+	}
 	lines = append(lines, "")
 	lines = append(lines, "  ── Autopilot Log ──")
 	lines = append(lines, "")
@@ -387,6 +849,12 @@ func (m Model) handleViewDetail() (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+func formatSpendLine(label string, t metrics.SpendTotals) string {
+	return fmt.Sprintf("%-18s $%7.4f  in %s  out %s  cache %s  %s",
+		label, t.CostUSD, formatNum(t.Input), formatNum(t.Output),
+		formatNum(t.CacheRead+t.CacheCreate), (time.Duration(t.DurationMs) * time.Millisecond).Round(time.Second))
+}
+
 func (m Model) handleDetailKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	k := msg.String()
 	switch k {
@@ -431,6 +899,11 @@ func (m Model) generatePlan(t queue.Task) tea.Cmd {
 	taskID := t.ID
 	desc := t.Description
 	proj := t.Project
+	cfg := m.cfg
+	feedback := ""
+	if t.ReviewFeedback != "" {
+		feedback = "REVIEWER FEEDBACK ON THE PREVIOUS PLAN (address every point):\n" + t.ReviewFeedback + "\n\n"
+	}
 
 	return func() tea.Msg {
 		prompt := fmt.Sprintf(
@@ -439,6 +912,7 @@ func (m Model) generatePlan(t queue.Task) tea.Cmd {
 				"Do NOT use any tools. Output ONLY the final markdown plan.\n\n"+
 				"TASK: %s\n"+
 				"PROJECT: %s\n\n"+
+				"%s"+
 				"--- COGNITIVE FRAMEWORK ---\n"+
 				"The execution engine uses a 3-layer cognitive model:\n"+
 				"- Layer 1 (Reflexive): Execute step, check exit code. Success = next step.\n"+
@@ -458,44 +932,56 @@ func (m Model) generatePlan(t queue.Task) tea.Cmd {
 				"- **John**: [scope/priority insight]\n"+
 				"- **Amelia**: [implementation insight]\n\n"+
 				"## Steps\n\n"+
-				"### Step 1: [title]\n[detailed instructions for Claude Code CLI]\nVerify: [concrete verification — test command, file check, or output match]\n\n"+
-				"### Step 2: [title]\n[detailed instructions]\nVerify: [concrete verification]\n\n"+
+				"### Step 1: [title]\nAgent: [bmad agent id, e.g. dev]\n[detailed instructions for Claude Code CLI]\nVerify: [concrete verification — test command, file check, or output match]\n\n"+
+				"### Step 2: [title]\nAgent: [bmad agent id]\n[detailed instructions]\nVerify: [concrete verification]\n\n"+
 				"(2-5 steps total, each independently executable)\n\n"+
 				"## Dependencies\n"+
 				"- %s/{other-project-name} (only if steps need to access files outside the main project directory)\n"+
 				"(Omit this section entirely if no external directories are needed)\n\n"+
 				"## Constraints\n- [constraints]\n\n"+
 				"Output ONLY the markdown plan.",
-			desc, proj, desc, m.cfg.ProjectsDir,
-		)
-
-		env := filterEnv(os.Environ(), "CLAUDECODE")
-		cmd := exec.Command("claude",
-			"-p", prompt,
-			"--output-format", "json",
-			"--max-turns", "1",
-			"--no-session-persistence",
+			desc, proj, feedback, desc, m.cfg.ProjectsDir,
 		)
-		cmd.Env = env
 
-		out, err := cmd.Output()
+		rt, err := engine.RuntimeFor(cfg)
 		if err != nil {
 			return engine.PlanGeneratedMsg{TaskID: taskID, Err: err}
 		}
-
-		var result struct {
-			Result  string `json:"result"`
-			IsError bool   `json:"is_error"`
-		}
-		if jsonErr := json.Unmarshal(out, &result); jsonErr != nil {
-			return engine.PlanGeneratedMsg{TaskID: taskID, Err: fmt.Errorf("parse error: %v", jsonErr)}
+		planCfg := cfg
+		planCfg.Spawn.MaxTurns = 1
+		planCfg.Spawn.Model = engine.ResolveModel(cfg.Spawn.Model, "plan")
+		planCfg.MCPServers = nil
+		turn := func(prompt, sessionID string) (string, string, error) {
+			sess, err := rt.Start(context.Background(), engine.AgentRequest{Prompt: prompt, SessionID: sessionID, Config: planCfg})
+			if err != nil {
+				return "", "", err
+			}
+			var isError bool
+			for evt := range sess.Events() {
+				if evt.Type == "result" {
+					isError = evt.IsError
+				}
+			}
+			result, err := sess.Wait()
+			engine.RecordSpend(metrics.SpendRecord{Kind: metrics.SpendPlan, TaskID: taskID, Project: proj}, result, planCfg.Spawn.Model)
+			if err != nil {
+				return "", "", err
+			}
+			if isError || result.Result == "" {
+				return "", "", fmt.Errorf("no plan generated")
+			}
+			return result.Result, result.SessionID, nil
 		}
 
-		if result.IsError || result.Result == "" {
-			return engine.PlanGeneratedMsg{TaskID: taskID, Err: fmt.Errorf("no plan generated")}
+		content, sessionID, err := turn(prompt, "")
+		if err != nil {
+			return engine.PlanGeneratedMsg{TaskID: taskID, Err: err}
 		}
-
-		return engine.PlanGeneratedMsg{TaskID: taskID, Content: result.Result}
+		content, _, err = plangen.ValidateAndRepair(content, sessionID, prompt, config.SkeletonFor(cfg, proj), turn, nil)
+		if err != nil {
+			return engine.PlanGeneratedMsg{TaskID: taskID, Err: err}
+		}
+		return engine.PlanGeneratedMsg{TaskID: taskID, Content: content, Meta: plangen.RevisionMeta(t, planCfg.Spawn.Model)}
 	}
 }
 
@@ -615,7 +1101,10 @@ func (m Model) handleInputKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.inputBuffer = ""
 			m.menuStatus = "Adding task..."
 			return m, func() tea.Msg {
-				_, err := queue.Add(p.Name, desc, pri)
+				t, err := queue.Add(p.Name, desc, pri)
+				if err == nil {
+					queue.RecordAction(t.ID, queue.ActorTUI, "created")
+				}
 				return taskAddMsg{err: err}
 			}
 		}
@@ -663,17 +1152,6 @@ func (m Model) fetchPRInfo() tea.Cmd {
 	}
 }
 
-func filterEnv(env []string, key string) []string {
-	prefix := key + "="
-	result := make([]string, 0, len(env))
-	for _, e := range env {
-		if !strings.HasPrefix(e, prefix) {
-			result = append(result, e)
-		}
-	}
-	return result
-}
-
 func newLogEntry(taskID int, project, message string, level int) logs.LogEntry {
 	return logs.LogEntry{
 		Time:    time.Now(),
@@ -113,8 +113,14 @@ func (m Model) View() string {
 	// Help - 2 compact lines
 	b.WriteString(helpStyle.Render(" esc: quit  tab: switch  ↑↓: nav  r: refresh"))
 	b.WriteString("\n")
-	if m.focus == "queue" {
-		b.WriteString(helpStyle.Render(" enter: detail  a: run  p: plan  d: done  x: replan  e: archive  ctrl+a: all"))
+	if m.queryInput {
+		help := fmt.Sprintf(" Query: %s_  (enter: apply  esc: cancel)", m.queryBuffer)
+		if m.queryErr != "" {
+			help += "  " + m.queryErr
+		}
+		b.WriteString(helpStyle.Render(help))
+	} else if m.focus == "queue" {
+		b.WriteString(helpStyle.Render(" enter: detail  a: run/retry  p: plan  d: done  x: replan  e: archive  /: search  f: filters  ctrl+a: all"))
 	} else {
 		b.WriteString(helpStyle.Render(" enter: actions"))
 	}
@@ -169,9 +175,19 @@ func (m Model) renderQueue(width int, maxItems int) string {
 	if m.focus == "queue" {
 		title = "» " + title
 	}
+	switch {
+	case m.queueFilter != "":
+		title += " [" + m.queueFilter + "]"
+	case m.queueQuery != "":
+		title += " [" + m.queueQuery + "]"
+	}
 	b.WriteString(panelTitleStyle.Render(fmt.Sprintf("%s (%d)", title, len(m.tasks))) + "\n")
 
 	if len(m.tasks) == 0 {
+		if m.queueQuery != "" {
+			b.WriteString("  No tasks match the query\n")
+			return b.String()
+		}
 		b.WriteString("  No pending tasks\n")
 		return b.String()
 	}
@@ -210,6 +226,9 @@ func (m Model) renderQueue(width int, maxItems int) string {
 		}
 
 		desc := strings.NewReplacer("\r", " ", "\n", " ", "\t", " ").Replace(t.Description)
+		if len(t.Labels) > 0 {
+			desc = "[" + strings.Join(t.Labels, " ") + "] " + desc
+		}
 		if len(desc) > colDesc {
 			desc = desc[:colDesc-3] + "..."
 		}
@@ -253,10 +272,20 @@ func formatStateTag(t queue.Task, isRunning bool, isGenerating bool) string {
 	}
 
 	switch state {
+	case queue.StatePlanning:
+		return plannedTagStyle.Render("GEN")
 	case queue.StatePlanned:
 		return plannedTagStyle.Render("PLN")
+	case queue.StateAwaitingApproval:
+		return medStyle.Render("REV")
 	case queue.StateRunning:
 		return runningTagStyle.Render("RUN")
+	case queue.StateInReview:
+		return plannedTagStyle.Render("PR ")
+	case queue.StateBlocked:
+		return medStyle.Render("BLK")
+	case queue.StateFailed:
+		return highStyle.Render("FAI")
 	case queue.StateDone:
 		return inactiveStyle.Render("DON")
 	default:
@@ -329,7 +358,18 @@ func (m Model) renderPlanOverlay(w, h int) string {
 	header := titleStyle.Render(" teamoon v1.0.5 ")
 	status := fmt.Sprintf("  %s Running    %s", runningDot, time.Now().Format("02 Jan 2006 15:04"))
 	b.WriteString(header + status + "\n")
-	titleBar := menuTitleStyle.Render(fmt.Sprintf(" Plan — Task #%d ", m.planTaskID))
+	title := fmt.Sprintf(" Plan — Task #%d ", m.planTaskID)
+	switch m.planMode {
+	case "history":
+		title = fmt.Sprintf(" Plan revisions — Task #%d ", m.planTaskID)
+	case "revision":
+		if m.planRevCur < len(m.planHistory.Revisions) {
+			title = fmt.Sprintf(" Plan — Task #%d — revision %d ", m.planTaskID, m.planHistory.Revisions[m.planRevCur].Number)
+		}
+	case "diff":
+		title = fmt.Sprintf(" Plan diff — Task #%d ", m.planTaskID)
+	}
+	titleBar := menuTitleStyle.Render(title)
 	b.WriteString(titleBar + "\n")
 
 	// Viewport: all remaining height minus header(2) + border(2) + help(1) + padding(1)
@@ -378,11 +418,90 @@ func (m Model) renderPlanOverlay(w, h int) string {
 	} else {
 		pos = fmt.Sprintf("  %d lines", totalLines)
 	}
-	b.WriteString(helpStyle.Render(" ↑↓/jk: scroll  pgup/pgdn: page  g/G: top/bottom  esc/q: close" + pos))
+	help := " ↑↓/jk: scroll  pgup/pgdn: page  g/G: top/bottom  h: revisions  e: edit  esc/q: close"
+	if m.planAwaiting() {
+		help = " ↑↓/jk: scroll  a: approve  x: reject  e: edit  h: revisions  esc/q: close"
+	}
+	switch m.planMode {
+	case "history":
+		help = " ↑↓/jk: select  enter: view  d: diff  r: restore  p: restore+pin  u: unpin  esc/q: close"
+	case "revision", "diff":
+		help = " ↑↓/jk: scroll  pgup/pgdn: page  g/G: top/bottom  esc/q: back to revisions"
+	}
+	if m.planInput {
+		help = fmt.Sprintf(" Reject feedback: %s_  (enter: send  esc: cancel)", m.planFeedback)
+	}
+	if m.planStatus != "" {
+		help += "  " + m.planStatus
+	}
+	b.WriteString(helpStyle.Render(help + pos))
 
 	return b.String()
 }
 
+// historyLines renders the revision list, two lines per revision.
+func (m Model) historyLines() []string {
+	h := m.planHistory
+	if len(h.Revisions) == 0 {
+		return []string{"  No plan revisions yet"}
+	}
+	lines := make([]string, 0, len(h.Revisions)*2)
+	for i, r := range h.Revisions {
+		head := fmt.Sprintf("rev %-3d %s", r.Number, r.Time.Format("2006-01-02 15:04"))
+		if r.Model != "" {
+			head += "  " + r.Model
+		}
+		if r.Attempt > 0 {
+			head += fmt.Sprintf("  attempt %d", r.Attempt)
+		}
+		if r.Number == h.Active {
+			head += "  " + activeStyle.Render("active")
+			if h.Pinned {
+				head += " " + costStyle.Render("pinned")
+			}
+		}
+		if i == m.planRevCur {
+			head = cursorStyle.Render(" > ") + " " + head
+		} else {
+			head = "    " + head
+		}
+		var why []string
+		if r.Reason != "" {
+			why = append(why, "reason: "+r.Reason)
+		}
+		if r.Replaced != "" {
+			why = append(why, "replaced: "+r.Replaced)
+		}
+		detail := strings.Join(why, " · ")
+		if maxW := m.width - 16; maxW > 10 && len(detail) > maxW {
+			detail = detail[:maxW-3] + "..."
+		}
+		lines = append(lines, head, inactiveStyle.Render("        "+detail))
+	}
+	return lines
+}
+
+// diffViewLines colors a unified diff for the plan overlay.
+func diffViewLines(diff string) []string {
+	raw := strings.Split(strings.TrimSuffix(diff, "\n"), "\n")
+	lines := make([]string, len(raw))
+	for i, l := range raw {
+		switch {
+		case strings.HasPrefix(l, "+++"), strings.HasPrefix(l, "---"):
+			lines[i] = "  " + panelTitleStyle.Render(l)
+		case strings.HasPrefix(l, "@@"):
+			lines[i] = "  " + plannedTagStyle.Render(l)
+		case strings.HasPrefix(l, "+"):
+			lines[i] = "  " + activeStyle.Render(l)
+		case strings.HasPrefix(l, "-"):
+			lines[i] = "  " + staleStyle.Render(l)
+		default:
+			lines[i] = "  " + l
+		}
+	}
+	return lines
+}
+
 func (m Model) renderDetailOverlay(w, h int) string {
 	var b strings.Builder
 
@@ -454,7 +573,17 @@ func (m Model) renderDetailOverlay(w, h int) string {
 	} else {
 		pos = fmt.Sprintf("  %d lines", totalLines)
 	}
-	b.WriteString(helpStyle.Render(" ↑↓/jk: scroll  pgup/pgdn: page  g/G: top/bottom  esc/q: close" + pos))
+	help := " ↑↓/jk: scroll  pgup/pgdn: page  g/G: top/bottom  h: revisions  esc/q: close"
+	switch m.planMode {
+	case "history":
+		help = " ↑↓/jk: select  enter: view  d: diff  r: restore  p: restore+pin  u: unpin  esc/q: close"
+	case "revision", "diff":
+		help = " ↑↓/jk: scroll  pgup/pgdn: page  g/G: top/bottom  esc/q: back to revisions"
+	}
+	if m.planStatus != "" {
+		help += "  " + m.planStatus
+	}
+	b.WriteString(helpStyle.Render(help + pos))
 
 	return b.String()
 }
@@ -473,6 +602,7 @@ func (m Model) renderProjects(width int, maxItems int) string {
 	colName := 24
 	colBranch := 14
 	colMod := 8
+	colCost := 8
 
 	for i := startIdx; i < endIdx; i++ {
 		p := m.projects[i]
@@ -518,8 +648,11 @@ func (m Model) renderProjects(width int, maxItems int) string {
 		line := prefix + icon + " " +
 			name + " " +
 			padStr(branch, colBranch) + " " +
-			padStr(modified, colMod) + " " +
-			commit
+			padStr(modified, colMod) + " "
+		if spend := m.projSpend[p.Name]; spend.CostUSD > 0 {
+			line += padStr(fmt.Sprintf("$%.2f", spend.CostUSD), colCost) + " "
+		}
+		line += commit
 
 		if m.focus == "projects" && i == m.projCursor {
 			b.WriteString(cursorStyle.Render(line) + "\n")
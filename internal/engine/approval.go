@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/logs"
+	"github.com/JuanVilla424/teamoon/internal/plan"
+	"github.com/JuanVilla424/teamoon/internal/queue"
+)
+
+// EventPlanAwaitingApproval is the webhook event fired when a generated plan
+// is held for review.
+const EventPlanAwaitingApproval = "plan_awaiting_approval"
+
+// RequiresApproval reports whether t's plan must be approved before it runs.
+// The task setting wins over the project setting, which wins over the global one.
+func RequiresApproval(cfg config.Config, t queue.Task) bool {
+	if t.RequirePlanApproval != nil {
+		return *t.RequirePlanApproval
+	}
+	if v, ok := cfg.Approval.Projects[t.Project]; ok {
+		return v
+	}
+	return cfg.Approval.RequirePlanApproval
+}
+
+// holdForApproval parks a freshly planned task in awaiting_approval when its
+// project requires review. It reports whether the task was held.
+func holdForApproval(cfg config.Config, t queue.Task, send func(tea.Msg), emit func(logs.LogLevel, string)) bool {
+	if !RequiresApproval(cfg, t) {
+		return false
+	}
+	if err := queue.UpdateState(t.ID, queue.StateAwaitingApproval); err != nil {
+		emit(logs.LevelError, fmt.Sprintf("Task #%d could not be held for approval: %v", t.ID, err))
+		return false
+	}
+	emit(logs.LevelInfo, fmt.Sprintf("Task #%d plan is awaiting approval", t.ID))
+	queue.NotifyEvent(EventPlanAwaitingApproval, t, nil)
+	send(TaskStateMsg{TaskID: t.ID, State: queue.StateAwaitingApproval})
+	return true
+}
+
+// ApprovePlan lets a task held for review run with its current plan.
+func ApprovePlan(id int) error {
+	if !plan.PlanExists(id) {
+		return fmt.Errorf("task #%d has no plan to approve", id)
+	}
+	return queue.ApprovePlan(id)
+}
+
+// RejectPlan discards the plan of a task held for review and sends it back to
+// planning; feedback is added to the next plan prompt.
+func RejectPlan(id int, feedback string) error {
+	feedback = strings.TrimSpace(feedback)
+	if feedback == "" {
+		return fmt.Errorf("rejecting a plan needs feedback for the replan")
+	}
+	t, err := queue.GetTask(id)
+	if err != nil {
+		return err
+	}
+	if queue.EffectiveState(t) != queue.StateAwaitingApproval {
+		return fmt.Errorf("task #%d is not awaiting plan approval", id)
+	}
+	if err := plan.RetirePlan(id, "rejected: "+feedback); err != nil {
+		return err
+	}
+	return queue.RejectPlan(id, feedback)
+}
+
+// EditPlan replaces the plan of a task that has not started running with a
+// reviewer's version. The edit must pass plan validation; the report is
+// returned either way so callers can show the issues.
+func EditPlan(cfg config.Config, id int, content string) (plan.Report, error) {
+	t, err := queue.GetTask(id)
+	if err != nil {
+		return plan.Report{}, err
+	}
+	switch queue.EffectiveState(t) {
+	case queue.StateAwaitingApproval, queue.StatePlanned:
+	default:
+		return plan.Report{}, fmt.Errorf("task #%d is %s; only planned or awaiting-approval plans can be edited", id, queue.EffectiveState(t))
+	}
+	report := plan.Validate(plan.ParseText(content), config.SkeletonFor(cfg, t.Project))
+	if !report.OK() {
+		return report, fmt.Errorf("edited plan has %d error(s)", len(report.Errors))
+	}
+	rev, err := plan.SavePlanRevision(id, content, plan.RevisionMeta{Reason: "edited by reviewer"})
+	if err != nil {
+		return report, err
+	}
+	// A pinned plan would otherwise stay active; the reviewer's edit takes its place.
+	if h, err := plan.LoadHistory(id); err == nil && h.Active != rev.Number {
+		if err := plan.RestoreRevision(id, rev.Number, h.Pinned); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,149 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/logs"
+	"github.com/JuanVilla424/teamoon/internal/plan"
+	"github.com/JuanVilla424/teamoon/internal/queue"
+)
+
+const reviewPlan = `# Plan: thing
+
+## Steps
+
+### Step 1: write
+Agent: dev
+Create a.txt.
+Verify: a.txt exists
+
+## Constraints
+- none
+`
+
+func TestRequiresApproval(t *testing.T) {
+	cfg := config.DefaultConfig()
+	task := queue.Task{Project: "proj"}
+	if RequiresApproval(cfg, task) {
+		t.Error("approval should be off by default")
+	}
+	cfg.Approval.RequirePlanApproval = true
+	if !RequiresApproval(cfg, task) {
+		t.Error("expected global setting to apply")
+	}
+	cfg.Approval.Projects = map[string]bool{"proj": false}
+	if RequiresApproval(cfg, task) {
+		t.Error("expected project setting to override global")
+	}
+	on := true
+	task.RequirePlanApproval = &on
+	if !RequiresApproval(cfg, task) {
+		t.Error("expected task setting to override project")
+	}
+}
+
+func TestPlanAndRun_HoldsForApproval(t *testing.T) {
+	fake := NewFakeRuntime()
+	cfg, task := fakeTaskEnv(t, fake)
+	cfg.Approval.RequirePlanApproval = true
+
+	planFn := func(t queue.Task, sk config.SkeletonConfig, logFn func(string)) (plan.Plan, error) {
+		plan.SavePlan(t.ID, reviewPlan)
+		queue.SetPlanFile(t.ID, plan.PlanPath(t.ID))
+		return plan.ParsePlan(plan.PlanPath(t.ID))
+	}
+	var states []queue.TaskState
+	send := func(msg tea.Msg) {
+		if m, ok := msg.(TaskStateMsg); ok {
+			states = append(states, m.State)
+		}
+	}
+	planAndRun(context.Background(), task, cfg, planFn, send, NewManager(), func(logs.LogLevel, string) {})
+
+	got, _ := queue.GetTask(task.ID)
+	if queue.EffectiveState(got) != queue.StateAwaitingApproval {
+		t.Fatalf("state = %s, want awaiting_approval", queue.EffectiveState(got))
+	}
+	if len(fake.Requests()) != 0 {
+		t.Errorf("no step should run before approval, got %d spawns", len(fake.Requests()))
+	}
+	if len(states) == 0 || states[len(states)-1] != queue.StateAwaitingApproval {
+		t.Errorf("states sent = %v", states)
+	}
+
+	if err := ApprovePlan(task.ID); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = queue.GetTask(task.ID)
+	if queue.EffectiveState(got) != queue.StatePlanned {
+		t.Errorf("state after approve = %s", queue.EffectiveState(got))
+	}
+	if err := ApprovePlan(task.ID); err == nil {
+		t.Error("approving a task that is not awaiting approval should fail")
+	}
+}
+
+func TestRejectPlan_ReplansWithFeedback(t *testing.T) {
+	_, task := fakeTaskEnv(t, NewFakeRuntime())
+	plan.SavePlan(task.ID, reviewPlan)
+	queue.SetPlanFile(task.ID, plan.PlanPath(task.ID))
+	queue.UpdateState(task.ID, queue.StateAwaitingApproval)
+
+	if err := RejectPlan(task.ID, "  "); err == nil {
+		t.Error("rejecting without feedback should fail")
+	}
+	if err := RejectPlan(task.ID, "split the migration into its own step"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := queue.GetTask(task.ID)
+	if queue.EffectiveState(got) != queue.StatePending || got.PlanFile != "" {
+		t.Errorf("task after reject = %+v", got)
+	}
+	if got.ReviewFeedback != "split the migration into its own step" {
+		t.Errorf("feedback = %q", got.ReviewFeedback)
+	}
+	if plan.PlanExists(task.ID) {
+		t.Error("rejected plan should no longer be active")
+	}
+	h, _ := plan.LoadHistory(task.ID)
+	if len(h.Revisions) != 1 || !strings.HasPrefix(h.Revisions[0].Replaced, "rejected: ") {
+		t.Errorf("history = %+v", h)
+	}
+}
+
+func TestEditPlan(t *testing.T) {
+	cfg, task := fakeTaskEnv(t, NewFakeRuntime())
+	cfg.Skeleton = config.SkeletonConfig{}
+
+	if _, err := EditPlan(cfg, task.ID, reviewPlan); err == nil {
+		t.Error("editing a pending task should fail")
+	}
+
+	plan.SavePlan(task.ID, reviewPlan)
+	queue.SetPlanFile(task.ID, plan.PlanPath(task.ID))
+	queue.UpdateState(task.ID, queue.StateAwaitingApproval)
+
+	report, err := EditPlan(cfg, task.ID, "# Plan: empty\n")
+	if err == nil || report.OK() {
+		t.Fatalf("expected validation failure, got report %+v err %v", report, err)
+	}
+
+	edited := strings.Replace(reviewPlan, "Create a.txt.", "Create a.txt and b.txt.", 1)
+	if _, err := EditPlan(cfg, task.ID, edited); err != nil {
+		t.Fatal(err)
+	}
+	p, err := plan.ParsePlan(plan.PlanPath(task.ID))
+	if err != nil || !strings.Contains(p.Steps[0].Body, "b.txt") {
+		t.Errorf("active plan not updated: %+v %v", p, err)
+	}
+	got, _ := queue.GetTask(task.ID)
+	if queue.EffectiveState(got) != queue.StateAwaitingApproval {
+		t.Errorf("edit should keep the task awaiting approval, got %s", queue.EffectiveState(got))
+	}
+}
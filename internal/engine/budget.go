@@ -0,0 +1,213 @@
+package engine
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/metrics"
+	"github.com/JuanVilla424/teamoon/internal/queue"
+	"github.com/JuanVilla424/teamoon/internal/webhook"
+)
+
+// Budget scopes reported alongside a pause.
+const (
+	budgetScopeGlobal  = "global"
+	budgetScopeProject = "project"
+	budgetScopeTask    = "task"
+)
+
+// budgetBreach describes the first cap a task would exceed.
+type budgetBreach struct {
+	Scope  string
+	Reason string
+}
+
+// taskTokenCap returns the per-task token cap for project; 0 means unlimited.
+func taskTokenCap(cfg config.Config, project string) int {
+	if pb, ok := cfg.Budget.Projects[project]; ok && pb.TaskMaxTokens > 0 {
+		return pb.TaskMaxTokens
+	}
+	return cfg.Budget.TaskMaxTokens
+}
+
+// taskTokens is the input + output tokens the ledger has booked for a task.
+func taskTokens(taskID int) int {
+	spend, err := metrics.SpendForTask(taskID)
+	if err != nil {
+		log.Printf("[budget] reading spend for task #%d: %v", taskID, err)
+		return 0
+	}
+	return spend.Total.Input + spend.Total.Output
+}
+
+// spendWindow is one USD cap that applies to a task.
+type spendWindow struct {
+	scope, project, label string
+	since                 time.Time
+	limit                 float64
+}
+
+// spendWindows lists the USD caps set for task. Daily windows start at local
+// midnight and monthly windows on the 1st.
+func spendWindows(cfg config.Config, task queue.Task) []spendWindow {
+	now := time.Now()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	all := []spendWindow{
+		{budgetScopeGlobal, "", "daily", day, cfg.Budget.DailyUSD},
+		{budgetScopeGlobal, "", "monthly", month, cfg.Budget.MonthlyUSD},
+	}
+	if pb, ok := cfg.Budget.Projects[task.Project]; ok {
+		all = append(all,
+			spendWindow{budgetScopeProject, task.Project, "daily", day, pb.DailyUSD},
+			spendWindow{budgetScopeProject, task.Project, "monthly", month, pb.MonthlyUSD},
+		)
+	}
+	var windows []spendWindow
+	for _, w := range all {
+		if w.limit > 0 {
+			windows = append(windows, w)
+		}
+	}
+	return windows
+}
+
+// checkBudget reports whether task may spend more.
+func checkBudget(cfg config.Config, task queue.Task) (budgetBreach, bool) {
+	if limit := taskTokenCap(cfg, task.Project); limit > 0 {
+		if used := taskTokens(task.ID); used >= limit {
+			return budgetBreach{budgetScopeTask, fmt.Sprintf("budget: task #%d used %d tokens (cap %d)", task.ID, used, limit)}, true
+		}
+	}
+	for _, w := range spendWindows(cfg, task) {
+		spent, err := metrics.SpendSince(w.since, w.project)
+		if err != nil {
+			log.Printf("[budget] reading spend ledger: %v", err)
+			return budgetBreach{}, false
+		}
+		if spent.CostUSD < w.limit {
+			continue
+		}
+		who := "all projects"
+		if w.project != "" {
+			who = w.project
+		}
+		return budgetBreach{w.scope, fmt.Sprintf("budget: %s %s spend $%.2f reached cap $%.2f", who, w.label, spent.CostUSD, w.limit)}, true
+	}
+	return budgetBreach{}, false
+}
+
+// notifyBudget fires the budget_exceeded webhook for task.
+func notifyBudget(task queue.Task, b budgetBreach) {
+	queue.NotifyEvent(webhook.EventBudgetExceeded, task, map[string]any{
+		"scope":  b.Scope,
+		"reason": b.Reason,
+	})
+}
+
+// overBudgetBreach explains a session cut off by its token meter.
+func overBudgetBreach(cfg config.Config, task queue.Task) budgetBreach {
+	if b, over := checkBudget(cfg, task); over {
+		return b
+	}
+	return budgetBreach{budgetScopeTask, fmt.Sprintf("budget: task #%d exceeded its budget", task.ID)}
+}
+
+// tokenMeter tracks a task's usage while a session streams, so a step can be
+// cut off as soon as it crosses the per-task token cap or a USD cap instead
+// of after it exits. The session's cost is estimated from the pricing table.
+type tokenMeter struct {
+	limit   int // 0 when the task has no token cap
+	base    int // tokens booked before this session
+	model   string
+	usdLeft float64 // spend left under the tightest USD cap
+	usdCap  bool
+	seen    map[string]metrics.Usage
+	anon    metrics.Usage // messages without an id
+}
+
+// newTokenMeter returns nil when the task has neither a token nor a USD cap.
+func newTokenMeter(cfg config.Config, task queue.Task) *tokenMeter {
+	m := &tokenMeter{limit: taskTokenCap(cfg, task.Project), model: ResolveModel(cfg.Spawn.Model, "exec"), seen: make(map[string]metrics.Usage)}
+	if m.limit < 0 {
+		m.limit = 0
+	}
+	if m.limit > 0 {
+		m.base = taskTokens(task.ID)
+	}
+	for _, w := range spendWindows(cfg, task) {
+		spent, err := metrics.SpendSince(w.since, w.project)
+		if err != nil {
+			log.Printf("[budget] reading spend ledger: %v", err)
+			continue
+		}
+		if left := w.limit - spent.CostUSD; !m.usdCap || left < m.usdLeft {
+			m.usdLeft, m.usdCap = left, true
+		}
+	}
+	if m.limit == 0 && !m.usdCap {
+		return nil
+	}
+	return m
+}
+
+// observe adds the usage carried by an assistant message and reports whether
+// a cap is now exceeded. Streamed messages repeat their id with growing
+// usage, so only the latest figure per message counts.
+func (m *tokenMeter) observe(msg *StreamMessage) bool {
+	if m == nil || msg == nil || msg.Usage == nil {
+		return false
+	}
+	if msg.ID != "" {
+		m.seen[msg.ID] = *msg.Usage
+	} else {
+		m.anon.InputTokens += msg.Usage.InputTokens
+		m.anon.OutputTokens += msg.Usage.OutputTokens
+		m.anon.CacheReadInputTokens += msg.Usage.CacheReadInputTokens
+		m.anon.CacheCreationInputTokens += msg.Usage.CacheCreationInputTokens
+	}
+	return m.overTokens() || m.overUSD()
+}
+
+func (m *tokenMeter) overTokens() bool {
+	return m.limit > 0 && m.total() >= m.limit
+}
+
+func (m *tokenMeter) overUSD() bool {
+	return m.usdCap && m.cost() >= m.usdLeft
+}
+
+// cost estimates what this session has spent so far.
+func (m *tokenMeter) cost() float64 {
+	u := m.usage()
+	return metrics.EstimateCost(m.model, u.InputTokens, u.OutputTokens, u.CacheReadInputTokens, u.CacheCreationInputTokens)
+}
+
+// reason says which cap stopped the session.
+func (m *tokenMeter) reason() string {
+	if m.overTokens() {
+		return fmt.Sprintf("Task token cap reached (%d/%d), stopping session", m.total(), m.limit)
+	}
+	return fmt.Sprintf("Spend cap reached (session ~$%.2f, $%.2f left), stopping session", m.cost(), m.usdLeft)
+}
+
+// usage sums what this session has consumed so far. It stands in for the
+// final result event, which a cancelled session never emits.
+func (m *tokenMeter) usage() metrics.Usage {
+	u := m.anon
+	for _, s := range m.seen {
+		u.InputTokens += s.InputTokens
+		u.OutputTokens += s.OutputTokens
+		u.CacheReadInputTokens += s.CacheReadInputTokens
+		u.CacheCreationInputTokens += s.CacheCreationInputTokens
+	}
+	return u
+}
+
+// total is the task's tokens including this session.
+func (m *tokenMeter) total() int {
+	u := m.usage()
+	return m.base + u.InputTokens + u.OutputTokens
+}
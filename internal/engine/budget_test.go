@@ -0,0 +1,172 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/metrics"
+	"github.com/JuanVilla424/teamoon/internal/queue"
+	"github.com/JuanVilla424/teamoon/internal/webhook"
+)
+
+// budgetWebhook saves cfg with a webhook pointing at a test server and
+// returns the events it receives.
+func budgetWebhook(t *testing.T, cfg *config.Config) <-chan map[string]any {
+	t.Helper()
+	events := make(chan map[string]any, 8)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+		events <- payload
+	}))
+	t.Cleanup(srv.Close)
+	cfg.WebhookURL = srv.URL
+	if err := config.Save(*cfg); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		webhook.Configure(config.DefaultConfig())
+	})
+	webhook.Start(ctx, *cfg)
+	return events
+}
+
+func expectBudgetEvent(t *testing.T, events <-chan map[string]any, scope string) {
+	t.Helper()
+	select {
+	case ev := <-events:
+		if ev["event"] != webhook.EventBudgetExceeded || ev["scope"] != scope {
+			t.Errorf("expected %s/%s event, got %v", webhook.EventBudgetExceeded, scope, ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("expected budget webhook")
+	}
+}
+
+func TestCheckBudget(t *testing.T) {
+	cfg, task := fakeTaskEnv(t, NewFakeRuntime())
+	metrics.RecordSpend(metrics.SpendRecord{Kind: metrics.SpendStep, TaskID: task.ID, Project: "proj", Input: 600, Output: 500, CostUSD: 3})
+	metrics.RecordSpend(metrics.SpendRecord{Kind: metrics.SpendStep, Project: "other", CostUSD: 4})
+
+	if _, over := checkBudget(cfg, task); over {
+		t.Fatal("expected no caps by default")
+	}
+
+	cfg.Budget.DailyUSD = 10
+	cfg.Budget.Projects = map[string]config.ProjectBudget{"proj": {MonthlyUSD: 3}}
+	b, over := checkBudget(cfg, task)
+	if !over || b.Scope != budgetScopeProject || !strings.Contains(b.Reason, "monthly") {
+		t.Errorf("expected project monthly cap, got %+v", b)
+	}
+
+	cfg.Budget.Projects = nil
+	cfg.Budget.DailyUSD = 7
+	if b, over = checkBudget(cfg, task); !over || b.Scope != budgetScopeGlobal {
+		t.Errorf("expected global daily cap, got %+v", b)
+	}
+
+	cfg.Budget.DailyUSD = 0
+	cfg.Budget.TaskMaxTokens = 1000
+	if b, over = checkBudget(cfg, task); !over || b.Scope != budgetScopeTask {
+		t.Errorf("expected task token cap, got %+v", b)
+	}
+	cfg.Budget.Projects = map[string]config.ProjectBudget{"proj": {TaskMaxTokens: 5000}}
+	if _, over = checkBudget(cfg, task); over {
+		t.Error("expected project token cap to override the global one")
+	}
+}
+
+func TestRunTask_PausesBeforeStepOverBudget(t *testing.T) {
+	fake := NewFakeRuntime()
+	cfg, task := fakeTaskEnv(t, fake)
+	cfg.Budget.DailyUSD = 1
+	events := budgetWebhook(t, &cfg)
+	metrics.RecordSpend(metrics.SpendRecord{Kind: metrics.SpendJob, JobID: 1, Project: "proj", CostUSD: 2})
+
+	runTask(context.Background(), task, twoStepPlan(), cfg, func(tea.Msg) {})
+
+	if n := len(fake.Requests()); n != 0 {
+		t.Fatalf("expected no sessions over budget, got %d", n)
+	}
+	got, _ := queue.GetTask(task.ID)
+	if got.State != queue.StatePlanned || !strings.HasPrefix(got.HeldReason, "budget:") {
+		t.Errorf("expected planned with budget hold, got %s %q", got.State, got.HeldReason)
+	}
+	expectBudgetEvent(t, events, budgetScopeGlobal)
+}
+
+func TestRunTask_StopsMidStepAtTokenCap(t *testing.T) {
+	msg := func(id string, out int) StreamEvent {
+		return StreamEvent{Type: "assistant", Message: &StreamMessage{
+			ID:      id,
+			Content: []StreamContent{{Type: "text", Text: "working"}},
+			Usage:   &metrics.Usage{InputTokens: 100, OutputTokens: out},
+		}}
+	}
+	// The repeated id must not be double counted: 100+300 stays under the
+	// cap, the second message pushes the task over.
+	fake := NewFakeRuntime(FakeTurn{Events: []StreamEvent{
+		msg("m1", 100), msg("m1", 300), msg("m2", 200), FakeResult("never reached"),
+	}})
+	cfg, task := fakeTaskEnv(t, fake)
+	cfg.Budget.TaskMaxTokens = 600
+	events := budgetWebhook(t, &cfg)
+
+	runTask(context.Background(), task, twoStepPlan(), cfg, func(tea.Msg) {})
+
+	got, _ := queue.GetTask(task.ID)
+	if got.State != queue.StatePlanned || got.FailReason != "" || got.CurrentStep != 0 {
+		t.Fatalf("expected planned at step 0, got %s step %d (%s)", got.State, got.CurrentStep, got.FailReason)
+	}
+	if !strings.Contains(got.HeldReason, "tokens") {
+		t.Errorf("expected token cap hold, got %q", got.HeldReason)
+	}
+	if n := len(fake.Requests()); n != 1 {
+		t.Errorf("expected a single session, got %d", n)
+	}
+	spend, _ := metrics.SpendForTask(task.ID)
+	if tokens := spend.Total.Input + spend.Total.Output; tokens != 700 {
+		t.Errorf("expected metered usage booked to the ledger, got %d tokens", tokens)
+	}
+	expectBudgetEvent(t, events, budgetScopeTask)
+}
+
+func TestRunTask_StopsMidStepAtSpendCap(t *testing.T) {
+	msg := func(id string, out int) StreamEvent {
+		return StreamEvent{Type: "assistant", Message: &StreamMessage{
+			ID:      id,
+			Content: []StreamContent{{Type: "text", Text: "working"}},
+			Usage:   &metrics.Usage{InputTokens: 100, OutputTokens: out},
+		}}
+	}
+	fake := NewFakeRuntime(FakeTurn{Events: []StreamEvent{
+		msg("m1", 100), msg("m2", 1_000_000), FakeResult("never reached"),
+	}})
+	cfg, task := fakeTaskEnv(t, fake)
+	cfg.Budget.DailyUSD = 1
+	events := budgetWebhook(t, &cfg)
+
+	runTask(context.Background(), task, twoStepPlan(), cfg, func(tea.Msg) {})
+
+	got, _ := queue.GetTask(task.ID)
+	if got.State != queue.StatePlanned || got.FailReason != "" || got.CurrentStep != 0 {
+		t.Fatalf("expected planned at step 0, got %s step %d (%s)", got.State, got.CurrentStep, got.FailReason)
+	}
+	if !strings.Contains(got.HeldReason, "daily") {
+		t.Errorf("expected daily spend cap hold, got %q", got.HeldReason)
+	}
+	if n := len(fake.Requests()); n != 1 {
+		t.Errorf("expected a single session, got %d", n)
+	}
+	expectBudgetEvent(t, events, budgetScopeGlobal)
+}
@@ -0,0 +1,302 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/logs"
+	"github.com/JuanVilla424/teamoon/internal/plan"
+	"github.com/JuanVilla424/teamoon/internal/queue"
+)
+
+// checkpointRefs is the ref namespace holding task checkpoints. Each
+// checkpoint is a commit whose tree is the working tree (minus ignored
+// files) and whose parent is HEAD at the time it was taken.
+const checkpointRefs = "refs/teamoon/checkpoints"
+
+// checkpointStart names the checkpoint taken before a task's first step.
+const checkpointStart = "start"
+
+// Checkpoint is a snapshot of a task's working tree.
+type Checkpoint struct {
+	Name   string    `json:"name"` // "start" or "step-N"
+	Step   int       `json:"step"` // step the snapshot precedes; 0 for start
+	Commit string    `json:"commit"`
+	Head   string    `json:"head"`   // HEAD when it was taken
+	Branch string    `json:"branch"` // checked-out branch; empty when detached
+	Dir    string    `json:"dir"`    // working tree it was taken in
+	Time   time.Time `json:"time"`
+}
+
+func stepCheckpoint(step int) string { return fmt.Sprintf("step-%d", step) }
+
+func checkpointRef(taskID int, name string) string {
+	return fmt.Sprintf("%s/task-%d/%s", checkpointRefs, taskID, name)
+}
+
+// gitEnv runs git in dir with extra environment variables.
+func gitEnv(dir string, env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+// checkpointIdentity keeps commit-tree working in repos without user.name.
+var checkpointIdentity = []string{
+	"GIT_AUTHOR_NAME=teamoon", "GIT_AUTHOR_EMAIL=teamoon@localhost",
+	"GIT_COMMITTER_NAME=teamoon", "GIT_COMMITTER_EMAIL=teamoon@localhost",
+}
+
+// createCheckpoint snapshots dir into the task's checkpoint ref name without
+// touching the real index, HEAD or working tree.
+func createCheckpoint(dir string, taskID int, name string) (Checkpoint, error) {
+	if !gitRefExists(dir, "HEAD") {
+		return Checkpoint{}, fmt.Errorf("%s is not a git repository with commits", dir)
+	}
+	head, _ := runGit(dir, "rev-parse", "HEAD")
+	branch, _ := runGit(dir, "symbolic-ref", "--short", "-q", "HEAD")
+	cp := Checkpoint{
+		Name:   name,
+		Head:   strings.TrimSpace(head),
+		Branch: strings.TrimSpace(branch),
+		Dir:    dir,
+		Time:   time.Now(),
+	}
+	if n, ok := strings.CutPrefix(name, "step-"); ok {
+		cp.Step, _ = strconv.Atoi(n)
+	}
+
+	tree, err := snapshotTree(dir)
+	if err != nil {
+		return cp, err
+	}
+	msg := fmt.Sprintf("teamoon checkpoint: task #%d %s\n\nDir: %s\nBranch: %s\n", taskID, name, dir, cp.Branch)
+	commit, err := gitEnv(dir, checkpointIdentity, "commit-tree", tree, "-p", cp.Head, "-m", msg)
+	if err != nil {
+		return cp, fmt.Errorf("git commit-tree: %s", strings.TrimSpace(commit))
+	}
+	cp.Commit = strings.TrimSpace(commit)
+	if out, err := runGit(dir, "update-ref", checkpointRef(taskID, name), cp.Commit); err != nil {
+		return cp, fmt.Errorf("git update-ref: %s", strings.TrimSpace(out))
+	}
+	return cp, nil
+}
+
+// snapshotTree writes the working tree of dir (minus ignored files) as a git
+// tree and returns its hash. A scratch index seeded from the real one is used
+// so the user's staging area is untouched and unchanged files are not rehashed.
+func snapshotTree(dir string) (string, error) {
+	tmp, err := os.CreateTemp("", "teamoon-index-")
+	if err != nil {
+		return "", err
+	}
+	index := tmp.Name()
+	tmp.Close()
+	defer os.Remove(index)
+	env := []string{"GIT_INDEX_FILE=" + index}
+	if real, err := runGit(dir, "rev-parse", "--path-format=absolute", "--git-path", "index"); err == nil {
+		if data, err := os.ReadFile(strings.TrimSpace(real)); err == nil {
+			os.WriteFile(index, data, 0600)
+		} else {
+			os.Remove(index)
+		}
+	}
+	if out, err := gitEnv(dir, env, "add", "-A"); err != nil {
+		return "", fmt.Errorf("git add: %s", strings.TrimSpace(out))
+	}
+	tree, err := gitEnv(dir, env, "write-tree")
+	if err != nil {
+		return "", fmt.Errorf("git write-tree: %s", strings.TrimSpace(tree))
+	}
+	return strings.TrimSpace(tree), nil
+}
+
+// listCheckpoints returns the checkpoints of a task stored in repo, start first.
+func listCheckpoints(repo string, taskID int) ([]Checkpoint, error) {
+	prefix := fmt.Sprintf("%s/task-%d/", checkpointRefs, taskID)
+	out, err := runGit(repo, "for-each-ref", "--format=%(refname)%00%(objectname)%00%(committerdate:unix)%00%(parent)%00%(contents:body)%1e", prefix)
+	if err != nil {
+		return nil, fmt.Errorf("git for-each-ref: %s", strings.TrimSpace(out))
+	}
+	var cps []Checkpoint
+	for _, rec := range strings.Split(out, "\x1e") {
+		f := strings.SplitN(strings.TrimLeft(rec, "\n"), "\x00", 5)
+		if len(f) < 5 {
+			continue
+		}
+		cp := Checkpoint{Name: strings.TrimPrefix(f[0], prefix), Commit: f[1], Head: f[3]}
+		if n, ok := strings.CutPrefix(cp.Name, "step-"); ok {
+			cp.Step, _ = strconv.Atoi(n)
+		}
+		if sec, err := strconv.ParseInt(f[2], 10, 64); err == nil {
+			cp.Time = time.Unix(sec, 0)
+		}
+		for _, line := range strings.Split(f[4], "\n") {
+			if v, ok := strings.CutPrefix(line, "Dir: "); ok {
+				cp.Dir = v
+			} else if v, ok := strings.CutPrefix(line, "Branch: "); ok {
+				cp.Branch = v
+			}
+		}
+		cps = append(cps, cp)
+	}
+	sort.Slice(cps, func(i, j int) bool { return cps[i].Step < cps[j].Step })
+	return cps, nil
+}
+
+// restoreCheckpoint puts cp.Dir back to the snapshot: the branch is reset to
+// the recorded HEAD and the working tree to the snapshot's files. Files
+// created since are removed; ignored files are left alone.
+func restoreCheckpoint(cp Checkpoint) error {
+	if _, err := os.Stat(cp.Dir); err != nil {
+		return fmt.Errorf("workspace %s no longer exists", cp.Dir)
+	}
+	if cp.Branch != "" {
+		current, _ := runGit(cp.Dir, "symbolic-ref", "--short", "-q", "HEAD")
+		if strings.TrimSpace(current) != cp.Branch {
+			if out, err := runGit(cp.Dir, "checkout", "-q", "-f", cp.Branch); err != nil {
+				return fmt.Errorf("git checkout %s: %s", cp.Branch, strings.TrimSpace(out))
+			}
+		}
+	}
+	for _, args := range [][]string{
+		{"reset", "-q", "--hard", cp.Head},
+		{"clean", "-fdq"},
+		{"checkout", cp.Commit, "--", "."},
+		{"reset", "-q"},
+	} {
+		if out, err := runGit(cp.Dir, args...); err != nil {
+			// An empty snapshot has nothing to check out.
+			if args[0] == "checkout" && strings.Contains(out, "did not match") {
+				continue
+			}
+			return fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(out))
+		}
+	}
+	return nil
+}
+
+// deleteCheckpoints drops every checkpoint ref of a task.
+func deleteCheckpoints(repo string, taskID int) {
+	cps, _ := listCheckpoints(repo, taskID)
+	for _, cp := range cps {
+		runGit(repo, "update-ref", "-d", checkpointRef(taskID, cp.Name))
+	}
+}
+
+func projectRepo(cfg config.Config, project string) string {
+	return filepath.Join(cfg.ProjectsDir, project)
+}
+
+// checkoutSharers returns the other running tasks of t's project that work
+// in the project checkout rather than in a worktree of their own.
+func checkoutSharers(t queue.Task) []string {
+	running, err := queue.ListWhere(queue.Filter{Project: t.Project, States: []queue.TaskState{queue.StateRunning}})
+	if err != nil {
+		return nil
+	}
+	var ids []string
+	for _, o := range running {
+		if o.ID == t.ID {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(worktreePath(o.Project, o.ID), ".git")); err == nil {
+			continue
+		}
+		ids = append(ids, fmt.Sprintf("#%d", o.ID))
+	}
+	return ids
+}
+
+// rollbackFailedStep applies cfg.Checkpoints.OnFailure after step failed for
+// good. Rolling back resets the whole project checkout, so while other tasks
+// run in it the changes are kept instead, as with the keep policy.
+func rollbackFailedStep(cfg config.Config, task queue.Task, step plan.Step, emit func(logs.LogLevel, string)) {
+	var err error
+	if cfg.Checkpoints.OnFailure == config.CheckpointOnFailureKeep {
+		return
+	}
+	if others := checkoutSharers(task); len(others) > 0 {
+		emit(logs.LevelWarn, fmt.Sprintf("Kept the failed step's changes: rolling back would also undo task %s running in the same checkout", strings.Join(others, ", ")))
+		return
+	}
+	switch cfg.Checkpoints.OnFailure {
+	case config.CheckpointOnFailureRollbackTask:
+		if err = revertTo(cfg, task, 0); err == nil {
+			emit(logs.LevelWarn, "Rolled back all task changes")
+		}
+	default:
+		if step.ReadOnly {
+			return
+		}
+		if err = revertTo(cfg, task, step.Number); err == nil {
+			emit(logs.LevelWarn, fmt.Sprintf("Rolled back changes from step %d", step.Number))
+		}
+	}
+	if err != nil {
+		emit(logs.LevelError, fmt.Sprintf("Rollback failed: %v", err))
+	}
+}
+
+// ListCheckpoints returns the checkpoints recorded for a task.
+func ListCheckpoints(cfg config.Config, taskID int) ([]Checkpoint, error) {
+	t, err := queue.GetTask(taskID)
+	if err != nil {
+		return nil, err
+	}
+	return listCheckpoints(projectRepo(cfg, t.Project), taskID)
+}
+
+// RevertStep undoes step and every step after it by restoring the checkpoint
+// taken before step ran. The task is set to resume from that step. Step 0
+// restores the pre-task state.
+func RevertStep(cfg config.Config, taskID, step int) error {
+	t, err := queue.GetTask(taskID)
+	if err != nil {
+		return err
+	}
+	if queue.EffectiveState(t) == queue.StateRunning {
+		return fmt.Errorf("task #%d is running; stop it before reverting", taskID)
+	}
+	return revertTo(cfg, t, step)
+}
+
+// RestoreTask returns the task's working tree to its state before the task
+// first ran.
+func RestoreTask(cfg config.Config, taskID int) error {
+	return RevertStep(cfg, taskID, 0)
+}
+
+func revertTo(cfg config.Config, t queue.Task, step int) error {
+	cps, err := listCheckpoints(projectRepo(cfg, t.Project), t.ID)
+	if err != nil {
+		return err
+	}
+	name := checkpointStart
+	if step > 0 {
+		name = stepCheckpoint(step)
+	}
+	for _, cp := range cps {
+		if cp.Name != name {
+			continue
+		}
+		if err := restoreCheckpoint(cp); err != nil {
+			return err
+		}
+		queue.DropStepDiffs(t.ID, step)
+		return queue.SetCurrentStep(t.ID, max(step-1, 0))
+	}
+	if step > 0 {
+		return fmt.Errorf("task #%d has no checkpoint before step %d", t.ID, step)
+	}
+	return fmt.Errorf("task #%d has no pre-task checkpoint", t.ID)
+}
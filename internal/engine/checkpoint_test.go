@@ -0,0 +1,181 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/plan"
+	"github.com/JuanVilla424/teamoon/internal/queue"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "<missing>"
+	}
+	return string(data)
+}
+
+func TestCheckpoint_RestoresWorkingTree(t *testing.T) {
+	cfg := initTestRepo(t)
+	repo := filepath.Join(cfg.ProjectsDir, "proj")
+	os.WriteFile(filepath.Join(repo, "README.md"), []byte("edited\n"), 0644)
+	os.WriteFile(filepath.Join(repo, "notes.txt"), []byte("untracked\n"), 0644)
+	before := strings.TrimSpace(mustGit(t, repo, "rev-parse", "HEAD"))
+
+	cp, err := createCheckpoint(repo, 3, stepCheckpoint(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := mustGit(t, repo, "status", "--porcelain"); !strings.Contains(status, "?? notes.txt") {
+		t.Errorf("checkpoint must not touch the index, status:\n%s", status)
+	}
+
+	os.WriteFile(filepath.Join(repo, "README.md"), []byte("broken\n"), 0644)
+	os.WriteFile(filepath.Join(repo, "junk.go"), []byte("junk\n"), 0644)
+	mustGit(t, repo, "add", "README.md")
+	mustGit(t, repo, "commit", "-q", "-m", "half done")
+	os.Remove(filepath.Join(repo, "notes.txt"))
+
+	cps, err := listCheckpoints(repo, 3)
+	if err != nil || len(cps) != 1 {
+		t.Fatalf("checkpoints = %+v, %v", cps, err)
+	}
+	got := cps[0]
+	if got.Commit != cp.Commit || got.Head != before || got.Step != 2 || got.Dir != repo || got.Branch != "dev" {
+		t.Errorf("listed %+v, created %+v", got, cp)
+	}
+
+	if err := restoreCheckpoint(got); err != nil {
+		t.Fatal(err)
+	}
+	if head := strings.TrimSpace(mustGit(t, repo, "rev-parse", "HEAD")); head != before {
+		t.Errorf("HEAD = %s, want %s", head, before)
+	}
+	if c := readFile(t, filepath.Join(repo, "README.md")); c != "edited\n" {
+		t.Errorf("README.md = %q", c)
+	}
+	if c := readFile(t, filepath.Join(repo, "notes.txt")); c != "untracked\n" {
+		t.Errorf("notes.txt = %q", c)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "junk.go")); err == nil {
+		t.Error("files created after the checkpoint should be removed")
+	}
+
+	deleteCheckpoints(repo, 3)
+	if cps, _ := listCheckpoints(repo, 3); len(cps) != 0 {
+		t.Errorf("checkpoints left after delete: %+v", cps)
+	}
+}
+
+func TestRunTask_RollsBackFailedStep(t *testing.T) {
+	cfg := initTestRepo(t)
+	os.MkdirAll(config.ConfigDir(), 0755)
+	cfg.Worktrees.Enabled = false
+	cfg.Spawn.Runtime = RuntimeFake
+	repo := filepath.Join(cfg.ProjectsDir, "proj")
+
+	write := func(name, content string) func(AgentRequest) {
+		return func(req AgentRequest) {
+			os.WriteFile(filepath.Join(req.Dir, name), []byte(content), 0644)
+		}
+	}
+	create := writeTurn("created a.txt")
+	create.Hook = write("a.txt", "step one\n")
+	fail := FakeTurn{ExitCode: 1, Events: []StreamEvent{FakeResult("boom")}, Hook: write("a.txt", "mangled\n")}
+	junk := FakeTurn{Events: []StreamEvent{FakeResult("tried")}, Hook: write("junk.txt", "junk\n")}
+	RegisterRuntime(NewFakeRuntime(create, fail, junk, fail, junk, fail))
+
+	task, err := queue.Add("proj", "build the thing", "med")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runTask(context.Background(), task, twoStepPlan(), cfg, func(tea.Msg) {})
+
+	got, _ := queue.GetTask(task.ID)
+	if got.State == queue.StateDone || !strings.HasPrefix(got.FailReason, "Step 2") {
+		t.Fatalf("expected step 2 to fail, got state %s (%s)", got.State, got.FailReason)
+	}
+	if c := readFile(t, filepath.Join(repo, "a.txt")); c != "step one\n" {
+		t.Errorf("a.txt after rollback = %q, want step one's content", c)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "junk.txt")); err == nil {
+		t.Error("failed step's files should be rolled back")
+	}
+
+	cps, _ := ListCheckpoints(cfg, task.ID)
+	if len(cps) != 3 || cps[0].Name != checkpointStart {
+		t.Fatalf("checkpoints = %+v", cps)
+	}
+	if err := RestoreTask(cfg, task.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "a.txt")); err == nil {
+		t.Error("restore should remove every change made by the task")
+	}
+	got, _ = queue.GetTask(task.ID)
+	if got.CurrentStep != 0 {
+		t.Errorf("current step after restore = %d", got.CurrentStep)
+	}
+	if diffs, _ := queue.LoadStepDiffs(task.ID); len(diffs) != 0 {
+		t.Errorf("restore should drop step diffs, got %+v", diffs)
+	}
+}
+
+func TestRunTask_NoRollbackWhileCheckoutShared(t *testing.T) {
+	cfg := initTestRepo(t)
+	os.MkdirAll(config.ConfigDir(), 0755)
+	cfg.Worktrees.Enabled = false
+	cfg.Spawn.Runtime = RuntimeFake
+	repo := filepath.Join(cfg.ProjectsDir, "proj")
+
+	fail := FakeTurn{ExitCode: 1, Events: []StreamEvent{FakeResult("boom")}, Hook: func(req AgentRequest) {
+		os.WriteFile(filepath.Join(req.Dir, "half.txt"), []byte("half\n"), 0644)
+	}}
+	RegisterRuntime(NewFakeRuntime(fail, fail, fail, fail, fail))
+	other, _ := queue.Add("proj", "another task", "med")
+	queue.UpdateState(other.ID, queue.StateRunning)
+	task, _ := queue.Add("proj", "build the thing", "med")
+	p := plan.Plan{Title: "thing", Steps: []plan.Step{{Number: 1, Title: "write", Body: "create", Agent: "dev"}}}
+
+	runTask(context.Background(), task, p, cfg, func(tea.Msg) {})
+
+	if _, err := os.Stat(filepath.Join(repo, "half.txt")); err != nil {
+		t.Error("rollback must not reset a checkout another task is running in")
+	}
+}
+
+func TestRunTask_KeepPolicyLeavesChanges(t *testing.T) {
+	cfg := initTestRepo(t)
+	os.MkdirAll(config.ConfigDir(), 0755)
+	cfg.Worktrees.Enabled = false
+	cfg.Spawn.Runtime = RuntimeFake
+	cfg.Checkpoints.OnFailure = config.CheckpointOnFailureKeep
+	repo := filepath.Join(cfg.ProjectsDir, "proj")
+
+	fail := FakeTurn{ExitCode: 1, Events: []StreamEvent{FakeResult("boom")}, Hook: func(req AgentRequest) {
+		os.WriteFile(filepath.Join(req.Dir, "half.txt"), []byte("half\n"), 0644)
+	}}
+	RegisterRuntime(NewFakeRuntime(fail, fail, fail, fail, fail))
+	task, _ := queue.Add("proj", "build the thing", "med")
+	p := plan.Plan{Title: "thing", Steps: []plan.Step{{Number: 1, Title: "write", Body: "create", Agent: "dev"}}}
+
+	runTask(context.Background(), task, p, cfg, func(tea.Msg) {})
+
+	if _, err := os.Stat(filepath.Join(repo, "half.txt")); err != nil {
+		t.Error("keep policy should leave the failed step's changes in place")
+	}
+	if err := RevertStep(cfg, task.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "half.txt")); err == nil {
+		t.Error("revert-step should remove the step's changes")
+	}
+}
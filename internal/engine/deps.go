@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/JuanVilla424/teamoon/internal/queue"
+)
+
+type depStatus int
+
+const (
+	depsReady   depStatus = iota // every predecessor is done or archived
+	depsWaiting                  // a predecessor is still queued or running
+	depsBlocked                  // a predecessor failed; the task is blocked
+)
+
+// predecessors returns the IDs task t must wait for: its explicit DependsOn
+// edges plus, for legacy wave-numbered tasks, every peer in a lower wave.
+func predecessors(t queue.Task, peers []queue.Task) []int {
+	preds := append([]int(nil), t.DependsOn...)
+	if t.Wave > 0 {
+		for _, p := range peers {
+			if p.ID != t.ID && p.Wave > 0 && p.Wave < t.Wave {
+				preds = append(preds, p.ID)
+			}
+		}
+	}
+	return preds
+}
+
+// predecessorFailed reports whether d ended in failure and is waiting for
+// a human or a retry. A blocked predecessor blocks its dependents in turn.
+func predecessorFailed(d queue.Task) bool {
+	switch queue.EffectiveState(d) {
+	case queue.StateFailed, queue.StateBlocked:
+		return true
+	case queue.StatePending:
+		return d.FailReason != ""
+	}
+	return false
+}
+
+// resolveDeps classifies whether t can start. When blocked, blocker is the
+// failed predecessor. active is true when a waiting task depends on work
+// that is actually progressing (running, or autopilot-queued elsewhere).
+func resolveDeps(t queue.Task, peers []queue.Task, lookup func(int) (queue.Task, bool)) (status depStatus, blocker int, active bool) {
+	status = depsReady
+	for _, id := range predecessors(t, peers) {
+		d, ok := lookup(id)
+		if !ok {
+			continue // deleted predecessors do not hold anything back
+		}
+		switch queue.EffectiveState(d) {
+		case queue.StateDone, queue.StateArchived:
+			continue
+		}
+		if predecessorFailed(d) {
+			return depsBlocked, d.ID, false
+		}
+		status = depsWaiting
+		if queue.EffectiveState(d) == queue.StateRunning || (d.AutoPilot && d.Project != t.Project) {
+			active = true
+		}
+	}
+	return status, 0, active
+}
+
+func blockedReason(blocker int) string {
+	return fmt.Sprintf("blocked by #%d", blocker)
+}
@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/JuanVilla424/teamoon/internal/queue"
+)
+
+func lookupIn(tasks ...queue.Task) func(int) (queue.Task, bool) {
+	m := make(map[int]queue.Task)
+	for _, t := range tasks {
+		m[t.ID] = t
+	}
+	return func(id int) (queue.Task, bool) {
+		t, ok := m[id]
+		return t, ok
+	}
+}
+
+func TestPredecessors_LegacyWaves(t *testing.T) {
+	w1 := queue.Task{ID: 1, Wave: 1}
+	w2 := queue.Task{ID: 2, Wave: 2}
+	w0 := queue.Task{ID: 3}
+	w3 := queue.Task{ID: 4, Wave: 3, DependsOn: []int{3}}
+	peers := []queue.Task{w1, w2, w0, w3}
+
+	if got := predecessors(w1, peers); len(got) != 0 {
+		t.Errorf("wave 1 should have no predecessors, got %v", got)
+	}
+	if got := predecessors(w0, peers); len(got) != 0 {
+		t.Errorf("wave 0 tasks are independent, got %v", got)
+	}
+	got := predecessors(w3, peers)
+	want := map[int]bool{3: true, 1: true, 2: true}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for _, id := range got {
+		if !want[id] {
+			t.Errorf("unexpected predecessor %d", id)
+		}
+	}
+}
+
+func TestResolveDeps(t *testing.T) {
+	done := queue.Task{ID: 1, State: queue.StateDone}
+	archived := queue.Task{ID: 2, State: queue.StateArchived}
+	pending := queue.Task{ID: 3, State: queue.StatePending, Project: "p"}
+	failed := queue.Task{ID: 4, State: queue.StatePending, FailReason: "step 2 failed"}
+	running := queue.Task{ID: 5, State: queue.StateRunning, Project: "p"}
+	otherProject := queue.Task{ID: 6, State: queue.StatePlanned, Project: "q", AutoPilot: true}
+	hardFailed := queue.Task{ID: 7, State: queue.StateFailed}
+	blocked := queue.Task{ID: 8, State: queue.StateBlocked}
+	lookup := lookupIn(done, archived, pending, failed, running, otherProject, hardFailed, blocked)
+
+	cases := []struct {
+		name       string
+		deps       []int
+		wantStatus depStatus
+		wantBlock  int
+		wantActive bool
+	}{
+		{"no deps", nil, depsReady, 0, false},
+		{"done and archived", []int{1, 2}, depsReady, 0, false},
+		{"missing predecessor", []int{99}, depsReady, 0, false},
+		{"queued manual predecessor", []int{1, 3}, depsWaiting, 0, false},
+		{"running predecessor", []int{5}, depsWaiting, 0, true},
+		{"autopilot task in another project", []int{6}, depsWaiting, 0, true},
+		{"failed predecessor", []int{3, 4}, depsBlocked, 4, false},
+		{"predecessor in failed state", []int{7}, depsBlocked, 7, false},
+		{"blocked predecessor", []int{1, 8}, depsBlocked, 8, false},
+	}
+	for _, tc := range cases {
+		task := queue.Task{ID: 10, Project: "p", DependsOn: tc.deps}
+		status, blocker, active := resolveDeps(task, nil, lookup)
+		if status != tc.wantStatus || blocker != tc.wantBlock || active != tc.wantActive {
+			t.Errorf("%s: got (%v, %d, %v), want (%v, %d, %v)",
+				tc.name, status, blocker, active, tc.wantStatus, tc.wantBlock, tc.wantActive)
+		}
+	}
+	if got := blockedReason(4); got != "blocked by #4" {
+		t.Errorf("unexpected reason %q", got)
+	}
+}
+
+func TestFailPlanning(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	task, err := queue.Add("p", "task", "med")
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.UpdateState(task.ID, queue.StatePlanning)
+
+	if got := failPlanning(task.ID, 2, errors.New("timeout")); got != queue.StatePending {
+		t.Fatalf("first failure: got %s, want pending", got)
+	}
+	queue.UpdateState(task.ID, queue.StatePlanning)
+	if got := failPlanning(task.ID, 2, errors.New("timeout")); got != queue.StateFailed {
+		t.Fatalf("last attempt: got %s, want failed", got)
+	}
+	stored, _ := queue.GetTask(task.ID)
+	if queue.EffectiveState(stored) != queue.StateFailed || stored.FailReason == "" {
+		t.Errorf("stored state=%s reason=%q", queue.EffectiveState(stored), stored.FailReason)
+	}
+}
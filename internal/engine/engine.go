@@ -2,7 +2,6 @@ package engine
 
 import (
 	"context"
-	"os/exec"
 	"sync"
 	"time"
 
@@ -27,6 +26,7 @@ type LogMsg struct {
 type PlanGeneratedMsg struct {
 	TaskID  int
 	Content string
+	Meta    plan.RevisionMeta
 	Err     error
 }
 
@@ -96,16 +96,23 @@ func (m *Manager) Start(task queue.Task, p plan.Plan, cfg config.Config, send fu
 	m.runners[task.ID] = r
 	m.mu.Unlock()
 
-	if _, err := exec.LookPath("claude"); err != nil {
+	rt, err := RuntimeFor(cfg)
+	if err == nil {
+		err = rt.Available()
+	}
+	if err != nil {
 		send(LogMsg{Entry: logs.LogEntry{
 			Time:    time.Now(),
 			TaskID:  task.ID,
 			Project: task.Project,
-			Message: "claude CLI not found in PATH",
+			Message: err.Error(),
 			Level:   logs.LevelError,
 		}})
-		queue.SetFailReason(task.ID, "claude CLI not found")
-		send(TaskStateMsg{TaskID: task.ID, State: queue.StatePending, Message: "claude CLI not found"})
+		queue.Fail(task.ID, err.Error())
+		send(TaskStateMsg{TaskID: task.ID, State: queue.StateFailed, Message: err.Error()})
+		m.mu.Lock()
+		delete(m.runners, task.ID)
+		m.mu.Unlock()
 		close(r.done)
 		return
 	}
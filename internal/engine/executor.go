@@ -1,13 +1,10 @@
 package engine
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -17,13 +14,14 @@ import (
 
 	"github.com/JuanVilla424/teamoon/internal/config"
 	"github.com/JuanVilla424/teamoon/internal/logs"
+	"github.com/JuanVilla424/teamoon/internal/metrics"
 	"github.com/JuanVilla424/teamoon/internal/plan"
 	"github.com/JuanVilla424/teamoon/internal/projectinit"
+	"github.com/JuanVilla424/teamoon/internal/projects"
 	"github.com/JuanVilla424/teamoon/internal/queue"
+	"github.com/JuanVilla424/teamoon/internal/webhook"
 )
 
-const maxRetries = 3
-
 // StreamEvent represents a single line from Claude CLI's stream-json output.
 type StreamEvent struct {
 	Type              string             `json:"type"`
@@ -35,11 +33,18 @@ type StreamEvent struct {
 	IsError           bool               `json:"is_error,omitempty"`
 	PermissionDenials []PermissionDenial `json:"permission_denials,omitempty"`
 	ToolUseResult     *ToolUseResult     `json:"tool_use_result,omitempty"`
+	Model             string             `json:"model,omitempty"`
+	Usage             *metrics.Usage     `json:"usage,omitempty"`
+	TotalCostUSD      float64            `json:"total_cost_usd,omitempty"`
+	NumTurns          int                `json:"num_turns,omitempty"`
+	Raw               string             `json:"-"` // the unparsed line
 }
 
 // StreamMessage is the message payload of an assistant or user event.
 type StreamMessage struct {
+	ID      string          `json:"id,omitempty"`
 	Content []StreamContent `json:"content"`
+	Usage   *metrics.Usage  `json:"usage,omitempty"`
 }
 
 // StreamContent is a single content block within a stream message.
@@ -200,6 +205,14 @@ type spawnResult struct {
 	Denials   []string
 	ToolsUsed []string
 	SessionID string
+	Agent     AgentResult // usage, cost and timing reported by the runtime
+	// OverBudget is set when the session was cancelled for crossing the task token cap.
+	OverBudget bool
+	// Errors, ToolErrors and Subtype feed classifyFailure: error events and
+	// error results, failed tool calls, and the final result's subtype.
+	Errors     []string
+	ToolErrors int
+	Subtype    string
 }
 
 // BuildSpawnArgs assembles CLI arguments for spawning claude, respecting config.
@@ -313,18 +326,61 @@ func runTask(ctx context.Context, task queue.Task, p plan.Plan, cfg config.Confi
 		}})
 	}
 
+	ws, err := prepareWorkspace(task, cfg)
+	if err != nil {
+		emit(logs.LevelWarn, fmt.Sprintf("Worktree unavailable, running in project checkout: %v", err), "")
+	} else if ws.isolated() {
+		emit(logs.LevelInfo, fmt.Sprintf("Working in worktree %s on branch %s", ws.Dir, ws.Branch), "")
+	}
+	// A worktree that did not reach completion is kept with its branch, so
+	// a retry resumes from the failed step and nothing the agent wrote is
+	// lost. Archiving the task discards it.
+	settled := false
+	defer func() {
+		if !settled && ws.isolated() {
+			emit(logs.LevelInfo, fmt.Sprintf("Kept worktree %s on branch %s; archive the task to discard it", ws.Dir, ws.Branch), "")
+		}
+	}()
+
 	// Ensure .bmad symlink exists so BMAD workflows resolve @.bmad/ paths
-	projectinit.EnsureBMADLink(filepath.Join(cfg.ProjectsDir, task.Project))
+	projectinit.EnsureBMADLink(ws.dirFor(cfg, task.Project))
 
 	emit(logs.LevelInfo, fmt.Sprintf("Autopilot started: %s", task.Description), "")
 	if err := queue.UpdateState(task.ID, queue.StateRunning); err != nil {
 		emit(logs.LevelError, fmt.Sprintf("State update failed: %v", err), "")
 	}
 	send(TaskStateMsg{TaskID: task.ID, State: queue.StateRunning})
+	if task.HeldReason != "" {
+		queue.SetHeldReason(task.ID, "")
+	}
+
+	// pauseForBudget parks the task as planned after step lastDone and fires
+	// the budget webhook.
+	pauseForBudget := func(b budgetBreach, lastDone int, agent string) {
+		settled = true
+		emit(logs.LevelWarn, "Paused: "+b.Reason, agent)
+		queue.SetCurrentStep(task.ID, lastDone)
+		queue.UpdateState(task.ID, queue.StatePlanned)
+		queue.SetHeldReason(task.ID, b.Reason)
+		notifyBudget(task, b)
+		send(TaskStateMsg{TaskID: task.ID, State: queue.StatePlanned, Message: b.Reason})
+	}
 
 	// Clear any lingering plan-gen session IDs so restart recovery works correctly
 	queue.SetSessionID(task.ID, "")
 
+	// Checkpoints let a failed step be rolled back instead of leaving
+	// half-applied edits for the next task.
+	wsDir := ws.dirFor(cfg, task.Project)
+	tracked := task.Assignee != "system" && gitRefExists(wsDir, "HEAD")
+	checkpoints := cfg.Checkpoints.Enabled && tracked
+	if checkpoints && !gitRefExists(wsDir, checkpointRef(task.ID, checkpointStart)) {
+		if _, err := createCheckpoint(wsDir, task.ID, checkpointStart); err != nil {
+			emit(logs.LevelWarn, fmt.Sprintf("Checkpoints disabled: %v", err), "")
+			checkpoints = false
+		}
+	}
+
 	addDirs := p.Dependencies
 	var stepSummaries []string
 	var sessionID string
@@ -347,7 +403,11 @@ func runTask(ctx context.Context, task queue.Task, p plan.Plan, cfg config.Confi
 			return
 		}
 
-		for reason := CheckGuardrails(); reason != ""; reason = CheckGuardrails() {
+		for reason, paused := CheckGuardrails(), ""; reason != ""; reason = CheckGuardrails() {
+			if reason != paused {
+				queue.Record(task.ID, queue.Event{Kind: queue.EventGuardrail, Actor: queue.ActorAutopilot, Step: step.Number, Reason: reason})
+				paused = reason
+			}
 			emit(logs.LevelWarn, "Guardrail: "+reason+", waiting 2m...", agent)
 			select {
 			case <-ctx.Done():
@@ -357,11 +417,34 @@ func runTask(ctx context.Context, task queue.Task, p plan.Plan, cfg config.Confi
 			case <-time.After(2 * time.Minute):
 			}
 		}
+		if b, over := checkBudget(cfg, task); over {
+			pauseForBudget(b, step.Number-1, agent)
+			return
+		}
+
+		// before is the snapshot the step's diff is taken against.
+		var before string
+		if tracked && !step.ReadOnly {
+			if checkpoints {
+				cp, err := createCheckpoint(wsDir, task.ID, stepCheckpoint(step.Number))
+				if err != nil {
+					emit(logs.LevelWarn, fmt.Sprintf("Step %d/%d: checkpoint failed: %v", step.Number, total, err), agent)
+				}
+				before = cp.Commit
+			} else {
+				before, _ = snapshotTree(wsDir)
+			}
+		}
 
 		success := false
 		var recoveryCtx string
 		var lastRes spawnResult
-		for retry := 0; retry < maxRetries; retry++ {
+		checksFailed := false
+		// attempts counts spawns charged to the failure policies; rate-limit
+		// waits are counted apart and do not use up attempts.
+		attempts, rateWaits := 0, 0
+		lastClass := ""
+		for {
 			if ctx.Err() != nil {
 				emit(logs.LevelWarn, "Autopilot stopped by user", agent)
 				queue.UpdateState(task.ID, queue.StatePlanned)
@@ -370,15 +453,23 @@ func runTask(ctx context.Context, task queue.Task, p plan.Plan, cfg config.Confi
 			}
 
 			queue.SetCurrentStep(task.ID, step.Number)
-			if retry == 0 {
+			if attempts+rateWaits == 0 {
+				queue.Record(task.ID, queue.Event{Kind: queue.EventStepStart, Actor: queue.ActorAutopilot, Step: step.Number, Reason: step.Title})
 				emit(logs.LevelInfo, fmt.Sprintf("Step %d/%d: %s", step.Number, total, step.Title), agent)
 			} else {
-				emit(logs.LevelWarn, fmt.Sprintf("Step %d/%d: retry %d/%d", step.Number, total, retry, maxRetries-1), agent)
+				queue.Record(task.ID, queue.Event{Kind: queue.EventStepRetry, Actor: queue.ActorAutopilot, Step: step.Number, Attempt: attempts + rateWaits + 1, Reason: lastClass})
+				emit(logs.LevelWarn, fmt.Sprintf("Step %d/%d: retry %d (%s)", step.Number, total, attempts+rateWaits, lastClass), agent)
 			}
 
-			prompt := buildStepPrompt(task, p, step, retry, recoveryCtx, strings.Join(stepSummaries, "\n"), cfg)
-			res, err := spawnClaude(ctx, task.Project, prompt, send, task.ID, addDirs, agent, cfg, sessionID)
+			prompt := buildStepPrompt(task, ws, p, step, attempts, recoveryCtx, strings.Join(stepSummaries, "\n"), cfg)
+			res, err := spawnClaude(ctx, task.Project, ws.Dir, prompt, send, task.ID, addDirs, agent, cfg, sessionID, newTokenMeter(cfg, task))
 			lastRes = res
+			attempts++
+			recordSpawn(metrics.SpendStep, task, step.Number, res, cfg)
+			if res.OverBudget {
+				pauseForBudget(overBudgetBreach(cfg, task), step.Number-1, agent)
+				return
+			}
 
 			if ctx.Err() != nil {
 				emit(logs.LevelWarn, "Autopilot stopped by user", agent)
@@ -405,20 +496,66 @@ func runTask(ctx context.Context, task queue.Task, p plan.Plan, cfg config.Confi
 
 			// Check real success: exit 0 AND no permission denials
 			stepOK := res.ExitCode == 0 && len(res.Denials) == 0
+			failOutput, checkFailure := res.Output, ""
 			if stepOK {
 				// ReadOnly steps don't require write tools
-				if !step.ReadOnly && !hasWriteTools(res.ToolsUsed) && retry < maxRetries-1 {
+				if !step.ReadOnly && !hasWriteTools(res.ToolsUsed) && attempts < config.RetryPolicyFor(cfg, config.FailureGaveUp).MaxAttempts {
 					emit(logs.LevelWarn, fmt.Sprintf("Step %d/%d: no changes produced (tools: %v), retrying", step.Number, total, res.ToolsUsed), agent)
 					recoveryCtx = "Previous attempt exited successfully but made NO file changes. You MUST create or edit files this time."
+					lastClass = config.FailureGaveUp
 					continue
 				}
+				if len(step.Checks) > 0 {
+					checkOut, passed, err := runStepChecks(ctx, checkDir(task, ws, cfg), step)
+					if err != nil {
+						emit(logs.LevelWarn, "Autopilot stopped by user", agent)
+						queue.UpdateState(task.ID, queue.StatePlanned)
+						send(TaskStateMsg{TaskID: task.ID, State: queue.StatePlanned, Message: "stopped"})
+						return
+					}
+					if !passed {
+						emit(logs.LevelWarn, fmt.Sprintf("Step %d/%d: verify checks failed", step.Number, total), agent)
+						checksFailed = true
+						stepOK = false
+						failOutput = checkOut
+						checkFailure = "Verify checks failed:\n" + checkOut
+					}
+				}
+			}
+			if stepOK {
 				emit(logs.LevelSuccess, fmt.Sprintf("Step %d/%d complete (tools: %v)", step.Number, total, res.ToolsUsed), agent)
 				success = true
 				break
 			}
 
+			lastClass = classifyFailure(res, checkFailure != "")
+			policy := config.RetryPolicyFor(cfg, lastClass)
+			queue.NotifyEvent(webhook.EventStepFailed, task, map[string]any{
+				"step":    step.Number,
+				"title":   step.Title,
+				"attempt": attempts + rateWaits,
+				"class":   lastClass,
+			})
+			if lastClass == config.FailureRateLimit {
+				// Rate limits are not the step's fault: wait for the reset and
+				// rerun the same attempt.
+				attempts--
+				rateWaits++
+				if rateWaits >= policy.MaxAttempts {
+					break
+				}
+				wait := retryDelay(policy, lastClass, res, rateWaits, time.Now())
+				emit(logs.LevelWarn, fmt.Sprintf("Step %d/%d: rate limited, waiting %s", step.Number, total, wait.Round(time.Second)), agent)
+				retryWait(ctx, wait)
+				continue
+			}
+			if attempts >= policy.MaxAttempts {
+				break
+			}
+
 			// Build failure context for Layer 2
 			var failInfo strings.Builder
+			failInfo.WriteString(checkFailure)
 			if res.ExitCode != 0 {
 				failInfo.WriteString(fmt.Sprintf("Exit code: %d\n", res.ExitCode))
 			}
@@ -428,22 +565,37 @@ func runTask(ctx context.Context, task queue.Task, p plan.Plan, cfg config.Confi
 			}
 
 			// Layer 2: Deliberative — analyze failure and feed context to next retry
-			if retry < maxRetries-1 {
-				emit(logs.LevelWarn, fmt.Sprintf("Step %d/%d failed (exit %d, %d denials), analyzing...",
-					step.Number, total, res.ExitCode, len(res.Denials)), agent)
-				recoveryPrompt := buildRecoveryPrompt(task, step, res.Output, res.ExitCode, cfg)
-				recRes, _ := spawnClaude(ctx, task.Project, recoveryPrompt, send, task.ID, addDirs, agent, cfg, sessionID)
+			recoveryCtx = failInfo.String()
+			if policy.Recovery {
+				emit(logs.LevelWarn, fmt.Sprintf("Step %d/%d failed (%s, exit %d, %d denials), analyzing...",
+					step.Number, total, lastClass, res.ExitCode, len(res.Denials)), agent)
+				recoveryPrompt := buildRecoveryPrompt(task, ws, step, failOutput, res.ExitCode, cfg)
+				recRes, _ := spawnClaude(ctx, task.Project, ws.Dir, recoveryPrompt, send, task.ID, addDirs, agent, cfg, sessionID, newTokenMeter(cfg, task))
+				recordSpawn(metrics.SpendRecovery, task, step.Number, recRes, cfg)
+				if recRes.OverBudget {
+					pauseForBudget(overBudgetBreach(cfg, task), step.Number-1, agent)
+					return
+				}
 				// Feed recovery analysis as context to next retry
-				recoveryCtx = failInfo.String()
 				if recRes.Output != "" {
 					// Extract the result text from recovery for context
 					recoveryCtx += "\nRecovery analysis:\n" + extractResult(recRes.Output)
 				}
 			}
+			if wait := retryDelay(policy, lastClass, res, attempts, time.Now()); wait > 0 {
+				emit(logs.LevelWarn, fmt.Sprintf("Step %d/%d: backing off %s", step.Number, total, wait.Round(time.Second)), agent)
+				retryWait(ctx, wait)
+			}
 		}
 
 		if success {
 			queue.SetCurrentStep(task.ID, step.Number)
+			queue.Record(task.ID, queue.Event{Kind: queue.EventStepEnd, Actor: queue.ActorAutopilot, Step: step.Number})
+			if before != "" {
+				if err := recordStepDiff(wsDir, task.ID, step, before); err != nil {
+					emit(logs.LevelWarn, fmt.Sprintf("Step %d/%d: diff not recorded: %v", step.Number, total, err), agent)
+				}
+			}
 		}
 
 		// Accumulate step context for subsequent steps
@@ -459,26 +611,62 @@ func runTask(ctx context.Context, task queue.Task, p plan.Plan, cfg config.Confi
 
 		if !success {
 			// Layer 3: Meta-cognitive — fail task
-			reason := fmt.Sprintf("Step %d '%s' failed after %d attempts", step.Number, step.Title, maxRetries)
+			detail := lastClass
+			if checksFailed {
+				detail += ", verify checks failed"
+			}
+			reason := fmt.Sprintf("Step %d '%s' failed after %d attempts (%s)", step.Number, step.Title, attempts+rateWaits, detail)
 			emit(logs.LevelError, "FAILED: "+reason, agent)
-			queue.SetFailReason(task.ID, reason)
-			send(TaskStateMsg{TaskID: task.ID, State: queue.StatePending, Message: reason})
+			queue.Record(task.ID, queue.Event{Kind: queue.EventStepEnd, Actor: queue.ActorAutopilot, Step: step.Number, Reason: reason})
+			// Isolated workspaces are kept for a retry; only the shared
+			// checkout needs rolling back.
+			if checkpoints && !ws.isolated() {
+				rollbackFailedStep(cfg, task, step, func(level logs.LogLevel, msg string) { emit(level, msg, agent) })
+			}
+			if ws.isolated() {
+				queue.FailAfter(task.ID, reason, step.Number-1)
+			} else {
+				queue.Fail(task.ID, reason)
+			}
+			send(TaskStateMsg{TaskID: task.ID, State: queue.StateFailed, Message: reason})
 			return
 		}
 	}
 
+	prURL, err := completeWorkspace(ws, task, cfg, stepSummaries, func(level logs.LogLevel, msg string) { emit(level, msg, "") })
+	if err != nil {
+		reason := fmt.Sprintf("Delivering %s failed: %v", ws.Branch, err)
+		emit(logs.LevelError, "FAILED: "+reason, "")
+		// Every step is done; a retry only delivers again.
+		queue.FailAfter(task.ID, reason, total)
+		send(TaskStateMsg{TaskID: task.ID, State: queue.StateFailed, Message: reason})
+		return
+	}
+	settled = true
+	if ws.isolated() {
+		deleteCheckpoints(ws.RepoDir, task.ID)
+	}
+
 	emit(logs.LevelSuccess, "All steps complete", "")
+	if prURL != "" {
+		number := projects.PRNumber(prURL)
+		if err := queue.SetInReview(task.ID, number, prURL); err != nil {
+			emit(logs.LevelError, fmt.Sprintf("State update failed: %v", err), "")
+		}
+		send(TaskStateMsg{TaskID: task.ID, State: queue.StateInReview, Message: prURL})
+		return
+	}
 	if err := queue.UpdateState(task.ID, queue.StateDone); err != nil {
 		emit(logs.LevelError, fmt.Sprintf("State update failed: %v", err), "")
 	}
 	send(TaskStateMsg{TaskID: task.ID, State: queue.StateDone})
 }
 
-func buildStepPrompt(task queue.Task, p plan.Plan, step plan.Step, retry int, recoveryCtx, prevSteps string, cfg config.Config) string {
+func buildStepPrompt(task queue.Task, ws workspace, p plan.Plan, step plan.Step, retry int, recoveryCtx, prevSteps string, cfg config.Config) string {
 	if task.Assignee == "system" {
 		return buildSystemStepPrompt(task, p, step, retry, recoveryCtx, prevSteps, cfg)
 	}
-	projectPath := filepath.Join(cfg.ProjectsDir, task.Project)
+	projectPath := ws.dirFor(cfg, task.Project)
 
 	var sb strings.Builder
 	sb.WriteString(fmt.Sprintf("You are the %s agent executing step %d of %d in an autopilot task.\n\n", step.Agent, step.Number, len(p.Steps)))
@@ -524,6 +712,12 @@ func buildStepPrompt(task queue.Task, p plan.Plan, step plan.Step, retry int, re
 	if step.Verify != "" {
 		sb.WriteString(fmt.Sprintf("\nVerify when done: %s\n", step.Verify))
 	}
+	if len(step.Checks) > 0 {
+		sb.WriteString("\nAutomated checks teamoon runs after this step (all must pass):\n")
+		for _, c := range step.Checks {
+			sb.WriteString("- " + c + "\n")
+		}
+	}
 	if retry > 0 && recoveryCtx != "" {
 		sb.WriteString(fmt.Sprintf("\nPrevious attempt context:\n%s\n", recoveryCtx))
 	}
@@ -542,7 +736,13 @@ func buildStepPrompt(task queue.Task, p plan.Plan, step plan.Step, retry int, re
 	sb.WriteString("\n6. NEVER invoke /bmad slash commands (party-mode, brainstorming-session, or any /bmad:* workflow). Use skills like /using-superpowers, /frontend-design, /ui-ux-pro-max when they help the task.")
 	sb.WriteString("\n7. NEVER use EnterPlanMode or create plan files. You ARE the plan execution. Just do the work.")
 	sb.WriteString("\n8. Be concise. Do not narrate. Do not ask questions. Do not offer to do more. When done, STOP.")
-	sb.WriteString("\n9. ALWAYS work on the dev branch. If not on dev, run: git checkout dev")
+	if ws.isolated() && config.DeliveryFor(cfg, task.Project) == config.WorktreeOnCompletePR {
+		sb.WriteString(fmt.Sprintf("\n9. ALWAYS work on the %s branch checked out in this worktree. NEVER switch branches, merge into other branches or open pull requests; teamoon pushes it and opens the pull request when the task completes.", ws.Branch))
+	} else if ws.isolated() {
+		sb.WriteString(fmt.Sprintf("\n9. ALWAYS work on the %s branch checked out in this worktree. NEVER switch branches; teamoon merges it when the task completes.", ws.Branch))
+	} else {
+		sb.WriteString("\n9. ALWAYS work on the dev branch. If not on dev, run: git checkout dev")
+	}
 	sb.WriteString("\n10. NEVER say 'Is there anything else', 'Let me know', 'Ready when you are', or similar. Just finish and stop.")
 	sb.WriteString("\n11. NEVER use heredoc (<<EOF, <<'EOF', cat <<) in any command. Use direct strings with quotes for git commit -m and similar.")
 	sb.WriteString("\n12. Commits: single line, NO Co-Authored-By, NO 'Made by Claude', NO 'Generated with Claude'. Format: type(core): description")
@@ -552,8 +752,8 @@ func buildStepPrompt(task queue.Task, p plan.Plan, step plan.Step, retry int, re
 	return sb.String()
 }
 
-func buildRecoveryPrompt(task queue.Task, step plan.Step, output string, exitCode int, cfg config.Config) string {
-	projectPath := filepath.Join(cfg.ProjectsDir, task.Project)
+func buildRecoveryPrompt(task queue.Task, ws workspace, step plan.Step, output string, exitCode int, cfg config.Config) string {
+	projectPath := ws.dirFor(cfg, task.Project)
 	truncated := output
 	if len(truncated) > 1000 {
 		truncated = truncated[len(truncated)-1000:]
@@ -597,6 +797,12 @@ func buildSystemStepPrompt(task queue.Task, p plan.Plan, step plan.Step, retry i
 	if step.Verify != "" {
 		sb.WriteString(fmt.Sprintf("\nVerify when done: %s\n", step.Verify))
 	}
+	if len(step.Checks) > 0 {
+		sb.WriteString("\nAutomated checks teamoon runs after this step (all must pass):\n")
+		for _, c := range step.Checks {
+			sb.WriteString("- " + c + "\n")
+		}
+	}
 	if retry > 0 && recoveryCtx != "" {
 		sb.WriteString(fmt.Sprintf("\nPrevious attempt context:\n%s\n", recoveryCtx))
 	}
@@ -611,8 +817,11 @@ func buildSystemStepPrompt(task queue.Task, p plan.Plan, step plan.Step, retry i
 	return sb.String()
 }
 
-func spawnClaude(ctx context.Context, project, prompt string, send func(tea.Msg), taskID int, addDirs []string, agent string, cfg config.Config, sessionID string) (spawnResult, error) {
-	projectPath := filepath.Join(cfg.ProjectsDir, project)
+func spawnClaude(ctx context.Context, project, dir, prompt string, send func(tea.Msg), taskID int, addDirs []string, agent string, cfg config.Config, sessionID string, meter *tokenMeter) (spawnResult, error) {
+	projectPath := dir
+	if projectPath == "" {
+		projectPath = filepath.Join(cfg.ProjectsDir, project)
+	}
 
 	if _, err := os.Stat(projectPath); err != nil {
 		home, _ := os.UserHomeDir()
@@ -629,75 +838,48 @@ func spawnClaude(ctx context.Context, project, prompt string, send func(tea.Msg)
 		defer cancelTimeout()
 	}
 
-	env := filterEnv(os.Environ(), "CLAUDECODE")
+	var env []string
 	if cfg.SudoEnabled {
 		env = append(env, "TEAMOON_SUDO_ENABLED=true")
 	}
-
 	// Satirical git identity for autopilot commits
-	gitName := GenerateName()
-	gitEmail := GenerateEmail(gitName)
-	env = append(env,
-		"GIT_AUTHOR_NAME="+gitName,
-		"GIT_AUTHOR_EMAIL="+gitEmail,
-		"GIT_COMMITTER_NAME="+gitName,
-		"GIT_COMMITTER_EMAIL="+gitEmail,
-	)
+	env = append(env, GitIdentityEnv()...)
 
+	rt, err := RuntimeFor(cfg)
+	if err != nil {
+		return spawnResult{ExitCode: -1}, err
+	}
 	// Resolve meta-model for step execution phase
 	execCfg := cfg
 	execCfg.Spawn.Model = ResolveModel(cfg.Spawn.Model, "exec")
-	args, cleanup := BuildSpawnArgs(execCfg, prompt, addDirs, sessionID)
-	if cleanup != nil {
-		defer cleanup()
-	}
-	// Block interactive tools — autopilot steps must be self-contained
-	args = append(args, "--disallowedTools",
-		"AskUserQuestion,EnterPlanMode,ExitPlanMode,TodoWrite")
-
-	cmd := exec.CommandContext(spawnCtx, "claude", args...)
-	cmd.Env = env
-	cmd.Dir = projectPath
-
-	devNull, _ := os.Open(os.DevNull)
-	if devNull != nil {
-		cmd.Stdin = devNull
-		defer devNull.Close()
-	}
-
-	stdout, err := cmd.StdoutPipe()
+	sess, err := rt.Start(spawnCtx, AgentRequest{
+		Prompt:    prompt,
+		Dir:       projectPath,
+		SessionID: sessionID,
+		AddDirs:   addDirs,
+		// Block interactive tools — autopilot steps must be self-contained
+		DisallowedTools: []string{"AskUserQuestion", "EnterPlanMode", "ExitPlanMode", "TodoWrite"},
+		Env:             env,
+		Config:          execCfg,
+	})
 	if err != nil {
 		return spawnResult{ExitCode: -1}, err
 	}
 
-	var stderrBuf strings.Builder
-	cmd.Stderr = &stderrBuf
-
-	if err := cmd.Start(); err != nil {
-		return spawnResult{ExitCode: -1}, err
-	}
-
 	var fullOutput strings.Builder
 	var denials []string
 	var toolsUsed []string
-	var capturedSessionID string
-	scanner := bufio.NewScanner(stdout)
-	scanner.Buffer(make([]byte, 256*1024), 256*1024)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		fullOutput.WriteString(line + "\n")
-
-		var event StreamEvent
-		if err := json.Unmarshal([]byte(line), &event); err != nil {
+	var errs []string
+	toolErrors := 0
+	subtype := ""
+	overBudget := false
+
+	for event := range sess.Events() {
+		fullOutput.WriteString(event.Raw + "\n")
+		if event.Type == "" {
 			continue
 		}
 
-		// Capture session_id from first event that has it
-		if event.SessionID != "" && capturedSessionID == "" {
-			capturedSessionID = event.SessionID
-		}
-
 		// Format and send to web UI as console output
 		if formatted := FormatStreamEvent(event); formatted != "" {
 			level := logs.LevelInfo
@@ -723,49 +905,95 @@ func spawnClaude(ctx context.Context, project, prompt string, send func(tea.Msg)
 					}
 				}
 			}
+			if !overBudget && meter.observe(event.Message) {
+				overBudget = true
+				send(LogMsg{Entry: logs.LogEntry{
+					Time:    time.Now(),
+					TaskID:  taskID,
+					Project: project,
+					Message: meter.reason(),
+					Level:   logs.LevelWarn,
+					Agent:   agent,
+				}})
+				sess.Cancel()
+			}
+		case "user":
+			if event.Message != nil {
+				for _, c := range event.Message.Content {
+					if c.Type == "tool_result" && c.IsError {
+						toolErrors++
+					}
+				}
+			}
+		case "error":
+			if event.Error != nil {
+				errs = append(errs, event.Error.Message)
+			}
 		case "result":
 			for _, d := range event.PermissionDenials {
 				denials = append(denials, d.ToolName)
 			}
+			subtype = event.Subtype
+			if event.IsError {
+				errs = append(errs, event.Result)
+			}
 		}
 	}
 
-	err = cmd.Wait()
-	exitCode := 0
-	if err != nil {
-		// Detect step timeout (spawnCtx expired but parent ctx still alive)
-		if spawnCtx.Err() != nil && ctx.Err() == nil {
-			send(LogMsg{Entry: logs.LogEntry{
-				Time:    time.Now(),
-				TaskID:  taskID,
-				Project: project,
-				Message: fmt.Sprintf("Step timed out after %d min", cfg.Spawn.StepTimeoutMin),
-				Level:   logs.LevelError,
-				Agent:   agent,
-			}})
-			return spawnResult{ExitCode: 124, Output: fullOutput.String()}, fmt.Errorf("step timeout after %d min", cfg.Spawn.StepTimeoutMin)
-		}
-		var exitErr *exec.ExitError
-		if errors.As(err, &exitErr) {
-			exitCode = exitErr.ExitCode()
-		} else {
-			return spawnResult{ExitCode: -1, Output: fullOutput.String()}, err
+	res, err := sess.Wait()
+	if overBudget {
+		if res.Usage == (metrics.Usage{}) {
+			res.Usage = meter.usage()
 		}
+		return spawnResult{ExitCode: -1, Output: fullOutput.String(), SessionID: res.SessionID, Agent: res, OverBudget: true}, nil
+	}
+	// Detect step timeout (spawnCtx expired but parent ctx still alive)
+	if spawnCtx.Err() != nil && ctx.Err() == nil {
+		send(LogMsg{Entry: logs.LogEntry{
+			Time:    time.Now(),
+			TaskID:  taskID,
+			Project: project,
+			Message: fmt.Sprintf("Step timed out after %d min", cfg.Spawn.StepTimeoutMin),
+			Level:   logs.LevelError,
+			Agent:   agent,
+		}})
+		return spawnResult{ExitCode: 124, Output: fullOutput.String(), Agent: res, Errors: errs, ToolErrors: toolErrors}, fmt.Errorf("step timeout after %d min", cfg.Spawn.StepTimeoutMin)
+	}
+	if err != nil {
+		return spawnResult{ExitCode: -1, Output: fullOutput.String(), Agent: res, Errors: errs}, err
 	}
 
-	if stderrBuf.Len() > 0 {
-		fullOutput.WriteString("\n[stderr] " + stderrBuf.String())
+	if res.Stderr != "" {
+		fullOutput.WriteString("\n[stderr] " + res.Stderr)
 	}
 
 	return spawnResult{
-		ExitCode:  exitCode,
-		Output:    fullOutput.String(),
-		Denials:   denials,
-		ToolsUsed: toolsUsed,
-		SessionID: capturedSessionID,
+		ExitCode:   res.ExitCode,
+		Output:     fullOutput.String(),
+		Denials:    denials,
+		ToolsUsed:  toolsUsed,
+		SessionID:  res.SessionID,
+		Agent:      res,
+		Errors:     errs,
+		ToolErrors: toolErrors,
+		Subtype:    subtype,
 	}, nil
 }
 
+// recordSpawn books a step or recovery spawn against the task. Spawns that
+// never started (no session) are skipped.
+func recordSpawn(kind metrics.SpendKind, task queue.Task, step int, res spawnResult, cfg config.Config) {
+	if res.Agent.SessionID == "" && res.Agent.Duration == 0 {
+		return
+	}
+	RecordSpend(metrics.SpendRecord{
+		Kind:    kind,
+		TaskID:  task.ID,
+		Project: task.Project,
+		Step:    step,
+	}, res.Agent, ResolveModel(cfg.Spawn.Model, "exec"))
+}
+
 func extractResult(rawOutput string) string {
 	for _, line := range strings.Split(rawOutput, "\n") {
 		var event StreamEvent
@@ -1,11 +1,14 @@
 package engine
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	tea "github.com/charmbracelet/bubbletea"
+
 	"github.com/JuanVilla424/teamoon/internal/config"
 	"github.com/JuanVilla424/teamoon/internal/plan"
 	"github.com/JuanVilla424/teamoon/internal/queue"
@@ -131,7 +134,7 @@ func TestBuildStepPrompt_AgentIdentity(t *testing.T) {
 	p := plan.Plan{Steps: []plan.Step{{Number: 1, Title: "Do stuff", Body: "body", Agent: "analyst"}}}
 	step := p.Steps[0]
 
-	prompt := buildStepPrompt(task, p, step, 0, "", "", config.DefaultConfig())
+	prompt := buildStepPrompt(task, workspace{}, p, step, 0, "", "", config.DefaultConfig())
 	if !strings.Contains(prompt, "executing step 1 of 1") {
 		t.Error("prompt should mention step execution")
 	}
@@ -145,7 +148,7 @@ func TestBuildStepPrompt_WithAgent(t *testing.T) {
 	step := plan.Step{Number: 1, Title: "Step", Body: "body", Agent: "architect"}
 	p := plan.Plan{Steps: []plan.Step{step}}
 
-	prompt := buildStepPrompt(task, p, step, 0, "", "", config.DefaultConfig())
+	prompt := buildStepPrompt(task, workspace{}, p, step, 0, "", "", config.DefaultConfig())
 	if !strings.Contains(prompt, "architect agent") {
 		t.Error("prompt should mention agent name")
 	}
@@ -163,7 +166,7 @@ func TestBuildStepPrompt_CLAUDEMDInjection(t *testing.T) {
 
 	// The function reads from ~/Projects/<project>/CLAUDE.md
 	// We can't easily mock HOME, so just verify the mechanism works by checking rules are present
-	prompt := buildStepPrompt(task, p, step, 0, "", "", config.DefaultConfig())
+	prompt := buildStepPrompt(task, workspace{}, p, step, 0, "", "", config.DefaultConfig())
 	if !strings.Contains(prompt, "RULES:") {
 		t.Error("prompt should contain RULES section")
 	}
@@ -174,7 +177,7 @@ func TestBuildStepPrompt_RetryContext(t *testing.T) {
 	step := plan.Step{Number: 1, Title: "Step", Body: "body"}
 	p := plan.Plan{Steps: []plan.Step{step}}
 
-	prompt := buildStepPrompt(task, p, step, 1, "Previous error: something broke", "", config.DefaultConfig())
+	prompt := buildStepPrompt(task, workspace{}, p, step, 1, "Previous error: something broke", "", config.DefaultConfig())
 	if !strings.Contains(prompt, "Previous attempt context") {
 		t.Error("prompt should include recovery context on retry")
 	}
@@ -188,7 +191,7 @@ func TestBuildStepPrompt_AllRules(t *testing.T) {
 	step := plan.Step{Number: 1, Title: "Step", Body: "body"}
 	p := plan.Plan{Steps: []plan.Step{step}}
 
-	prompt := buildStepPrompt(task, p, step, 0, "", "", config.DefaultConfig())
+	prompt := buildStepPrompt(task, workspace{}, p, step, 0, "", "", config.DefaultConfig())
 	expectedRules := []string{
 		"create, edit or modify source code",
 		"FULL permissions",
@@ -206,7 +209,7 @@ func TestBuildStepPrompt_AllRules(t *testing.T) {
 
 	// ReadOnly step should have different rules
 	roStep := plan.Step{Number: 1, Title: "Step", Body: "body", ReadOnly: true}
-	roPrompt := buildStepPrompt(task, p, roStep, 0, "", "", config.DefaultConfig())
+	roPrompt := buildStepPrompt(task, workspace{}, p, roStep, 0, "", "", config.DefaultConfig())
 	roExpected := []string{
 		"READ-ONLY step",
 		"Summarize your findings",
@@ -227,7 +230,7 @@ func TestBuildStepPrompt_PrevSteps(t *testing.T) {
 	step := plan.Step{Number: 2, Title: "Step 2", Body: "body"}
 	p := plan.Plan{Steps: []plan.Step{{Number: 1, Title: "Step 1"}, step}}
 
-	prompt := buildStepPrompt(task, p, step, 0, "", "Step 1: did things", config.DefaultConfig())
+	prompt := buildStepPrompt(task, workspace{}, p, step, 0, "", "Step 1: did things", config.DefaultConfig())
 	if !strings.Contains(prompt, "Previous steps completed") {
 		t.Error("prompt should include previous steps section")
 	}
@@ -241,7 +244,7 @@ func TestBuildRecoveryPrompt_Truncation(t *testing.T) {
 	step := plan.Step{Number: 1, Title: "Apply fix"}
 
 	longOutput := strings.Repeat("x", 2000)
-	prompt := buildRecoveryPrompt(task, step, longOutput, 1, config.DefaultConfig())
+	prompt := buildRecoveryPrompt(task, workspace{}, step, longOutput, 1, config.DefaultConfig())
 
 	// After truncation, the output section should only have last 1000 chars of 'x'
 	// The full prompt includes template text + 1000 x's, so total x count should be 1000
@@ -267,7 +270,7 @@ func TestBuildRecoveryPrompt_ShortOutput(t *testing.T) {
 	task := queue.Task{ID: 1, Project: "test", Description: "test"}
 	step := plan.Step{Number: 1, Title: "Test step"}
 
-	prompt := buildRecoveryPrompt(task, step, "short error", 2, config.DefaultConfig())
+	prompt := buildRecoveryPrompt(task, workspace{}, step, "short error", 2, config.DefaultConfig())
 	if !strings.Contains(prompt, "short error") {
 		t.Error("short output should be included verbatim")
 	}
@@ -345,7 +348,7 @@ func TestBuildStepPrompt_ReadOnlyRules(t *testing.T) {
 	step := plan.Step{Number: 1, Title: "Investigate", Body: "Read files", ReadOnly: true}
 	p := plan.Plan{Steps: []plan.Step{step}}
 
-	prompt := buildStepPrompt(task, p, step, 0, "", "", config.DefaultConfig())
+	prompt := buildStepPrompt(task, workspace{}, p, step, 0, "", "", config.DefaultConfig())
 	if !strings.Contains(prompt, "READ-ONLY step") {
 		t.Error("ReadOnly step prompt should contain READ-ONLY instruction")
 	}
@@ -359,7 +362,7 @@ func TestBuildStepPrompt_NonReadOnlyRules(t *testing.T) {
 	step := plan.Step{Number: 1, Title: "Implement", Body: "Write code", ReadOnly: false}
 	p := plan.Plan{Steps: []plan.Step{step}}
 
-	prompt := buildStepPrompt(task, p, step, 0, "", "", config.DefaultConfig())
+	prompt := buildStepPrompt(task, workspace{}, p, step, 0, "", "", config.DefaultConfig())
 	if strings.Contains(prompt, "READ-ONLY step") {
 		t.Error("Non-ReadOnly step should NOT contain READ-ONLY instruction")
 	}
@@ -442,3 +445,51 @@ func containsArgValue(args []string, flag, value string) bool {
 	}
 	return false
 }
+
+func TestRunTask_RecordsStepEvents(t *testing.T) {
+	cfg := initTestRepo(t)
+	os.MkdirAll(config.ConfigDir(), 0755)
+	cfg.Worktrees.Enabled = false
+	cfg.Spawn.Runtime = RuntimeFake
+	fail := FakeTurn{ExitCode: 1, Events: []StreamEvent{FakeResult("boom")}}
+	recovery := FakeTurn{Events: []StreamEvent{FakeResult("try again")}}
+	RegisterRuntime(NewFakeRuntime(writeTurn("one"), fail, recovery, fail, recovery, fail))
+
+	task, err := queue.Add("proj", "build the thing", "med")
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.SetPlanFile(task.ID, "plan.md")
+	queue.UpdateState(task.ID, queue.StateRunning)
+	runTask(context.Background(), task, twoStepPlan(), cfg, func(tea.Msg) {})
+
+	events, _ := queue.LoadEvents(task.ID)
+	var got []string
+	for _, e := range events {
+		if e.Step > 0 {
+			got = append(got, queue.DescribeEvent(e))
+		}
+	}
+	want := []string{
+		"step 1 started: " + twoStepPlan().Steps[0].Title,
+		"step 1 done",
+		"step 2 started: " + twoStepPlan().Steps[1].Title,
+		"step 2 attempt 2: gave_up",
+		"step 2 attempt 3: gave_up",
+	}
+	if len(got) != len(want)+1 {
+		t.Fatalf("step events = %q", got)
+	}
+	for i, w := range want {
+		if got[i] != w {
+			t.Errorf("event %d = %q, want %q", i, got[i], w)
+		}
+	}
+	if !strings.HasPrefix(got[len(want)], "step 2 failed: ") {
+		t.Errorf("last step event = %q", got[len(want)])
+	}
+	last := events[len(events)-1]
+	if last.Kind != queue.EventState || last.To != queue.StateFailed {
+		t.Errorf("last event = %+v, want move to failed", last)
+	}
+}
@@ -2,6 +2,7 @@ package engine
 
 import (
 	"fmt"
+	"log"
 	"sync"
 	"time"
 
@@ -18,6 +19,9 @@ type guardrailSnapshot struct {
 var (
 	grMu    sync.Mutex
 	grCache guardrailSnapshot
+	// grWarned is set while usage is unknown so the warning is logged once
+	// per outage rather than on every check.
+	grWarned bool
 )
 
 func refreshCache() guardrailSnapshot {
@@ -32,14 +36,24 @@ func refreshCache() guardrailSnapshot {
 		usage:   metrics.GetUsage(),
 		fetched: time.Now(),
 	}
+	if !grCache.usage.Known && !grWarned {
+		log.Printf("[guardrails] WARNING: Claude usage unknown (provider has no recent reading); usage guardrails are not enforced")
+	} else if grCache.usage.Known && grWarned {
+		log.Printf("[guardrails] Claude usage available again from %s", grCache.usage.Source)
+	}
+	grWarned = !grCache.usage.Known
 	return grCache
 }
 
 // CheckGuardrails returns a non-empty reason string if the engine should pause.
 // Thresholds are driven by Claude's own usage percentages (session + weekly).
-// Returns "" if it's safe to proceed.
+// Returns "" if it's safe to proceed. Unknown usage does not pause the engine;
+// it is logged instead of being read as 0%.
 func CheckGuardrails() string {
 	snap := refreshCache()
+	if !snap.usage.Known {
+		return ""
+	}
 
 	if snap.usage.WeekAll.Utilization >= 90 {
 		return fmt.Sprintf("Claude weekly usage at %.0f%% — pausing", snap.usage.WeekAll.Utilization)
@@ -6,7 +6,6 @@ import (
 	"log"
 	"os/exec"
 	"path/filepath"
-	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -17,6 +16,7 @@ import (
 	"github.com/JuanVilla424/teamoon/internal/logs"
 	"github.com/JuanVilla424/teamoon/internal/plan"
 	"github.com/JuanVilla424/teamoon/internal/queue"
+	"github.com/JuanVilla424/teamoon/internal/webhook"
 )
 
 // PlanFunc generates a plan for a task synchronously.
@@ -66,36 +66,6 @@ func firstEligibleTask(tasks []queue.Task, maxAttempts int, emit func(logs.LogLe
 	return nil
 }
 
-// groupByWave groups tasks by wave number. Wave 0 tasks are treated as sequential (each in its own group).
-func groupByWave(tasks []queue.Task) [][]queue.Task {
-	waveMap := make(map[int][]queue.Task)
-	var seqTasks []queue.Task
-	for _, t := range tasks {
-		if t.Wave == 0 {
-			seqTasks = append(seqTasks, t)
-		} else {
-			waveMap[t.Wave] = append(waveMap[t.Wave], t)
-		}
-	}
-
-	// Collect wave numbers and sort
-	var waveNums []int
-	for w := range waveMap {
-		waveNums = append(waveNums, w)
-	}
-	sort.Ints(waveNums)
-
-	var groups [][]queue.Task
-	for _, w := range waveNums {
-		groups = append(groups, waveMap[w])
-	}
-	// Sequential tasks go at the end, one per group
-	for _, t := range seqTasks {
-		groups = append(groups, []queue.Task{t})
-	}
-	return groups
-}
-
 // planOneTask plans a single task. Returns the plan or an error.
 func planOneTask(ctx context.Context, task queue.Task, cfg config.Config, planFn PlanFunc, send func(tea.Msg), emit func(logs.LogLevel, string)) (plan.Plan, bool) {
 	maxAttempts := effectiveMaxPlanAttempts(cfg)
@@ -116,7 +86,8 @@ func planOneTask(ctx context.Context, task queue.Task, cfg config.Config, planFn
 
 	emit(logs.LevelInfo, fmt.Sprintf("Planning task #%d (attempt %d/%d): %s",
 		task.ID, task.PlanAttempts+1, maxAttempts, task.Description))
-	send(TaskStateMsg{TaskID: task.ID, State: queue.StatePending, Message: "planning"})
+	queue.UpdateState(task.ID, queue.StatePlanning)
+	send(TaskStateMsg{TaskID: task.ID, State: queue.StatePlanning, Message: "planning"})
 	planLogFn := func(toolName string) {
 		send(LogMsg{Entry: logs.LogEntry{
 			Time:    time.Now(),
@@ -128,11 +99,9 @@ func planOneTask(ctx context.Context, task queue.Task, cfg config.Config, planFn
 	}
 	p, planErr := planFn(task, skeleton, planLogFn)
 	if planErr != nil {
-		attempts, _ := queue.IncrementPlanAttempts(task.ID)
-		reason := fmt.Sprintf("plan generation failed (attempt %d/%d): %v", attempts, maxAttempts, planErr)
 		emit(logs.LevelError, fmt.Sprintf("Plan failed for task #%d: %v", task.ID, planErr))
-		queue.SetFailReason(task.ID, reason)
-		send(TaskStateMsg{TaskID: task.ID, State: queue.StatePending, Message: "plan_failed"})
+		state := failPlanning(task.ID, maxAttempts, planErr)
+		send(TaskStateMsg{TaskID: task.ID, State: state, Message: "plan_failed"})
 		return plan.Plan{}, false
 	}
 	emit(logs.LevelSuccess, fmt.Sprintf("Plan ready for task #%d", task.ID))
@@ -140,9 +109,26 @@ func planOneTask(ctx context.Context, task queue.Task, cfg config.Config, planFn
 	return p, true
 }
 
-// RunProjectLoop processes autopilot-eligible tasks for a project with wave-aware execution.
-// Tasks with the same wave number run in parallel. Different waves run sequentially.
-// Tasks with wave=0 (legacy) run sequentially after all waved tasks.
+// failPlanning records a failed plan generation. The task goes back to
+// pending for another attempt, or fails once maxAttempts are used up. It
+// returns the task's new state.
+func failPlanning(taskID, maxAttempts int, planErr error) queue.TaskState {
+	attempts, _ := queue.IncrementPlanAttempts(taskID)
+	reason := fmt.Sprintf("plan generation failed (attempt %d/%d): %v", attempts, maxAttempts, planErr)
+	if attempts >= maxAttempts {
+		queue.Fail(taskID, reason)
+		return queue.StateFailed
+	}
+	queue.SetFailReason(taskID, reason)
+	return queue.StatePending
+}
+
+// RunProjectLoop processes autopilot-eligible tasks for a project as a dependency graph.
+// Any task whose predecessors are done is planned and run; independent tasks run in
+// parallel up to cfg.MaxConcurrent. Dependents of a failed predecessor are moved to
+// blocked with a "blocked by #N" reason until it recovers; tasks over a spend cap are held
+// with the budget reason and not launched. Plans awaiting approval keep the
+// loop polling without blocking other tasks.
 func RunProjectLoop(ctx context.Context, project string, cfg config.Config, planFn PlanFunc, send func(tea.Msg), mgr *Manager) {
 	emit := func(level logs.LogLevel, msg string) {
 		send(LogMsg{Entry: logs.LogEntry{
@@ -155,6 +141,21 @@ func RunProjectLoop(ctx context.Context, project string, cfg config.Config, plan
 
 	emit(logs.LevelInfo, fmt.Sprintf("Project autopilot started for %s", project))
 
+	limit := cfg.MaxConcurrent
+	if limit <= 0 {
+		limit = 3
+	}
+	maxAttempts := effectiveMaxPlanAttempts(cfg)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	inFlight := make(map[int]queue.Task)
+	finished := make(chan int, limit)
+	exhausted := make(map[int]bool)
+	// pausedBy is the guardrail reason last recorded, so a long pause is
+	// logged on the held task once rather than every two minutes.
+	pausedBy := ""
+
 	for {
 		if ctx.Err() != nil {
 			emit(logs.LevelWarn, fmt.Sprintf("Project autopilot stopped for %s", project))
@@ -166,152 +167,196 @@ func RunProjectLoop(ctx context.Context, project string, cfg config.Config, plan
 			emit(logs.LevelError, fmt.Sprintf("Failed to list tasks: %v", err))
 			return
 		}
-		if len(tasks) == 0 {
+		if len(tasks) == 0 && len(inFlight) == 0 {
 			emit(logs.LevelSuccess, fmt.Sprintf("No more autopilot tasks for %s", project))
 			stabilizeProject(project, cfg.ProjectsDir, emit)
 			return
 		}
 
-		maxAttempts := effectiveMaxPlanAttempts(cfg)
-
-		// Filter eligible tasks
-		var eligible []queue.Task
-		for _, t := range tasks {
-			state := queue.EffectiveState(t)
-			if state == queue.StatePending && t.PlanAttempts >= maxAttempts {
-				emit(logs.LevelWarn, fmt.Sprintf(
-					"Task #%d exhausted plan attempts (%d/%d), skipping",
-					t.ID, t.PlanAttempts, maxAttempts,
-				))
-				continue
-			}
-			eligible = append(eligible, t)
-		}
-		if len(eligible) == 0 {
-			emit(logs.LevelSuccess, fmt.Sprintf("No more eligible autopilot tasks for %s", project))
-			return
+		// Peers for legacy wave ordering: everything queued or in flight.
+		peers := append([]queue.Task(nil), tasks...)
+		for _, t := range inFlight {
+			peers = append(peers, t)
 		}
-
-		// Group by wave and process wave by wave
-		waves := groupByWave(eligible)
-		if len(waves) == 0 {
-			return
+		known := make(map[int]queue.Task, len(peers))
+		for _, t := range peers {
+			known[t.ID] = t
 		}
-
-		// Process only the first wave group, then re-scan
-		wave := waves[0]
-
-		for reason := CheckGuardrails(); reason != ""; reason = CheckGuardrails() {
-			emit(logs.LevelWarn, fmt.Sprintf("Guardrail: %s, waiting 2m...", reason))
-			select {
-			case <-ctx.Done():
-				emit(logs.LevelWarn, fmt.Sprintf("Project autopilot stopped for %s", project))
-				return
-			case <-time.After(2 * time.Minute):
+		lookup := func(id int) (queue.Task, bool) {
+			if t, ok := known[id]; ok {
+				return t, true
+			}
+			t, err := queue.GetTask(id)
+			if err != nil {
+				return queue.Task{}, false
 			}
+			known[id] = t
+			return t, true
 		}
 
-		if len(wave) == 1 {
-			// Single task — same sequential behavior as before
-			task := wave[0]
-			if cfg.Debug {
-				log.Printf("[debug][autopilot] selected task #%d (wave %d) state=%s", task.ID, task.Wave, queue.EffectiveState(task))
+		launched, activeWait := 0, false
+		guardrail, heldID := "", 0
+		for _, task := range tasks {
+			if _, busy := inFlight[task.ID]; busy {
+				continue
 			}
-
 			state := queue.EffectiveState(task)
-			if state == queue.StatePending {
-				p, ok := planOneTask(ctx, task, cfg, planFn, send, emit)
-				if !ok {
-					if ctx.Err() != nil {
-						return
-					}
-					continue
+			if state == queue.StateAwaitingApproval {
+				// Stay alive so the task runs once a reviewer approves it.
+				activeWait = true
+				continue
+			}
+			if state == queue.StatePending && task.PlanAttempts >= maxAttempts {
+				if !exhausted[task.ID] {
+					exhausted[task.ID] = true
+					emit(logs.LevelWarn, fmt.Sprintf(
+						"Task #%d exhausted plan attempts (%d/%d), skipping",
+						task.ID, task.PlanAttempts, maxAttempts,
+					))
 				}
-				select {
-				case <-ctx.Done():
-					return
-				case <-time.After(2 * time.Second):
+				continue
+			}
+
+			status, blocker, active := resolveDeps(task, peers, lookup)
+			if status == depsBlocked {
+				if reason := blockedReason(blocker); state != queue.StateBlocked || task.HeldReason != reason {
+					if _, err := queue.Block(task.ID, reason); err == nil {
+						emit(logs.LevelWarn, fmt.Sprintf("Task #%d %s", task.ID, reason))
+						send(TaskStateMsg{TaskID: task.ID, State: queue.StateBlocked, Message: reason})
+					}
 				}
-				runOneTask(ctx, task, p, cfg, send, mgr, emit)
-			} else if state == queue.StatePlanned {
-				p, parseErr := plan.ParsePlan(plan.PlanPath(task.ID))
-				if parseErr != nil {
-					emit(logs.LevelError, fmt.Sprintf("Plan parse failed for task #%d: %v", task.ID, parseErr))
-					queue.SetFailReason(task.ID, "plan parse failed: "+parseErr.Error())
+				continue
+			}
+			if state == queue.StateBlocked {
+				t, err := queue.Unblock(task.ID)
+				if err != nil {
 					continue
 				}
-				runOneTask(ctx, task, p, cfg, send, mgr, emit)
-			}
-		} else {
-			// Multi-task wave — plan sequentially, then run in parallel
-			waveNum := wave[0].Wave
-			var taskIDs []int
-			for _, t := range wave {
-				taskIDs = append(taskIDs, t.ID)
+				task, state = t, queue.EffectiveState(t)
+				emit(logs.LevelInfo, fmt.Sprintf("Task #%d unblocked", task.ID))
+				send(TaskStateMsg{TaskID: task.ID, State: state})
 			}
-			emit(logs.LevelInfo, fmt.Sprintf("Wave %d: %d tasks %v — planning sequentially", waveNum, len(wave), taskIDs))
-
-			type taskPlan struct {
-				task queue.Task
-				plan plan.Plan
+			held := ""
+			breach, overBudget := budgetBreach{}, false
+			if status == depsReady {
+				if breach, overBudget = checkBudget(cfg, task); overBudget {
+					held = breach.Reason
+				}
 			}
-			var planned []taskPlan
-
-			for _, task := range wave {
-				if ctx.Err() != nil {
-					return
+			if held != task.HeldReason {
+				queue.SetHeldReason(task.ID, held)
+				if held != "" {
+					emit(logs.LevelWarn, fmt.Sprintf("Task #%d held: %s", task.ID, held))
 				}
-				state := queue.EffectiveState(task)
-				if state == queue.StatePending {
-					p, ok := planOneTask(ctx, task, cfg, planFn, send, emit)
-					if !ok {
-						continue // skip failed plans, run the rest
-					}
-					planned = append(planned, taskPlan{task: task, plan: p})
-				} else if state == queue.StatePlanned {
-					p, parseErr := plan.ParsePlan(plan.PlanPath(task.ID))
-					if parseErr != nil {
-						emit(logs.LevelError, fmt.Sprintf("Plan parse failed for task #%d: %v", task.ID, parseErr))
-						queue.SetFailReason(task.ID, "plan parse failed: "+parseErr.Error())
-						continue
-					}
-					planned = append(planned, taskPlan{task: task, plan: p})
+				if overBudget {
+					notifyBudget(task, breach)
 				}
+				send(TaskStateMsg{TaskID: task.ID, State: state, Message: held})
 			}
-
-			if len(planned) == 0 {
-				emit(logs.LevelWarn, fmt.Sprintf("Wave %d: no tasks planned successfully, skipping", waveNum))
+			if status != depsReady {
+				activeWait = activeWait || active
 				continue
 			}
+			if overBudget {
+				continue
+			}
+			if len(inFlight) >= limit {
+				activeWait = true
+				break
+			}
+			if guardrail == "" {
+				guardrail = CheckGuardrails()
+			}
+			if guardrail != "" {
+				heldID = task.ID
+				break
+			}
 
-			emit(logs.LevelInfo, fmt.Sprintf("Wave %d: running %d tasks in parallel", waveNum, len(planned)))
-
-			var wg sync.WaitGroup
-			for _, tp := range planned {
-				wg.Add(1)
-				go func(t queue.Task, p plan.Plan) {
-					defer wg.Done()
+			if cfg.Debug {
+				log.Printf("[debug][autopilot] selected task #%d state=%s deps=%v", task.ID, state, predecessors(task, peers))
+			}
+			inFlight[task.ID] = task
+			launched++
+			wg.Add(1)
+			go func(t queue.Task) {
+				defer wg.Done()
+				defer func() {
 					select {
+					case finished <- t.ID:
 					case <-ctx.Done():
-						return
-					case <-time.After(2 * time.Second):
 					}
-					runOneTask(ctx, t, p, cfg, send, mgr, emit)
-				}(tp.task, tp.plan)
-			}
-			wg.Wait()
+				}()
+				planAndRun(ctx, t, cfg, planFn, send, mgr, emit)
+			}(task)
+		}
 
-			emit(logs.LevelSuccess, fmt.Sprintf("Wave %d completed (%d tasks)", waveNum, len(planned)))
+		wait := 2 * time.Second
+		if guardrail != "" && guardrail != pausedBy {
+			queue.Record(heldID, queue.Event{Kind: queue.EventGuardrail, Actor: queue.ActorAutopilot, Reason: guardrail})
+			webhook.Publish(webhook.EventGuardrailPaused, map[string]any{"project": project, "reason": guardrail})
+		}
+		pausedBy = guardrail
+		if guardrail != "" {
+			emit(logs.LevelWarn, fmt.Sprintf("Guardrail: %s, waiting 2m...", guardrail))
+			wait = 2 * time.Minute
+		} else if launched == 0 && len(inFlight) == 0 && !activeWait {
+			emit(logs.LevelSuccess, fmt.Sprintf("No more eligible autopilot tasks for %s", project))
+			return
 		}
 
-		// Small delay between waves/tasks
 		select {
 		case <-ctx.Done():
 			emit(logs.LevelWarn, fmt.Sprintf("Project autopilot stopped for %s", project))
 			return
+		case id := <-finished:
+			delete(inFlight, id)
+		case <-time.After(wait):
+		}
+		// Drain any other completions that arrived meanwhile.
+		for drained := false; !drained; {
+			select {
+			case id := <-finished:
+				delete(inFlight, id)
+			default:
+				drained = true
+			}
+		}
+	}
+}
+
+// planAndRun plans a pending task (or loads the plan of a planned one) and runs it.
+func planAndRun(ctx context.Context, task queue.Task, cfg config.Config, planFn PlanFunc, send func(tea.Msg), mgr *Manager, emit func(logs.LogLevel, string)) {
+	var p plan.Plan
+	switch queue.EffectiveState(task) {
+	case queue.StatePending:
+		var ok bool
+		p, ok = planOneTask(ctx, task, cfg, planFn, send, emit)
+		if !ok {
+			return
+		}
+		if holdForApproval(cfg, task, send, emit) {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
 		case <-time.After(2 * time.Second):
 		}
+	case queue.StatePlanned:
+		var parseErr error
+		p, parseErr = plan.ParsePlan(plan.PlanPath(task.ID))
+		if parseErr != nil {
+			emit(logs.LevelError, fmt.Sprintf("Plan parse failed for task #%d: %v", task.ID, parseErr))
+			queue.Fail(task.ID, "plan parse failed: "+parseErr.Error())
+			return
+		}
+	default:
+		return
+	}
+	if ctx.Err() != nil {
+		return
 	}
+	runOneTask(ctx, task, p, cfg, send, mgr, emit)
 }
 
 // RunSystemLoop processes system-assignee tasks sequentially.
@@ -352,7 +397,11 @@ func RunSystemLoop(ctx context.Context, cfg config.Config, planFn PlanFunc, send
 		task := *taskPtr
 		state := queue.EffectiveState(task)
 
-		for reason := CheckGuardrails(); reason != ""; reason = CheckGuardrails() {
+		for reason, paused := CheckGuardrails(), ""; reason != ""; reason = CheckGuardrails() {
+			if reason != paused {
+				queue.Record(task.ID, queue.Event{Kind: queue.EventGuardrail, Actor: queue.ActorAutopilot, Reason: reason})
+				paused = reason
+			}
 			emit(logs.LevelWarn, fmt.Sprintf("Guardrail: %s, waiting 2m...", reason))
 			select {
 			case <-ctx.Done():
@@ -382,7 +431,8 @@ func RunSystemLoop(ctx context.Context, cfg config.Config, planFn PlanFunc, send
 
 			emit(logs.LevelInfo, fmt.Sprintf("Planning system task #%d (attempt %d/%d): %s",
 				task.ID, task.PlanAttempts+1, maxAttempts, task.Description))
-			send(TaskStateMsg{TaskID: task.ID, State: queue.StatePending, Message: "planning"})
+			queue.UpdateState(task.ID, queue.StatePlanning)
+			send(TaskStateMsg{TaskID: task.ID, State: queue.StatePlanning, Message: "planning"})
 			sysLogFn := func(toolName string) {
 				send(LogMsg{Entry: logs.LogEntry{
 					Time:    time.Now(),
@@ -394,15 +444,16 @@ func RunSystemLoop(ctx context.Context, cfg config.Config, planFn PlanFunc, send
 			}
 			p, planErr := planFn(task, skeleton, sysLogFn)
 			if planErr != nil {
-				attempts, _ := queue.IncrementPlanAttempts(task.ID)
-				reason := fmt.Sprintf("plan generation failed (attempt %d/%d): %v", attempts, maxAttempts, planErr)
 				emit(logs.LevelError, fmt.Sprintf("Plan failed for system task #%d: %v", task.ID, planErr))
-				queue.SetFailReason(task.ID, reason)
-				send(TaskStateMsg{TaskID: task.ID, State: queue.StatePending, Message: "plan_failed"})
+				state := failPlanning(task.ID, maxAttempts, planErr)
+				send(TaskStateMsg{TaskID: task.ID, State: state, Message: "plan_failed"})
 				continue
 			}
 			emit(logs.LevelSuccess, fmt.Sprintf("Plan ready for system task #%d", task.ID))
 			send(TaskStateMsg{TaskID: task.ID, State: queue.StatePlanned})
+			if holdForApproval(cfg, task, send, emit) {
+				continue
+			}
 			select {
 			case <-ctx.Done():
 				return
@@ -413,7 +464,7 @@ func RunSystemLoop(ctx context.Context, cfg config.Config, planFn PlanFunc, send
 			p, parseErr := plan.ParsePlan(plan.PlanPath(task.ID))
 			if parseErr != nil {
 				emit(logs.LevelError, fmt.Sprintf("Plan parse failed for system task #%d: %v", task.ID, parseErr))
-				queue.SetFailReason(task.ID, "plan parse failed: "+parseErr.Error())
+				queue.Fail(task.ID, "plan parse failed: "+parseErr.Error())
 				continue
 			}
 			runOneTask(ctx, task, p, cfg, send, mgr, emit)
@@ -428,6 +479,15 @@ func RunSystemLoop(ctx context.Context, cfg config.Config, planFn PlanFunc, send
 	}
 }
 
+// taskSettled reports whether a run that reports state has ended.
+func taskSettled(state queue.TaskState) bool {
+	switch state {
+	case queue.StateDone, queue.StatePending, queue.StateFailed, queue.StateInReview:
+		return true
+	}
+	return false
+}
+
 // runOneTask starts a single task via the engine manager and waits for completion or cancellation.
 func runOneTask(ctx context.Context, task queue.Task, p plan.Plan, cfg config.Config, send func(tea.Msg), mgr *Manager, emit func(logs.LogLevel, string)) {
 	// Acquire concurrency slot (blocks if max concurrent reached)
@@ -440,7 +500,7 @@ func runOneTask(ctx context.Context, task queue.Task, p plan.Plan, cfg config.Co
 	wrappedSend := func(msg tea.Msg) {
 		send(msg)
 		if tsm, ok := msg.(TaskStateMsg); ok {
-			if tsm.TaskID == task.ID && (tsm.State == queue.StateDone || tsm.State == queue.StatePending) {
+			if tsm.TaskID == task.ID && taskSettled(tsm.State) {
 				select {
 				case taskDone <- struct{}{}:
 				default:
@@ -457,7 +517,7 @@ func runOneTask(ctx context.Context, task queue.Task, p plan.Plan, cfg config.Co
 	case <-ctx.Done():
 		return // loop exits; task keeps running on its own
 	case <-taskDone:
-		// Task finished (done or back to pending), continue loop
+		// Task finished (done, failed, in review or back to pending), continue loop
 	}
 }
 
@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+)
+
+// maxRateLimitWait caps how long a step sleeps for a single rate-limit reset.
+const maxRateLimitWait = 6 * time.Hour
+
+var rateLimitMarkers = []string{
+	"rate limit", "rate_limit", "ratelimit", "usage limit", "hour limit reached",
+	"overloaded", "too many requests", "api error: 429", "api error: 529",
+}
+
+var (
+	// "Claude AI usage limit reached|1760536800"
+	resetEpochRe = regexp.MustCompile(`limit reached\|(\d{10})`)
+	// "5-hour limit reached ∙ resets 3pm", "resets at 10:30am"
+	resetClockRe = regexp.MustCompile(`resets (?:at )?(\d{1,2})(?::(\d{2}))?\s*(am|pm)`)
+)
+
+// classifyFailure sorts a failed step spawn into one of the config.Failure*
+// classes, from its error events, stderr, exit code and tool results.
+func classifyFailure(res spawnResult, checksFailed bool) string {
+	text := strings.ToLower(failureText(res))
+	for _, m := range rateLimitMarkers {
+		if strings.Contains(text, m) {
+			return config.FailureRateLimit
+		}
+	}
+	switch {
+	case res.ExitCode == 124:
+		return config.FailureTimeout
+	case len(res.Denials) > 0:
+		return config.FailureDenied
+	case checksFailed:
+		return config.FailureToolError
+	case res.Subtype == "error_max_turns":
+		return config.FailureGaveUp
+	case res.ToolErrors > 0:
+		return config.FailureToolError
+	}
+	return config.FailureGaveUp
+}
+
+// failureText is the error output a spawn reported, without the transcript.
+func failureText(res spawnResult) string {
+	return strings.Join(append(append([]string(nil), res.Errors...), res.Agent.Stderr), "\n")
+}
+
+// rateLimitReset finds the reset time announced in a rate-limit message.
+func rateLimitReset(text string, now time.Time) (time.Time, bool) {
+	text = strings.ToLower(text)
+	if m := resetEpochRe.FindStringSubmatch(text); m != nil {
+		sec, _ := strconv.ParseInt(m[1], 10, 64)
+		return time.Unix(sec, 0), true
+	}
+	if m := resetClockRe.FindStringSubmatch(text); m != nil {
+		hour, _ := strconv.Atoi(m[1])
+		min, _ := strconv.Atoi(m[2])
+		if hour > 12 || min > 59 {
+			return time.Time{}, false
+		}
+		hour %= 12
+		if m[3] == "pm" {
+			hour += 12
+		}
+		reset := time.Date(now.Year(), now.Month(), now.Day(), hour, min, 0, 0, now.Location())
+		if !reset.After(now) {
+			reset = reset.Add(24 * time.Hour)
+		}
+		return reset, true
+	}
+	return time.Time{}, false
+}
+
+// retryDelay is how long to wait before retry n (1-based) of a failure of
+// class. Rate limits wait for the announced reset when there is one.
+func retryDelay(p config.RetryPolicy, class string, res spawnResult, n int, now time.Time) time.Duration {
+	backoff := time.Duration(p.BackoffSec) * time.Second
+	if class == config.FailureRateLimit {
+		if reset, ok := rateLimitReset(failureText(res), now); ok {
+			d := reset.Sub(now) + 30*time.Second
+			if d < 0 {
+				d = 0
+			}
+			if d > maxRateLimitWait {
+				d = maxRateLimitWait
+			}
+			return d
+		}
+		return backoff
+	}
+	for i := 1; i < n && backoff > 0 && backoff < time.Hour; i++ {
+		backoff *= 2
+	}
+	return backoff
+}
+
+// retryWait sleeps for d and reports false if ctx ended first. Tests replace it.
+var retryWait = func(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
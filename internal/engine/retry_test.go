@@ -0,0 +1,137 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/queue"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	cases := []struct {
+		name   string
+		res    spawnResult
+		checks bool
+		want   string
+	}{
+		{"usage limit", spawnResult{ExitCode: 1, Errors: []string{"Claude AI usage limit reached|1760536800"}}, false, config.FailureRateLimit},
+		{"overloaded stderr", spawnResult{ExitCode: 1, Agent: AgentResult{Stderr: "API Error: 529 Overloaded"}}, false, config.FailureRateLimit},
+		{"timeout", spawnResult{ExitCode: 124}, false, config.FailureTimeout},
+		{"denied", spawnResult{Denials: []string{"Bash"}}, false, config.FailureDenied},
+		{"checks", spawnResult{}, true, config.FailureToolError},
+		{"max turns", spawnResult{ExitCode: 1, Subtype: "error_max_turns", ToolErrors: 2}, false, config.FailureGaveUp},
+		{"tool errors", spawnResult{ExitCode: 1, ToolErrors: 1}, false, config.FailureToolError},
+		{"other", spawnResult{ExitCode: 1}, false, config.FailureGaveUp},
+	}
+	for _, c := range cases {
+		if got := classifyFailure(c.res, c.checks); got != c.want {
+			t.Errorf("%s: got %s, want %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestRateLimitReset(t *testing.T) {
+	now := time.Date(2026, 3, 1, 14, 0, 0, 0, time.UTC)
+	if got, ok := rateLimitReset("Claude AI usage limit reached|1772377200", now); !ok || got.Unix() != 1772377200 {
+		t.Errorf("epoch reset = %v %v", got, ok)
+	}
+	if got, ok := rateLimitReset("5-hour limit reached ∙ resets 3pm", now); !ok || !got.Equal(now.Add(time.Hour)) {
+		t.Errorf("clock reset = %v %v", got, ok)
+	}
+	if got, ok := rateLimitReset("resets at 10:30am", now); !ok || !got.Equal(time.Date(2026, 3, 2, 10, 30, 0, 0, time.UTC)) {
+		t.Errorf("reset tomorrow = %v %v", got, ok)
+	}
+	if _, ok := rateLimitReset("overloaded", now); ok {
+		t.Error("expected no reset time")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	now := time.Date(2026, 3, 1, 14, 0, 0, 0, time.UTC)
+	p := config.RetryPolicy{MaxAttempts: 3, BackoffSec: 10}
+	if got := retryDelay(p, config.FailureGaveUp, spawnResult{}, 1, now); got != 10*time.Second {
+		t.Errorf("first backoff = %s", got)
+	}
+	if got := retryDelay(p, config.FailureGaveUp, spawnResult{}, 3, now); got != 40*time.Second {
+		t.Errorf("third backoff = %s", got)
+	}
+	limited := spawnResult{Errors: []string{"limit reached ∙ resets 3pm"}}
+	if got := retryDelay(p, config.FailureRateLimit, limited, 1, now); got != time.Hour+30*time.Second {
+		t.Errorf("rate-limit wait = %s", got)
+	}
+	far := spawnResult{Errors: []string{fmt.Sprintf("usage limit reached|%d", now.Add(48*time.Hour).Unix())}}
+	if got := retryDelay(p, config.FailureRateLimit, far, 1, now); got != maxRateLimitWait {
+		t.Errorf("capped wait = %s", got)
+	}
+	if got := retryDelay(p, config.FailureRateLimit, spawnResult{}, 1, now); got != 10*time.Second {
+		t.Errorf("wait without reset = %s", got)
+	}
+}
+
+func TestRunTask_WaitsOutRateLimit(t *testing.T) {
+	limited := FakeResult("Claude AI usage limit reached|1772377200")
+	limited.IsError = true
+	fake := NewFakeRuntime(
+		FakeTurn{ExitCode: 1, Events: []StreamEvent{limited}},
+		writeTurn("created a.txt"),
+		writeTurn("edited a.txt"),
+	)
+	cfg, task := fakeTaskEnv(t, fake)
+
+	var waits []time.Duration
+	orig := retryWait
+	retryWait = func(_ context.Context, d time.Duration) bool {
+		waits = append(waits, d)
+		return true
+	}
+	t.Cleanup(func() { retryWait = orig })
+
+	runTask(context.Background(), task, twoStepPlan(), cfg, func(tea.Msg) {})
+
+	got, _ := queue.GetTask(task.ID)
+	if got.State != queue.StateDone {
+		t.Fatalf("expected done, got %s (%s)", got.State, got.FailReason)
+	}
+	if n := len(fake.Requests()); n != 3 {
+		t.Errorf("expected no recovery session, got %d sessions", n)
+	}
+	if len(waits) != 1 {
+		t.Errorf("expected one rate-limit wait, got %v", waits)
+	}
+	events, _ := queue.LoadEvents(task.ID)
+	found := false
+	for _, e := range events {
+		if e.Kind == queue.EventStepRetry && e.Reason == config.FailureRateLimit {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("expected a rate_limit retry event")
+	}
+}
+
+func TestRunTask_RetryPolicyOverride(t *testing.T) {
+	fail := FakeTurn{ExitCode: 1, Events: []StreamEvent{FakeResult("boom")}}
+	fake := NewFakeRuntime(writeTurn("created a.txt"), fail)
+	cfg, task := fakeTaskEnv(t, fake)
+	cfg.Spawn.Retry = map[string]config.RetryPolicy{config.FailureGaveUp: {MaxAttempts: 1}}
+
+	runTask(context.Background(), task, twoStepPlan(), cfg, func(tea.Msg) {})
+
+	got, _ := queue.GetTask(task.ID)
+	if got.State != queue.StateFailed {
+		t.Fatalf("expected failed, got %s", got.State)
+	}
+	if n := len(fake.Requests()); n != 2 {
+		t.Errorf("expected a single attempt for step 2, got %d sessions", n)
+	}
+	if want := "failed after 1 attempts (gave_up)"; !strings.Contains(got.FailReason, want) {
+		t.Errorf("reason %q, want %q", got.FailReason, want)
+	}
+}
@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/projects"
+	"github.com/JuanVilla424/teamoon/internal/queue"
+)
+
+// defaultReviewPoll is used when cfg.Worktrees.ReviewPollMin is unset.
+const defaultReviewPoll = 5 * time.Minute
+
+// prState returns the GitHub state of pull request number ("OPEN", "MERGED"
+// or "CLOSED") for the repository checked out at dir. Tests replace it.
+var prState = func(dir string, number int) (string, error) {
+	out, err := runGit(dir, "remote", "get-url", "origin")
+	if err != nil {
+		return "", fmt.Errorf("no origin remote in %s", dir)
+	}
+	detail, err := projects.FetchPRDetail(extractRepoSlug(strings.TrimSpace(out)), number)
+	if err != nil {
+		return "", err
+	}
+	return detail.State, nil
+}
+
+// PollReviews checks the pull request of every task in review once. Tasks
+// whose PR was merged become done; closed ones fail. onChange is called with
+// each task that left review and its new state.
+func PollReviews(cfg config.Config, onChange func(queue.Task, queue.TaskState)) {
+	tasks, err := queue.ListInReview()
+	if err != nil {
+		log.Printf("[review] list: %v", err)
+		return
+	}
+	for _, t := range tasks {
+		if t.PRNumber == 0 {
+			continue
+		}
+		state, err := prState(filepath.Join(cfg.ProjectsDir, t.Project), t.PRNumber)
+		if err != nil {
+			log.Printf("[review] task #%d PR #%d: %v", t.ID, t.PRNumber, err)
+			continue
+		}
+		var merged bool
+		switch strings.ToUpper(state) {
+		case "MERGED":
+			merged = true
+		case "CLOSED":
+		default:
+			continue
+		}
+		if err := queue.FinishReview(t.ID, merged); err != nil {
+			log.Printf("[review] task #%d: %v", t.ID, err)
+			continue
+		}
+		if onChange != nil {
+			next := queue.StateFailed
+			if merged {
+				next = queue.StateDone
+			}
+			onChange(t, next)
+		}
+	}
+}
+
+// StartReviewPoller runs PollReviews every cfg.Worktrees.ReviewPollMin
+// minutes until ctx is done.
+func StartReviewPoller(ctx context.Context, cfg config.Config, onChange func(queue.Task, queue.TaskState)) {
+	interval := time.Duration(cfg.Worktrees.ReviewPollMin) * time.Minute
+	if interval <= 0 {
+		interval = defaultReviewPoll
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			PollReviews(cfg, onChange)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
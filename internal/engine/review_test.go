@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"os"
+	"testing"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/projects"
+	"github.com/JuanVilla424/teamoon/internal/queue"
+)
+
+func TestPollReviews(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	os.MkdirAll(config.ConfigDir(), 0755)
+	states := map[int]string{1: "OPEN", 2: "MERGED", 3: "CLOSED"}
+	orig := prState
+	prState = func(dir string, number int) (string, error) { return states[number], nil }
+	defer func() { prState = orig }()
+
+	var ids []int
+	for n := 1; n <= 3; n++ {
+		task, _ := queue.Add("proj", "task", "med")
+		queue.UpdateState(task.ID, queue.StateRunning)
+		queue.SetInReview(task.ID, n, "https://github.com/o/r/pull/1")
+		ids = append(ids, task.ID)
+	}
+
+	changed := map[int]queue.TaskState{}
+	PollReviews(config.DefaultConfig(), func(t queue.Task, s queue.TaskState) { changed[t.ID] = s })
+
+	if len(changed) != 2 || changed[ids[1]] != queue.StateDone || changed[ids[2]] != queue.StateFailed {
+		t.Errorf("changed = %v", changed)
+	}
+	if open, _ := queue.GetTask(ids[0]); open.State != queue.StateInReview {
+		t.Errorf("open PR task state = %s", open.State)
+	}
+}
+
+func TestPRNumber(t *testing.T) {
+	for url, want := range map[string]int{
+		"https://github.com/o/r/pull/42\n":         42,
+		"https://github.com/o/r/pull/7#discussion": 7,
+		"https://github.com/o/r":                   0,
+	} {
+		if got := projects.PRNumber(url); got != want {
+			t.Errorf("PRNumber(%q) = %d, want %d", url, got, want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/metrics"
+)
+
+// RuntimeClaude is the default agent runtime, backed by the claude CLI.
+const RuntimeClaude = "claude"
+
+// AgentRuntime starts agent sessions. Implementations wrap a CLI agent (or a
+// scripted fake in tests) and translate its output into StreamEvents.
+type AgentRuntime interface {
+	// Name identifies the runtime in config and logs.
+	Name() string
+	// Available reports why the runtime cannot be used (e.g. binary missing).
+	Available() error
+	// Start launches a session. A non-empty req.SessionID resumes that session.
+	Start(ctx context.Context, req AgentRequest) (AgentSession, error)
+}
+
+// AgentSession is one running agent invocation.
+type AgentSession interface {
+	// Events streams parsed output until the agent exits. The channel is
+	// closed once the output ends.
+	Events() <-chan StreamEvent
+	// Wait discards events not yet received and blocks until the agent exits.
+	Wait() (AgentResult, error)
+	// Cancel stops the agent. Wait still has to be called.
+	Cancel()
+}
+
+// AgentRequest describes a single agent invocation.
+type AgentRequest struct {
+	Prompt          string
+	Dir             string        // working directory
+	SessionID       string        // resume this session when set
+	AddDirs         []string      // extra directories the agent may access
+	DisallowedTools []string      // tools the agent must not call
+	Env             []string      // appended to the inherited environment
+	ExtraArgs       []string      // runtime-specific flags, ignored by runtimes that do not understand them
+	Config          config.Config // model, turns, MCP servers
+}
+
+// AgentResult summarises a finished session.
+type AgentResult struct {
+	ExitCode  int
+	SessionID string
+	Model     string
+	Result    string // text of the final result event
+	Usage     metrics.Usage
+	CostUSD   float64
+	NumTurns  int
+	Duration  time.Duration
+	Stderr    string
+}
+
+var (
+	runtimeMu sync.RWMutex
+	runtimes  = map[string]AgentRuntime{RuntimeClaude: ClaudeRuntime{}}
+)
+
+// RegisterRuntime makes r selectable via spawn.runtime in config. Registering
+// an existing name replaces it.
+func RegisterRuntime(r AgentRuntime) {
+	runtimeMu.Lock()
+	defer runtimeMu.Unlock()
+	runtimes[r.Name()] = r
+}
+
+// RuntimeFor returns the runtime configured in cfg.Spawn.Runtime, defaulting
+// to the claude CLI.
+func RuntimeFor(cfg config.Config) (AgentRuntime, error) {
+	name := cfg.Spawn.Runtime
+	if name == "" {
+		name = RuntimeClaude
+	}
+	runtimeMu.RLock()
+	defer runtimeMu.RUnlock()
+	r, ok := runtimes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown agent runtime %q", name)
+	}
+	return r, nil
+}
+
+// observe records the session ID and final totals carried by ev.
+func (r *AgentResult) observe(ev StreamEvent) {
+	if ev.SessionID != "" && r.SessionID == "" {
+		r.SessionID = ev.SessionID
+	}
+	if ev.Model != "" && r.Model == "" {
+		r.Model = ev.Model
+	}
+	if ev.Type != "result" {
+		return
+	}
+	r.Result = ev.Result
+	r.CostUSD = ev.TotalCostUSD
+	r.NumTurns = ev.NumTurns
+	if ev.Usage != nil {
+		r.Usage = *ev.Usage
+	}
+}
+
+// RecordSpend writes a finished session to the cost ledger. rec carries the
+// labels (kind, task, step, project); usage, cost and timing come from res.
+// When the runtime did not report a model, model is used instead.
+func RecordSpend(rec metrics.SpendRecord, res AgentResult, model string) {
+	rec.Model = res.Model
+	if rec.Model == "" {
+		rec.Model = model
+	}
+	rec.SessionID = res.SessionID
+	rec.Input = res.Usage.InputTokens
+	rec.Output = res.Usage.OutputTokens
+	rec.CacheRead = res.Usage.CacheReadInputTokens
+	rec.CacheCreate = res.Usage.CacheCreationInputTokens
+	rec.CostUSD = res.CostUSD
+	rec.DurationMs = res.Duration.Milliseconds()
+	if err := metrics.RecordSpend(rec); err != nil {
+		log.Printf("[engine] recording spend: %v", err)
+	}
+}
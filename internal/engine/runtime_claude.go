@@ -0,0 +1,158 @@
+package engine
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ClaudeRuntime runs agents through the claude CLI in stream-json mode.
+type ClaudeRuntime struct {
+	// Binary overrides the executable; defaults to "claude" on PATH.
+	Binary string
+}
+
+func (c ClaudeRuntime) Name() string { return RuntimeClaude }
+
+func (c ClaudeRuntime) binary() string {
+	if c.Binary != "" {
+		return c.Binary
+	}
+	return "claude"
+}
+
+func (c ClaudeRuntime) Available() error {
+	if _, err := exec.LookPath(c.binary()); err != nil {
+		return fmt.Errorf("claude CLI not found in PATH")
+	}
+	return nil
+}
+
+func (c ClaudeRuntime) Start(ctx context.Context, req AgentRequest) (AgentSession, error) {
+	args, cleanup := BuildSpawnArgs(req.Config, req.Prompt, req.AddDirs, req.SessionID)
+	if len(req.DisallowedTools) > 0 {
+		args = append(args, "--disallowedTools", strings.Join(req.DisallowedTools, ","))
+	}
+	args = append(args, req.ExtraArgs...)
+
+	ctx, cancel := context.WithCancel(ctx)
+	cmd := exec.CommandContext(ctx, c.binary(), args...)
+	cmd.Env = append(filterEnv(os.Environ(), "CLAUDECODE"), req.Env...)
+	cmd.Dir = req.Dir
+
+	fail := func(err error) (AgentSession, error) {
+		cancel()
+		if cleanup != nil {
+			cleanup()
+		}
+		return nil, err
+	}
+	devNull, _ := os.Open(os.DevNull)
+	if devNull != nil {
+		cmd.Stdin = devNull
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fail(err)
+	}
+	s := &claudeSession{
+		cmd:     cmd,
+		cancel:  cancel,
+		events:  make(chan StreamEvent),
+		done:    make(chan struct{}),
+		started: time.Now(),
+	}
+	cmd.Stderr = &s.stderr
+	if err := cmd.Start(); err != nil {
+		if devNull != nil {
+			devNull.Close()
+		}
+		return fail(err)
+	}
+
+	go func() {
+		defer close(s.events)
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 256*1024), 256*1024)
+		for scanner.Scan() {
+			line := scanner.Text()
+			var ev StreamEvent
+			if json.Unmarshal([]byte(line), &ev) != nil {
+				// Non-JSON lines still count as output for callers that keep a transcript.
+				ev = StreamEvent{}
+			}
+			ev.Raw = line
+			s.mu.Lock()
+			s.result.observe(ev)
+			s.mu.Unlock()
+			select {
+			case s.events <- ev:
+			case <-s.done:
+			}
+		}
+	}()
+	s.finish = func() {
+		if devNull != nil {
+			devNull.Close()
+		}
+		if cleanup != nil {
+			cleanup()
+		}
+		cancel()
+	}
+	return s, nil
+}
+
+type claudeSession struct {
+	cmd    *exec.Cmd
+	cancel context.CancelFunc
+	finish func()
+	events chan StreamEvent
+	done   chan struct{} // closed by Wait so the reader stops blocking on events
+
+	stderr   strings.Builder
+	mu       sync.Mutex
+	result   AgentResult
+	started  time.Time
+	waitOnce sync.Once
+	waitErr  error
+}
+
+func (s *claudeSession) Events() <-chan StreamEvent { return s.events }
+
+func (s *claudeSession) Cancel() { s.cancel() }
+
+func (s *claudeSession) Wait() (AgentResult, error) {
+	s.waitOnce.Do(func() {
+		close(s.done)
+		for range s.events {
+		}
+		err := s.cmd.Wait()
+		s.finish()
+		s.mu.Lock()
+		s.result.Stderr = s.stderr.String()
+		s.mu.Unlock()
+		if err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				s.result.ExitCode = exitErr.ExitCode()
+			} else {
+				s.result.ExitCode = -1
+				s.waitErr = err
+			}
+		}
+	})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.result.Duration == 0 {
+		s.result.Duration = time.Since(s.started)
+	}
+	return s.result, s.waitErr
+}
@@ -0,0 +1,153 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RuntimeFake is the name the scripted test runtime registers under.
+const RuntimeFake = "fake"
+
+// FakeTurn scripts the outcome of one session started on a FakeRuntime.
+type FakeTurn struct {
+	Events   []StreamEvent
+	ExitCode int
+	Err      error // returned from Start instead of running the turn
+	// Hook, when set, runs before the events are emitted (e.g. to write files
+	// into req.Dir the way a real agent would).
+	Hook func(req AgentRequest)
+}
+
+// FakeRuntime is a deterministic AgentRuntime. Each Start consumes the next
+// scripted turn; once the script is exhausted every session succeeds with a
+// plain "done" result. Requests are recorded for assertions.
+type FakeRuntime struct {
+	mu       sync.Mutex
+	turns    []FakeTurn
+	requests []AgentRequest
+	sessions int
+}
+
+// NewFakeRuntime returns a fake runtime that plays turns in order.
+func NewFakeRuntime(turns ...FakeTurn) *FakeRuntime {
+	return &FakeRuntime{turns: turns}
+}
+
+func (f *FakeRuntime) Name() string { return RuntimeFake }
+
+func (f *FakeRuntime) Available() error { return nil }
+
+// Requests returns every request started so far.
+func (f *FakeRuntime) Requests() []AgentRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]AgentRequest(nil), f.requests...)
+}
+
+func (f *FakeRuntime) Start(ctx context.Context, req AgentRequest) (AgentSession, error) {
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	f.sessions++
+	id := req.SessionID
+	if id == "" {
+		id = fmt.Sprintf("fake-session-%d", f.sessions)
+	}
+	turn := FakeTurn{Events: []StreamEvent{FakeResult("done")}}
+	if len(f.turns) > 0 {
+		turn = f.turns[0]
+		f.turns = f.turns[1:]
+	}
+	f.mu.Unlock()
+
+	if turn.Err != nil {
+		return nil, turn.Err
+	}
+	if turn.Hook != nil {
+		turn.Hook(req)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s := &fakeSession{
+		cancel:  cancel,
+		events:  make(chan StreamEvent),
+		done:    make(chan struct{}),
+		started: time.Now(),
+	}
+	s.result.ExitCode = turn.ExitCode
+	go func() {
+		defer close(s.events)
+		for _, ev := range turn.Events {
+			if ev.SessionID == "" {
+				ev.SessionID = id
+			}
+			if ev.Raw == "" {
+				raw, _ := json.Marshal(ev)
+				ev.Raw = string(raw)
+			}
+			s.mu.Lock()
+			s.result.observe(ev)
+			s.mu.Unlock()
+			select {
+			case s.events <- ev:
+			case <-s.done:
+			case <-ctx.Done():
+				s.mu.Lock()
+				s.result.ExitCode = -1
+				s.mu.Unlock()
+				return
+			}
+		}
+	}()
+	return s, nil
+}
+
+type fakeSession struct {
+	cancel   context.CancelFunc
+	events   chan StreamEvent
+	done     chan struct{}
+	mu       sync.Mutex
+	result   AgentResult
+	started  time.Time
+	waitOnce sync.Once
+}
+
+func (s *fakeSession) Events() <-chan StreamEvent { return s.events }
+
+func (s *fakeSession) Cancel() { s.cancel() }
+
+func (s *fakeSession) Wait() (AgentResult, error) {
+	s.waitOnce.Do(func() {
+		close(s.done)
+		for range s.events {
+		}
+		s.cancel()
+	})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.result.Duration == 0 {
+		s.result.Duration = time.Since(s.started)
+	}
+	return s.result, nil
+}
+
+// FakeText builds an assistant event carrying text.
+func FakeText(text string) StreamEvent {
+	return StreamEvent{Type: "assistant", Message: &StreamMessage{
+		Content: []StreamContent{{Type: "text", Text: text}},
+	}}
+}
+
+// FakeToolUse builds an assistant event calling tool with input.
+func FakeToolUse(tool string, input map[string]any) StreamEvent {
+	return StreamEvent{Type: "assistant", Message: &StreamMessage{
+		Content: []StreamContent{{Type: "tool_use", Name: tool, Input: input}},
+	}}
+}
+
+// FakeResult builds the final result event.
+func FakeResult(text string) StreamEvent {
+	return StreamEvent{Type: "result", Result: text, NumTurns: 1}
+}
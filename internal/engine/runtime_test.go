@@ -0,0 +1,207 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/metrics"
+	"github.com/JuanVilla424/teamoon/internal/plan"
+	"github.com/JuanVilla424/teamoon/internal/queue"
+)
+
+// fakeTaskEnv isolates HOME, creates a project directory and registers fake
+// as the configured runtime.
+func fakeTaskEnv(t *testing.T, fake *FakeRuntime) (config.Config, queue.Task) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	os.MkdirAll(filepath.Join(home, ".config", "teamoon"), 0755)
+
+	cfg := config.DefaultConfig()
+	cfg.ProjectsDir = filepath.Join(home, "projects")
+	cfg.Worktrees.Enabled = false
+	cfg.Spawn.Runtime = RuntimeFake
+	os.MkdirAll(filepath.Join(cfg.ProjectsDir, "proj"), 0755)
+	RegisterRuntime(fake)
+
+	task, err := queue.Add("proj", "build the thing", "med")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg, task
+}
+
+func twoStepPlan() plan.Plan {
+	return plan.Plan{Title: "thing", Steps: []plan.Step{
+		{Number: 1, Title: "write", Body: "create a.txt", Agent: "dev"},
+		{Number: 2, Title: "edit", Body: "edit a.txt", Agent: "dev"},
+	}}
+}
+
+func writeTurn(summary string) FakeTurn {
+	result := FakeResult(summary)
+	result.Usage = &metrics.Usage{InputTokens: 10, OutputTokens: 20}
+	result.TotalCostUSD = 0.01
+	return FakeTurn{Events: []StreamEvent{
+		FakeToolUse("Write", map[string]any{"file_path": "a.txt"}),
+		result,
+	}}
+}
+
+func TestRunTask_FakeRuntime(t *testing.T) {
+	fake := NewFakeRuntime(writeTurn("created a.txt"), writeTurn("edited a.txt"))
+	cfg, task := fakeTaskEnv(t, fake)
+
+	var states []queue.TaskState
+	runTask(context.Background(), task, twoStepPlan(), cfg, func(msg tea.Msg) {
+		if m, ok := msg.(TaskStateMsg); ok {
+			states = append(states, m.State)
+		}
+	})
+
+	got, _ := queue.GetTask(task.ID)
+	if got.State != queue.StateDone {
+		t.Fatalf("expected done, got %s (%s)", got.State, got.FailReason)
+	}
+	reqs := fake.Requests()
+	if len(reqs) != 2 {
+		t.Fatalf("expected one session per step, got %d", len(reqs))
+	}
+	if want := filepath.Join(cfg.ProjectsDir, "proj"); reqs[0].Dir != want {
+		t.Errorf("expected dir %s, got %s", want, reqs[0].Dir)
+	}
+	if len(reqs[0].DisallowedTools) == 0 {
+		t.Error("expected interactive tools to be disallowed")
+	}
+	if len(states) == 0 || states[len(states)-1] != queue.StateDone {
+		t.Errorf("expected final done state message, got %v", states)
+	}
+
+	spend, err := metrics.SpendForTask(task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spend.Steps) != 2 || spend.Steps[0].Step != 1 || spend.Steps[1].Step != 2 {
+		t.Errorf("expected one ledger entry per step, got %+v", spend.Steps)
+	}
+	if spend.Total.Output != 40 || spend.Total.CostUSD != 0.02 {
+		t.Errorf("expected usage from result events, got %+v", spend.Total)
+	}
+}
+
+func TestRunTask_FakeRuntimeRetriesFailedStep(t *testing.T) {
+	fake := NewFakeRuntime(
+		FakeTurn{ExitCode: 1, Events: []StreamEvent{FakeResult("boom")}},
+		FakeTurn{Events: []StreamEvent{FakeResult("the file path was wrong")}}, // recovery analysis
+		writeTurn("created a.txt"),
+		writeTurn("edited a.txt"),
+	)
+	cfg, task := fakeTaskEnv(t, fake)
+
+	runTask(context.Background(), task, twoStepPlan(), cfg, func(tea.Msg) {})
+
+	got, _ := queue.GetTask(task.ID)
+	if got.State != queue.StateDone {
+		t.Fatalf("expected done after retry, got %s (%s)", got.State, got.FailReason)
+	}
+	reqs := fake.Requests()
+	if len(reqs) != 4 {
+		t.Fatalf("expected 4 sessions (fail, recovery, retry, step 2), got %d", len(reqs))
+	}
+}
+
+func TestRunTask_FakeRuntimeFailsTask(t *testing.T) {
+	fail := FakeTurn{ExitCode: 1, Events: []StreamEvent{FakeResult("boom")}}
+	fake := NewFakeRuntime(fail, fail, fail, fail, fail)
+	cfg, task := fakeTaskEnv(t, fake)
+
+	runTask(context.Background(), task, twoStepPlan(), cfg, func(tea.Msg) {})
+
+	got, _ := queue.GetTask(task.ID)
+	if got.FailReason == "" {
+		t.Fatalf("expected fail reason, got state %s", got.State)
+	}
+}
+
+func TestClaudeRuntime_ParsesStream(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "agent")
+	script := `#!/bin/sh
+echo '{"type":"system","subtype":"init","session_id":"s-1"}'
+echo 'not json'
+echo '{"type":"assistant","message":{"content":[{"type":"text","text":"hi"}]}}'
+echo '{"type":"result","result":"ok","num_turns":2,"total_cost_usd":0.5,"usage":{"input_tokens":10,"output_tokens":20,"cache_read_input_tokens":30}}'
+echo oops >&2
+exit 3
+`
+	if err := os.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	rt := ClaudeRuntime{Binary: bin}
+	sess, err := rt.Start(context.Background(), AgentRequest{Prompt: "p", Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for ev := range sess.Events() {
+		types = append(types, ev.Type)
+		if ev.Raw == "" {
+			t.Error("expected raw line on every event")
+		}
+	}
+	res, err := sess.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(types) != 4 || types[1] != "" {
+		t.Errorf("unexpected event types %q", types)
+	}
+	if res.ExitCode != 3 || res.SessionID != "s-1" || res.Result != "ok" || res.NumTurns != 2 {
+		t.Errorf("unexpected result %+v", res)
+	}
+	if res.CostUSD != 0.5 || res.Usage.InputTokens != 10 || res.Usage.OutputTokens != 20 || res.Usage.CacheReadInputTokens != 30 {
+		t.Errorf("unexpected usage %+v cost %v", res.Usage, res.CostUSD)
+	}
+	if res.Stderr != "oops\n" {
+		t.Errorf("expected stderr captured, got %q", res.Stderr)
+	}
+}
+
+func TestClaudeRuntime_WaitWithoutReading(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "agent")
+	os.WriteFile(bin, []byte("#!/bin/sh\nfor i in 1 2 3 4 5; do echo '{\"type\":\"assistant\"}'; done\n"), 0755)
+
+	sess, err := ClaudeRuntime{Binary: bin}.Start(context.Background(), AgentRequest{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-sess.Events() // read one event, then abandon the stream
+	if _, err := sess.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRuntimeFor(t *testing.T) {
+	cfg := config.DefaultConfig()
+	if rt, err := RuntimeFor(cfg); err != nil || rt.Name() != RuntimeClaude {
+		t.Errorf("expected claude by default, got %v %v", rt, err)
+	}
+	cfg.Spawn.Runtime = "nope"
+	if _, err := RuntimeFor(cfg); err == nil {
+		t.Error("expected error for unknown runtime")
+	}
+}
@@ -0,0 +1,45 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/JuanVilla424/teamoon/internal/plan"
+	"github.com/JuanVilla424/teamoon/internal/queue"
+)
+
+// diffStep compares the workspace against before (a tree or commit taken
+// when the step started) and returns the stat and full patch. Commits the
+// agent made during the step are included, since both sides are snapshots.
+func diffStep(dir, before string) (stat, patch string, err error) {
+	after, err := snapshotTree(dir)
+	if err != nil {
+		return "", "", err
+	}
+	out, err := runGit(dir, "diff", "--stat", "--no-color", before, after)
+	if err != nil {
+		return "", "", fmt.Errorf("git diff --stat: %s", strings.TrimSpace(out))
+	}
+	stat = out
+	out, err = runGit(dir, "diff", "--no-color", "--no-ext-diff", before, after)
+	if err != nil {
+		return "", "", fmt.Errorf("git diff: %s", strings.TrimSpace(out))
+	}
+	return stat, out, nil
+}
+
+// recordStepDiff stores what step changed in dir since before.
+func recordStepDiff(dir string, taskID int, step plan.Step, before string) error {
+	stat, patch, err := diffStep(dir, before)
+	if err != nil {
+		return err
+	}
+	return queue.SaveStepDiff(taskID, queue.StepDiff{
+		Step:  step.Number,
+		Title: step.Title,
+		Time:  time.Now(),
+		Stat:  stat,
+		Patch: patch,
+	})
+}
@@ -0,0 +1,48 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/queue"
+)
+
+func TestRunTask_RecordsStepDiffs(t *testing.T) {
+	cfg := initTestRepo(t)
+	os.MkdirAll(config.ConfigDir(), 0755)
+	cfg.Worktrees.Enabled = false
+	cfg.Spawn.Runtime = RuntimeFake
+	cfg.Checkpoints.Enabled = false // diffs don't depend on checkpoints
+
+	create := writeTurn("created a.txt")
+	create.Hook = func(req AgentRequest) {
+		os.WriteFile(filepath.Join(req.Dir, "a.txt"), []byte("one\n"), 0644)
+	}
+	edit := writeTurn("edited a.txt and committed")
+	edit.Hook = func(req AgentRequest) {
+		os.WriteFile(filepath.Join(req.Dir, "a.txt"), []byte("two\n"), 0644)
+		mustGit(t, req.Dir, "add", "a.txt")
+		mustGit(t, req.Dir, "commit", "-q", "-m", "edit a")
+	}
+	RegisterRuntime(NewFakeRuntime(create, edit))
+	task, _ := queue.Add("proj", "build the thing", "med")
+
+	runTask(context.Background(), task, twoStepPlan(), cfg, func(tea.Msg) {})
+
+	diffs, err := queue.LoadStepDiffs(task.ID)
+	if err != nil || len(diffs) != 2 {
+		t.Fatalf("diffs = %+v, %v", diffs, err)
+	}
+	if d := diffs[0]; d.Step != 1 || d.Title != "write" || !strings.Contains(d.Stat, "a.txt") || !strings.Contains(d.Patch, "+one") {
+		t.Errorf("step 1 diff = %+v", d)
+	}
+	if d := diffs[1]; !strings.Contains(d.Patch, "-one\n+two") {
+		t.Errorf("step 2 diff should include committed changes, got:\n%s", d.Patch)
+	}
+}
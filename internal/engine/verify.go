@@ -0,0 +1,181 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/plan"
+	"github.com/JuanVilla424/teamoon/internal/queue"
+)
+
+const (
+	// checkTimeout bounds a single run check so a hung command cannot stall the task.
+	checkTimeout = 5 * time.Minute
+	// checkWaitDelay is how long a killed check may keep its output open,
+	// e.g. through a background child, before it is abandoned.
+	checkWaitDelay = 5 * time.Second
+	// checkOutputTail is how much of a failed run check's output is reported.
+	checkOutputTail = 1500
+	// grepMaxFile skips files too large to be source when grepping a tree.
+	grepMaxFile = 2 << 20
+)
+
+// checkDir is where a step's checks run: the task workspace, or the home
+// directory for system tasks.
+func checkDir(task queue.Task, ws workspace, cfg config.Config) string {
+	if task.Assignee == "system" {
+		home, _ := os.UserHomeDir()
+		return home
+	}
+	return ws.dirFor(cfg, task.Project)
+}
+
+// runStepChecks runs the step's Check: lines in dir and returns a report of
+// every check and whether all of them passed. A malformed check fails the step.
+// If ctx is cancelled meanwhile, the checks stop and ctx's error is returned
+// instead of a verdict.
+func runStepChecks(ctx context.Context, dir string, step plan.Step) (string, bool, error) {
+	checks, err := step.ParsedChecks()
+	if err != nil {
+		return "FAIL " + err.Error() + "\n", false, nil
+	}
+	var out strings.Builder
+	ok := true
+	for _, c := range checks {
+		detail, passed := runCheck(ctx, dir, c)
+		if err := ctx.Err(); err != nil {
+			return out.String(), false, err
+		}
+		if passed {
+			fmt.Fprintf(&out, "PASS %s\n", c.Raw)
+			continue
+		}
+		ok = false
+		fmt.Fprintf(&out, "FAIL %s: %s\n", c.Raw, detail)
+	}
+	return out.String(), ok, nil
+}
+
+func runCheck(ctx context.Context, dir string, c plan.Check) (string, bool) {
+	switch c.Kind {
+	case plan.CheckRun:
+		return runCommandCheck(ctx, dir, c)
+	case plan.CheckExists:
+		if _, err := os.Stat(checkPath(dir, c.Path)); err != nil {
+			return "path does not exist", false
+		}
+		return "", true
+	case plan.CheckMissing:
+		if _, err := os.Stat(checkPath(dir, c.Path)); err == nil {
+			return "path exists", false
+		}
+		return "", true
+	case plan.CheckGrep:
+		return grepCheck(dir, c)
+	}
+	return fmt.Sprintf("unknown check kind %q", c.Kind), false
+}
+
+func checkPath(dir, p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(dir, p)
+}
+
+func runCommandCheck(ctx context.Context, dir string, c plan.Check) (string, bool) {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", c.Command)
+	cmd.Dir = dir
+	cmd.WaitDelay = checkWaitDelay
+	killProcessGroup(cmd)
+	output, err := cmd.CombinedOutput()
+
+	code := 0
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return err.Error(), false
+		}
+		code = exitErr.ExitCode()
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Sprintf("timed out after %s", checkTimeout), false
+	}
+	if code == c.Exit {
+		return "", true
+	}
+	tail := strings.TrimSpace(string(output))
+	if len(tail) > checkOutputTail {
+		tail = tail[len(tail)-checkOutputTail:]
+	}
+	detail := fmt.Sprintf("exit %d (want %d)", code, c.Exit)
+	if tail != "" {
+		detail += "\n" + tail
+	}
+	return detail, false
+}
+
+// grepCheck matches c.Pattern against a file, or every regular file under a
+// directory (skipping .git and node_modules).
+func grepCheck(dir string, c plan.Check) (string, bool) {
+	re, err := regexp.Compile(c.Pattern)
+	if err != nil {
+		return err.Error(), false
+	}
+	root := checkPath(dir, c.Path)
+	if _, err := os.Stat(root); err != nil {
+		return "path does not exist", false
+	}
+
+	var match string
+	errFound := errors.New("found")
+	walkErr := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && (d.Name() == ".git" || d.Name() == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info, err := d.Info(); err != nil || !info.Mode().IsRegular() || info.Size() > grepMaxFile {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		loc := re.FindIndex(data)
+		if loc == nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, path)
+		line := bytes.Count(data[:loc[0]], []byte("\n")) + 1
+		match = fmt.Sprintf("%s:%d", rel, line)
+		return errFound
+	})
+	if walkErr != nil && walkErr != errFound {
+		return walkErr.Error(), false
+	}
+
+	switch {
+	case c.Negate && match != "":
+		return "unexpected match at " + match, false
+	case !c.Negate && match == "":
+		return "no match", false
+	}
+	return "", true
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package engine
+
+import "os/exec"
+
+// Process groups are only used on unix; elsewhere cmd.WaitDelay is what
+// stops a killed check's children from holding up the task.
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/JuanVilla424/teamoon/internal/plan"
+	"github.com/JuanVilla424/teamoon/internal/queue"
+)
+
+func TestRunStepChecks(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "src"), 0755)
+	os.WriteFile(filepath.Join(dir, "src", "api.go"), []byte("package src\n\nfunc HandleUsers() {}\n"), 0644)
+
+	tests := []struct {
+		check string
+		ok    bool
+	}{
+		{"run true", true},
+		{"run false", false},
+		{"run(3) exit 3", true},
+		{"exists src/api.go", true},
+		{"exists src/missing.go", false},
+		{"missing src/missing.go", true},
+		{"missing src", false},
+		{`grep "func Handle\\w+" src`, true},
+		{"grep HandleOrders src", false},
+		{"!grep MOCK_ src", true},
+		{"!grep HandleUsers src/api.go", false},
+		{"grep x nowhere", false},
+		{"compile everything", false},
+	}
+	for _, tt := range tests {
+		out, ok, _ := runStepChecks(context.Background(), dir, plan.Step{Checks: []string{tt.check}})
+		if ok != tt.ok {
+			t.Errorf("%q: ok = %v, want %v (%s)", tt.check, ok, tt.ok, out)
+		}
+	}
+
+	out, _, _ := runStepChecks(context.Background(), dir, plan.Step{Checks: []string{"run echo broken; exit 2", "!grep HandleUsers src"}})
+	for _, want := range []string{"exit 2 (want 0)", "broken", "unexpected match at src/api.go:3"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestRunStepChecks_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	start := time.Now()
+	// The background sleep keeps the output pipe open after the shell dies.
+	_, ok, err := runStepChecks(ctx, t.TempDir(), plan.Step{Checks: []string{"run sleep 30 & sleep 30"}})
+	if err != context.Canceled || ok {
+		t.Errorf("ok = %v, err = %v, want a cancel", ok, err)
+	}
+	if d := time.Since(start); d >= checkWaitDelay {
+		t.Errorf("cancelled check took %s", d)
+	}
+}
+
+func TestRunTask_FailedCheckRetriesWithCheckOutput(t *testing.T) {
+	create := writeTurn("created a.txt")
+	create.Hook = func(req AgentRequest) {
+		os.WriteFile(filepath.Join(req.Dir, "a.txt"), []byte("hi\n"), 0644)
+	}
+	fake := NewFakeRuntime(
+		writeTurn("forgot the file"),
+		FakeTurn{Events: []StreamEvent{FakeResult("a.txt was never written")}}, // recovery analysis
+		create,
+	)
+	cfg, task := fakeTaskEnv(t, fake)
+	p := plan.Plan{Title: "thing", Steps: []plan.Step{
+		{Number: 1, Title: "write", Body: "create a.txt", Agent: "dev", Checks: []string{"exists a.txt"}},
+	}}
+
+	runTask(context.Background(), task, p, cfg, func(tea.Msg) {})
+
+	got, _ := queue.GetTask(task.ID)
+	if got.State != queue.StateDone {
+		t.Fatalf("expected done, got %s (%s)", got.State, got.FailReason)
+	}
+	reqs := fake.Requests()
+	if len(reqs) != 3 {
+		t.Fatalf("expected step, recovery and retry sessions, got %d", len(reqs))
+	}
+	if !strings.Contains(reqs[0].Prompt, "- exists a.txt") {
+		t.Error("step prompt should list the checks")
+	}
+	if !strings.Contains(reqs[1].Prompt, "FAIL exists a.txt") {
+		t.Error("recovery prompt should carry the check output")
+	}
+	if !strings.Contains(reqs[2].Prompt, "Verify checks failed:\nFAIL exists a.txt: path does not exist") {
+		t.Errorf("retry prompt missing check output:\n%s", reqs[2].Prompt)
+	}
+}
+
+func TestRunTask_FailedChecksFailTask(t *testing.T) {
+	cfg, task := fakeTaskEnv(t, NewFakeRuntime(writeTurn("a"), writeTurn("b"), writeTurn("c"), writeTurn("d"), writeTurn("e")))
+	p := plan.Plan{Title: "thing", Steps: []plan.Step{
+		{Number: 1, Title: "write", Body: "create a.txt", Agent: "dev", Checks: []string{"run exit 1"}},
+	}}
+
+	runTask(context.Background(), task, p, cfg, func(tea.Msg) {})
+
+	got, _ := queue.GetTask(task.ID)
+	if got.State == queue.StateDone || !strings.Contains(got.FailReason, "verify checks failed") {
+		t.Errorf("state %s, reason %q", got.State, got.FailReason)
+	}
+}
@@ -30,3 +30,16 @@ func GenerateName() string {
 func GenerateEmail(name string) string {
 	return name + "@mail.com"
 }
+
+// GitIdentityEnv returns GIT_AUTHOR_*/GIT_COMMITTER_* variables for a freshly
+// generated identity, so agent commits never use the operator's name.
+func GitIdentityEnv() []string {
+	name := GenerateName()
+	email := GenerateEmail(name)
+	return []string{
+		"GIT_AUTHOR_NAME=" + name,
+		"GIT_AUTHOR_EMAIL=" + email,
+		"GIT_COMMITTER_NAME=" + name,
+		"GIT_COMMITTER_EMAIL=" + email,
+	}
+}
@@ -0,0 +1,308 @@
+package engine
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/logs"
+	"github.com/JuanVilla424/teamoon/internal/persist"
+	"github.com/JuanVilla424/teamoon/internal/plan"
+	"github.com/JuanVilla424/teamoon/internal/projects"
+	"github.com/JuanVilla424/teamoon/internal/queue"
+)
+
+// workspace is where a task's agent runs: either the project checkout
+// itself or a dedicated git worktree on the task branch.
+type workspace struct {
+	Dir     string // working directory for every spawn of the task
+	RepoDir string // main checkout of the project
+	Branch  string // task branch; empty when running in the main checkout
+}
+
+func (w workspace) isolated() bool { return w.Branch != "" }
+
+// dirFor returns the workspace directory, falling back to the project checkout.
+func (w workspace) dirFor(cfg config.Config, project string) string {
+	if w.Dir != "" {
+		return w.Dir
+	}
+	return filepath.Join(cfg.ProjectsDir, project)
+}
+
+func taskBranch(taskID int) string {
+	return fmt.Sprintf("teamoon/task-%d", taskID)
+}
+
+func worktreePath(project string, taskID int) string {
+	return filepath.Join(config.ConfigDir(), "worktrees", project, fmt.Sprintf("task-%d", taskID))
+}
+
+func baseBranch(cfg config.Config) string {
+	if cfg.Worktrees.BaseBranch != "" {
+		return cfg.Worktrees.BaseBranch
+	}
+	return "dev"
+}
+
+func gitRefExists(dir, ref string) bool {
+	_, err := runGit(dir, "rev-parse", "--verify", "--quiet", ref)
+	return err == nil
+}
+
+// prepareWorkspace gives the task its own worktree on teamoon/task-<id>,
+// branched from the base branch. Tasks fall back to the main checkout when
+// worktrees are disabled, the task is a system task, or the project is not
+// a git repository with at least one commit. Projects delivered as pull
+// requests always get a worktree, since the PR needs a branch of its own.
+// A worktree left behind by a crashed process is reused so the task resumes
+// where it left off.
+func prepareWorkspace(task queue.Task, cfg config.Config) (workspace, error) {
+	repo := filepath.Join(cfg.ProjectsDir, task.Project)
+	ws := workspace{Dir: repo, RepoDir: repo}
+	enabled := cfg.Worktrees.Enabled || config.DeliveryFor(cfg, task.Project) == config.WorktreeOnCompletePR
+	if !enabled || task.Assignee == "system" {
+		return ws, nil
+	}
+	if !gitRefExists(repo, "HEAD") {
+		return ws, nil
+	}
+
+	branch := taskBranch(task.ID)
+	path := worktreePath(task.Project, task.ID)
+	if _, err := os.Stat(filepath.Join(path, ".git")); err == nil {
+		return workspace{Dir: path, RepoDir: repo, Branch: branch}, nil
+	}
+
+	runGit(repo, "worktree", "prune")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return ws, err
+	}
+	var out string
+	var err error
+	if gitRefExists(repo, "refs/heads/"+branch) {
+		out, err = runGit(repo, "worktree", "add", path, branch)
+	} else {
+		base := baseBranch(cfg)
+		if !gitRefExists(repo, "refs/heads/"+base) {
+			base = "HEAD"
+		}
+		out, err = runGit(repo, "worktree", "add", "-b", branch, path, base)
+	}
+	if err != nil {
+		return ws, fmt.Errorf("git worktree add: %s", strings.TrimSpace(out))
+	}
+	return workspace{Dir: path, RepoDir: repo, Branch: branch}, nil
+}
+
+// completeWorkspace delivers the task branch according to the project's
+// delivery mode and removes the worktree. In PR mode it returns the URL of
+// the pull request it opened; summaries are the per-step results for its body.
+func completeWorkspace(ws workspace, task queue.Task, cfg config.Config, summaries []string, emit func(logs.LogLevel, string)) (string, error) {
+	if !ws.isolated() {
+		return "", nil
+	}
+	if err := commitPending(ws, task); err != nil {
+		return "", err
+	}
+	base := baseBranch(cfg)
+	if config.DeliveryFor(cfg, task.Project) == config.WorktreeOnCompletePR {
+		if out, err := runGit(ws.Dir, "push", "-u", "origin", ws.Branch); err != nil {
+			return "", fmt.Errorf("push %s: %s", ws.Branch, strings.TrimSpace(out))
+		}
+		url, err := projects.CreatePR(ws.Dir, ws.Branch, base, prTitle(task), prBody(task, summaries))
+		if err != nil {
+			return "", err
+		}
+		emit(logs.LevelSuccess, fmt.Sprintf("Opened PR for %s: %s", ws.Branch, url))
+		if err := removeWorkspace(ws, false); err != nil {
+			emit(logs.LevelWarn, err.Error())
+		}
+		return url, nil
+	}
+
+	if err := mergeTaskBranch(ws, base); err != nil {
+		// Keep the worktree and branch so the work can be merged by hand.
+		return "", err
+	}
+	emit(logs.LevelSuccess, fmt.Sprintf("Merged %s into %s", ws.Branch, base))
+	if err := removeWorkspace(ws, true); err != nil {
+		emit(logs.LevelWarn, err.Error())
+	}
+	return "", nil
+}
+
+// commitPending commits whatever the agent left uncommitted in the worktree
+// to the task branch, so delivery does not leave edits behind.
+func commitPending(ws workspace, task queue.Task) error {
+	out, err := runGit(ws.Dir, "status", "--porcelain")
+	if err != nil {
+		return fmt.Errorf("git status: %s", strings.TrimSpace(out))
+	}
+	if strings.TrimSpace(out) == "" {
+		return nil
+	}
+	if out, err := runGit(ws.Dir, "add", "-A"); err != nil {
+		return fmt.Errorf("git add: %s", strings.TrimSpace(out))
+	}
+	msg := fmt.Sprintf("teamoon: uncommitted changes of task #%d", task.ID)
+	if out, err := runGit(ws.Dir, "commit", "-q", "--no-verify", "-m", msg); err != nil {
+		return fmt.Errorf("commit pending changes: %s", strings.TrimSpace(out))
+	}
+	return nil
+}
+
+// deliveryAttempts bounds how often a delivery re-merges base after the
+// fast-forward lost a race with another change to base.
+const deliveryAttempts = 3
+
+var (
+	deliveryLocksMu sync.Mutex
+	deliveryLocks   = make(map[string]*persist.Mutex)
+)
+
+// deliveryLock serializes delivery into the base branch of the checkout at
+// repo, across processes too, since parallel tasks of a project can finish
+// together.
+func deliveryLock(repo string) *persist.Mutex {
+	deliveryLocksMu.Lock()
+	defer deliveryLocksMu.Unlock()
+	m, ok := deliveryLocks[repo]
+	if !ok {
+		name := filepath.Base(repo)
+		m = persist.NewMutex(func() string { return filepath.Join(config.ConfigDir(), "worktrees", name, "deliver") })
+		deliveryLocks[repo] = m
+	}
+	return m
+}
+
+// mergeTaskBranch brings the task branch up to date with base inside the
+// worktree, then fast-forwards base to it. If base moved in between, it
+// merges again and retries.
+func mergeTaskBranch(ws workspace, base string) error {
+	lock := deliveryLock(ws.RepoDir)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if !gitRefExists(ws.RepoDir, "refs/heads/"+base) {
+		if out, err := runGit(ws.RepoDir, "branch", base, ws.Branch); err != nil {
+			return fmt.Errorf("create %s: %s", base, strings.TrimSpace(out))
+		}
+		return nil
+	}
+	var err error
+	for attempt := 0; attempt < deliveryAttempts; attempt++ {
+		if out, mergeErr := runGit(ws.Dir, "merge", "--no-edit", base); mergeErr != nil {
+			runGit(ws.Dir, "merge", "--abort")
+			return fmt.Errorf("merge %s into %s conflicts: %s", base, ws.Branch, strings.TrimSpace(out))
+		}
+		if err = fastForward(ws, base); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// fastForward moves base to the task branch, in the main checkout when base
+// is checked out there.
+func fastForward(ws workspace, base string) error {
+	current, _ := runGit(ws.RepoDir, "symbolic-ref", "--short", "HEAD")
+	var out string
+	var err error
+	if strings.TrimSpace(current) == base {
+		out, err = runGit(ws.RepoDir, "merge", "--ff-only", ws.Branch)
+	} else {
+		out, err = runGit(ws.RepoDir, "fetch", ".", ws.Branch+":"+base)
+	}
+	if err != nil {
+		return fmt.Errorf("fast-forward %s to %s: %s", base, ws.Branch, strings.TrimSpace(out))
+	}
+	return nil
+}
+
+// removeWorkspace deletes the worktree and, if deleteBranch is set, the task
+// branch. A worktree with uncommitted changes is kept, branch included, and
+// reported as an error.
+func removeWorkspace(ws workspace, deleteBranch bool) error {
+	if !ws.isolated() {
+		return nil
+	}
+	if out, err := runGit(ws.RepoDir, "worktree", "remove", ws.Dir); err != nil {
+		return fmt.Errorf("kept worktree %s: %s", ws.Dir, strings.TrimSpace(out))
+	}
+	runGit(ws.RepoDir, "worktree", "prune")
+	if deleteBranch {
+		runGit(ws.RepoDir, "branch", "-D", ws.Branch)
+	}
+	return nil
+}
+
+// DiscardWorkspace deletes the worktree and branch that a failed or stopped
+// task left behind, together with any work in them, and its checkpoints.
+// It does nothing for tasks that have neither.
+func DiscardWorkspace(cfg config.Config, t queue.Task) error {
+	repo := projectRepo(cfg, t.Project)
+	ws := workspace{Dir: worktreePath(t.Project, t.ID), RepoDir: repo, Branch: taskBranch(t.ID)}
+	_, statErr := os.Stat(ws.Dir)
+	if os.IsNotExist(statErr) && !gitRefExists(repo, "refs/heads/"+ws.Branch) {
+		return nil
+	}
+	if out, err := runGit(repo, "worktree", "remove", "--force", ws.Dir); err != nil && statErr == nil {
+		return fmt.Errorf("remove worktree %s: %s", ws.Dir, strings.TrimSpace(out))
+	}
+	runGit(repo, "worktree", "prune")
+	runGit(repo, "branch", "-D", ws.Branch)
+	deleteCheckpoints(repo, t.ID)
+	log.Printf("[worktree] task #%d: discarded %s", t.ID, ws.Branch)
+	return nil
+}
+
+// DiscardWorkspaces discards the workspaces of task id and of its subtasks,
+// which are archived along with it. Failures are logged.
+func DiscardWorkspaces(cfg config.Config, id int) {
+	tasks, _ := queue.Descendants(id)
+	if t, err := queue.GetTask(id); err == nil {
+		tasks = append(tasks, t)
+	}
+	for _, t := range tasks {
+		if err := DiscardWorkspace(cfg, t); err != nil {
+			log.Printf("[worktree] task #%d: %v", t.ID, err)
+		}
+	}
+}
+
+func prTitle(task queue.Task) string {
+	title := strings.SplitN(task.Description, "\n", 2)[0]
+	if len(title) > 72 {
+		title = title[:72]
+	}
+	return fmt.Sprintf("task #%d: %s", task.ID, title)
+}
+
+// prBody describes the task for its pull request: the description, the plan
+// it ran (collapsed) and what each step reported.
+func prBody(task queue.Task, summaries []string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Autopilot task #%d (%s)\n\n%s\n", task.ID, task.Project, task.Description)
+	if data, err := os.ReadFile(plan.PlanPath(task.ID)); err == nil {
+		content := strings.TrimSpace(string(data))
+		// GitHub rejects bodies over 65536 characters.
+		if len(content) > 40000 {
+			content = content[:40000] + "\n\n[truncated]"
+		}
+		sb.WriteString("\n<details>\n<summary>Plan</summary>\n\n")
+		sb.WriteString(content)
+		sb.WriteString("\n\n</details>\n")
+	}
+	if len(summaries) > 0 {
+		sb.WriteString("\n## Steps\n\n")
+		for _, s := range summaries {
+			sb.WriteString("- " + strings.ReplaceAll(strings.TrimSpace(s), "\n", " ") + "\n")
+		}
+	}
+	return sb.String()
+}
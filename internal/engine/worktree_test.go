@@ -0,0 +1,345 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/logs"
+	"github.com/JuanVilla424/teamoon/internal/plan"
+	"github.com/JuanVilla424/teamoon/internal/queue"
+)
+
+func initTestRepo(t *testing.T) config.Config {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	cfg := config.DefaultConfig()
+	cfg.ProjectsDir = filepath.Join(home, "projects")
+	repo := filepath.Join(cfg.ProjectsDir, "proj")
+	if err := os.MkdirAll(repo, 0755); err != nil {
+		t.Fatal(err)
+	}
+	mustGit(t, repo, "init", "-q", "-b", "dev")
+	os.WriteFile(filepath.Join(repo, "README.md"), []byte("hello\n"), 0644)
+	mustGit(t, repo, "add", ".")
+	mustGit(t, repo, "commit", "-q", "-m", "init")
+	return cfg
+}
+
+func mustGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := runGit(dir, args...)
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return out
+}
+
+func TestWorkspace_MergeOnComplete(t *testing.T) {
+	cfg := initTestRepo(t)
+	task := queue.Task{ID: 7, Project: "proj", Description: "add file"}
+
+	ws, err := prepareWorkspace(task, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ws.isolated() || ws.Branch != "teamoon/task-7" {
+		t.Fatalf("expected isolated workspace on task branch, got %+v", ws)
+	}
+	if ws.Dir == ws.RepoDir {
+		t.Fatal("worktree must not be the main checkout")
+	}
+
+	os.WriteFile(filepath.Join(ws.Dir, "feature.txt"), []byte("x\n"), 0644)
+	mustGit(t, ws.Dir, "add", ".")
+	mustGit(t, ws.Dir, "commit", "-q", "-m", "feature")
+	if _, err := os.Stat(filepath.Join(ws.RepoDir, "feature.txt")); err == nil {
+		t.Fatal("main checkout must not see worktree commits before merge")
+	}
+
+	if _, err := completeWorkspace(ws, task, cfg, nil, func(logs.LogLevel, string) {}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(ws.RepoDir, "feature.txt")); err != nil {
+		t.Error("expected feature.txt merged into dev checkout")
+	}
+	if _, err := os.Stat(ws.Dir); !os.IsNotExist(err) {
+		t.Error("expected worktree directory to be removed")
+	}
+	if gitRefExists(ws.RepoDir, "refs/heads/"+ws.Branch) {
+		t.Error("expected task branch to be deleted after merge")
+	}
+}
+
+func TestWorkspace_DeliversBranchesFromSameBase(t *testing.T) {
+	cfg := initTestRepo(t)
+	deliver := func(wss []workspace, tasks []queue.Task, parallel bool) {
+		t.Helper()
+		errs := make([]error, len(wss))
+		var wg sync.WaitGroup
+		for i := range wss {
+			run := func() {
+				_, errs[i] = completeWorkspace(wss[i], tasks[i], cfg, nil, func(logs.LogLevel, string) {})
+			}
+			if !parallel {
+				run()
+				continue
+			}
+			wg.Add(1)
+			go func() { defer wg.Done(); run() }()
+		}
+		wg.Wait()
+		for i, err := range errs {
+			if err != nil {
+				t.Errorf("deliver task #%d: %v", tasks[i].ID, err)
+			}
+		}
+	}
+	prepare := func(ids ...int) ([]workspace, []queue.Task) {
+		t.Helper()
+		var wss []workspace
+		var tasks []queue.Task
+		for _, id := range ids {
+			task := queue.Task{ID: id, Project: "proj"}
+			ws, err := prepareWorkspace(task, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			name := fmt.Sprintf("task%d.txt", id)
+			os.WriteFile(filepath.Join(ws.Dir, name), []byte("x\n"), 0644)
+			mustGit(t, ws.Dir, "add", ".")
+			mustGit(t, ws.Dir, "commit", "-q", "-m", name)
+			wss, tasks = append(wss, ws), append(tasks, task)
+		}
+		return wss, tasks
+	}
+
+	wss, tasks := prepare(20, 21)
+	deliver(wss, tasks, false)
+	wss, tasks = prepare(22, 23, 24)
+	deliver(wss, tasks, true)
+
+	for id := 20; id <= 24; id++ {
+		if _, err := os.Stat(filepath.Join(wss[0].RepoDir, fmt.Sprintf("task%d.txt", id))); err != nil {
+			t.Errorf("work of task #%d missing from dev", id)
+		}
+	}
+}
+
+func TestWorkspace_ParallelTasksAreIsolated(t *testing.T) {
+	cfg := initTestRepo(t)
+	a, err := prepareWorkspace(queue.Task{ID: 1, Project: "proj"}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := prepareWorkspace(queue.Task{ID: 2, Project: "proj"}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Dir == b.Dir {
+		t.Fatal("parallel tasks share a working directory")
+	}
+	os.WriteFile(filepath.Join(a.Dir, "a.txt"), []byte("a\n"), 0644)
+	if _, err := os.Stat(filepath.Join(b.Dir, "a.txt")); err == nil {
+		t.Error("edit in one worktree leaked into another")
+	}
+}
+
+func TestWorkspace_RemoveDiscardsBranch(t *testing.T) {
+	cfg := initTestRepo(t)
+	ws, err := prepareWorkspace(queue.Task{ID: 3, Project: "proj"}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	removeWorkspace(ws, true)
+	if _, err := os.Stat(ws.Dir); !os.IsNotExist(err) {
+		t.Error("expected worktree directory to be removed")
+	}
+	if gitRefExists(ws.RepoDir, "refs/heads/"+ws.Branch) {
+		t.Error("expected task branch to be deleted")
+	}
+}
+
+func TestWorkspace_CommitsLeftoverEdits(t *testing.T) {
+	cfg := initTestRepo(t)
+	task := queue.Task{ID: 10, Project: "proj"}
+	ws, err := prepareWorkspace(task, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(ws.Dir, "forgot.txt"), []byte("x\n"), 0644)
+
+	if _, err := completeWorkspace(ws, task, cfg, nil, func(logs.LogLevel, string) {}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(ws.RepoDir, "forgot.txt")); err != nil {
+		t.Error("uncommitted edit was not delivered")
+	}
+}
+
+func TestWorkspace_RemoveKeepsDirtyWorktree(t *testing.T) {
+	cfg := initTestRepo(t)
+	ws, err := prepareWorkspace(queue.Task{ID: 11, Project: "proj"}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(ws.Dir, "wip.txt"), []byte("x\n"), 0644)
+
+	if err := removeWorkspace(ws, true); err == nil {
+		t.Error("expected removing a dirty worktree to fail")
+	}
+	if _, err := os.Stat(filepath.Join(ws.Dir, "wip.txt")); err != nil {
+		t.Error("uncommitted edit was destroyed")
+	}
+	if !gitRefExists(ws.RepoDir, "refs/heads/"+ws.Branch) {
+		t.Error("branch of a kept worktree was deleted")
+	}
+}
+
+func TestDiscardWorkspace(t *testing.T) {
+	cfg := initTestRepo(t)
+	task := queue.Task{ID: 12, Project: "proj"}
+	ws, err := prepareWorkspace(task, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(ws.Dir, "wip.txt"), []byte("x\n"), 0644)
+
+	if err := DiscardWorkspace(cfg, task); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(ws.Dir); !os.IsNotExist(err) {
+		t.Error("expected worktree directory to be removed")
+	}
+	if gitRefExists(ws.RepoDir, "refs/heads/"+ws.Branch) {
+		t.Error("expected task branch to be deleted")
+	}
+	if err := DiscardWorkspace(cfg, queue.Task{ID: 13, Project: "proj"}); err != nil {
+		t.Errorf("task without a worktree: %v", err)
+	}
+}
+
+func TestRunTask_RetryResumesInWorktree(t *testing.T) {
+	cfg := initTestRepo(t)
+	os.MkdirAll(config.ConfigDir(), 0755)
+	cfg.Spawn.Runtime = RuntimeFake
+	first := writeTurn("one")
+	first.Hook = func(req AgentRequest) {
+		os.WriteFile(filepath.Join(req.Dir, "a.txt"), []byte("one\n"), 0644)
+	}
+	fail := FakeTurn{ExitCode: 1, Events: []StreamEvent{FakeResult("boom")}}
+	recovery := FakeTurn{Events: []StreamEvent{FakeResult("try again")}}
+	RegisterRuntime(NewFakeRuntime(first, fail, recovery, fail, recovery, fail))
+
+	task, _ := queue.Add("proj", "build the thing", "med")
+	queue.SetPlanFile(task.ID, "plan.md")
+	runTask(context.Background(), task, twoStepPlan(), cfg, func(tea.Msg) {})
+
+	got, _ := queue.GetTask(task.ID)
+	if got.State != queue.StateFailed || got.CurrentStep != 1 {
+		t.Fatalf("expected failed after step 1, got %s at step %d", got.State, got.CurrentStep)
+	}
+
+	fake := NewFakeRuntime(writeTurn("two"))
+	RegisterRuntime(fake)
+	if got, err := queue.Retry(task.ID); err != nil || got.CurrentStep != 1 {
+		t.Fatalf("retry: %v, step %d", err, got.CurrentStep)
+	}
+	got, _ = queue.GetTask(task.ID)
+	runTask(context.Background(), got, twoStepPlan(), cfg, func(tea.Msg) {})
+
+	got, _ = queue.GetTask(task.ID)
+	if got.State != queue.StateDone {
+		t.Fatalf("expected done after retry, got %s (%s)", got.State, got.FailReason)
+	}
+	if reqs := fake.Requests(); len(reqs) != 1 || !strings.Contains(reqs[0].Prompt, "edit a.txt") {
+		t.Errorf("retry should only run step 2, got %d sessions", len(reqs))
+	}
+	if _, err := os.Stat(filepath.Join(cfg.ProjectsDir, "proj", "a.txt")); err != nil {
+		t.Error("step 1 work from the first run was not delivered")
+	}
+}
+
+func TestDiscardWorkspaces_IncludesSubtasks(t *testing.T) {
+	cfg := initTestRepo(t)
+	os.MkdirAll(config.ConfigDir(), 0755)
+	epic, _ := queue.Add("proj", "epic", "med")
+	child, _ := queue.Add("proj", "child", "med")
+	queue.SetParent(child.ID, epic.ID)
+	var wss []workspace
+	for _, task := range []queue.Task{epic, child} {
+		ws, err := prepareWorkspace(task, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wss = append(wss, ws)
+	}
+
+	DiscardWorkspaces(cfg, epic.ID)
+	for _, ws := range wss {
+		if _, err := os.Stat(ws.Dir); !os.IsNotExist(err) {
+			t.Errorf("worktree %s left behind", ws.Dir)
+		}
+		if gitRefExists(ws.RepoDir, "refs/heads/"+ws.Branch) {
+			t.Errorf("branch %s left behind", ws.Branch)
+		}
+	}
+}
+
+func TestWorkspace_DisabledOrNotGit(t *testing.T) {
+	cfg := initTestRepo(t)
+	cfg.Worktrees.Enabled = false
+	ws, err := prepareWorkspace(queue.Task{ID: 4, Project: "proj"}, cfg)
+	if err != nil || ws.isolated() {
+		t.Errorf("disabled worktrees should use the checkout, got %+v %v", ws, err)
+	}
+
+	cfg.Worktrees.Enabled = true
+	os.MkdirAll(filepath.Join(cfg.ProjectsDir, "plain"), 0755)
+	ws, err = prepareWorkspace(queue.Task{ID: 5, Project: "plain"}, cfg)
+	if err != nil || ws.isolated() {
+		t.Errorf("non-git project should use the checkout, got %+v %v", ws, err)
+	}
+}
+
+func TestWorkspace_PRDeliveryForcesWorktree(t *testing.T) {
+	cfg := initTestRepo(t)
+	cfg.Worktrees.Enabled = false
+	cfg.Worktrees.Projects = map[string]string{"proj": config.WorktreeOnCompletePR}
+	ws, err := prepareWorkspace(queue.Task{ID: 6, Project: "proj"}, cfg)
+	if err != nil || !ws.isolated() {
+		t.Fatalf("pr delivery needs a task branch, got %+v %v", ws, err)
+	}
+	removeWorkspace(ws, true)
+}
+
+func TestPRBody(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	task := queue.Task{ID: 9, Project: "proj", Description: "add login"}
+	os.MkdirAll(plan.PlansDir(), 0755)
+	os.WriteFile(plan.PlanPath(9), []byte("# Plan: login\n\n### Step 1: form\n"), 0644)
+
+	body := prBody(task, []string{"Step 1: built the form\nand styled it"})
+	for _, want := range []string{"Autopilot task #9 (proj)", "add login", "<summary>Plan</summary>", "### Step 1: form", "- Step 1: built the form and styled it"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body missing %q:\n%s", want, body)
+		}
+	}
+}
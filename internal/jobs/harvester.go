@@ -63,7 +63,8 @@ func RunHarvester(cfg config.Config) string {
 			log.Printf("[harvester] %s: failed to create task: %v", p.Name, err)
 			continue
 		}
-		queue.ToggleAutoPilot(t.ID)
+		queue.RecordAction(t.ID, queue.ActorJob, "created by security harvester")
+		queue.SetAutoPilot(t.ID, true)
 		tasksCreated++
 		log.Printf("[harvester] %s: created security task #%d", p.Name, t.ID)
 	}
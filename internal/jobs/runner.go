@@ -1,22 +1,40 @@
 package jobs
 
 import (
-	"bufio"
 	"context"
-	"encoding/json"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/JuanVilla424/teamoon/internal/config"
 	"github.com/JuanVilla424/teamoon/internal/engine"
+	"github.com/JuanVilla424/teamoon/internal/metrics"
+	"github.com/JuanVilla424/teamoon/internal/webhook"
 )
 
 // RunJob spawns a Claude session for the given job and captures the result.
+// The run is added to the job's history and a job_finished webhook event
+// carries the outcome.
 func RunJob(ctx context.Context, job Job, cfg config.Config) string {
+	started := time.Now()
+	result := runJob(ctx, job, cfg)
+	status := StatusDone
+	if j, ok := GetByID(job.ID); ok {
+		status = j.Status
+	}
+	if err := recordRun(Run{JobID: job.ID, Status: status, Result: result, StartedAt: started, FinishedAt: time.Now()}); err != nil {
+		log.Printf("[jobs] job #%d run history: %v", job.ID, err)
+	}
+	webhook.Publish(webhook.EventJobFinished, map[string]any{
+		"job":    map[string]any{"id": job.ID, "name": job.Name, "project": job.Project},
+		"status": status,
+		"result": result,
+	})
+	return result
+}
+
+func runJob(ctx context.Context, job Job, cfg config.Config) string {
 	SetStatus(job.ID, StatusRunning)
 
 	// Native harvester — no Claude spawn needed
@@ -37,11 +55,6 @@ func RunJob(ctx context.Context, job Job, cfg config.Config) string {
 		projectPath = home
 	}
 
-	args, cleanup := engine.BuildSpawnArgs(cfg, job.Instruction, nil, "")
-	if cleanup != nil {
-		defer cleanup()
-	}
-
 	spawnCtx := ctx
 	var cancel context.CancelFunc
 	if cfg.Spawn.StepTimeoutMin > 0 {
@@ -51,28 +64,20 @@ func RunJob(ctx context.Context, job Job, cfg config.Config) string {
 	}
 	defer cancel()
 
-	env := os.Environ()
-	cmd := exec.CommandContext(spawnCtx, "claude", args...)
-	cmd.Env = env
-	cmd.Dir = projectPath
-
-	devNull, _ := os.Open(os.DevNull)
-	if devNull != nil {
-		cmd.Stdin = devNull
-		defer devNull.Close()
-	}
-
-	stdout, err := cmd.StdoutPipe()
+	rt, err := engine.RuntimeFor(cfg)
 	if err != nil {
-		result := "failed to create pipe: " + err.Error()
+		result := err.Error()
 		SetStatus(job.ID, StatusError)
 		SetLastRun(job.ID, result)
 		return result
 	}
-	cmd.Stderr = nil
-
-	if err := cmd.Start(); err != nil {
-		result := "failed to start claude: " + err.Error()
+	sess, err := rt.Start(spawnCtx, engine.AgentRequest{
+		Prompt: job.Instruction,
+		Dir:    projectPath,
+		Config: cfg,
+	})
+	if err != nil {
+		result := "failed to start agent: " + err.Error()
 		SetStatus(job.ID, StatusError)
 		SetLastRun(job.ID, result)
 		return result
@@ -81,23 +86,7 @@ func RunJob(ctx context.Context, job Job, cfg config.Config) string {
 	log.Printf("[jobs] job #%d %q running in %s", job.ID, job.Name, projectPath)
 
 	var lastText string
-	scanner := bufio.NewScanner(stdout)
-	scanner.Buffer(make([]byte, 256*1024), 256*1024)
-	for scanner.Scan() {
-		line := scanner.Text()
-		var event struct {
-			Type    string `json:"type"`
-			Result  string `json:"result,omitempty"`
-			Message *struct {
-				Content []struct {
-					Type string `json:"type"`
-					Text string `json:"text,omitempty"`
-				} `json:"content"`
-			} `json:"message,omitempty"`
-		}
-		if json.Unmarshal([]byte(line), &event) != nil {
-			continue
-		}
+	for event := range sess.Events() {
 		switch event.Type {
 		case "assistant":
 			if event.Message != nil {
@@ -114,7 +103,8 @@ func RunJob(ctx context.Context, job Job, cfg config.Config) string {
 		}
 	}
 
-	err = cmd.Wait()
+	res, err := sess.Wait()
+	engine.RecordSpend(metrics.SpendRecord{Kind: metrics.SpendJob, JobID: job.ID, Project: job.Project}, res, engine.ResolveModel(cfg.Spawn.Model, "exec"))
 
 	// Truncate result for storage
 	result := lastText
@@ -122,8 +112,8 @@ func RunJob(ctx context.Context, job Job, cfg config.Config) string {
 		result = result[:500] + "..."
 	}
 
-	if err != nil {
-		if strings.Contains(err.Error(), "signal: killed") || spawnCtx.Err() != nil {
+	if err != nil || res.ExitCode != 0 {
+		if spawnCtx.Err() != nil {
 			result = "timeout: " + result
 		}
 		SetStatus(job.ID, StatusError)
@@ -0,0 +1,102 @@
+package jobs
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/persist"
+)
+
+// Run is one finished execution of a job.
+type Run struct {
+	ID         int       `json:"id"`
+	JobID      int       `json:"job_id"`
+	Status     JobStatus `json:"status"`
+	Result     string    `json:"result,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// maxRunsPerJob bounds the history kept for each job; older runs are dropped.
+const maxRunsPerJob = 50
+
+type runStore struct {
+	NextID int   `json:"next_id"`
+	Runs   []Run `json:"runs"`
+}
+
+var runsMu = persist.NewMutex(runsPath)
+
+func runsPath() string {
+	return filepath.Join(config.ConfigDir(), "job_runs.json")
+}
+
+func loadRuns() (runStore, error) {
+	store := runStore{NextID: 1}
+	data, err := os.ReadFile(runsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return store, nil
+		}
+		return store, err
+	}
+	err = json.Unmarshal(data, &store)
+	return store, err
+}
+
+// recordRun appends a finished run to the history of its job.
+func recordRun(r Run) error {
+	runsMu.Lock()
+	defer runsMu.Unlock()
+
+	store, err := loadRuns()
+	if err != nil {
+		return err
+	}
+	r.ID = store.NextID
+	store.NextID++
+	store.Runs = append(store.Runs, r)
+
+	count := 0
+	kept := make([]Run, 0, len(store.Runs))
+	for i := len(store.Runs) - 1; i >= 0; i-- {
+		if store.Runs[i].JobID == r.JobID {
+			count++
+			if count > maxRunsPerJob {
+				continue
+			}
+		}
+		kept = append(kept, store.Runs[i])
+	}
+	for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+		kept[i], kept[j] = kept[j], kept[i]
+	}
+	store.Runs = kept
+
+	data, err := json.MarshalIndent(store, "", "  ")
+	if err != nil {
+		return err
+	}
+	return persist.WriteFile(runsPath(), data, 0644)
+}
+
+// ListRuns returns the recorded runs of job id, newest first.
+func ListRuns(id int) ([]Run, error) {
+	runsMu.Lock()
+	defer runsMu.Unlock()
+
+	store, err := loadRuns()
+	if err != nil {
+		return nil, err
+	}
+	out := []Run{}
+	for i := len(store.Runs) - 1; i >= 0; i-- {
+		if store.Runs[i].JobID == id {
+			out = append(out, store.Runs[i])
+		}
+	}
+	return out, nil
+}
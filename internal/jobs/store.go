@@ -6,10 +6,10 @@ import (
 	"log"
 	"os"
 	"path/filepath"
-	"sync"
 	"time"
 
 	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/persist"
 )
 
 type JobStatus string
@@ -40,7 +40,7 @@ type jobStore struct {
 	Jobs   []Job `json:"jobs"`
 }
 
-var storeMu sync.Mutex
+var storeMu = persist.NewMutex(jobsPath)
 
 func jobsPath() string {
 	return filepath.Join(config.ConfigDir(), "jobs.json")
@@ -68,7 +68,7 @@ func saveStore(store jobStore) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(jobsPath(), data, 0644)
+	return persist.WriteFile(jobsPath(), data, 0644)
 }
 
 func ListAll() ([]Job, error) {
@@ -1,38 +1,16 @@
 package metrics
 
-// Claude API pricing per million tokens (Feb 2026)
-type modelPricing struct {
-	Input      float64
-	Output     float64
-	CacheRead  float64
-	CacheWrite float64
-}
-
-var pricing = map[string]modelPricing{
-	"opus-4-6":  {Input: 15.0, Output: 75.0, CacheRead: 1.875, CacheWrite: 18.75},
-	"sonnet-4-6": {Input: 3.0, Output: 15.0, CacheRead: 0.30, CacheWrite: 3.75},
-	"haiku-4-5":  {Input: 0.80, Output: 4.0, CacheRead: 0.08, CacheWrite: 1.0},
-}
-
+// tokenCost sums the per-request costs collected while scanning. Summaries
+// without per-model data are priced at the table's default entry.
 func tokenCost(s TokenSummary) float64 {
 	if len(s.ByModel) == 0 {
-		// Fallback to sonnet-4-6 pricing if no model info
-		p := pricing["sonnet-4-6"]
-		return (float64(s.Input)*p.Input +
-			float64(s.Output)*p.Output +
-			float64(s.CacheRead)*p.CacheRead +
-			float64(s.CacheCreate)*p.CacheWrite) / 1_000_000.0
+		table := Pricing()
+		p, _, _ := table.Lookup("")
+		return p.cost(s.Input, s.Output, s.CacheRead, s.CacheCreate)
 	}
 	var total float64
-	for tier, mt := range s.ByModel {
-		p, ok := pricing[tier]
-		if !ok {
-			p = pricing["sonnet-4-6"]
-		}
-		total += (float64(mt.Input)*p.Input +
-			float64(mt.Output)*p.Output +
-			float64(mt.CacheRead)*p.CacheRead +
-			float64(mt.CacheCreate)*p.CacheWrite) / 1_000_000.0
+	for _, mt := range s.ByModel {
+		total += mt.Cost
 	}
 	return total
 }
@@ -62,3 +40,11 @@ func CalculateCost(today, week, month TokenSummary) CostSummary {
 		OutputMonth:   month.Output,
 	}
 }
+
+// EstimateCost prices a single spawn from its token counts, for runtimes that
+// do not report a cost themselves. The counts are totals over many requests,
+// so base rates are used rather than the long-context tier.
+func EstimateCost(model string, input, output, cacheRead, cacheCreate int) float64 {
+	p, _, _ := Pricing().Lookup(model)
+	return p.cost(input, output, cacheRead, cacheCreate)
+}
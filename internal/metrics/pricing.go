@@ -0,0 +1,246 @@
+package metrics
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/persist"
+)
+
+// TokenPrices are USD per million tokens.
+type TokenPrices struct {
+	Input      float64 `json:"input"`
+	Output     float64 `json:"output"`
+	CacheRead  float64 `json:"cache_read"`
+	CacheWrite float64 `json:"cache_write"`
+}
+
+func (p TokenPrices) cost(input, output, cacheRead, cacheCreate int) float64 {
+	return (float64(input)*p.Input +
+		float64(output)*p.Output +
+		float64(cacheRead)*p.CacheRead +
+		float64(cacheCreate)*p.CacheWrite) / 1_000_000.0
+}
+
+// LongContextPrices apply to a request whose prompt (input plus cache read
+// and write) exceeds ThresholdTokens.
+type LongContextPrices struct {
+	ThresholdTokens int `json:"threshold_tokens"`
+	TokenPrices
+}
+
+// ModelPrice is one entry of the pricing table.
+type ModelPrice struct {
+	TokenPrices
+	LongContext *LongContextPrices `json:"long_context,omitempty"`
+	Batch       *TokenPrices       `json:"batch,omitempty"`
+}
+
+// RequestCost prices a single API request, switching to the long-context
+// tier when its prompt crosses the threshold.
+func (m ModelPrice) RequestCost(u Usage, batch bool) float64 {
+	p := m.TokenPrices
+	if batch && m.Batch != nil {
+		p = *m.Batch
+	}
+	if lc := m.LongContext; lc != nil && !batch &&
+		u.InputTokens+u.CacheReadInputTokens+u.CacheCreationInputTokens > lc.ThresholdTokens {
+		p = lc.TokenPrices
+	}
+	return p.cost(u.InputTokens, u.OutputTokens, u.CacheReadInputTokens, u.CacheCreationInputTokens)
+}
+
+// PricingTable maps model IDs (or ID prefixes) to prices. Default names the
+// entry used for models nothing matches.
+type PricingTable struct {
+	Version int                   `json:"version"`
+	Updated string                `json:"updated"`
+	Default string                `json:"default"`
+	Models  map[string]ModelPrice `json:"models"`
+}
+
+//go:embed pricing.json
+var defaultPricingJSON []byte
+
+// DefaultPricing returns the table compiled into the binary.
+func DefaultPricing() PricingTable {
+	var t PricingTable
+	if err := json.Unmarshal(defaultPricingJSON, &t); err != nil {
+		panic("metrics: embedded pricing.json: " + err.Error())
+	}
+	return t
+}
+
+// PricingPath is the user override file; entries in it replace or extend the
+// embedded defaults.
+func PricingPath() string {
+	return filepath.Join(config.ConfigDir(), "pricing.json")
+}
+
+// Lookup resolves model to a price. It tries the exact ID, then drops
+// trailing "-segment"s (so "claude-haiku-4-5-20251001" finds
+// "claude-haiku-4-5", then "claude-haiku"). matched is the entry used; ok is
+// false when the model fell through to the default entry.
+func (t PricingTable) Lookup(model string) (price ModelPrice, matched string, ok bool) {
+	key := strings.ToLower(model)
+	for key != "" {
+		if p, found := t.Models[key]; found {
+			return p, key, true
+		}
+		i := strings.LastIndex(key, "-")
+		if i < 0 {
+			break
+		}
+		key = key[:i]
+	}
+	return t.Models[t.Default], t.Default, false
+}
+
+type pricingCache struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	loaded  bool
+	table   PricingTable
+}
+
+var pricingState pricingCache
+
+// Pricing returns the active table: the embedded defaults merged with
+// PricingPath when it exists. The file is re-read when it changes.
+func Pricing() PricingTable {
+	path := PricingPath()
+	var modTime time.Time
+	info, statErr := os.Stat(path)
+	if statErr == nil {
+		modTime = info.ModTime()
+	}
+
+	pricingState.mu.Lock()
+	defer pricingState.mu.Unlock()
+	if pricingState.loaded && pricingState.path == path && pricingState.modTime.Equal(modTime) {
+		return pricingState.table
+	}
+
+	table := DefaultPricing()
+	if statErr == nil {
+		if user, err := loadPricingFile(path); err != nil {
+			log.Printf("[pricing] ignoring %s: %v", path, err)
+		} else {
+			if user.Version < table.Version {
+				log.Printf("[pricing] %s is version %d, defaults are version %d; missing models use the defaults", path, user.Version, table.Version)
+			}
+			for k, v := range user.Models {
+				table.Models[strings.ToLower(k)] = v
+			}
+			if user.Default != "" {
+				table.Default = user.Default
+			}
+			table.Version, table.Updated = user.Version, user.Updated
+		}
+	}
+	pricingState.path = path
+	pricingState.modTime = modTime
+	pricingState.loaded = true
+	pricingState.table = table
+	return table
+}
+
+// WriteDefaultPricing copies the embedded table to PricingPath so it can be
+// edited. An existing file is left alone.
+func WriteDefaultPricing() (string, error) {
+	path := PricingPath()
+	if _, err := os.Stat(path); err == nil {
+		return path, fmt.Errorf("%s already exists", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return path, err
+	}
+	return path, persist.WriteFile(path, defaultPricingJSON, 0644)
+}
+
+func loadPricingFile(path string) (PricingTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return PricingTable{}, err
+	}
+	var t PricingTable
+	if err := json.Unmarshal(data, &t); err != nil {
+		return PricingTable{}, fmt.Errorf("parse: %w", err)
+	}
+	return t, nil
+}
+
+// ModelSeen summarises a model found in session logs or the spend ledger.
+type ModelSeen struct {
+	Model    string `json:"model"`
+	Requests int    `json:"requests"`
+	Input    int    `json:"input"`
+	Output   int    `json:"output"`
+	Matched  string `json:"matched"` // pricing entry used
+	Priced   bool   `json:"priced"`  // false when only the default entry applied
+}
+
+// ModelsSeen lists every model that used tokens since the given time, from
+// the Claude session logs under claudeDir and from the spend ledger.
+func ModelsSeen(claudeDir string, since time.Time) ([]ModelSeen, error) {
+	table := Pricing()
+	byModel := make(map[string]*ModelSeen)
+	add := func(model string, input, output int) {
+		if model == "" || input+output == 0 {
+			return
+		}
+		m := byModel[model]
+		if m == nil {
+			_, matched, ok := table.Lookup(model)
+			m = &ModelSeen{Model: model, Matched: matched, Priced: ok}
+			byModel[model] = m
+		}
+		m.Requests++
+		m.Input += input
+		m.Output += output
+	}
+
+	for _, f := range collectJSONL(filepath.Join(claudeDir, "projects")) {
+		info, err := os.Stat(f)
+		if err != nil || info.ModTime().Before(since) {
+			continue
+		}
+		for _, e := range parseJSONL(f) {
+			if e.Message == nil {
+				continue
+			}
+			add(e.Message.Model, e.Message.Usage.InputTokens, e.Message.Usage.OutputTokens)
+		}
+	}
+	records, err := LoadSpend()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range records {
+		if !r.Time.Before(since) {
+			add(r.Model, r.Input, r.Output)
+		}
+	}
+
+	out := make([]ModelSeen, 0, len(byModel))
+	for _, m := range byModel {
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Priced != out[j].Priced {
+			return !out[i].Priced
+		}
+		return out[i].Model < out[j].Model
+	})
+	return out, nil
+}
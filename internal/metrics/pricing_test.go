@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"math"
+	"os"
+	"testing"
+	"time"
+)
+
+func approx(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+func TestPricingLookup(t *testing.T) {
+	table := DefaultPricing()
+	cases := []struct {
+		model, matched string
+		ok             bool
+	}{
+		{"claude-sonnet-4-6", "claude-sonnet-4-6", true},
+		{"claude-haiku-4-5-20251001", "claude-haiku-4-5", true},
+		{"claude-opus-4-1", "claude-opus", true},
+		{"gpt-9", table.Default, false},
+		{"", table.Default, false},
+	}
+	for _, c := range cases {
+		_, matched, ok := table.Lookup(c.model)
+		if matched != c.matched || ok != c.ok {
+			t.Errorf("Lookup(%q) = %q %v, want %q %v", c.model, matched, ok, c.matched, c.ok)
+		}
+	}
+}
+
+func TestRequestCost_Tiers(t *testing.T) {
+	p, _, _ := DefaultPricing().Lookup("claude-sonnet-4-6")
+	small := Usage{InputTokens: 100_000}
+	if got := p.RequestCost(small, false); !approx(got, 0.3) {
+		t.Errorf("base input cost = %v, want 0.3", got)
+	}
+	if got := p.RequestCost(small, true); !approx(got, 0.15) {
+		t.Errorf("batch input cost = %v, want 0.15", got)
+	}
+	long := Usage{InputTokens: 150_000, CacheReadInputTokens: 100_000}
+	want := (150_000*6.0 + 100_000*0.6) / 1_000_000
+	if got := p.RequestCost(long, false); !approx(got, want) {
+		t.Errorf("long-context cost = %v, want %v", got, want)
+	}
+}
+
+func TestPricing_UserOverride(t *testing.T) {
+	setupSpendEnv(t)
+	if EstimateCost("acme-1", 1_000_000, 0, 0, 0) != 3 {
+		t.Fatal("expected unknown model to use the default entry")
+	}
+	override := `{"version": 2, "models": {"acme-1": {"input": 10, "output": 20}}}`
+	if err := os.WriteFile(PricingPath(), []byte(override), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Make sure the cache notices the new file even within one mtime tick.
+	os.Chtimes(PricingPath(), time.Now().Add(time.Second), time.Now().Add(time.Second))
+
+	if got := EstimateCost("acme-1-preview", 1_000_000, 1_000_000, 0, 0); !approx(got, 30) {
+		t.Errorf("override cost = %v, want 30", got)
+	}
+	if got := EstimateCost("claude-opus-4-6", 0, 1_000_000, 0, 0); !approx(got, 75) {
+		t.Errorf("defaults should survive a partial override, got %v", got)
+	}
+	if _, err := WriteDefaultPricing(); err == nil {
+		t.Error("expected WriteDefaultPricing to refuse to overwrite")
+	}
+}
+
+func TestModelsSeen_FlagsUnpriced(t *testing.T) {
+	setupSpendEnv(t)
+	claudeDir := t.TempDir()
+	writeSessionJSONL(t, claudeDir,
+		usageLine(time.Now(), 10, 5),
+		`{"message":{"model":"mystery-model","usage":{"input_tokens":3,"output_tokens":4}}}`,
+	)
+	RecordSpend(SpendRecord{Kind: SpendStep, Model: "mystery-model", Input: 1, Output: 1})
+
+	seen, err := ModelsSeen(claudeDir, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 2 || seen[0].Model != "mystery-model" || seen[0].Priced || seen[0].Requests != 2 {
+		t.Fatalf("expected unpriced model listed first with 2 requests, got %+v", seen)
+	}
+	if !seen[1].Priced || seen[1].Matched != "claude-sonnet" {
+		t.Errorf("expected claude-sonnet to match its family entry, got %+v", seen[1])
+	}
+}
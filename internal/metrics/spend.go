@@ -0,0 +1,269 @@
+package metrics
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/persist"
+)
+
+// SpendKind says what an agent spawn was for.
+type SpendKind string
+
+const (
+	SpendPlan     SpendKind = "plan"
+	SpendStep     SpendKind = "step"
+	SpendRecovery SpendKind = "recovery"
+	SpendJob      SpendKind = "job"
+	SpendChat     SpendKind = "chat"
+)
+
+// SpendRecord is one agent spawn in the cost ledger.
+type SpendRecord struct {
+	Time        time.Time `json:"time"`
+	Kind        SpendKind `json:"kind"`
+	TaskID      int       `json:"task_id,omitempty"`
+	JobID       int       `json:"job_id,omitempty"`
+	Project     string    `json:"project,omitempty"`
+	Step        int       `json:"step,omitempty"`
+	Model       string    `json:"model,omitempty"`
+	SessionID   string    `json:"session_id,omitempty"`
+	Input       int       `json:"input"`
+	Output      int       `json:"output"`
+	CacheRead   int       `json:"cache_read"`
+	CacheCreate int       `json:"cache_create"`
+	CostUSD     float64   `json:"cost_usd"`
+	DurationMs  int64     `json:"duration_ms"`
+}
+
+// SpendTotals aggregates a set of spend records.
+type SpendTotals struct {
+	Spawns      int     `json:"spawns"`
+	Input       int     `json:"input"`
+	Output      int     `json:"output"`
+	CacheRead   int     `json:"cache_read"`
+	CacheCreate int     `json:"cache_create"`
+	CostUSD     float64 `json:"cost_usd"`
+	DurationMs  int64   `json:"duration_ms"`
+}
+
+func (t *SpendTotals) Add(r SpendRecord) {
+	t.Spawns++
+	t.Input += r.Input
+	t.Output += r.Output
+	t.CacheRead += r.CacheRead
+	t.CacheCreate += r.CacheCreate
+	t.CostUSD += r.CostUSD
+	t.DurationMs += r.DurationMs
+}
+
+// StepSpend is the cost of one plan step (or of planning, with Step 0) for a task.
+type StepSpend struct {
+	Kind SpendKind `json:"kind"`
+	Step int       `json:"step"`
+	SpendTotals
+}
+
+// TaskSpend is the cost breakdown of a single task.
+type TaskSpend struct {
+	Steps []StepSpend `json:"steps"`
+	Total SpendTotals `json:"total"`
+}
+
+var spendMu = persist.NewMutex(spendPath)
+
+func spendPath() string {
+	return filepath.Join(config.ConfigDir(), "spend.jsonl")
+}
+
+// RecordSpend appends r to the ledger. The ledger is append-only so a crash
+// can lose at most the record being written.
+func RecordSpend(r SpendRecord) error {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	if r.CostUSD == 0 {
+		r.CostUSD = EstimateCost(r.Model, r.Input, r.Output, r.CacheRead, r.CacheCreate)
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	spendMu.Lock()
+	defer spendMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(spendPath()), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(spendPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	spendCache.invalidate()
+	log.Printf("[spend] %s task=%d step=%d job=%d $%.4f in=%d out=%d", r.Kind, r.TaskID, r.Step, r.JobID, r.CostUSD, r.Input, r.Output)
+	return nil
+}
+
+// ledgerCache keeps the parsed ledger until the file changes, since the web
+// snapshot reads project totals on every refresh.
+type ledgerCache struct {
+	mu      sync.Mutex
+	path    string
+	size    int64
+	modTime time.Time
+	records []SpendRecord
+}
+
+var spendCache ledgerCache
+
+func (c *ledgerCache) invalidate() {
+	c.mu.Lock()
+	c.size = -1
+	c.mu.Unlock()
+}
+
+// LoadSpend returns every record in the ledger, oldest first.
+func LoadSpend() ([]SpendRecord, error) {
+	path := spendPath()
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	spendCache.mu.Lock()
+	defer spendCache.mu.Unlock()
+	if spendCache.records != nil && spendCache.path == path &&
+		info.Size() == spendCache.size && info.ModTime().Equal(spendCache.modTime) {
+		return spendCache.records, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var records []SpendRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r SpendRecord
+		if json.Unmarshal(scanner.Bytes(), &r) != nil {
+			continue // tolerate a torn last line
+		}
+		records = append(records, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading spend ledger: %w", err)
+	}
+	if records == nil {
+		records = []SpendRecord{}
+	}
+	spendCache.path = path
+	spendCache.size = info.Size()
+	spendCache.modTime = info.ModTime()
+	spendCache.records = records
+	return records, nil
+}
+
+// SpendForTask returns the per-step breakdown for a task. Planning is listed
+// first, followed by steps in order; recovery spawns are kept separate from
+// the step attempts they diagnosed.
+func SpendForTask(taskID int) (TaskSpend, error) {
+	records, err := LoadSpend()
+	if err != nil {
+		return TaskSpend{}, err
+	}
+	type key struct {
+		kind SpendKind
+		step int
+	}
+	byKey := make(map[key]*StepSpend)
+	var ts TaskSpend
+	for _, r := range records {
+		if r.TaskID != taskID || r.JobID != 0 {
+			continue
+		}
+		k := key{r.Kind, r.Step}
+		s := byKey[k]
+		if s == nil {
+			s = &StepSpend{Kind: r.Kind, Step: r.Step}
+			byKey[k] = s
+		}
+		s.Add(r)
+		ts.Total.Add(r)
+	}
+	for _, s := range byKey {
+		ts.Steps = append(ts.Steps, *s)
+	}
+	sort.Slice(ts.Steps, func(i, j int) bool {
+		a, b := ts.Steps[i], ts.Steps[j]
+		if a.Step != b.Step {
+			return a.Step < b.Step
+		}
+		return a.Kind == SpendStep && b.Kind != SpendStep
+	})
+	return ts, nil
+}
+
+// SpendByTask sums the ledger per task ID.
+func SpendByTask() (map[int]SpendTotals, error) {
+	records, err := LoadSpend()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[int]SpendTotals)
+	for _, r := range records {
+		if r.TaskID == 0 {
+			continue
+		}
+		t := out[r.TaskID]
+		t.Add(r)
+		out[r.TaskID] = t
+	}
+	return out, nil
+}
+
+// SpendByProject sums the ledger per project. Spawns without a project
+// (e.g. chat outside a project) are grouped under "".
+func SpendByProject() (map[string]SpendTotals, error) {
+	records, err := LoadSpend()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]SpendTotals)
+	for _, r := range records {
+		t := out[r.Project]
+		t.Add(r)
+		out[r.Project] = t
+	}
+	return out, nil
+}
+
+// SpendSince sums records at or after since. An empty project sums everything.
+func SpendSince(since time.Time, project string) (SpendTotals, error) {
+	records, err := LoadSpend()
+	if err != nil {
+		return SpendTotals{}, err
+	}
+	var t SpendTotals
+	for _, r := range records {
+		if r.Time.Before(since) || (project != "" && r.Project != project) {
+			continue
+		}
+		t.Add(r)
+	}
+	return t, nil
+}
@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func setupSpendEnv(t *testing.T) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	os.MkdirAll(filepath.Join(home, ".config", "teamoon"), 0755)
+}
+
+func TestSpendForTask_Breakdown(t *testing.T) {
+	setupSpendEnv(t)
+	records := []SpendRecord{
+		{Kind: SpendPlan, TaskID: 1, Project: "a", Input: 100, CostUSD: 0.10},
+		{Kind: SpendStep, TaskID: 1, Project: "a", Step: 1, Output: 50, CostUSD: 0.20},
+		{Kind: SpendRecovery, TaskID: 1, Project: "a", Step: 1, CostUSD: 0.05},
+		{Kind: SpendStep, TaskID: 1, Project: "a", Step: 1, Output: 25, CostUSD: 0.30},
+		{Kind: SpendStep, TaskID: 1, Project: "a", Step: 2, CostUSD: 0.40},
+		{Kind: SpendStep, TaskID: 2, Project: "b", Step: 1, CostUSD: 1.00},
+		{Kind: SpendJob, JobID: 1, Project: "a", CostUSD: 2.00},
+	}
+	for _, r := range records {
+		if err := RecordSpend(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ts, err := SpendForTask(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ts.Steps) != 4 {
+		t.Fatalf("expected plan, step 1, step 1 recovery, step 2; got %+v", ts.Steps)
+	}
+	if ts.Steps[0].Kind != SpendPlan || ts.Steps[1].Kind != SpendStep || ts.Steps[2].Kind != SpendRecovery || ts.Steps[3].Step != 2 {
+		t.Errorf("unexpected order %+v", ts.Steps)
+	}
+	if ts.Steps[1].Spawns != 2 || ts.Steps[1].Output != 75 {
+		t.Errorf("expected two step 1 attempts with 75 output tokens, got %+v", ts.Steps[1])
+	}
+	if !near(ts.Total.CostUSD, 1.05) {
+		t.Errorf("expected task total 1.05, got %v", ts.Total.CostUSD)
+	}
+
+	byProject, _ := SpendByProject()
+	if !near(byProject["a"].CostUSD, 3.05) || !near(byProject["b"].CostUSD, 1.00) {
+		t.Errorf("unexpected project totals %+v", byProject)
+	}
+	byTask, _ := SpendByTask()
+	if !near(byTask[2].CostUSD, 1.00) || len(byTask) != 2 {
+		t.Errorf("unexpected task totals %+v", byTask)
+	}
+}
+
+func TestRecordSpend_EstimatesMissingCost(t *testing.T) {
+	setupSpendEnv(t)
+	RecordSpend(SpendRecord{Kind: SpendStep, TaskID: 1, Model: "claude-sonnet-4-6", Input: 1_000_000})
+	ts, _ := SpendForTask(1)
+	if !near(ts.Total.CostUSD, 3.0) {
+		t.Errorf("expected sonnet input price, got %v", ts.Total.CostUSD)
+	}
+}
+
+func TestLoadSpend_SkipsTornLine(t *testing.T) {
+	setupSpendEnv(t)
+	RecordSpend(SpendRecord{Kind: SpendChat, CostUSD: 0.5})
+	f, _ := os.OpenFile(spendPath(), os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"kind":"step","cost_u`)
+	f.Close()
+
+	records, err := LoadSpend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Errorf("expected torn line to be skipped, got %d records", len(records))
+	}
+}
+
+func near(a, b float64) bool {
+	d := a - b
+	return d < 1e-9 && d > -1e-9
+}
+
+func TestSpendSince_WindowAndProject(t *testing.T) {
+	setupSpendEnv(t)
+	now := time.Now()
+	for _, r := range []SpendRecord{
+		{Time: now.Add(-48 * time.Hour), Kind: SpendStep, Project: "a", CostUSD: 5},
+		{Time: now.Add(-time.Minute), Kind: SpendStep, Project: "a", CostUSD: 1},
+		{Time: now.Add(-time.Minute), Kind: SpendStep, Project: "b", CostUSD: 2},
+	} {
+		if err := RecordSpend(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	since := now.Add(-time.Hour)
+	if all, _ := SpendSince(since, ""); all.CostUSD != 3 || all.Spawns != 2 {
+		t.Errorf("expected $3 over 2 spawns, got %+v", all)
+	}
+	if a, _ := SpendSince(since, "a"); a.CostUSD != 1 {
+		t.Errorf("expected $1 for project a, got %+v", a)
+	}
+}
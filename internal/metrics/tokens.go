@@ -24,18 +24,6 @@ func contextLimitForModel(model string) int {
 	}
 }
 
-// modelTier returns "opus-4-6", "sonnet-4-6", or "haiku-4-5" from a model string.
-func modelTier(model string) string {
-	m := strings.ToLower(model)
-	if strings.Contains(m, "opus") {
-		return "opus-4-6"
-	}
-	if strings.Contains(m, "haiku") {
-		return "haiku-4-5"
-	}
-	return "sonnet-4-6" // default
-}
-
 type Usage struct {
 	InputTokens              int `json:"input_tokens"`
 	OutputTokens             int `json:"output_tokens"`
@@ -53,12 +41,13 @@ type jsonlEntry struct {
 	Timestamp string   `json:"timestamp,omitempty"`
 }
 
-// ModelTokens tracks tokens per model tier for accurate cost calculation.
+// ModelTokens tracks tokens and cost per model for accurate cost calculation.
 type ModelTokens struct {
 	Input       int
 	Output      int
 	CacheRead   int
 	CacheCreate int
+	Cost        float64 // summed per request so long-context pricing applies
 }
 
 type TokenSummary struct {
@@ -69,10 +58,10 @@ type TokenSummary struct {
 	Total        int                     `json:"total"`
 	LastModel    string                  `json:"last_model"`
 	SessionCount int                     `json:"session_count"`
-	ByModel      map[string]*ModelTokens `json:"-"` // keyed by tier: "opus-4-6", "sonnet-4-6", "haiku-4-5"
+	ByModel      map[string]*ModelTokens `json:"-"` // keyed by model ID ("" when unknown)
 }
 
-func (s *TokenSummary) addUsage(u Usage, tier string) {
+func (s *TokenSummary) addUsage(u Usage, model string, cost float64) {
 	s.Input += u.InputTokens
 	s.Output += u.OutputTokens
 	s.CacheRead += u.CacheReadInputTokens
@@ -80,15 +69,16 @@ func (s *TokenSummary) addUsage(u Usage, tier string) {
 	if s.ByModel == nil {
 		s.ByModel = make(map[string]*ModelTokens)
 	}
-	mt, ok := s.ByModel[tier]
+	mt, ok := s.ByModel[model]
 	if !ok {
 		mt = &ModelTokens{}
-		s.ByModel[tier] = mt
+		s.ByModel[model] = mt
 	}
 	mt.Input += u.InputTokens
 	mt.Output += u.OutputTokens
 	mt.CacheRead += u.CacheReadInputTokens
 	mt.CacheCreate += u.CacheCreationInputTokens
+	mt.Cost += cost
 }
 
 type SessionContext struct {
@@ -128,6 +118,7 @@ func ScanTokens(claudeDir string) (today TokenSummary, week TokenSummary, month
 
 	var latestModTime time.Time
 	var latestModel string
+	table := Pricing()
 
 	for _, d := range dirs {
 		if !d.IsDir() {
@@ -149,7 +140,6 @@ func ScanTokens(claudeDir string) (today TokenSummary, week TokenSummary, month
 			}
 
 			var fileModel string
-			var fileTier string
 			entries := parseJSONL(f)
 			for _, e := range entries {
 				if e.Message == nil || e.Message.Usage.InputTokens == 0 {
@@ -159,21 +149,18 @@ func ScanTokens(claudeDir string) (today TokenSummary, week TokenSummary, month
 				u := e.Message.Usage
 				if e.Message.Model != "" {
 					fileModel = e.Message.Model
-					fileTier = modelTier(e.Message.Model)
-				}
-				tier := fileTier
-				if tier == "" {
-					tier = "sonnet-4-6"
 				}
+				price, _, _ := table.Lookup(fileModel)
+				cost := price.RequestCost(u, false)
 
-				month.addUsage(u, tier)
+				month.addUsage(u, fileModel, cost)
 
 				if modTime.After(weekStart) || modTime.Equal(weekStart) {
-					week.addUsage(u, tier)
+					week.addUsage(u, fileModel, cost)
 				}
 
 				if modTime.After(todayStart) || modTime.Equal(todayStart) {
-					today.addUsage(u, tier)
+					today.addUsage(u, fileModel, cost)
 				}
 			}
 
@@ -11,6 +11,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
 )
 
 // UsagePeriod represents a single usage quota period.
@@ -19,11 +21,15 @@ type UsagePeriod struct {
 	ResetsAt    string  `json:"resets_at"`
 }
 
-// ClaudeUsage holds the usage data parsed from interactive `claude /usage`.
+// ClaudeUsage holds plan usage as reported by a UsageProvider. Known is false
+// until a provider has answered, so callers can tell "0% used" from "no data".
 type ClaudeUsage struct {
 	Session    UsagePeriod `json:"session"`
 	WeekAll    UsagePeriod `json:"week_all"`
 	WeekSonnet UsagePeriod `json:"week_sonnet"`
+	Known      bool        `json:"known"`
+	Source     string      `json:"source,omitempty"`
+	FetchedAt  time.Time   `json:"fetched_at,omitempty"`
 }
 
 var ansiRe = regexp.MustCompile(`\x1b\[[0-9;?]*[a-zA-Z]|\x1b\][^\x07]*\x07|\x1b`)
@@ -59,6 +65,16 @@ expect eof
 // executes /usage (Tab to accept autocomplete + Enter to submit), and parses the log.
 // projectDir should be a trusted project directory to avoid the trust prompt.
 func FetchClaudeUsage(projectDir string) (ClaudeUsage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Second)
+	defer cancel()
+	return fetchClaudeUsage(ctx, projectDir)
+}
+
+func fetchClaudeUsage(ctx context.Context, projectDir string) (ClaudeUsage, error) {
+	if _, err := exec.LookPath("expect"); err != nil {
+		return ClaudeUsage{}, fmt.Errorf("expect not found in PATH")
+	}
+
 	// Temp file for expect log output
 	tmpLog, err := os.CreateTemp("", "teamoon_usage_log_*.txt")
 	if err != nil {
@@ -80,9 +96,6 @@ func FetchClaudeUsage(projectDir string) (ClaudeUsage, error) {
 	os.Chmod(tmpExpPath, 0755)
 	defer os.Remove(tmpExpPath)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Second)
-	defer cancel()
-
 	cmd := exec.CommandContext(ctx, "expect", tmpExpPath)
 	cmd.Env = filterEnvKey(os.Environ(), "CLAUDECODE")
 	cmd.Dir = projectDir
@@ -110,6 +123,9 @@ func parseUsageOutput(raw string) (ClaudeUsage, error) {
 	// Find all "X% used" occurrences in order:
 	// 1st = session, 2nd = week (all models), 3rd = week (Sonnet only)
 	matches := pctUsedRe.FindAllStringSubmatch(raw, -1)
+	if len(matches) == 0 {
+		return usage, fmt.Errorf("no usage figures in /usage output")
+	}
 	if len(matches) >= 1 {
 		usage.Session.Utilization, _ = strconv.ParseFloat(matches[0][1], 64)
 	}
@@ -163,39 +179,59 @@ func filterEnvKey(env []string, key string) []string {
 
 // --- Shared background fetcher ---
 
+const (
+	usageFetchInterval = 2 * time.Minute
+	// usageStaleAfter is how long a reading is trusted once fetches start failing.
+	usageStaleAfter = 10 * time.Minute
+)
+
 var (
 	usageMu    sync.RWMutex
 	usageCache ClaudeUsage
 	usageOnce  sync.Once
 )
 
-// StartUsageFetcher starts a single background goroutine that fetches
-// claude /usage every 2 minutes. Must be called once at startup.
-// projectDir is a trusted project directory to avoid Claude's trust prompt.
-func StartUsageFetcher(projectDir string) {
+// StartUsageFetcher starts a single background goroutine that polls the usage
+// provider selected by cfg.Usage every 2 minutes. Must be called once at startup.
+func StartUsageFetcher(cfg config.Config) {
 	usageOnce.Do(func() {
+		p, err := NewUsageProvider(cfg)
+		if err != nil {
+			log.Printf("[usage] %v; usage will be reported as unknown", err)
+			return
+		}
 		go func() {
 			for {
-				u, err := FetchClaudeUsage(projectDir)
-				usageMu.Lock()
+				ctx, cancel := context.WithTimeout(context.Background(), 50*time.Second)
+				u, err := p.Fetch(ctx)
+				cancel()
 				if err == nil {
+					u.Known = true
+					u.Source = p.Name()
+					u.FetchedAt = time.Now()
+					usageMu.Lock()
 					usageCache = u
-					log.Printf("[usage] session=%.0f%% week_all=%.0f%% week_sonnet=%.0f%% session_resets=%q week_resets=%q",
-						u.Session.Utilization, u.WeekAll.Utilization, u.WeekSonnet.Utilization,
+					usageMu.Unlock()
+					log.Printf("[usage] %s: session=%.0f%% week_all=%.0f%% week_sonnet=%.0f%% session_resets=%q week_resets=%q",
+						p.Name(), u.Session.Utilization, u.WeekAll.Utilization, u.WeekSonnet.Utilization,
 						u.Session.ResetsAt, u.WeekAll.ResetsAt)
 				} else {
-					log.Printf("[usage] fetch failed: %v", err)
+					log.Printf("[usage] %s fetch failed: %v", p.Name(), err)
 				}
-				usageMu.Unlock()
-				time.Sleep(2 * time.Minute)
+				time.Sleep(usageFetchInterval)
 			}
 		}()
 	})
 }
 
 // GetUsage returns the last successfully fetched usage data (non-blocking).
+// A reading older than usageStaleAfter is returned with Known unset.
 func GetUsage() ClaudeUsage {
 	usageMu.RLock()
 	defer usageMu.RUnlock()
-	return usageCache
+	u := usageCache
+	if u.Known && time.Since(u.FetchedAt) > usageStaleAfter {
+		u.Known = false
+	}
+	return u
 }
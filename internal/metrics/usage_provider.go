@@ -0,0 +1,179 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+)
+
+// UsageProvider reports plan usage percentages for the guardrails.
+type UsageProvider interface {
+	Name() string
+	Fetch(ctx context.Context) (ClaudeUsage, error)
+}
+
+// NewUsageProvider builds the provider selected by cfg.Usage.Provider.
+func NewUsageProvider(cfg config.Config) (UsageProvider, error) {
+	u := cfg.Usage
+	switch u.Provider {
+	case "", config.UsageProviderExpect:
+		return ExpectUsageProvider{ProjectDir: cfg.ProjectsDir}, nil
+	case config.UsageProviderLocal:
+		if u.SessionTokens <= 0 && u.WeeklyTokens <= 0 {
+			return nil, fmt.Errorf("local usage provider needs usage.session_tokens or usage.weekly_tokens")
+		}
+		window := time.Duration(u.SessionHours) * time.Hour
+		if window <= 0 {
+			window = 5 * time.Hour
+		}
+		return LocalUsageProvider{
+			ClaudeDir:     cfg.ClaudeDir,
+			SessionTokens: u.SessionTokens,
+			WeeklyTokens:  u.WeeklyTokens,
+			SessionWindow: window,
+		}, nil
+	case config.UsageProviderRemote:
+		if u.URL == "" {
+			return nil, fmt.Errorf("remote usage provider needs usage.url")
+		}
+		return RemoteUsageProvider{URL: u.URL}, nil
+	default:
+		return nil, fmt.Errorf("unknown usage provider %q", u.Provider)
+	}
+}
+
+// ExpectUsageProvider scrapes `/usage` from an interactive claude session.
+type ExpectUsageProvider struct {
+	ProjectDir string
+}
+
+func (ExpectUsageProvider) Name() string { return config.UsageProviderExpect }
+
+func (p ExpectUsageProvider) Fetch(ctx context.Context) (ClaudeUsage, error) {
+	return fetchClaudeUsage(ctx, p.ProjectDir)
+}
+
+// LocalUsageProvider derives usage from the session JSONL files under
+// ClaudeDir against token allowances configured for the plan. Both windows
+// are rolling: the last SessionWindow and the last 7 days.
+type LocalUsageProvider struct {
+	ClaudeDir     string
+	SessionTokens int
+	WeeklyTokens  int
+	SessionWindow time.Duration
+	Now           func() time.Time // for tests; defaults to time.Now
+}
+
+func (LocalUsageProvider) Name() string { return config.UsageProviderLocal }
+
+func (p LocalUsageProvider) Fetch(ctx context.Context) (ClaudeUsage, error) {
+	now := time.Now()
+	if p.Now != nil {
+		now = p.Now()
+	}
+	sessionStart := now.Add(-p.SessionWindow)
+	weekStart := now.AddDate(0, 0, -7)
+
+	projectsDir := filepath.Join(p.ClaudeDir, "projects")
+	if _, err := os.Stat(projectsDir); err != nil {
+		return ClaudeUsage{}, err
+	}
+	var session, week int
+	var sessionFirst, weekFirst time.Time
+	for _, f := range collectJSONL(projectsDir) {
+		if ctx.Err() != nil {
+			return ClaudeUsage{}, ctx.Err()
+		}
+		info, err := os.Stat(f)
+		if err != nil || info.ModTime().Before(weekStart) {
+			continue
+		}
+		for _, e := range parseJSONL(f) {
+			if e.Message == nil {
+				continue
+			}
+			ts, err := time.Parse(time.RFC3339Nano, e.Timestamp)
+			if err != nil || ts.Before(weekStart) || ts.After(now) {
+				continue
+			}
+			n := e.Message.Usage.InputTokens + e.Message.Usage.OutputTokens
+			week += n
+			if weekFirst.IsZero() || ts.Before(weekFirst) {
+				weekFirst = ts
+			}
+			if !ts.Before(sessionStart) {
+				session += n
+				if sessionFirst.IsZero() || ts.Before(sessionFirst) {
+					sessionFirst = ts
+				}
+			}
+		}
+	}
+
+	var u ClaudeUsage
+	if p.SessionTokens > 0 {
+		u.Session.Utilization = 100 * float64(session) / float64(p.SessionTokens)
+		if !sessionFirst.IsZero() {
+			u.Session.ResetsAt = sessionFirst.Add(p.SessionWindow).Local().Format("Jan 2 15:04")
+		}
+	}
+	if p.WeeklyTokens > 0 {
+		u.WeekAll.Utilization = 100 * float64(week) / float64(p.WeeklyTokens)
+		if !weekFirst.IsZero() {
+			u.WeekAll.ResetsAt = weekFirst.AddDate(0, 0, 7).Local().Format("Jan 2 15:04")
+		}
+	}
+	return u, nil
+}
+
+// RemoteUsageProvider reads ClaudeUsage JSON from an http(s) URL or a local
+// file, for setups where another process tracks usage.
+type RemoteUsageProvider struct {
+	URL    string
+	Client *http.Client // defaults to a client with a 10s timeout
+}
+
+func (RemoteUsageProvider) Name() string { return config.UsageProviderRemote }
+
+func (p RemoteUsageProvider) Fetch(ctx context.Context) (ClaudeUsage, error) {
+	var data []byte
+	if strings.HasPrefix(p.URL, "http://") || strings.HasPrefix(p.URL, "https://") {
+		client := p.Client
+		if client == nil {
+			client = &http.Client{Timeout: 10 * time.Second}
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL, nil)
+		if err != nil {
+			return ClaudeUsage{}, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return ClaudeUsage{}, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return ClaudeUsage{}, fmt.Errorf("usage endpoint returned %s", resp.Status)
+		}
+		if data, err = io.ReadAll(io.LimitReader(resp.Body, 1<<20)); err != nil {
+			return ClaudeUsage{}, err
+		}
+	} else {
+		var err error
+		if data, err = os.ReadFile(strings.TrimPrefix(p.URL, "file://")); err != nil {
+			return ClaudeUsage{}, err
+		}
+	}
+	var u ClaudeUsage
+	if err := json.Unmarshal(data, &u); err != nil {
+		return ClaudeUsage{}, fmt.Errorf("parsing usage: %w", err)
+	}
+	return u, nil
+}
@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+)
+
+func writeSessionJSONL(t *testing.T, claudeDir string, lines ...string) {
+	t.Helper()
+	dir := filepath.Join(claudeDir, "projects", "-home-proj")
+	os.MkdirAll(dir, 0755)
+	var data []byte
+	for _, l := range lines {
+		data = append(data, l+"\n"...)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "s.jsonl"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func usageLine(ts time.Time, in, out int) string {
+	return fmt.Sprintf(`{"timestamp":%q,"message":{"model":"claude-sonnet","usage":{"input_tokens":%d,"output_tokens":%d}}}`,
+		ts.UTC().Format(time.RFC3339Nano), in, out)
+}
+
+func TestLocalUsageProvider_Windows(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	writeSessionJSONL(t, dir,
+		usageLine(now.Add(-time.Hour), 100, 100),    // session + week
+		usageLine(now.Add(-30*time.Hour), 300, 300), // week only
+		usageLine(now.AddDate(0, 0, -8), 1000, 0),   // outside both
+		`not json`,
+	)
+	p := LocalUsageProvider{ClaudeDir: dir, SessionTokens: 1000, WeeklyTokens: 4000, SessionWindow: 5 * time.Hour}
+	u, err := p.Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Session.Utilization != 20 || u.WeekAll.Utilization != 20 {
+		t.Errorf("expected 20%% session and week, got %+v", u)
+	}
+	if u.Session.ResetsAt == "" {
+		t.Error("expected a session reset time")
+	}
+}
+
+func TestRemoteUsageProvider(t *testing.T) {
+	body := `{"session":{"utilization":42},"week_all":{"utilization":7,"resets_at":"Mon"}}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	u, err := RemoteUsageProvider{URL: srv.URL}.Fetch(context.Background())
+	if err != nil || u.Session.Utilization != 42 || u.WeekAll.ResetsAt != "Mon" {
+		t.Errorf("http: got %+v, %v", u, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "usage.json")
+	os.WriteFile(path, []byte(body), 0644)
+	if u, err = (RemoteUsageProvider{URL: "file://" + path}).Fetch(context.Background()); err != nil || u.WeekAll.Utilization != 7 {
+		t.Errorf("file: got %+v, %v", u, err)
+	}
+}
+
+func TestNewUsageProvider(t *testing.T) {
+	cfg := config.DefaultConfig()
+	if p, err := NewUsageProvider(cfg); err != nil || p.Name() != config.UsageProviderExpect {
+		t.Errorf("expected expect provider by default, got %v %v", p, err)
+	}
+	cfg.Usage.Provider = config.UsageProviderLocal
+	if _, err := NewUsageProvider(cfg); err == nil {
+		t.Error("expected error for local provider without limits")
+	}
+	cfg.Usage.WeeklyTokens = 1000
+	if p, err := NewUsageProvider(cfg); err != nil || p.(LocalUsageProvider).SessionWindow != 5*time.Hour {
+		t.Errorf("expected local provider with default window, got %v %v", p, err)
+	}
+	cfg.Usage.Provider = "nope"
+	if _, err := NewUsageProvider(cfg); err == nil {
+		t.Error("expected error for unknown provider")
+	}
+}
+
+func TestParseUsageOutput_NoFigures(t *testing.T) {
+	if _, err := parseUsageOutput("Welcome to Claude"); err == nil {
+		t.Error("expected error when /usage output has no percentages")
+	}
+	u, err := parseUsageOutput("Current session 12% used Resets 5pm  \nCurrent week 40% used")
+	if err != nil || u.Session.Utilization != 12 || u.WeekAll.Utilization != 40 {
+		t.Errorf("got %+v, %v", u, err)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package persist
+
+import "os"
+
+// Advisory locking is only implemented on unix; elsewhere the in-process
+// mutex is the only guard.
+func lockFile(f *os.File) error { return nil }
+
+func unlockFile(f *os.File) error { return nil }
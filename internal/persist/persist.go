@@ -0,0 +1,130 @@
+// Package persist provides crash-safe file writes and cross-process locking
+// for the JSON stores under ~/.config/teamoon.
+package persist
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// WriteFile atomically replaces path with data. The bytes are written to a
+// temp file in the same directory, fsynced, and renamed over the target, so
+// readers see either the old or the new content, never a truncated file.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmpName)
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		cleanup()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		cleanup()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		cleanup()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// syncDir flushes the directory entry so the rename survives power loss.
+// Errors are ignored: some filesystems do not support fsync on directories.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
+// FileLock is an advisory exclusive lock held on "<path>.lock".
+type FileLock struct {
+	f *os.File
+}
+
+// Lock blocks until the exclusive lock for path is acquired.
+func Lock(path string) (*FileLock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &FileLock{f: f}, nil
+}
+
+// Unlock releases the lock. Closing the descriptor also drops the lock if
+// the explicit unlock fails.
+func (l *FileLock) Unlock() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	unlockFile(l.f)
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// Mutex serializes access to a store file both within the process and
+// across processes (e.g. `teamoon task add` racing `teamoon serve`).
+// The path is resolved on every Lock so it follows HOME changes.
+type Mutex struct {
+	mu   sync.Mutex
+	path func() string
+	lock *FileLock
+}
+
+// NewMutex returns a Mutex guarding the file returned by path.
+func NewMutex(path func() string) *Mutex {
+	return &Mutex{path: path}
+}
+
+// Lock acquires the in-process mutex, then the file lock. If the file lock
+// cannot be taken the failure is logged and only the in-process mutex is held.
+func (m *Mutex) Lock() {
+	m.mu.Lock()
+	l, err := Lock(m.path())
+	if err != nil {
+		log.Printf("[persist] lock %s: %v", m.path(), err)
+		return
+	}
+	m.lock = l
+}
+
+func (m *Mutex) Unlock() {
+	if m.lock != nil {
+		m.lock.Unlock()
+		m.lock = nil
+	}
+	m.mu.Unlock()
+}
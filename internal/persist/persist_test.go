@@ -0,0 +1,191 @@
+package persist
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// ---------- WriteFile ----------
+
+func TestWriteFile_CreatesAndReplaces(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "store.json")
+
+	if err := WriteFile(path, []byte("first"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(path, []byte("second"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "second" {
+		t.Errorf("expected 'second', got %q", data)
+	}
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected perm 0600, got %v", info.Mode().Perm())
+	}
+}
+
+func TestWriteFile_NoTempLeftovers(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "store.json")
+	for i := 0; i < 5; i++ {
+		if err := WriteFile(path, []byte(fmt.Sprint(i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("expected only store.json, got %v", names)
+	}
+}
+
+func TestWriteFile_FailureKeepsOriginal(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "store.json")
+	if err := WriteFile(path, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// A directory in place of the target makes the rename fail.
+	bad := filepath.Join(dir, "sub")
+	os.Mkdir(bad, 0755)
+	os.WriteFile(filepath.Join(bad, "x"), nil, 0644)
+	if err := WriteFile(bad, []byte("new"), 0644); err == nil {
+		t.Fatal("expected rename over non-empty directory to fail")
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "original" {
+		t.Errorf("expected original content, got %q", data)
+	}
+}
+
+// ---------- Concurrent writers ----------
+
+type counter struct {
+	N int `json:"n"`
+}
+
+// increment performs one unguarded read-modify-write of the counter file.
+func increment(path string) error {
+	var c counter
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &c); err != nil {
+			return fmt.Errorf("corrupt store %q: %w", data, err)
+		}
+	}
+	c.N++
+	out, _ := json.Marshal(c)
+	return WriteFile(path, out, 0644)
+}
+
+func readCounter(t *testing.T, path string) int {
+	t.Helper()
+	var c counter
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		t.Fatal(err)
+	}
+	return c.N
+}
+
+// Each goroutine owns its own Mutex, as separate processes would, so only
+// the file lock keeps the increments from being lost.
+func TestMutex_ConcurrentWritersSeparateMutexes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counter.json")
+	const writers, perWriter = 8, 25
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m := NewMutex(func() string { return path })
+			for i := 0; i < perWriter; i++ {
+				m.Lock()
+				err := increment(path)
+				m.Unlock()
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	if got := readCounter(t, path); got != writers*perWriter {
+		t.Errorf("lost updates: expected %d, got %d", writers*perWriter, got)
+	}
+}
+
+const helperEnv = "TEAMOON_PERSIST_HELPER"
+
+// TestHelperProcess is the child side of TestMutex_CrossProcessWriters.
+func TestHelperProcess(t *testing.T) {
+	path := os.Getenv(helperEnv)
+	if path == "" {
+		t.Skip("helper process only")
+	}
+	m := NewMutex(func() string { return path })
+	for i := 0; i < 40; i++ {
+		m.Lock()
+		err := increment(path)
+		m.Unlock()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+}
+
+func TestMutex_CrossProcessWriters(t *testing.T) {
+	if testing.Short() {
+		t.Skip("spawns subprocesses")
+	}
+	path := filepath.Join(t.TempDir(), "counter.json")
+	const procs = 4
+
+	var cmds []*exec.Cmd
+	for i := 0; i < procs; i++ {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+		cmd.Env = append(os.Environ(), helperEnv+"="+path)
+		var stderr strings.Builder
+		cmd.Stderr = &stderr
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		cmds = append(cmds, cmd)
+	}
+	for _, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Fatalf("helper failed: %v: %s", err, cmd.Stderr)
+		}
+	}
+	if got := readCounter(t, path); got != procs*40 {
+		t.Errorf("lost updates across processes: expected %d, got %d", procs*40, got)
+	}
+}
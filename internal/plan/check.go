@@ -0,0 +1,107 @@
+package plan
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CheckKind is the type of a machine-checkable Check: line.
+type CheckKind string
+
+const (
+	CheckRun     CheckKind = "run"     // shell command with an expected exit code
+	CheckExists  CheckKind = "exists"  // path must exist
+	CheckMissing CheckKind = "missing" // path must not exist
+	CheckGrep    CheckKind = "grep"    // regexp must (or, negated, must not) match in a file or tree
+)
+
+// Check is a parsed Check: line. Paths are relative to the project directory.
+//
+//	Check: run go build ./...
+//	Check: run(1) grep -q TODO main.go
+//	Check: exists internal/foo/foo.go
+//	Check: missing tmp/scratch.txt
+//	Check: grep "func HandleX" internal/foo
+//	Check: !grep MOCK_ src
+type Check struct {
+	Kind    CheckKind
+	Command string // run
+	Exit    int    // run: expected exit code
+	Path    string // exists, missing, grep
+	Pattern string // grep
+	Negate  bool   // grep: assert no match
+	Raw     string
+}
+
+var runExitRe = regexp.MustCompile(`^run\((\d+)\)$`)
+
+// ParseCheck parses the text after "Check:".
+func ParseCheck(raw string) (Check, error) {
+	raw = strings.TrimSpace(raw)
+	c := Check{Raw: raw}
+	verb, rest, _ := strings.Cut(raw, " ")
+	rest = strings.TrimSpace(rest)
+
+	switch {
+	case verb == "run" || runExitRe.MatchString(verb):
+		if m := runExitRe.FindStringSubmatch(verb); m != nil {
+			c.Exit, _ = strconv.Atoi(m[1])
+		}
+		if rest == "" {
+			return c, fmt.Errorf("check %q: run needs a command", raw)
+		}
+		c.Kind, c.Command = CheckRun, rest
+	case verb == "exists" || verb == "missing":
+		if rest == "" {
+			return c, fmt.Errorf("check %q: %s needs a path", raw, verb)
+		}
+		c.Kind, c.Path = CheckKind(verb), rest
+	case verb == "grep" || verb == "!grep":
+		pattern, path, err := splitPattern(rest)
+		if err != nil {
+			return c, fmt.Errorf("check %q: %w", raw, err)
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return c, fmt.Errorf("check %q: bad pattern: %w", raw, err)
+		}
+		c.Kind, c.Pattern, c.Path, c.Negate = CheckGrep, pattern, path, verb == "!grep"
+	default:
+		return c, fmt.Errorf("check %q: unknown kind %q (want run, exists, missing, grep or !grep)", raw, verb)
+	}
+	return c, nil
+}
+
+// splitPattern splits `<pattern> <path>`. A pattern containing spaces must be
+// a double-quoted Go string.
+func splitPattern(s string) (pattern, path string, err error) {
+	if strings.HasPrefix(s, `"`) {
+		q, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return "", "", fmt.Errorf("unterminated quoted pattern")
+		}
+		pattern, _ = strconv.Unquote(q)
+		path = strings.TrimSpace(s[len(q):])
+	} else {
+		pattern, path, _ = strings.Cut(s, " ")
+		path = strings.TrimSpace(path)
+	}
+	if pattern == "" || path == "" {
+		return "", "", fmt.Errorf("grep needs a pattern and a path")
+	}
+	return pattern, path, nil
+}
+
+// ParsedChecks returns the step's checks, stopping at the first malformed one.
+func (s Step) ParsedChecks() ([]Check, error) {
+	checks := make([]Check, 0, len(s.Checks))
+	for _, raw := range s.Checks {
+		c, err := ParseCheck(raw)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, c)
+	}
+	return checks, nil
+}
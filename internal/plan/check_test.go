@@ -0,0 +1,79 @@
+package plan
+
+import (
+	"testing"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+)
+
+func TestParseCheck(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want Check
+	}{
+		{"run go build ./...", Check{Kind: CheckRun, Command: "go build ./..."}},
+		{"run(1) grep -q TODO main.go", Check{Kind: CheckRun, Command: "grep -q TODO main.go", Exit: 1}},
+		{"exists internal/foo/foo.go", Check{Kind: CheckExists, Path: "internal/foo/foo.go"}},
+		{"missing tmp/scratch.txt", Check{Kind: CheckMissing, Path: "tmp/scratch.txt"}},
+		{`grep "func Handle\\w+" internal/foo`, Check{Kind: CheckGrep, Pattern: `func Handle\w+`, Path: "internal/foo"}},
+		{"!grep MOCK_ src", Check{Kind: CheckGrep, Pattern: "MOCK_", Path: "src", Negate: true}},
+	}
+	for _, tt := range tests {
+		got, err := ParseCheck(tt.raw)
+		if err != nil {
+			t.Errorf("ParseCheck(%q): %v", tt.raw, err)
+			continue
+		}
+		tt.want.Raw = tt.raw
+		if got != tt.want {
+			t.Errorf("ParseCheck(%q) = %+v, want %+v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestParseCheck_Errors(t *testing.T) {
+	for _, raw := range []string{
+		"run",
+		"exists",
+		"grep onlypattern",
+		`grep "unterminated src`,
+		"grep ([ src",
+		"compile ./...",
+	} {
+		if _, err := ParseCheck(raw); err == nil {
+			t.Errorf("ParseCheck(%q) should fail", raw)
+		}
+	}
+}
+
+func TestParsePlan_Checks(t *testing.T) {
+	p := ParseText(`# Plan: Checks
+
+## Steps
+
+### Step 1: Build
+Agent: dev
+Do it.
+Verify: it builds
+Check: run go build ./...
+Check: exists main.go
+
+### Step 2: Broken
+Agent: dev
+Do more.
+Verify: done
+Check: compile everything
+`)
+	if got := p.Steps[0].Checks; len(got) != 2 || got[1] != "exists main.go" {
+		t.Fatalf("checks = %q", got)
+	}
+	if _, err := p.Steps[0].ParsedChecks(); err != nil {
+		t.Errorf("ParsedChecks: %v", err)
+	}
+	if _, err := p.Steps[1].ParsedChecks(); err == nil {
+		t.Error("expected malformed check to fail")
+	}
+	if c := codes(Validate(p, config.SkeletonConfig{}).Errors); c["bad_check"] != 1 {
+		t.Errorf("errors = %v", c)
+	}
+}
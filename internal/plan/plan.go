@@ -3,6 +3,7 @@ package plan
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -16,6 +17,7 @@ type Step struct {
 	Title    string
 	Body     string
 	Verify   string
+	Checks   []string // raw Check: lines; see ParseCheck
 	Agent    string
 	ReadOnly bool
 }
@@ -41,16 +43,16 @@ func PlanExists(taskID int) bool {
 	return err == nil
 }
 
+// SavePlan stores content as a new plan revision without metadata.
 func SavePlan(taskID int, content string) error {
-	if err := os.MkdirAll(PlansDir(), 0755); err != nil {
-		return err
-	}
-	return os.WriteFile(PlanPath(taskID), []byte(content), 0644)
+	_, err := SavePlanRevision(taskID, content, RevisionMeta{})
+	return err
 }
 
 var (
 	stepRe     = regexp.MustCompile(`^###\s+Step\s+(\d+):\s+(.+)$`)
 	verifyRe   = regexp.MustCompile(`(?i)^Verify:\s+(.+)$`)
+	checkRe    = regexp.MustCompile(`(?i)^Check:\s+(.+)$`)
 	agentRe    = regexp.MustCompile(`(?i)^Agent:\s+(.+)$`)
 	readOnlyRe = regexp.MustCompile(`(?i)^ReadOnly:\s*(true|yes)$`)
 )
@@ -62,8 +64,35 @@ func ParsePlan(path string) (Plan, error) {
 	}
 	defer f.Close()
 
-	p := Plan{FilePath: path}
-	scanner := bufio.NewScanner(f)
+	p, err := parse(f)
+	p.FilePath = path
+	if err != nil {
+		return p, err
+	}
+
+	if len(p.Steps) == 0 {
+		return p, fmt.Errorf("no steps found in plan: %s", path)
+	}
+
+	for _, s := range p.Steps {
+		if s.Agent == "" {
+			return p, fmt.Errorf("step %d (%q) missing Agent — BMAD must assign agents to all steps", s.Number, s.Title)
+		}
+	}
+
+	return p, nil
+}
+
+// ParseText parses plan markdown without the checks ParsePlan enforces, so a
+// draft can be handed to Validate.
+func ParseText(content string) Plan {
+	p, _ := parse(strings.NewReader(content))
+	return p
+}
+
+func parse(r io.Reader) (Plan, error) {
+	var p Plan
+	scanner := bufio.NewScanner(r)
 
 	type state int
 	const (
@@ -125,6 +154,10 @@ func ParsePlan(path string) (Plan, error) {
 				if curStep != nil {
 					curStep.Verify = matches[1]
 				}
+			} else if matches := checkRe.FindStringSubmatch(line); matches != nil {
+				if curStep != nil {
+					curStep.Checks = append(curStep.Checks, strings.TrimSpace(matches[1]))
+				}
 			} else if matches := agentRe.FindStringSubmatch(line); matches != nil {
 				if curStep != nil {
 					curStep.Agent = strings.TrimSpace(matches[1])
@@ -155,15 +188,5 @@ func ParsePlan(path string) (Plan, error) {
 
 	finishStep()
 
-	if len(p.Steps) == 0 {
-		return p, fmt.Errorf("no steps found in plan: %s", path)
-	}
-
-	for _, s := range p.Steps {
-		if s.Agent == "" {
-			return p, fmt.Errorf("step %d (%q) missing Agent — BMAD must assign agents to all steps", s.Number, s.Title)
-		}
-	}
-
 	return p, scanner.Err()
 }
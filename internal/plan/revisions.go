@@ -0,0 +1,279 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/JuanVilla424/teamoon/internal/persist"
+)
+
+// Revision is one saved version of a task's plan. Reason says why it was
+// generated; Replaced says why it stopped being the active plan.
+type Revision struct {
+	Number   int       `json:"number"`
+	Time     time.Time `json:"time"`
+	Model    string    `json:"model,omitempty"`
+	Attempt  int       `json:"attempt,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	Replaced string    `json:"replaced,omitempty"`
+}
+
+// RevisionMeta is what the caller knows about a freshly generated plan.
+type RevisionMeta struct {
+	Model   string
+	Attempt int
+	Reason  string
+}
+
+// History is the revision index of a task. Active is 0 when no revision is
+// the current plan (e.g. after a replan). A pinned revision stays active when
+// new revisions are saved.
+type History struct {
+	TaskID    int        `json:"task_id"`
+	Active    int        `json:"active"`
+	Pinned    bool       `json:"pinned"`
+	Revisions []Revision `json:"revisions"`
+}
+
+// Revision returns revision n, if present.
+func (h History) Revision(n int) (Revision, bool) {
+	for _, r := range h.Revisions {
+		if r.Number == n {
+			return r, true
+		}
+	}
+	return Revision{}, false
+}
+
+func (h *History) rev(n int) *Revision {
+	for i := range h.Revisions {
+		if h.Revisions[i].Number == n {
+			return &h.Revisions[i]
+		}
+	}
+	return nil
+}
+
+func (h History) next() int {
+	if len(h.Revisions) == 0 {
+		return 1
+	}
+	return h.Revisions[len(h.Revisions)-1].Number + 1
+}
+
+// revMu guards every task's revision index; plan writes are rare enough
+// that one lock for the plans directory is plenty.
+var revMu = persist.NewMutex(func() string { return filepath.Join(PlansDir(), "revisions") })
+
+// RevisionsDir holds the numbered revisions of a task's plan.
+func RevisionsDir(taskID int) string {
+	return filepath.Join(PlansDir(), fmt.Sprintf("task-%d", taskID))
+}
+
+func revisionPath(taskID, n int) string {
+	return filepath.Join(RevisionsDir(taskID), fmt.Sprintf("rev-%d.md", n))
+}
+
+func historyPath(taskID int) string {
+	return filepath.Join(RevisionsDir(taskID), "revisions.json")
+}
+
+func loadHistory(taskID int) (History, error) {
+	h := History{TaskID: taskID}
+	data, err := os.ReadFile(historyPath(taskID))
+	if err != nil && !os.IsNotExist(err) {
+		return h, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &h); err != nil {
+			return h, fmt.Errorf("parsing plan revisions for task #%d: %w", taskID, err)
+		}
+		h.TaskID = taskID
+	}
+	if len(h.Revisions) == 0 {
+		adoptLegacy(&h)
+	}
+	return h, nil
+}
+
+// adoptLegacy records a plan written before revisions existed as revision 1,
+// so the first regeneration doesn't lose it.
+func adoptLegacy(h *History) {
+	info, err := os.Stat(PlanPath(h.TaskID))
+	if err != nil {
+		return
+	}
+	content, err := os.ReadFile(PlanPath(h.TaskID))
+	if err != nil {
+		return
+	}
+	if err := persist.WriteFile(revisionPath(h.TaskID, 1), content, 0644); err != nil {
+		return
+	}
+	h.Revisions = []Revision{{Number: 1, Time: info.ModTime(), Reason: "imported"}}
+	h.Active = 1
+}
+
+func saveHistory(h History) error {
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	return persist.WriteFile(historyPath(h.TaskID), data, 0644)
+}
+
+// LoadHistory returns the revision index of a task. A task without history
+// reports its current plan (if any) as revision 1.
+func LoadHistory(taskID int) (History, error) {
+	revMu.Lock()
+	defer revMu.Unlock()
+	return loadHistory(taskID)
+}
+
+// LoadRevision returns the content of revision n.
+func LoadRevision(taskID, n int) (string, error) {
+	revMu.Lock()
+	defer revMu.Unlock()
+	h, err := loadHistory(taskID)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := h.Revision(n); !ok {
+		return "", fmt.Errorf("task #%d has no plan revision %d", taskID, n)
+	}
+	data, err := os.ReadFile(revisionPath(taskID, n))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// SavePlanRevision stores content as the next revision of the task's plan and
+// makes it the active plan, unless another revision is pinned.
+func SavePlanRevision(taskID int, content string, meta RevisionMeta) (Revision, error) {
+	revMu.Lock()
+	defer revMu.Unlock()
+	h, err := loadHistory(taskID)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	rev := Revision{
+		Number:  h.next(),
+		Time:    time.Now(),
+		Model:   meta.Model,
+		Attempt: meta.Attempt,
+		Reason:  meta.Reason,
+	}
+	if rev.Reason == "" && h.Active == 0 && len(h.Revisions) > 0 {
+		// The previous plan was retired (replan); carry its reason forward.
+		rev.Reason = h.Revisions[len(h.Revisions)-1].Replaced
+	}
+	if err := persist.WriteFile(revisionPath(taskID, rev.Number), []byte(content), 0644); err != nil {
+		return Revision{}, err
+	}
+	h.Revisions = append(h.Revisions, rev)
+
+	if h.Pinned && h.rev(h.Active) != nil {
+		log.Printf("[plan] task #%d revision %d saved, pinned revision %d stays active", taskID, rev.Number, h.Active)
+		return rev, saveHistory(h)
+	}
+	if prev := h.rev(h.Active); prev != nil && prev.Replaced == "" {
+		prev.Replaced = rev.Reason
+		if prev.Replaced == "" {
+			prev.Replaced = fmt.Sprintf("superseded by revision %d", rev.Number)
+		}
+	}
+	if err := persist.WriteFile(PlanPath(taskID), []byte(content), 0644); err != nil {
+		return Revision{}, err
+	}
+	h.Active, h.Pinned = rev.Number, false
+	log.Printf("[plan] task #%d revision %d saved", taskID, rev.Number)
+	return rev, saveHistory(h)
+}
+
+// RetirePlan removes the active plan, recording reason on its revision. The
+// revision itself is kept and can be restored later.
+func RetirePlan(taskID int, reason string) error {
+	revMu.Lock()
+	defer revMu.Unlock()
+	h, err := loadHistory(taskID)
+	if err != nil {
+		return err
+	}
+	if prev := h.rev(h.Active); prev != nil {
+		prev.Replaced = reason
+	}
+	h.Active, h.Pinned = 0, false
+	if err := os.Remove(PlanPath(taskID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(h.Revisions) == 0 {
+		return nil
+	}
+	log.Printf("[plan] task #%d plan retired: %s", taskID, reason)
+	return saveHistory(h)
+}
+
+// RestoreRevision makes revision n the active plan. With pin set, later
+// regenerations are recorded but do not replace it.
+func RestoreRevision(taskID, n int, pin bool) error {
+	revMu.Lock()
+	defer revMu.Unlock()
+	h, err := loadHistory(taskID)
+	if err != nil {
+		return err
+	}
+	target := h.rev(n)
+	if target == nil {
+		return fmt.Errorf("task #%d has no plan revision %d", taskID, n)
+	}
+	content, err := os.ReadFile(revisionPath(taskID, n))
+	if err != nil {
+		return err
+	}
+	if h.Active != n {
+		if prev := h.rev(h.Active); prev != nil {
+			prev.Replaced = fmt.Sprintf("revision %d restored", n)
+		}
+		if err := persist.WriteFile(PlanPath(taskID), content, 0644); err != nil {
+			return err
+		}
+	}
+	target.Replaced = ""
+	h.Active, h.Pinned = n, pin
+	log.Printf("[plan] task #%d revision %d restored (pinned=%v)", taskID, n, pin)
+	return saveHistory(h)
+}
+
+// SetPinned pins or unpins the active revision.
+func SetPinned(taskID int, pinned bool) error {
+	revMu.Lock()
+	defer revMu.Unlock()
+	h, err := loadHistory(taskID)
+	if err != nil {
+		return err
+	}
+	if pinned && h.rev(h.Active) == nil {
+		return fmt.Errorf("task #%d has no active plan revision", taskID)
+	}
+	h.Pinned = pinned
+	return saveHistory(h)
+}
+
+// DiffRevisions returns the unified diff from revision a to revision b.
+func DiffRevisions(taskID, a, b int) (string, error) {
+	from, err := LoadRevision(taskID, a)
+	if err != nil {
+		return "", err
+	}
+	to, err := LoadRevision(taskID, b)
+	if err != nil {
+		return "", err
+	}
+	return UnifiedDiff(from, to, fmt.Sprintf("rev-%d", a), fmt.Sprintf("rev-%d", b)), nil
+}
@@ -0,0 +1,168 @@
+package plan
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func readActive(t *testing.T, taskID int) string {
+	t.Helper()
+	data, err := os.ReadFile(PlanPath(taskID))
+	if err != nil {
+		t.Fatalf("reading active plan: %v", err)
+	}
+	return string(data)
+}
+
+func TestSavePlanRevision_NumbersAndReplaces(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	r1, err := SavePlanRevision(7, "plan one\n", RevisionMeta{Model: "opus", Attempt: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := SavePlanRevision(7, "plan two\n", RevisionMeta{Model: "opus", Attempt: 2, Reason: "retry after: parse failed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r1.Number != 1 || r2.Number != 2 {
+		t.Fatalf("numbers = %d, %d, want 1, 2", r1.Number, r2.Number)
+	}
+	if got := readActive(t, 7); got != "plan two\n" {
+		t.Errorf("active plan = %q", got)
+	}
+
+	h, err := LoadHistory(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Active != 2 || len(h.Revisions) != 2 {
+		t.Fatalf("history = %+v", h)
+	}
+	first := h.Revisions[0]
+	if first.Model != "opus" || first.Attempt != 1 {
+		t.Errorf("rev 1 meta = %+v", first)
+	}
+	if first.Replaced != "retry after: parse failed" {
+		t.Errorf("rev 1 replaced = %q", first.Replaced)
+	}
+	if c, _ := LoadRevision(7, 1); c != "plan one\n" {
+		t.Errorf("rev 1 content = %q", c)
+	}
+}
+
+func TestSavePlan_AdoptsLegacyPlan(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if err := os.MkdirAll(PlansDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(PlanPath(3), []byte("old plan\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SavePlan(3, "new plan\n"); err != nil {
+		t.Fatal(err)
+	}
+	h, _ := LoadHistory(3)
+	if len(h.Revisions) != 2 || h.Revisions[0].Reason != "imported" {
+		t.Fatalf("history = %+v", h)
+	}
+	if c, _ := LoadRevision(3, 1); c != "old plan\n" {
+		t.Errorf("imported content = %q", c)
+	}
+}
+
+func TestRetirePlan_ReasonCarriesForward(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	SavePlan(4, "first\n")
+
+	if err := RetirePlan(4, "replan requested"); err != nil {
+		t.Fatal(err)
+	}
+	if PlanExists(4) {
+		t.Fatal("active plan should be removed")
+	}
+	h, _ := LoadHistory(4)
+	if h.Active != 0 || h.Revisions[0].Replaced != "replan requested" {
+		t.Fatalf("history = %+v", h)
+	}
+
+	rev, _ := SavePlanRevision(4, "second\n", RevisionMeta{})
+	if rev.Reason != "replan requested" {
+		t.Errorf("new revision reason = %q", rev.Reason)
+	}
+}
+
+func TestRestoreAndPin(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	SavePlan(5, "a\n")
+	SavePlan(5, "b\n")
+
+	if err := RestoreRevision(5, 1, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := readActive(t, 5); got != "a\n" {
+		t.Fatalf("active after restore = %q", got)
+	}
+
+	// A pinned revision survives regeneration; the new plan is still recorded.
+	if err := SavePlan(5, "c\n"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readActive(t, 5); got != "a\n" {
+		t.Errorf("pinned plan replaced: %q", got)
+	}
+	h, _ := LoadHistory(5)
+	if h.Active != 1 || !h.Pinned || len(h.Revisions) != 3 {
+		t.Fatalf("history = %+v", h)
+	}
+	if h.Revisions[1].Replaced != "revision 1 restored" {
+		t.Errorf("rev 2 replaced = %q", h.Revisions[1].Replaced)
+	}
+
+	if err := SetPinned(5, false); err != nil {
+		t.Fatal(err)
+	}
+	SavePlan(5, "d\n")
+	if got := readActive(t, 5); got != "d\n" {
+		t.Errorf("active after unpin = %q", got)
+	}
+
+	if err := RestoreRevision(5, 99, false); err == nil {
+		t.Error("restoring a missing revision should fail")
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	a := "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n"
+	b := "one\ntwo\nTHREE\nfour\nfive\nsix\nseven\neight\nnine\nten\neleven\n"
+
+	got := UnifiedDiff(a, b, "rev-1", "rev-2")
+	want := `--- rev-1
++++ rev-2
+@@ -1,6 +1,6 @@
+ one
+ two
+-three
++THREE
+ four
+ five
+ six
+@@ -8,3 +8,4 @@
+ eight
+ nine
+ ten
++eleven
+`
+	if got != want {
+		t.Errorf("diff =\n%s\nwant\n%s", got, want)
+	}
+
+	if d := UnifiedDiff(a, a, "x", "y"); d != "" {
+		t.Errorf("equal texts diff = %q", d)
+	}
+	if d := UnifiedDiff("", "new\n", "x", "y"); !strings.Contains(d, "@@ -0,0 +1,1 @@") {
+		t.Errorf("diff from empty = %q", d)
+	}
+}
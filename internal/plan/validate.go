@@ -0,0 +1,142 @@
+package plan
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+)
+
+// Severity of a lint issue. Errors block a plan from being accepted;
+// warnings are reported but do not.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Issue is one problem found by Validate. Step is 0 for plan-wide issues.
+type Issue struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Step     int      `json:"step,omitempty"`
+	Message  string   `json:"message"`
+}
+
+func (i Issue) String() string {
+	if i.Step > 0 {
+		return fmt.Sprintf("step %d: %s", i.Step, i.Message)
+	}
+	return i.Message
+}
+
+// Report is the result of Validate.
+type Report struct {
+	Errors   []Issue `json:"errors"`
+	Warnings []Issue `json:"warnings"`
+}
+
+// OK reports whether the plan has no errors.
+func (r Report) OK() bool { return len(r.Errors) == 0 }
+
+func (r *Report) add(sev Severity, code string, step int, format string, args ...any) {
+	is := Issue{Severity: sev, Code: code, Step: step, Message: fmt.Sprintf(format, args...)}
+	if sev == SeverityError {
+		r.Errors = append(r.Errors, is)
+	} else {
+		r.Warnings = append(r.Warnings, is)
+	}
+}
+
+// skeletonPhase describes how to recognise an enabled skeleton phase among
+// the plan steps. Action phases run commands, so a plan without them would
+// silently skip work; missing investigation phases are only warned about.
+type skeletonPhase struct {
+	id      string
+	enabled func(config.SkeletonConfig) bool
+	match   func(text string) bool
+	action  bool
+}
+
+func mentions(pattern string) func(string) bool {
+	return regexp.MustCompile(pattern).MatchString
+}
+
+var (
+	preCommitRe = regexp.MustCompile(`\bpre[-_ ]?commit\b`)
+	commitRe    = regexp.MustCompile(`\bcommit\b`)
+)
+
+var skeletonPhases = []skeletonPhase{
+	{"doc_setup", func(s config.SkeletonConfig) bool { return s.DocSetup }, mentions(`\b(docs?|documentation|investigat\w*|research|analy[sz]\w*)\b`), false},
+	{"web_search", func(s config.SkeletonConfig) bool { return s.WebSearch }, mentions(`\b(web|search|research)\b`), false},
+	{"build_verify", func(s config.SkeletonConfig) bool { return s.BuildVerify }, mentions(`\b(build|compile)\b`), true},
+	{"test", func(s config.SkeletonConfig) bool { return s.Test }, mentions(`\btests?\b`), true},
+	{"security_review", func(s config.SkeletonConfig) bool { return s.SecurityReview }, mentions(`\bsecurity\b`), false},
+	{"pre_commit", func(s config.SkeletonConfig) bool { return s.PreCommit }, preCommitRe.MatchString, true},
+	{"commit", func(s config.SkeletonConfig) bool { return s.Commit }, func(t string) bool {
+		return commitRe.MatchString(preCommitRe.ReplaceAllString(t, ""))
+	}, true},
+	{"push", func(s config.SkeletonConfig) bool { return s.Push }, mentions(`\bpush\b`), true},
+}
+
+// Validate lints a parsed plan against the skeleton it was generated for.
+func Validate(p Plan, sk config.SkeletonConfig) Report {
+	var r Report
+	if len(p.Steps) == 0 {
+		r.add(SeverityError, "no_steps", 0, "plan has no steps")
+		return r
+	}
+
+	seen := make(map[int]bool)
+	for i, s := range p.Steps {
+		if seen[s.Number] {
+			r.add(SeverityError, "duplicate_step", s.Number, "step number %d is used more than once", s.Number)
+		} else if s.Number != i+1 {
+			r.add(SeverityError, "step_sequence", s.Number, "expected step %d, got step %d — number steps 1..N in order", i+1, s.Number)
+		}
+		seen[s.Number] = true
+
+		if strings.TrimSpace(s.Title) == "" {
+			r.add(SeverityError, "empty_title", s.Number, "missing title")
+		}
+		if strings.TrimSpace(s.Body) == "" {
+			r.add(SeverityError, "empty_body", s.Number, "%q has no instructions", s.Title)
+		}
+		if s.Agent == "" {
+			r.add(SeverityError, "missing_agent", s.Number, "%q is missing an Agent line", s.Title)
+		}
+		if strings.TrimSpace(s.Verify) == "" {
+			r.add(SeverityWarning, "missing_verify", s.Number, "%q has no Verify line", s.Title)
+		}
+		for _, raw := range s.Checks {
+			if _, err := ParseCheck(raw); err != nil {
+				r.add(SeverityError, "bad_check", s.Number, "%v", err)
+			}
+		}
+	}
+
+	for _, ph := range skeletonPhases {
+		if !ph.enabled(sk) {
+			continue
+		}
+		found := false
+		for _, s := range p.Steps {
+			if ph.match(strings.ToLower(s.Title + "\n" + s.Body + "\n" + s.Verify)) {
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		sev := SeverityWarning
+		if ph.action {
+			sev = SeverityError
+		}
+		r.add(sev, "missing_phase", 0, "skeleton phase %q is enabled but no step covers it", ph.id)
+	}
+	return r
+}
@@ -0,0 +1,78 @@
+package plan
+
+import (
+	"testing"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+)
+
+func codes(issues []Issue) map[string]int {
+	out := make(map[string]int)
+	for _, is := range issues {
+		out[is.Code]++
+	}
+	return out
+}
+
+func TestValidate_ValidPlan(t *testing.T) {
+	r := Validate(ParseText(validPlan), config.SkeletonConfig{Test: true, BuildVerify: true})
+	if !r.OK() || len(r.Warnings) != 0 {
+		t.Errorf("expected clean report, got %+v", r)
+	}
+}
+
+func TestValidate_StructuralErrors(t *testing.T) {
+	content := `# Plan: Broken
+
+## Steps
+
+### Step 1: First
+Agent: dev
+Do it.
+Verify: done
+
+### Step 3: Skipped two
+Agent: dev
+Do more.
+
+### Step 3: Duplicate
+Verify: nothing
+
+## Constraints
+`
+	r := Validate(ParseText(content), config.SkeletonConfig{})
+	got := codes(r.Errors)
+	if got["step_sequence"] != 1 || got["duplicate_step"] != 1 || got["empty_body"] != 1 || got["missing_agent"] != 1 {
+		t.Errorf("unexpected errors %+v", r.Errors)
+	}
+	if w := codes(r.Warnings); w["missing_verify"] != 1 {
+		t.Errorf("expected a missing Verify warning, got %+v", r.Warnings)
+	}
+}
+
+func TestValidate_NoSteps(t *testing.T) {
+	r := Validate(ParseText("# Plan: nothing\n"), config.SkeletonConfig{})
+	if r.OK() || r.Errors[0].Code != "no_steps" {
+		t.Errorf("expected no_steps error, got %+v", r)
+	}
+}
+
+func TestValidate_SkeletonPhases(t *testing.T) {
+	content := `# Plan: Phases
+
+## Steps
+
+### Step 1: Run pre-commit hooks
+Agent: dev
+Run pre-commit on all files.
+Verify: hooks pass
+`
+	sk := config.SkeletonConfig{PreCommit: true, Commit: true, WebSearch: true}
+	r := Validate(ParseText(content), sk)
+	if len(r.Errors) != 1 || r.Errors[0].Code != "missing_phase" {
+		t.Fatalf("expected only the commit phase to be missing (pre-commit must not count), got %+v", r.Errors)
+	}
+	if len(r.Warnings) != 1 || r.Warnings[0].Code != "missing_phase" {
+		t.Errorf("expected missing web_search as a warning, got %+v", r.Warnings)
+	}
+}
@@ -1,18 +1,17 @@
 package plangen
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/JuanVilla424/teamoon/internal/config"
 	"github.com/JuanVilla424/teamoon/internal/engine"
+	"github.com/JuanVilla424/teamoon/internal/metrics"
 	"github.com/JuanVilla424/teamoon/internal/plan"
 	"github.com/JuanVilla424/teamoon/internal/projectinit"
 	"github.com/JuanVilla424/teamoon/internal/queue"
@@ -122,6 +121,9 @@ func BuildPlanPrompt(t queue.Task, skeletonBlock, projectsDir string) string {
 	if attachmentBlock != "" {
 		contextSection = "\nCONTEXT FROM ATTACHMENTS:\n" + attachmentBlock + "\n"
 	}
+	if t.ReviewFeedback != "" {
+		contextSection += "\nREVIEWER FEEDBACK ON THE PREVIOUS PLAN (the new plan must address every point):\n" + t.ReviewFeedback + "\n"
+	}
 
 	const tpl = `You are a plan generator for project %s/%s.
 
@@ -176,11 +178,14 @@ ReadOnly: true|false
 - [instruction as bullet point]
 
 Verify: [success criteria]
+Check: [optional machine check, one per line: run <cmd> | run(N) <cmd> | exists <path> | missing <path> | grep <regexp> <path> | !grep <regexp> <path>]
 
 ## Constraints
 
 - [constraint as bullet point]
 
+Check lines are run by teamoon in the project directory after the step; a failing check retries the step. Only add checks that are certain to pass when the step is done (e.g. "run go build ./...", "exists src/api/users.ts"). Quote grep patterns containing spaces.
+
 5-12 steps total. Do not create files. Final message must be the plan text.`
 
 	return fmt.Sprintf(tpl, projectsDir, t.Project, t.Description, contextSection, skeletonBlock)
@@ -242,6 +247,16 @@ func PlanToolMessage(name string, input map[string]any) string {
 	return "Planning: " + name
 }
 
+// RevisionMeta describes a plan generated for t. A task that failed before
+// records the failure as the reason for the new revision.
+func RevisionMeta(t queue.Task, model string) plan.RevisionMeta {
+	meta := plan.RevisionMeta{Model: model, Attempt: t.PlanAttempts + 1}
+	if t.FailReason != "" {
+		meta.Reason = "retry after: " + t.FailReason
+	}
+	return meta
+}
+
 // GeneratePlan runs claude to generate a plan synchronously and saves it.
 // logFn is called with descriptive messages as planning progresses (may be nil).
 func GeneratePlan(t queue.Task, sk config.SkeletonConfig, cfg config.Config, logFn func(string)) (plan.Plan, error) {
@@ -258,32 +273,16 @@ func GeneratePlan(t queue.Task, sk config.SkeletonConfig, cfg config.Config, log
 	skeletonBlock := SkeletonJSON(sk, cfg.MCPServers, cfg.PhaseHints)
 	prompt := BuildPlanPrompt(t, skeletonBlock, cfg.ProjectsDir)
 
-	env := filterEnv(os.Environ(), "CLAUDECODE")
-	gitName := engine.GenerateName()
-	gitEmail := engine.GenerateEmail(gitName)
-	env = append(env,
-		"GIT_AUTHOR_NAME="+gitName,
-		"GIT_AUTHOR_EMAIL="+gitEmail,
-		"GIT_COMMITTER_NAME="+gitName,
-		"GIT_COMMITTER_EMAIL="+gitEmail,
-	)
-
+	rt, err := engine.RuntimeFor(cfg)
+	if err != nil {
+		return plan.Plan{}, err
+	}
 	// Resolve meta-model for plan generation phase
 	planCfg := cfg
 	planCfg.Spawn.MaxTurns = cfg.Spawn.PlanMaxTurns
 	planCfg.Spawn.Model = engine.ResolveModel(cfg.Spawn.Model, "plan")
 	// No MCPs for plan gen — skeleton prompt already references MCP steps from full config.
 	planCfg.MCPServers = nil
-	args, cleanup := engine.BuildSpawnArgs(planCfg, prompt, nil, "")
-	if cleanup != nil {
-		defer cleanup()
-	}
-	// Disallow write/edit tools — plan gen only reads and invokes BMAD Skill.
-	args = append(args,
-		"--disallowedTools",
-		"Edit,Write,NotebookEdit,Bash,ExitPlanMode,EnterPlanMode,TodoWrite,Task,AskUserQuestion",
-	)
-	// Note: --verbose is required by stream-json output format — do NOT strip it.
 	// Apply plan-specific timeout (defaults to 15 min — plan gen needs more time than step execution)
 	timeout := time.Duration(cfg.Spawn.PlanTimeoutMin) * time.Minute
 	if timeout <= 0 {
@@ -292,18 +291,59 @@ func GeneratePlan(t queue.Task, sk config.SkeletonConfig, cfg config.Config, log
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "claude", args...)
-	cmd.Dir = filepath.Join(cfg.ProjectsDir, t.Project)
-	cmd.Env = env
-
-	// Stream plan generation using stream-json for real-time progress visibility
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return plan.Plan{}, fmt.Errorf("plan generation pipe error: %w", err)
+	req := engine.AgentRequest{
+		Dir: filepath.Join(cfg.ProjectsDir, t.Project),
+		// Disallow write/edit tools — plan gen only reads and invokes BMAD Skill.
+		DisallowedTools: []string{"Edit", "Write", "NotebookEdit", "Bash", "ExitPlanMode", "EnterPlanMode", "TodoWrite", "Task", "AskUserQuestion"},
+		Env:             engine.GitIdentityEnv(),
+		Config:          planCfg,
 	}
-
-	if err := cmd.Start(); err != nil {
-		return plan.Plan{}, fmt.Errorf("plan generation start error: %w", err)
+	turn := func(prompt, sessionID string) (string, string, error) {
+		req.Prompt, req.SessionID = prompt, sessionID
+		sess, err := rt.Start(ctx, req)
+		if err != nil {
+			return "", "", fmt.Errorf("plan generation start error: %w", err)
+		}
+		var planResult string
+		var planText strings.Builder
+		planCaptured := false
+		for evt := range sess.Events() {
+			switch evt.Type {
+			case "assistant":
+				if evt.Message != nil {
+					for _, c := range evt.Message.Content {
+						if c.Type == "tool_use" && c.Name != "" && logFn != nil {
+							logFn(PlanToolMessage(c.Name, c.Input))
+						}
+						if c.Type == "text" && len(c.Text) > 0 {
+							planText.WriteString(c.Text)
+							txt := planText.String()
+							if strings.Contains(txt, "# Plan:") && strings.Contains(txt, "## Steps") && strings.Contains(txt, "## Constraints") {
+								planResult = txt
+								planCaptured = true
+							}
+						}
+					}
+				}
+			case "result":
+				if !planCaptured {
+					planResult = evt.Result
+				}
+			}
+			if planCaptured {
+				sess.Cancel()
+				break
+			}
+		}
+		res, _ := sess.Wait()
+		engine.RecordSpend(metrics.SpendRecord{Kind: metrics.SpendPlan, TaskID: t.ID, Project: t.Project}, res, planCfg.Spawn.Model)
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", "", fmt.Errorf("plan generation timed out after %v", timeout)
+		}
+		if planResult == "" {
+			return "", "", fmt.Errorf("plan generation returned empty result")
+		}
+		return planResult, res.SessionID, nil
 	}
 
 	// Heartbeat: periodic progress during stream-json gaps
@@ -324,79 +364,18 @@ func GeneratePlan(t queue.Task, sk config.SkeletonConfig, cfg config.Config, log
 			}
 		}
 	}()
+	defer close(heartbeatDone)
 
-	type planStreamContent struct {
-		Type  string         `json:"type"`
-		Text  string         `json:"text,omitempty"`
-		Name  string         `json:"name,omitempty"`
-		Input map[string]any `json:"input,omitempty"`
-	}
-	type planStreamEvt struct {
-		Type      string `json:"type"`
-		SessionID string `json:"session_id,omitempty"`
-		Message   *struct {
-			Content []planStreamContent `json:"content"`
-		} `json:"message,omitempty"`
-		Result  string `json:"result,omitempty"`
-		Subtype string `json:"subtype,omitempty"`
-	}
-
-	scanner := bufio.NewScanner(stdout)
-	scanner.Buffer(make([]byte, 256*1024), 256*1024)
-
-	var planResult string
-	var planText strings.Builder
-	var sessionID string
-	planCaptured := false
-	for scanner.Scan() {
-		line := scanner.Text()
-		var evt planStreamEvt
-		if json.Unmarshal([]byte(line), &evt) != nil {
-			continue
-		}
-		// Capture session_id from first event that has it
-		if evt.SessionID != "" && sessionID == "" {
-			sessionID = evt.SessionID
-		}
-		switch evt.Type {
-		case "assistant":
-			if evt.Message != nil {
-				for _, c := range evt.Message.Content {
-					if c.Type == "tool_use" && c.Name != "" && logFn != nil {
-						logFn(PlanToolMessage(c.Name, c.Input))
-					}
-					if c.Type == "text" && len(c.Text) > 0 {
-						planText.WriteString(c.Text)
-						txt := planText.String()
-						if strings.Contains(txt, "# Plan:") && strings.Contains(txt, "## Steps") && strings.Contains(txt, "## Constraints") {
-							planResult = txt
-							planCaptured = true
-						}
-					}
-				}
-			}
-			if planCaptured {
-				cmd.Process.Kill()
-				break
-			}
-		case "result":
-			if !planCaptured {
-				planResult = evt.Result
-			}
-		}
-	}
-	cmd.Wait()
-	close(heartbeatDone)
-
-	if ctx.Err() == context.DeadlineExceeded {
-		return plan.Plan{}, fmt.Errorf("plan generation timed out after %v", timeout)
+	planResult, sessionID, err := turn(prompt, "")
+	if err != nil {
+		return plan.Plan{}, err
 	}
-
-	if planResult == "" {
-		return plan.Plan{}, fmt.Errorf("plan generation returned empty result")
+	planResult, _, err = ValidateAndRepair(planResult, sessionID, prompt, sk, turn, logFn)
+	if err != nil {
+		return plan.Plan{}, err
 	}
 
-	if err := plan.SavePlan(t.ID, planResult); err != nil {
+	if _, err := plan.SavePlanRevision(t.ID, planResult, RevisionMeta(t, planCfg.Spawn.Model)); err != nil {
 		return plan.Plan{}, fmt.Errorf("saving plan: %w", err)
 	}
 	if err := queue.SetPlanFile(t.ID, plan.PlanPath(t.ID)); err != nil {
@@ -408,14 +387,3 @@ func GeneratePlan(t queue.Task, sk config.SkeletonConfig, cfg config.Config, log
 	}
 	return p, nil
 }
-
-func filterEnv(env []string, key string) []string {
-	prefix := key + "="
-	result := make([]string, 0, len(env))
-	for _, e := range env {
-		if !strings.HasPrefix(e, prefix) {
-			result = append(result, e)
-		}
-	}
-	return result
-}
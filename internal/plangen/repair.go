@@ -0,0 +1,67 @@
+package plangen
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/plan"
+)
+
+// maxPlanRepairs bounds how many times a plan that fails validation is sent
+// back to the planner before generation gives up.
+const maxPlanRepairs = 2
+
+// PlanTurn runs one planner turn and returns the captured plan text plus the
+// session ID a follow-up turn can resume ("" if the runtime reported none).
+type PlanTurn func(prompt, sessionID string) (text, nextSessionID string, err error)
+
+// BuildRepairPrompt asks the planner to fix the errors in its last plan.
+func BuildRepairPrompt(r plan.Report) string {
+	var sb strings.Builder
+	sb.WriteString("The plan you produced failed validation:\n\n")
+	for _, is := range r.Errors {
+		sb.WriteString("- " + is.String() + "\n")
+	}
+	sb.WriteString("\nFix every problem above and emit the complete corrected plan as your final message, ")
+	sb.WriteString("in exactly the same output format (# Plan:, ## Steps, ### Step N: ..., ## Constraints). ")
+	sb.WriteString("Number steps 1..N without gaps. Do not call any tools.")
+	return sb.String()
+}
+
+// ValidateAndRepair lints text against sk and, while it has errors, resumes
+// the planner with a repair prompt. When no session can be resumed the
+// original prompt is re-sent with the repair notes appended. It returns the
+// last plan text and its report; err is set if errors remain after the last
+// repair attempt.
+func ValidateAndRepair(text, sessionID, originalPrompt string, sk config.SkeletonConfig, turn PlanTurn, logFn func(string)) (string, plan.Report, error) {
+	report := plan.Validate(plan.ParseText(text), sk)
+	for attempt := 1; !report.OK() && attempt <= maxPlanRepairs; attempt++ {
+		if logFn != nil {
+			logFn(fmt.Sprintf("Plan failed validation (%d errors), asking planner to repair (%d/%d)", len(report.Errors), attempt, maxPlanRepairs))
+		}
+		prompt := BuildRepairPrompt(report)
+		if sessionID == "" {
+			prompt = originalPrompt + "\n\n" + prompt
+		}
+		repaired, next, err := turn(prompt, sessionID)
+		if err != nil {
+			return text, report, fmt.Errorf("plan repair: %w", err)
+		}
+		text, sessionID = repaired, next
+		report = plan.Validate(plan.ParseText(text), sk)
+	}
+	if logFn != nil {
+		for _, w := range report.Warnings {
+			logFn("Plan warning: " + w.String())
+		}
+	}
+	if !report.OK() {
+		msgs := make([]string, len(report.Errors))
+		for i, is := range report.Errors {
+			msgs[i] = is.String()
+		}
+		return text, report, fmt.Errorf("plan failed validation: %s", strings.Join(msgs, "; "))
+	}
+	return text, report, nil
+}
@@ -0,0 +1,81 @@
+package plangen
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+)
+
+const brokenPlan = `# Plan: Fix
+
+## Steps
+
+### Step 2: Implement
+Agent: dev
+Change the code.
+Verify: builds
+
+## Constraints
+- none
+`
+
+const fixedPlan = `# Plan: Fix
+
+## Steps
+
+### Step 1: Implement
+Agent: dev
+Change the code.
+Verify: builds
+
+## Constraints
+- none
+`
+
+func TestValidateAndRepair_ResumesSession(t *testing.T) {
+	var prompts, sessions []string
+	turn := func(prompt, sessionID string) (string, string, error) {
+		prompts = append(prompts, prompt)
+		sessions = append(sessions, sessionID)
+		return fixedPlan, "s-2", nil
+	}
+	text, report, err := ValidateAndRepair(brokenPlan, "s-1", "ORIGINAL", config.SkeletonConfig{}, turn, nil)
+	if err != nil || !report.OK() || text != fixedPlan {
+		t.Fatalf("expected repaired plan, got err=%v report=%+v", err, report)
+	}
+	if len(prompts) != 1 || sessions[0] != "s-1" {
+		t.Fatalf("expected one repair turn on the planner session, got %v", sessions)
+	}
+	if !strings.Contains(prompts[0], "step 2: expected step 1") || strings.Contains(prompts[0], "ORIGINAL") {
+		t.Errorf("repair prompt should list errors without repeating the original prompt:\n%s", prompts[0])
+	}
+}
+
+func TestValidateAndRepair_GivesUp(t *testing.T) {
+	calls := 0
+	turn := func(prompt, sessionID string) (string, string, error) {
+		calls++
+		if !strings.HasPrefix(prompt, "ORIGINAL") {
+			t.Error("expected the original prompt to be re-sent without a session")
+		}
+		return brokenPlan, "", nil
+	}
+	_, report, err := ValidateAndRepair(brokenPlan, "", "ORIGINAL", config.SkeletonConfig{}, turn, nil)
+	if err == nil || report.OK() {
+		t.Fatal("expected validation error after exhausting repairs")
+	}
+	if calls != maxPlanRepairs {
+		t.Errorf("expected %d repair turns, got %d", maxPlanRepairs, calls)
+	}
+}
+
+func TestValidateAndRepair_ValidPlanSkipsRepair(t *testing.T) {
+	turn := func(string, string) (string, string, error) {
+		t.Fatal("valid plan should not be repaired")
+		return "", "", nil
+	}
+	if _, _, err := ValidateAndRepair(fixedPlan, "s", "p", config.SkeletonConfig{}, turn, nil); err != nil {
+		t.Fatal(err)
+	}
+}
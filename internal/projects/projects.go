@@ -182,6 +182,40 @@ func MergePR(repo string, number int) error {
 	return cmd.Run()
 }
 
+// CreatePR opens a pull request from head into base for the repository
+// checked out at dir and returns its URL.
+func CreatePR(dir, head, base, title, body string) (string, error) {
+	cmd := exec.Command("gh", "pr", "create",
+		"--head", head,
+		"--base", base,
+		"--title", title,
+		"--body", body,
+	)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("gh pr create: %s", strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// PRNumber extracts the pull request number from a URL such as
+// https://github.com/owner/repo/pull/12, or 0 if there is none.
+func PRNumber(url string) int {
+	_, tail, ok := strings.Cut(strings.TrimSpace(url), "/pull/")
+	if !ok {
+		return 0
+	}
+	n := 0
+	for _, c := range tail {
+		if c < '0' || c > '9' {
+			break
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n
+}
+
 func GitPull(projectPath string) (string, error) {
 	cmd := exec.Command("git", "pull")
 	cmd.Dir = projectPath
@@ -0,0 +1,161 @@
+package queue
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// AddDependency records that task id cannot start before dep is done.
+func AddDependency(id, dep int) error {
+	return updateDependencies(id, func(cur []int) []int {
+		return append(append([]int(nil), cur...), dep)
+	})
+}
+
+// RemoveDependency drops the edge id -> dep if present.
+func RemoveDependency(id, dep int) error {
+	_, err := repo().Update(id, func(t *Task) error {
+		kept := t.DependsOn[:0]
+		for _, d := range t.DependsOn {
+			if d != dep {
+				kept = append(kept, d)
+			}
+		}
+		t.DependsOn = kept
+		if len(t.DependsOn) == 0 {
+			t.DependsOn = nil
+			t.HeldReason = ""
+		}
+		return nil
+	})
+	if err == nil {
+		_, err = unblockIfFree(id)
+	}
+	return err
+}
+
+// SetDependencies replaces the predecessors of task id. Unknown IDs,
+// self-references and edges that would close a cycle are rejected. The check
+// and the write happen under one lock, so concurrent edits cannot together
+// close a cycle.
+func SetDependencies(id int, deps []int) error {
+	return updateDependencies(id, func([]int) []int { return deps })
+}
+
+// updateDependencies sets the predecessors of task id to next(current ones).
+func updateDependencies(id int, next func(cur []int) []int) error {
+	var deps []int
+	_, err := repo().UpdateWithAll(id, func(t *Task, all []Task) error {
+		deps = uniqueSorted(next(t.DependsOn))
+		if err := checkDependencies(id, deps, all); err != nil {
+			return err
+		}
+		t.DependsOn = deps
+		if len(deps) == 0 {
+			t.HeldReason = ""
+		}
+		return nil
+	})
+	if err == nil {
+		log.Printf("[queue] task #%d depends_on=%v", id, deps)
+		_, err = unblockIfFree(id)
+	}
+	return err
+}
+
+// checkDependencies validates deps as the new predecessors of task id
+// against all.
+func checkDependencies(id int, deps []int, all []Task) error {
+	graph := make(map[int][]int, len(all))
+	for _, t := range all {
+		graph[t.ID] = t.DependsOn
+	}
+	for _, d := range deps {
+		if d == id {
+			return fmt.Errorf("task #%d cannot depend on itself", id)
+		}
+		if _, ok := graph[d]; !ok {
+			return notFound(d)
+		}
+	}
+	graph[id] = deps
+	if cycle := findCycle(graph, id); cycle != nil {
+		return fmt.Errorf("dependency cycle: %s", formatCycle(cycle))
+	}
+	return nil
+}
+
+// unblockIfFree releases a blocked task that no longer has predecessors.
+func unblockIfFree(id int) (Task, error) {
+	t, err := GetTask(id)
+	if err != nil || len(t.DependsOn) > 0 || t.Wave > 0 {
+		return t, err
+	}
+	return Unblock(id)
+}
+
+// SetHeldReason records why a task is not being scheduled (e.g. "blocked by #3").
+// An empty reason clears it.
+func SetHeldReason(id int, reason string) error {
+	_, err := repo().Update(id, func(t *Task) error {
+		t.HeldReason = reason
+		return nil
+	})
+	return err
+}
+
+// findCycle walks the predecessor graph from start and returns the path of
+// the first cycle that leads back to start, or nil.
+func findCycle(graph map[int][]int, start int) []int {
+	visited := make(map[int]bool)
+	var path []int
+	var walk func(n int) bool
+	walk = func(n int) bool {
+		path = append(path, n)
+		for _, d := range graph[n] {
+			if d == start {
+				path = append(path, d)
+				return true
+			}
+			if visited[d] {
+				continue
+			}
+			visited[d] = true
+			if walk(d) {
+				return true
+			}
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+	if walk(start) {
+		return path
+	}
+	return nil
+}
+
+func formatCycle(cycle []int) string {
+	parts := make([]string, len(cycle))
+	for i, id := range cycle {
+		parts[i] = fmt.Sprintf("#%d", id)
+	}
+	return strings.Join(parts, " -> ")
+}
+
+func uniqueSorted(ids []int) []int {
+	if len(ids) == 0 {
+		return nil
+	}
+	seen := make(map[int]bool, len(ids))
+	var out []int
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	sort.Ints(out)
+	return out
+}
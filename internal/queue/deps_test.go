@@ -0,0 +1,117 @@
+package queue
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSetDependencies(t *testing.T) {
+	setupTestEnv(t)
+	a, _ := Add("proj", "a", "")
+	b, _ := Add("proj", "b", "")
+	c, _ := Add("proj", "c", "")
+
+	if err := SetDependencies(c.ID, []int{b.ID, a.ID, b.ID}); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := GetTask(c.ID)
+	if !equalInts(got.DependsOn, []int{a.ID, b.ID}) {
+		t.Errorf("expected sorted unique deps [1 2], got %v", got.DependsOn)
+	}
+}
+
+func TestAddDependency_RejectsCycle(t *testing.T) {
+	setupTestEnv(t)
+	a, _ := Add("proj", "a", "")
+	b, _ := Add("proj", "b", "")
+	c, _ := Add("proj", "c", "")
+
+	if err := AddDependency(b.ID, a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddDependency(c.ID, b.ID); err != nil {
+		t.Fatal(err)
+	}
+	err := AddDependency(a.ID, c.ID)
+	if err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Fatalf("expected cycle error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "#1 -> #3 -> #2 -> #1") {
+		t.Errorf("expected cycle path in error, got %v", err)
+	}
+	got, _ := GetTask(a.ID)
+	if len(got.DependsOn) != 0 {
+		t.Errorf("rejected edge must not be stored, got %v", got.DependsOn)
+	}
+}
+
+func TestAddDependency_ConcurrentEditsCannotCloseCycle(t *testing.T) {
+	for name, open := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			useRepo(t, open(t))
+			for i := 0; i < 20; i++ {
+				a, _ := Add("proj", "a", "")
+				b, _ := Add("proj", "b", "")
+				var wg sync.WaitGroup
+				errs := make([]error, 2)
+				for j, e := range [][2]int{{a.ID, b.ID}, {b.ID, a.ID}} {
+					wg.Add(1)
+					go func(j int, e [2]int) {
+						defer wg.Done()
+						errs[j] = AddDependency(e[0], e[1])
+					}(j, e)
+				}
+				wg.Wait()
+				if errs[0] == nil && errs[1] == nil {
+					t.Fatalf("both #%d -> #%d and its reverse were stored", a.ID, b.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestAddDependency_RejectsSelfAndUnknown(t *testing.T) {
+	setupTestEnv(t)
+	a, _ := Add("proj", "a", "")
+
+	if err := AddDependency(a.ID, a.ID); err == nil {
+		t.Error("expected self-dependency to be rejected")
+	}
+	if err := AddDependency(a.ID, 42); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected not found, got %v", err)
+	}
+	if err := AddDependency(42, a.ID); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected not found, got %v", err)
+	}
+}
+
+func TestAddDependency_DiamondIsNotACycle(t *testing.T) {
+	setupTestEnv(t)
+	a, _ := Add("proj", "a", "")
+	b, _ := Add("proj", "b", "")
+	c, _ := Add("proj", "c", "")
+	d, _ := Add("proj", "d", "")
+
+	for _, e := range [][2]int{{b.ID, a.ID}, {c.ID, a.ID}, {d.ID, b.ID}, {d.ID, c.ID}} {
+		if err := AddDependency(e[0], e[1]); err != nil {
+			t.Fatalf("edge %v: %v", e, err)
+		}
+	}
+}
+
+func TestRemoveDependency_ClearsHeldReason(t *testing.T) {
+	setupTestEnv(t)
+	a, _ := Add("proj", "a", "")
+	b, _ := Add("proj", "b", "")
+	AddDependency(b.ID, a.ID)
+	SetHeldReason(b.ID, "blocked by #1")
+
+	if err := RemoveDependency(b.ID, a.ID); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := GetTask(b.ID)
+	if len(got.DependsOn) != 0 || got.HeldReason != "" {
+		t.Errorf("expected no deps and no held reason, got %v %q", got.DependsOn, got.HeldReason)
+	}
+}
@@ -0,0 +1,117 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/persist"
+)
+
+// MaxPatchBytes caps the patch stored for a single step; larger patches are
+// cut and flagged Truncated.
+const MaxPatchBytes = 256 << 10
+
+// StepDiff is the change one autopilot step made to the task workspace.
+type StepDiff struct {
+	Step      int       `json:"step"`
+	Title     string    `json:"title"`
+	Time      time.Time `json:"time"`
+	Stat      string    `json:"stat"`  // git diff --stat
+	Patch     string    `json:"patch"` // full unified diff
+	Truncated bool      `json:"truncated,omitempty"`
+}
+
+// diffMu guards every task's diff file; steps finish far apart, so one lock
+// for the directory is plenty.
+var diffMu = persist.NewMutex(func() string { return filepath.Join(diffsDir(), "diffs") })
+
+func diffsDir() string {
+	return filepath.Join(config.ConfigDir(), "diffs")
+}
+
+func diffsPath(taskID int) string {
+	return filepath.Join(diffsDir(), fmt.Sprintf("task-%d.json", taskID))
+}
+
+func loadStepDiffs(taskID int) ([]StepDiff, error) {
+	data, err := os.ReadFile(diffsPath(taskID))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var diffs []StepDiff
+	if err := json.Unmarshal(data, &diffs); err != nil {
+		return nil, fmt.Errorf("parsing step diffs for task #%d: %w", taskID, err)
+	}
+	return diffs, nil
+}
+
+func saveStepDiffs(taskID int, diffs []StepDiff) error {
+	if len(diffs) == 0 {
+		err := os.Remove(diffsPath(taskID))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	data, err := json.MarshalIndent(diffs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return persist.WriteFile(diffsPath(taskID), data, 0644)
+}
+
+// LoadStepDiffs returns the recorded step diffs of a task, by step number.
+func LoadStepDiffs(taskID int) ([]StepDiff, error) {
+	diffMu.Lock()
+	defer diffMu.Unlock()
+	return loadStepDiffs(taskID)
+}
+
+// SaveStepDiff records d, replacing an earlier diff of the same step (a step
+// that is run again after a revert or a failed attempt).
+func SaveStepDiff(taskID int, d StepDiff) error {
+	if len(d.Patch) > MaxPatchBytes {
+		d.Patch = d.Patch[:MaxPatchBytes]
+		d.Truncated = true
+	}
+	diffMu.Lock()
+	defer diffMu.Unlock()
+	diffs, err := loadStepDiffs(taskID)
+	if err != nil {
+		return err
+	}
+	kept := diffs[:0]
+	for _, old := range diffs {
+		if old.Step != d.Step {
+			kept = append(kept, old)
+		}
+	}
+	diffs = append(kept, d)
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Step < diffs[j].Step })
+	return saveStepDiffs(taskID, diffs)
+}
+
+// DropStepDiffs forgets the diffs of step fromStep and every step after it.
+func DropStepDiffs(taskID, fromStep int) error {
+	diffMu.Lock()
+	defer diffMu.Unlock()
+	diffs, err := loadStepDiffs(taskID)
+	if err != nil {
+		return err
+	}
+	kept := diffs[:0]
+	for _, d := range diffs {
+		if d.Step < fromStep {
+			kept = append(kept, d)
+		}
+	}
+	return saveStepDiffs(taskID, kept)
+}
@@ -0,0 +1,44 @@
+package queue
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStepDiffs(t *testing.T) {
+	setupTestEnv(t)
+
+	if diffs, err := LoadStepDiffs(1); err != nil || diffs != nil {
+		t.Fatalf("no diffs yet: got %v, %v", diffs, err)
+	}
+	for _, d := range []StepDiff{
+		{Step: 2, Title: "edit", Patch: "+b\n"},
+		{Step: 1, Title: "write", Patch: "+a\n"},
+		{Step: 2, Title: "edit", Patch: "+b again\n"},
+	} {
+		if err := SaveStepDiff(1, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	diffs, _ := LoadStepDiffs(1)
+	if len(diffs) != 2 || diffs[0].Step != 1 || diffs[1].Patch != "+b again\n" {
+		t.Fatalf("diffs = %+v", diffs)
+	}
+
+	SaveStepDiff(1, StepDiff{Step: 3, Patch: strings.Repeat("x", MaxPatchBytes+10)})
+	diffs, _ = LoadStepDiffs(1)
+	if d := diffs[2]; !d.Truncated || len(d.Patch) != MaxPatchBytes {
+		t.Errorf("large patch not truncated: len %d, truncated %v", len(d.Patch), d.Truncated)
+	}
+
+	if err := DropStepDiffs(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if diffs, _ = LoadStepDiffs(1); len(diffs) != 1 || diffs[0].Step != 1 {
+		t.Errorf("after drop = %+v", diffs)
+	}
+	DropStepDiffs(1, 0)
+	if diffs, _ = LoadStepDiffs(1); diffs != nil {
+		t.Errorf("after dropping all = %+v", diffs)
+	}
+}
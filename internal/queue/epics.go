@@ -0,0 +1,176 @@
+package queue
+
+import (
+	"fmt"
+	"log"
+)
+
+// Rollup summarises the leaf tasks below an epic. Archived tasks are left out.
+type Rollup struct {
+	Total   int       `json:"total"`
+	Done    int       `json:"done"`
+	Failed  int       `json:"failed"`
+	Running int       `json:"running"`
+	State   TaskState `json:"state"`
+}
+
+// SetParent makes task id a child of parent; 0 detaches it. A task cannot
+// become its own ancestor. The check and the write happen under one lock,
+// so concurrent moves cannot together form a parent loop.
+func SetParent(id, parent int) (Task, error) {
+	t, err := repo().UpdateWithAll(id, func(t *Task, all []Task) error {
+		if err := checkParent(id, parent, all); err != nil {
+			return err
+		}
+		t.ParentID = parent
+		return nil
+	})
+	if err == nil {
+		log.Printf("[queue] task #%d parent=%d", id, parent)
+	}
+	return t, err
+}
+
+// checkParent validates parent as the new parent of task id against all.
+func checkParent(id, parent int, all []Task) error {
+	if parent == 0 {
+		return nil
+	}
+	if parent == id {
+		return fmt.Errorf("task #%d cannot be its own parent", id)
+	}
+	parents := make(map[int]int, len(all))
+	for _, t := range all {
+		parents[t.ID] = t.ParentID
+	}
+	if _, ok := parents[parent]; !ok {
+		return notFound(parent)
+	}
+	seen := map[int]bool{}
+	for p := parent; p != 0 && !seen[p]; p = parents[p] {
+		if p == id {
+			return fmt.Errorf("task #%d is an ancestor of #%d", id, parent)
+		}
+		seen[p] = true
+	}
+	return nil
+}
+
+// ChildIndex maps each parent ID to its direct children in tasks.
+func ChildIndex(tasks []Task) map[int][]Task {
+	idx := make(map[int][]Task)
+	for _, t := range tasks {
+		if t.ParentID != 0 {
+			idx[t.ParentID] = append(idx[t.ParentID], t)
+		}
+	}
+	return idx
+}
+
+// Descendants returns every task below id, children before grandchildren.
+func Descendants(id int) ([]Task, error) {
+	all, err := ListAll()
+	if err != nil {
+		return nil, err
+	}
+	return DescendantsIn(id, ChildIndex(all)), nil
+}
+
+// DescendantsIn is Descendants over a ChildIndex.
+func DescendantsIn(id int, children map[int][]Task) []Task {
+	var out []Task
+	queue := []int{id}
+	seen := map[int]bool{id: true}
+	for len(queue) > 0 {
+		for _, c := range children[queue[0]] {
+			if !seen[c.ID] {
+				seen[c.ID] = true
+				out = append(out, c)
+				queue = append(queue, c.ID)
+			}
+		}
+		queue = queue[1:]
+	}
+	return out
+}
+
+// RollupOf totals the leaf tasks below id. Nested epics count through their
+// own children. The state is done once every leaf is done, failed if any
+// failed, running once work has started, then blocked or pending.
+func RollupOf(id int, children map[int][]Task) Rollup {
+	var r Rollup
+	blocked := 0
+	for _, t := range DescendantsIn(id, children) {
+		st := EffectiveState(t)
+		if len(children[t.ID]) > 0 || st == StateArchived {
+			continue
+		}
+		r.Total++
+		switch st {
+		case StateDone:
+			r.Done++
+		case StateFailed:
+			r.Failed++
+		case StatePlanning, StateRunning, StateInReview:
+			r.Running++
+		case StateBlocked:
+			blocked++
+		}
+	}
+	switch {
+	case r.Total == 0:
+	case r.Done == r.Total:
+		r.State = StateDone
+	case r.Failed > 0:
+		r.State = StateFailed
+	case r.Running > 0 || r.Done > 0:
+		r.State = StateRunning
+	case blocked > 0:
+		r.State = StateBlocked
+	default:
+		r.State = StatePending
+	}
+	return r
+}
+
+// completeParent marks epic id done once all of its children are done, and
+// carries on up the tree.
+func completeParent(id int) {
+	all, err := ListAll()
+	if err != nil {
+		return
+	}
+	children := ChildIndex(all)
+	if RollupOf(id, children).State != StateDone {
+		return
+	}
+	parent, err := GetTask(id)
+	if err != nil || EffectiveState(parent) == StateDone || EffectiveState(parent) == StateArchived {
+		return
+	}
+	log.Printf("[queue] epic #%d: all subtasks done", id)
+	if err := MarkDone(id); err != nil {
+		log.Printf("[queue] epic #%d: %v", id, err)
+	}
+}
+
+// archiveChildren archives the subtree below id after the parent is archived.
+func archiveChildren(id int) {
+	below, err := Descendants(id)
+	if err != nil {
+		log.Printf("[queue] epic #%d: %v", id, err)
+		return
+	}
+	for _, c := range below {
+		if EffectiveState(c) == StateArchived {
+			continue
+		}
+		if _, err := moveTask(c.ID, StateArchived, fmt.Sprintf("parent #%d archived", id), func(t *Task, _ TaskState) error {
+			t.SessionID = ""
+			t.CurrentStep = 0
+			return nil
+		}); err != nil {
+			log.Printf("[queue] archiving subtask #%d: %v", c.ID, err)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package queue
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSetParent(t *testing.T) {
+	setupTestEnv(t)
+	epic, _ := Add("proj", "epic", "med")
+	a, _ := Add("proj", "a", "med")
+	b, _ := Add("proj", "b", "med")
+
+	if _, err := SetParent(a.ID, epic.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SetParent(b.ID, a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SetParent(epic.ID, b.ID); err == nil {
+		t.Error("expected a cycle to be rejected")
+	}
+	if _, err := SetParent(a.ID, a.ID); err == nil {
+		t.Error("expected self-parenting to be rejected")
+	}
+	if _, err := SetParent(a.ID, 99); err == nil {
+		t.Error("expected unknown parent to be rejected")
+	}
+
+	below, err := Descendants(epic.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(below) != 2 || below[0].ID != a.ID || below[1].ID != b.ID {
+		t.Errorf("Descendants = %+v", below)
+	}
+
+	got, _ := SetParent(b.ID, 0)
+	if got.ParentID != 0 {
+		t.Errorf("detach left parent %d", got.ParentID)
+	}
+}
+
+func TestSetParent_ConcurrentMovesCannotLoop(t *testing.T) {
+	for name, open := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			useRepo(t, open(t))
+			for i := 0; i < 20; i++ {
+				a, _ := Add("proj", "a", "med")
+				b, _ := Add("proj", "b", "med")
+				var wg sync.WaitGroup
+				errs := make([]error, 2)
+				for j, e := range [][2]int{{a.ID, b.ID}, {b.ID, a.ID}} {
+					wg.Add(1)
+					go func(j int, e [2]int) {
+						defer wg.Done()
+						_, errs[j] = SetParent(e[0], e[1])
+					}(j, e)
+				}
+				wg.Wait()
+				if errs[0] == nil && errs[1] == nil {
+					t.Fatalf("#%d and #%d were made each other's parent", a.ID, b.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestRollupOf(t *testing.T) {
+	tasks := []Task{
+		{ID: 1},
+		{ID: 2, ParentID: 1, State: StateDone},
+		{ID: 3, ParentID: 1},                       // nested epic
+		{ID: 4, ParentID: 3, State: StateRunning},  // leaf
+		{ID: 5, ParentID: 3, State: StatePending},  // leaf
+		{ID: 6, ParentID: 1, State: StateArchived}, // ignored
+	}
+	children := ChildIndex(tasks)
+
+	r := RollupOf(1, children)
+	if r.Total != 3 || r.Done != 1 || r.Running != 1 || r.State != StateRunning {
+		t.Errorf("RollupOf(1) = %+v", r)
+	}
+	tasks[4].State = StateFailed
+	if r := RollupOf(1, ChildIndex(tasks)); r.State != StateFailed || r.Failed != 1 {
+		t.Errorf("with a failed leaf: %+v", r)
+	}
+	if r := RollupOf(2, children); r.Total != 0 || r.State != "" {
+		t.Errorf("leaf rollup = %+v", r)
+	}
+}
+
+func TestEpic_DoneWhenSubtasksDone(t *testing.T) {
+	setupTestEnv(t)
+	epic, _ := Add("proj", "epic", "med")
+	sub, _ := Add("proj", "sub-epic", "med")
+	a, _ := Add("proj", "a", "med")
+	b, _ := Add("proj", "b", "med")
+	SetParent(sub.ID, epic.ID)
+	SetParent(a.ID, epic.ID)
+	SetParent(b.ID, sub.ID)
+
+	MarkDone(a.ID)
+	if got, _ := GetTask(epic.ID); EffectiveState(got) == StateDone {
+		t.Fatal("epic done before all subtasks")
+	}
+	MarkDone(b.ID)
+	for _, id := range []int{sub.ID, epic.ID} {
+		if got, _ := GetTask(id); EffectiveState(got) != StateDone {
+			t.Errorf("epic #%d state = %s, want done", id, EffectiveState(got))
+		}
+	}
+}
+
+func TestArchive_CascadesToSubtasks(t *testing.T) {
+	setupTestEnv(t)
+	epic, _ := Add("proj", "epic", "med")
+	a, _ := Add("proj", "a", "med")
+	b, _ := Add("proj", "b", "med")
+	other, _ := Add("proj", "other", "med")
+	SetParent(a.ID, epic.ID)
+	SetParent(b.ID, a.ID)
+
+	if err := Archive(epic.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int{epic.ID, a.ID, b.ID} {
+		if got, _ := GetTask(id); EffectiveState(got) != StateArchived {
+			t.Errorf("task #%d state = %s, want archived", id, EffectiveState(got))
+		}
+	}
+	if got, _ := GetTask(other.ID); EffectiveState(got) != StatePending {
+		t.Errorf("unrelated task archived")
+	}
+}
+
+func TestListAutopilotPending_SkipsEpics(t *testing.T) {
+	setupTestEnv(t)
+	epic, _ := Add("proj", "epic", "med")
+	a, _ := Add("proj", "a", "med")
+	SetParent(a.ID, epic.ID)
+	ToggleAutoPilot(epic.ID)
+	ToggleAutoPilot(a.ID)
+
+	pending, err := ListAutopilotPending("proj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].ID != a.ID {
+		t.Errorf("pending = %+v, want only #%d", pending, a.ID)
+	}
+}
+
+func TestQueryMatch_Parent(t *testing.T) {
+	q, err := ParseQuery("parent:#3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !q.Match(Task{ID: 4, ParentID: 3}) || q.Match(Task{ID: 5}) {
+		t.Error("parent: should match subtasks of #3 only")
+	}
+	if _, err := ParseQuery("parent:x"); err == nil {
+		t.Error("parent: needs a task number")
+	}
+}
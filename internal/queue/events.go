@@ -0,0 +1,261 @@
+package queue
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/persist"
+)
+
+// Event kinds.
+const (
+	EventCreated     = "created"      // the task was added
+	EventState       = "state"        // the task moved From -> To
+	EventPlanAttempt = "plan_attempt" // plan generation attempt number Attempt failed
+	EventReplan      = "replan"       // the plan was thrown away
+	EventStepStart   = "step_start"   // step Step started
+	EventStepRetry   = "step_retry"   // step Step started attempt Attempt
+	EventStepEnd     = "step_end"     // step Step finished; Reason is set when it failed
+	EventGuardrail   = "guardrail"    // autopilot paused; Reason says why
+	EventAction      = "action"       // someone asked for Reason through Actor
+)
+
+// Actors record where an action came from.
+const (
+	ActorAutopilot = "autopilot"
+	ActorWeb       = "web"
+	ActorCLI       = "cli"
+	ActorTUI       = "tui"
+	ActorChat      = "chat"
+	ActorJob       = "job"
+)
+
+// ActorToken is the actor recorded for requests made with the named API token.
+func ActorToken(name string) string {
+	return "token:" + name
+}
+
+// Event is one entry of a task's append-only event log.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Kind    string    `json:"kind"`
+	Actor   string    `json:"actor,omitempty"`
+	From    TaskState `json:"from,omitempty"`
+	To      TaskState `json:"to,omitempty"`
+	Step    int       `json:"step,omitempty"`
+	Attempt int       `json:"attempt,omitempty"`
+	Reason  string    `json:"reason,omitempty"`
+}
+
+var eventMu = persist.NewMutex(func() string { return filepath.Join(eventsDir(), "events") })
+
+func eventsDir() string {
+	return filepath.Join(config.ConfigDir(), "events")
+}
+
+func eventsPath(taskID int) string {
+	return filepath.Join(eventsDir(), fmt.Sprintf("task-%d.jsonl", taskID))
+}
+
+// appendEvent adds e to the end of the task's log, one JSON object per line.
+func appendEvent(taskID int, e Event) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	eventMu.Lock()
+	defer eventMu.Unlock()
+	if err := os.MkdirAll(eventsDir(), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(eventsPath(taskID), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// recordEvent appends e and logs instead of failing: losing an event must not
+// undo the change it describes.
+func recordEvent(taskID int, e Event) {
+	if err := appendEvent(taskID, e); err != nil {
+		log.Printf("[queue] task #%d: recording %s event: %v", taskID, e.Kind, err)
+	}
+}
+
+// Record appends e to the task's event log. It is for events the queue cannot
+// see itself, such as step progress and the actor behind a request.
+func Record(taskID int, e Event) {
+	recordEvent(taskID, e)
+}
+
+// RecordAction notes that actor asked for action on a task.
+func RecordAction(taskID int, actor, action string) {
+	recordEvent(taskID, Event{Kind: EventAction, Actor: actor, Reason: action})
+}
+
+// DescribeEvent renders e as a short line for timelines.
+func DescribeEvent(e Event) string {
+	var msg string
+	switch e.Kind {
+	case EventCreated:
+		msg = "created"
+	case EventState:
+		msg = fmt.Sprintf("%s -> %s", e.From, e.To)
+	case EventPlanAttempt:
+		msg = fmt.Sprintf("plan attempt %d failed", e.Attempt)
+	case EventReplan:
+		msg = "plan discarded"
+	case EventStepStart:
+		msg = fmt.Sprintf("step %d started", e.Step)
+	case EventStepRetry:
+		msg = fmt.Sprintf("step %d attempt %d", e.Step, e.Attempt)
+	case EventStepEnd:
+		msg = fmt.Sprintf("step %d done", e.Step)
+		if e.Reason != "" {
+			msg = fmt.Sprintf("step %d failed", e.Step)
+		}
+	case EventGuardrail:
+		msg = "paused by guardrail"
+	case EventAction:
+		return e.Reason
+	default:
+		msg = e.Kind
+	}
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+// LoadEvents returns a task's events, oldest first. Unreadable lines, such as
+// one cut short by a crash, are skipped.
+func LoadEvents(taskID int) ([]Event, error) {
+	eventMu.Lock()
+	defer eventMu.Unlock()
+	f, err := os.Open(eventsPath(taskID))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var events []Event
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		var e Event
+		if json.Unmarshal(sc.Bytes(), &e) == nil {
+			events = append(events, e)
+		}
+	}
+	return events, sc.Err()
+}
+
+// FlowTimes is how long a task took: Lead from creation to done and Cycle
+// from its first run to done. Both are zero until the task is done.
+type FlowTimes struct {
+	Lead  time.Duration `json:"lead_ns"`
+	Cycle time.Duration `json:"cycle_ns"`
+}
+
+// Flow computes lead and cycle time from a task's events. The last move to
+// done counts, so a reopened task is measured to its final completion.
+func Flow(events []Event) FlowTimes {
+	var created, started, done time.Time
+	for _, e := range events {
+		switch {
+		case e.Kind == EventCreated:
+			created = e.Time
+		case e.Kind != EventState:
+		case e.To == StateRunning && started.IsZero():
+			started = e.Time
+		case e.To == StateDone:
+			done = e.Time
+		}
+	}
+	var f FlowTimes
+	if done.IsZero() {
+		return f
+	}
+	if !created.IsZero() {
+		f.Lead = done.Sub(created)
+	}
+	if !started.IsZero() {
+		f.Cycle = done.Sub(started)
+	}
+	return f
+}
+
+// reachedDone reports whether events include a move to done.
+func reachedDone(events []Event) bool {
+	for _, e := range events {
+		if e.Kind == EventState && e.To == StateDone {
+			return true
+		}
+	}
+	return false
+}
+
+// FlowStats averages lead and cycle time over done tasks, optionally limited
+// to one project. Tasks done before events were recorded are skipped.
+// Abandoned counts the archived tasks that never reached done; they have no
+// lead or cycle time and are left out of the averages.
+type FlowStats struct {
+	Tasks     int           `json:"tasks"`
+	AvgLead   time.Duration `json:"avg_lead_ns"`
+	AvgCycle  time.Duration `json:"avg_cycle_ns"`
+	Abandoned int           `json:"abandoned"`
+}
+
+// ProjectFlow returns FlowStats for the done and archived tasks of project,
+// or of every project when project is empty.
+func ProjectFlow(project string) (FlowStats, error) {
+	tasks, err := repo().List(Filter{Project: project, States: []TaskState{StateDone, StateArchived}})
+	if err != nil {
+		return FlowStats{}, err
+	}
+	var st FlowStats
+	var lead, cycle time.Duration
+	var cycles int
+	for _, t := range tasks {
+		events, err := LoadEvents(t.ID)
+		if err != nil {
+			continue
+		}
+		f := Flow(events)
+		if f.Lead == 0 {
+			if len(events) > 0 && !reachedDone(events) {
+				st.Abandoned++
+			}
+			continue
+		}
+		st.Tasks++
+		lead += f.Lead
+		if f.Cycle > 0 {
+			cycles++
+			cycle += f.Cycle
+		}
+	}
+	if st.Tasks > 0 {
+		st.AvgLead = lead / time.Duration(st.Tasks)
+	}
+	if cycles > 0 {
+		st.AvgCycle = cycle / time.Duration(cycles)
+	}
+	return st, nil
+}
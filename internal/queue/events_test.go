@@ -0,0 +1,109 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFlow(t *testing.T) {
+	t0 := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	at := func(h int) time.Time { return t0.Add(time.Duration(h) * time.Hour) }
+	events := []Event{
+		{Time: at(0), Kind: EventCreated, To: StatePending},
+		{Time: at(1), Kind: EventState, From: StatePending, To: StatePlanned},
+		{Time: at(2), Kind: EventState, From: StatePlanned, To: StateRunning},
+		{Time: at(3), Kind: EventState, From: StateRunning, To: StateFailed},
+		{Time: at(4), Kind: EventState, From: StateFailed, To: StatePlanned},
+		{Time: at(5), Kind: EventState, From: StatePlanned, To: StateRunning},
+		{Time: at(6), Kind: EventAction, Actor: ActorWeb, Reason: "marked done"},
+		{Time: at(7), Kind: EventState, From: StateRunning, To: StateDone},
+	}
+
+	f := Flow(events)
+	if f.Lead != 7*time.Hour || f.Cycle != 5*time.Hour {
+		t.Errorf("Flow = %+v, want lead 7h cycle 5h", f)
+	}
+	if f := Flow(events[:6]); f.Lead != 0 || f.Cycle != 0 {
+		t.Errorf("unfinished task should have no flow times, got %+v", f)
+	}
+}
+
+func TestDescribeEvent(t *testing.T) {
+	cases := []struct {
+		e    Event
+		want string
+	}{
+		{Event{Kind: EventState, From: StatePending, To: StatePlanning}, "pending -> planning"},
+		{Event{Kind: EventStepEnd, Step: 2}, "step 2 done"},
+		{Event{Kind: EventStepEnd, Step: 2, Reason: "boom"}, "step 2 failed: boom"},
+		{Event{Kind: EventStepRetry, Step: 1, Attempt: 2}, "step 1 attempt 2"},
+		{Event{Kind: EventGuardrail, Reason: "usage 95%"}, "paused by guardrail: usage 95%"},
+		{Event{Kind: EventAction, Actor: ActorCLI, Reason: "retry"}, "retry"},
+	}
+	for _, c := range cases {
+		if got := DescribeEvent(c.e); got != c.want {
+			t.Errorf("DescribeEvent(%+v) = %q, want %q", c.e, got, c.want)
+		}
+	}
+}
+
+func TestEvents_PlanAttemptsReplanAndActions(t *testing.T) {
+	setupTestEnv(t)
+	task, _ := Add("proj", "task", "med")
+	IncrementPlanAttempts(task.ID)
+	SetPlanFile(task.ID, "/tmp/plan.md")
+	ResetPlan(task.ID)
+	RecordAction(task.ID, ActorCLI, "replan")
+
+	events, err := LoadEvents(task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kinds []string
+	for _, e := range events {
+		kinds = append(kinds, e.Kind)
+	}
+	want := []string{EventCreated, EventPlanAttempt, EventState, EventState, EventReplan, EventAction}
+	if len(kinds) != len(want) {
+		t.Fatalf("kinds = %v, want %v", kinds, want)
+	}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Errorf("kinds = %v, want %v", kinds, want)
+			break
+		}
+	}
+	if events[1].Attempt != 1 {
+		t.Errorf("plan attempt = %d", events[1].Attempt)
+	}
+	if last := events[len(events)-1]; last.Actor != ActorCLI {
+		t.Errorf("action actor = %q", last.Actor)
+	}
+}
+
+func TestProjectFlow(t *testing.T) {
+	setupTestEnv(t)
+	a, _ := Add("proj", "a", "med")
+	b, _ := Add("proj", "b", "med")
+	other, _ := Add("other", "c", "med")
+	Add("proj", "still open", "med")
+	dropped, _ := Add("proj", "dropped", "med")
+	for _, id := range []int{a.ID, b.ID, other.ID} {
+		UpdateState(id, StateRunning)
+		MarkDone(id)
+	}
+	Archive(a.ID)
+	Archive(dropped.ID)
+
+	st, err := ProjectFlow("proj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Tasks != 2 || st.Abandoned != 1 || st.AvgLead <= 0 || st.AvgCycle <= 0 || st.AvgCycle > st.AvgLead {
+		t.Errorf("ProjectFlow = %+v", st)
+	}
+	all, _ := ProjectFlow("")
+	if all.Tasks != 3 {
+		t.Errorf("all projects: %d tasks, want 3", all.Tasks)
+	}
+}
@@ -0,0 +1,121 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/persist"
+)
+
+// SavedFilter is a named search query, shared by the web UI, TUI and CLI.
+type SavedFilter struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+}
+
+var filterMu = persist.NewMutex(filtersPath)
+
+func filtersPath() string {
+	return filepath.Join(config.ConfigDir(), "filters.json")
+}
+
+func loadFilters() ([]SavedFilter, error) {
+	data, err := os.ReadFile(filtersPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var filters []SavedFilter
+	if err := json.Unmarshal(data, &filters); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", filtersPath(), err)
+	}
+	return filters, nil
+}
+
+func saveFilters(filters []SavedFilter) error {
+	sort.Slice(filters, func(i, j int) bool { return filters[i].Name < filters[j].Name })
+	data, err := json.MarshalIndent(filters, "", "  ")
+	if err != nil {
+		return err
+	}
+	return persist.WriteFile(filtersPath(), data, 0644)
+}
+
+// ListFilters returns the saved filters sorted by name.
+func ListFilters() ([]SavedFilter, error) {
+	filterMu.Lock()
+	defer filterMu.Unlock()
+	return loadFilters()
+}
+
+// GetFilter returns the saved filter called name.
+func GetFilter(name string) (SavedFilter, error) {
+	filters, err := ListFilters()
+	if err != nil {
+		return SavedFilter{}, err
+	}
+	for _, f := range filters {
+		if f.Name == name {
+			return f, nil
+		}
+	}
+	return SavedFilter{}, fmt.Errorf("no saved filter named %q", name)
+}
+
+// SaveFilter stores query under name, replacing a filter of the same name.
+// The query must parse.
+func SaveFilter(name, query string) (SavedFilter, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return SavedFilter{}, fmt.Errorf("filter name required")
+	}
+	q, err := ParseQuery(query)
+	if err != nil {
+		return SavedFilter{}, err
+	}
+	f := SavedFilter{Name: name, Query: q.Raw}
+	filterMu.Lock()
+	defer filterMu.Unlock()
+	filters, err := loadFilters()
+	if err != nil {
+		return f, err
+	}
+	replaced := false
+	for i := range filters {
+		if filters[i].Name == name {
+			filters[i] = f
+			replaced = true
+		}
+	}
+	if !replaced {
+		filters = append(filters, f)
+	}
+	return f, saveFilters(filters)
+}
+
+// DeleteFilter removes the saved filter called name.
+func DeleteFilter(name string) error {
+	filterMu.Lock()
+	defer filterMu.Unlock()
+	filters, err := loadFilters()
+	if err != nil {
+		return err
+	}
+	kept := filters[:0]
+	for _, f := range filters {
+		if f.Name != name {
+			kept = append(kept, f)
+		}
+	}
+	if len(kept) == len(filters) {
+		return fmt.Errorf("no saved filter named %q", name)
+	}
+	return saveFilters(kept)
+}
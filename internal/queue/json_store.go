@@ -0,0 +1,182 @@
+package queue
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/persist"
+)
+
+type TaskStore struct {
+	NextID int    `json:"next_id"`
+	Tasks  []Task `json:"tasks"`
+}
+
+var storeMu = persist.NewMutex(tasksPath)
+
+func tasksPath() string {
+	return filepath.Join(config.ConfigDir(), "tasks.json")
+}
+
+func loadStore() (TaskStore, error) {
+	store := TaskStore{NextID: 1}
+	data, err := os.ReadFile(tasksPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return store, nil
+		}
+		return store, err
+	}
+	// Legacy files called the failure reason block_reason.
+	data = bytes.ReplaceAll(data, []byte(`"block_reason"`), []byte(`"fail_reason"`))
+	err = json.Unmarshal(data, &store)
+	return store, err
+}
+
+func saveStore(store TaskStore) error {
+	dir := config.ConfigDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(store, "", "  ")
+	if err != nil {
+		return err
+	}
+	return persist.WriteFile(tasksPath(), data, 0644)
+}
+
+// jsonRepository keeps every task in a single tasks.json document that is
+// rewritten on each mutation. It resolves its path on every call so it
+// follows HOME changes.
+type jsonRepository struct{}
+
+func (jsonRepository) Create(t Task) (Task, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+
+	store, err := loadStore()
+	if err != nil {
+		return Task{}, err
+	}
+	t.ID = store.NextID
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Now()
+	}
+	store.NextID++
+	store.Tasks = append(store.Tasks, t)
+	if err := saveStore(store); err != nil {
+		return Task{}, err
+	}
+	return t, nil
+}
+
+func (jsonRepository) Get(id int) (Task, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+
+	store, err := loadStore()
+	if err != nil {
+		return Task{}, err
+	}
+	for _, t := range store.Tasks {
+		if t.ID == id {
+			return t, nil
+		}
+	}
+	return Task{}, notFound(id)
+}
+
+func (jsonRepository) List(f Filter) ([]Task, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+
+	store, err := loadStore()
+	if err != nil {
+		return nil, err
+	}
+	var result []Task
+	for _, t := range store.Tasks {
+		if f.match(t) {
+			result = append(result, t)
+		}
+	}
+	return result, nil
+}
+
+func (jsonRepository) Update(id int, fn func(*Task) error) (Task, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+
+	store, err := loadStore()
+	if err != nil {
+		return Task{}, err
+	}
+	for i := range store.Tasks {
+		if store.Tasks[i].ID != id {
+			continue
+		}
+		t := store.Tasks[i]
+		if err := fn(&t); err != nil {
+			return Task{}, err
+		}
+		store.Tasks[i] = t
+		if err := saveStore(store); err != nil {
+			return Task{}, err
+		}
+		return t, nil
+	}
+	return Task{}, notFound(id)
+}
+
+func (jsonRepository) UpdateWithAll(id int, fn func(*Task, []Task) error) (Task, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+
+	store, err := loadStore()
+	if err != nil {
+		return Task{}, err
+	}
+	for i := range store.Tasks {
+		if store.Tasks[i].ID != id {
+			continue
+		}
+		t := store.Tasks[i]
+		if err := fn(&t, store.Tasks); err != nil {
+			return Task{}, err
+		}
+		store.Tasks[i] = t
+		if err := saveStore(store); err != nil {
+			return Task{}, err
+		}
+		return t, nil
+	}
+	return Task{}, notFound(id)
+}
+
+func (jsonRepository) UpdateWhere(f Filter, fn func(*Task) bool) ([]Task, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+
+	store, err := loadStore()
+	if err != nil {
+		return nil, err
+	}
+	var changed []Task
+	for i := range store.Tasks {
+		if f.match(store.Tasks[i]) && fn(&store.Tasks[i]) {
+			changed = append(changed, store.Tasks[i])
+		}
+	}
+	if len(changed) > 0 {
+		if err := saveStore(store); err != nil {
+			return nil, err
+		}
+	}
+	return changed, nil
+}
+
+func (jsonRepository) Close() error { return nil }
@@ -0,0 +1,139 @@
+package queue
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// Storage backends selectable through config.TaskBackend.
+const (
+	BackendJSON   = "json"
+	BackendSQLite = "sqlite"
+)
+
+// TaskRepository is the storage backend behind the queue API. Implementations
+// must be safe for concurrent use; Update runs fn under the backend's write
+// lock so read-modify-write cycles on a single task are atomic.
+type TaskRepository interface {
+	// Create assigns the next ID to t and persists it.
+	Create(t Task) (Task, error)
+	Get(id int) (Task, error)
+	// List returns tasks matching f ordered by ID.
+	List(f Filter) ([]Task, error)
+	// Update applies fn to task id and persists the result. If fn returns an
+	// error nothing is written.
+	Update(id int, fn func(*Task) error) (Task, error)
+	// UpdateWhere applies fn to every task matching f and persists the tasks
+	// for which fn returned true. It returns the changed tasks.
+	UpdateWhere(f Filter, fn func(*Task) bool) ([]Task, error)
+	// UpdateWithAll is Update with every task, as read under the same write
+	// lock, passed to fn. Checks that span tasks, such as cycle detection,
+	// then cannot race with other writers.
+	UpdateWithAll(id int, fn func(t *Task, all []Task) error) (Task, error)
+	Close() error
+}
+
+// Filter selects tasks for List and UpdateWhere. Zero fields match anything.
+type Filter struct {
+	Project       string
+	Projects      []string // project must be one of these, ignoring case
+	Assignee      string
+	States        []TaskState // effective state must be one of these
+	ExcludeStates []TaskState // effective state must not be one of these
+	AutoPilot     bool        // only tasks with autopilot enabled
+}
+
+func (f Filter) match(t Task) bool {
+	if f.Project != "" && t.Project != f.Project {
+		return false
+	}
+	if len(f.Projects) > 0 && !containsFold(f.Projects, t.Project) {
+		return false
+	}
+	if f.Assignee != "" && t.Assignee != f.Assignee {
+		return false
+	}
+	if f.AutoPilot && !t.AutoPilot {
+		return false
+	}
+	s := EffectiveState(t)
+	if len(f.States) > 0 && !containsState(f.States, s) {
+		return false
+	}
+	if containsState(f.ExcludeStates, s) {
+		return false
+	}
+	return true
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsState(states []TaskState, s TaskState) bool {
+	for _, v := range states {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func notFound(id int) error {
+	return fmt.Errorf("task #%d not found", id)
+}
+
+var (
+	repoMu sync.Mutex
+	active TaskRepository = jsonRepository{}
+)
+
+func repo() TaskRepository {
+	repoMu.Lock()
+	defer repoMu.Unlock()
+	return active
+}
+
+// SetRepository swaps the active backend and returns the previous one.
+// The caller owns closing the returned repository.
+func SetRepository(r TaskRepository) TaskRepository {
+	repoMu.Lock()
+	defer repoMu.Unlock()
+	prev := active
+	active = r
+	return prev
+}
+
+// OpenRepository opens the named backend. An empty name selects JSON.
+func OpenRepository(backend string) (TaskRepository, error) {
+	switch backend {
+	case "", BackendJSON:
+		return jsonRepository{}, nil
+	case BackendSQLite:
+		return openSQLite(sqlitePath())
+	default:
+		return nil, fmt.Errorf("unknown task backend %q", backend)
+	}
+}
+
+// Init opens the configured backend and makes it the active repository.
+func Init(backend string) error {
+	r, err := OpenRepository(backend)
+	if err != nil {
+		return err
+	}
+	if prev := SetRepository(r); prev != nil {
+		prev.Close()
+	}
+	if backend != "" {
+		log.Printf("[queue] task backend: %s", backend)
+	}
+	return nil
+}
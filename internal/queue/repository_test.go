@@ -0,0 +1,308 @@
+package queue
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// backends returns a fresh instance of every repository implementation,
+// each rooted in its own temp HOME.
+func backends(t *testing.T) map[string]func(t *testing.T) TaskRepository {
+	return map[string]func(t *testing.T) TaskRepository{
+		"json": func(t *testing.T) TaskRepository {
+			setupTestEnv(t)
+			return jsonRepository{}
+		},
+		"sqlite": func(t *testing.T) TaskRepository {
+			setupTestEnv(t)
+			r, err := openSQLite(sqlitePath())
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { r.Close() })
+			return r
+		},
+	}
+}
+
+// useRepo makes r the active repository for the duration of the test.
+func useRepo(t *testing.T, r TaskRepository) {
+	t.Helper()
+	prev := SetRepository(r)
+	t.Cleanup(func() { SetRepository(prev) })
+}
+
+// ---------- Repository contract ----------
+
+func TestRepository_CreateGetUpdate(t *testing.T) {
+	for name, open := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			r := open(t)
+
+			a, err := r.Create(Task{Project: "p", Description: "a", State: StatePending})
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := r.Create(Task{Project: "p", Description: "b", State: StatePending})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a.ID != 1 || b.ID != 2 {
+				t.Fatalf("expected IDs 1,2 got %d,%d", a.ID, b.ID)
+			}
+			if a.CreatedAt.IsZero() {
+				t.Error("expected CreatedAt to be set")
+			}
+
+			got, err := r.Update(a.ID, func(t *Task) error {
+				t.State = StateRunning
+				t.CurrentStep = 2
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.State != StateRunning || got.CurrentStep != 2 {
+				t.Errorf("update not applied: %+v", got)
+			}
+
+			reread, err := r.Get(a.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reread.State != StateRunning || reread.Description != "a" {
+				t.Errorf("update not persisted: %+v", reread)
+			}
+
+			if _, err := r.Get(99); err == nil || !strings.Contains(err.Error(), "not found") {
+				t.Errorf("expected not found, got %v", err)
+			}
+			if _, err := r.Update(99, func(*Task) error { return nil }); err == nil || !strings.Contains(err.Error(), "not found") {
+				t.Errorf("expected not found, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRepository_UpdateErrorDiscardsChanges(t *testing.T) {
+	for name, open := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			r := open(t)
+			task, _ := r.Create(Task{Project: "p", Description: "a"})
+
+			_, err := r.Update(task.ID, func(t *Task) error {
+				t.Description = "changed"
+				return os.ErrInvalid
+			})
+			if err != os.ErrInvalid {
+				t.Fatalf("expected fn error, got %v", err)
+			}
+			got, _ := r.Get(task.ID)
+			if got.Description != "a" {
+				t.Errorf("expected description unchanged, got %q", got.Description)
+			}
+		})
+	}
+}
+
+func TestRepository_ListFilter(t *testing.T) {
+	for name, open := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			r := open(t)
+			r.Create(Task{Project: "alpha", State: StatePending, AutoPilot: true})
+			r.Create(Task{Project: "alpha", State: StateDone, Done: true})
+			r.Create(Task{Project: "beta", State: StatePlanned, AutoPilot: true, Assignee: "system"})
+			r.Create(Task{Project: "beta", Done: true}) // legacy record without state
+			r.Create(Task{Project: "alpha", State: StateArchived})
+
+			cases := []struct {
+				name   string
+				filter Filter
+				want   []int
+			}{
+				{"all", Filter{}, []int{1, 2, 3, 4, 5}},
+				{"project", Filter{Project: "alpha"}, []int{1, 2, 5}},
+				{"states", Filter{States: []TaskState{StatePending, StatePlanned}}, []int{1, 3}},
+				{"exclude", Filter{ExcludeStates: []TaskState{StateDone}}, []int{1, 3, 5}},
+				{"autopilot", Filter{AutoPilot: true}, []int{1, 3}},
+				{"assignee", Filter{Assignee: "system"}, []int{3}},
+				{"combined", Filter{Project: "beta", States: []TaskState{StateDone}}, []int{4}},
+			}
+			for _, tc := range cases {
+				tasks, err := r.List(tc.filter)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var ids []int
+				for _, task := range tasks {
+					ids = append(ids, task.ID)
+				}
+				if !equalInts(ids, tc.want) {
+					t.Errorf("%s: expected %v, got %v", tc.name, tc.want, ids)
+				}
+			}
+		})
+	}
+}
+
+func TestRepository_UpdateWhere(t *testing.T) {
+	for name, open := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			r := open(t)
+			r.Create(Task{Project: "p", State: StateRunning})
+			r.Create(Task{Project: "p", State: StateRunning, SessionID: "s"})
+			r.Create(Task{Project: "p", State: StatePending})
+
+			changed, err := r.UpdateWhere(Filter{States: []TaskState{StateRunning}}, func(t *Task) bool {
+				if t.SessionID != "" {
+					return false
+				}
+				t.State = StatePending
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(changed) != 1 || changed[0].ID != 1 {
+				t.Fatalf("expected only task 1 changed, got %+v", changed)
+			}
+			running, _ := r.List(Filter{States: []TaskState{StateRunning}})
+			if len(running) != 1 || running[0].ID != 2 {
+				t.Errorf("expected task 2 still running, got %+v", running)
+			}
+		})
+	}
+}
+
+// ---------- SQLite backend ----------
+
+func TestSQLite_QueueAPI(t *testing.T) {
+	setupTestEnv(t)
+	r, err := openSQLite(sqlitePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	useRepo(t, r)
+
+	a, _ := Add("proj", "first", "high")
+	b, _ := Add("proj", "second", "")
+	Add("other", "third", "low")
+	ToggleAutoPilot(a.ID)
+	ToggleAutoPilot(b.ID)
+	if err := UpdateWave(b.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := ListAutopilotPending("proj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 2 || pending[0].ID != b.ID {
+		t.Fatalf("expected wave 1 task first, got %+v", pending)
+	}
+
+	if err := MarkDone(a.ID); err != nil {
+		t.Fatal(err)
+	}
+	projects, _ := AutopilotProjects()
+	if len(projects) != 1 || projects[0] != "proj" {
+		t.Errorf("expected [proj], got %v", projects)
+	}
+	active, _ := ListPending()
+	if len(active) != 2 {
+		t.Errorf("expected 2 pending tasks, got %d", len(active))
+	}
+
+	if _, err := os.Stat(tasksPath()); !os.IsNotExist(err) {
+		t.Error("sqlite backend must not write tasks.json")
+	}
+}
+
+func TestSQLite_MigrateFromJSON(t *testing.T) {
+	dir := setupTestEnv(t)
+
+	// Populate the JSON store through the default backend.
+	for i := 0; i < 3; i++ {
+		if _, err := Add("proj", "legacy", "med"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	MarkDone(2)
+
+	r, err := openSQLite(sqlitePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	tasks, err := r.List(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 3 {
+		t.Fatalf("expected 3 migrated tasks, got %d", len(tasks))
+	}
+	done, _ := r.List(Filter{States: []TaskState{StateDone}})
+	if len(done) != 1 || done[0].ID != 2 {
+		t.Errorf("expected task 2 done after migration, got %+v", done)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "tasks.json")); !os.IsNotExist(err) {
+		t.Error("expected tasks.json to be renamed after migration")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "tasks.json.migrated")); err != nil {
+		t.Errorf("expected tasks.json.migrated: %v", err)
+	}
+
+	next, err := r.Create(Task{Project: "proj"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.ID != 4 {
+		t.Errorf("expected NextID to continue at 4, got %d", next.ID)
+	}
+}
+
+func TestSQLite_MigrationRunsOnce(t *testing.T) {
+	dir := setupTestEnv(t)
+	Add("proj", "legacy", "med")
+
+	r, err := openSQLite(sqlitePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+
+	// A stray tasks.json appearing later must not be imported over live data.
+	os.WriteFile(filepath.Join(dir, "tasks.json"), []byte(`{"next_id":9,"tasks":[{"id":8,"project":"x"}]}`), 0644)
+	r, err = openSQLite(sqlitePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	tasks, _ := r.List(Filter{})
+	if len(tasks) != 1 || tasks[0].ID != 1 {
+		t.Errorf("expected only the originally migrated task, got %+v", tasks)
+	}
+}
+
+func TestOpenRepository_UnknownBackend(t *testing.T) {
+	if _, err := OpenRepository("mongo"); err == nil {
+		t.Error("expected error for unknown backend")
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,243 @@
+package queue
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Query is a parsed task search. The language is a list of space-separated
+// clauses, all of which must match:
+//
+//	word or "some phrase"   text in the description, plan, labels or fail reason
+//	project:name            also label:, state:, priority:, assignee:, id: and parent:
+//	label:a,b               a comma-separated list matches any of its values
+//	-label:wip, -word       a leading dash negates the clause
+//
+// Matching is case-insensitive. Archived tasks are left out unless a state:
+// clause asks for them.
+type Query struct {
+	Raw     string
+	clauses []clause
+}
+
+type clause struct {
+	key    string // "" for free text
+	values []string
+	negate bool
+}
+
+// queryKeys are the keys a clause may use.
+var queryKeys = map[string]bool{
+	"project": true, "label": true, "state": true, "priority": true, "assignee": true, "id": true, "parent": true,
+}
+
+// ParseQuery parses s. An empty query matches every task that is not archived.
+func ParseQuery(s string) (Query, error) {
+	q := Query{Raw: strings.TrimSpace(s)}
+	tokens, err := splitQuery(s)
+	if err != nil {
+		return q, err
+	}
+	for _, tok := range tokens {
+		c := clause{}
+		if strings.HasPrefix(tok, "-") && len(tok) > 1 {
+			c.negate = true
+			tok = tok[1:]
+		}
+		if k, v, ok := strings.Cut(tok, ":"); ok && queryKeys[strings.ToLower(k)] {
+			c.key = strings.ToLower(k)
+			for _, part := range strings.Split(v, ",") {
+				if part = strings.ToLower(strings.TrimSpace(part)); part != "" {
+					c.values = append(c.values, part)
+				}
+			}
+			if len(c.values) == 0 {
+				return q, fmt.Errorf("%s: needs a value", c.key)
+			}
+			if err := c.validate(); err != nil {
+				return q, err
+			}
+		} else {
+			c.values = []string{strings.ToLower(tok)}
+		}
+		q.clauses = append(q.clauses, c)
+	}
+	return q, nil
+}
+
+// splitQuery splits on spaces, keeping double-quoted runs together.
+func splitQuery(s string) ([]string, error) {
+	var tokens []string
+	var cur strings.Builder
+	quoted := false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case (r == ' ' || r == '\t') && !quoted:
+			if cur.Len() > 0 {
+				tokens = append(tokens, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in query")
+	}
+	if cur.Len() > 0 {
+		tokens = append(tokens, cur.String())
+	}
+	return tokens, nil
+}
+
+func (c clause) validate() error {
+	for _, v := range c.values {
+		switch c.key {
+		case "state":
+			if !ValidState(TaskState(v)) {
+				return fmt.Errorf("state: unknown state %q", v)
+			}
+		case "id", "parent":
+			if _, err := strconv.Atoi(strings.TrimPrefix(v, "#")); err != nil {
+				return fmt.Errorf("%s: %q is not a task number", c.key, v)
+			}
+		}
+	}
+	return nil
+}
+
+// wantsState reports whether the query names state s in a positive clause.
+func (q Query) wantsState(s TaskState) bool {
+	for _, c := range q.clauses {
+		if c.key == "state" && !c.negate && containsString(c.values, string(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether t satisfies every clause of q. Field clauses are
+// checked first, so the plan file is only read for tasks they leave in.
+func (q Query) Match(t Task) bool {
+	if EffectiveState(t) == StateArchived && !q.wantsState(StateArchived) {
+		return false
+	}
+	for _, c := range q.clauses {
+		if c.key != "" && c.matchField(t) == c.negate {
+			return false
+		}
+	}
+	var text string
+	textLoaded := false
+	for _, c := range q.clauses {
+		if c.key != "" {
+			continue
+		}
+		if !textLoaded {
+			text, textLoaded = searchText(t), true
+		}
+		if strings.Contains(text, c.values[0]) == c.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// filter is the part of q the repository can apply itself: the project and
+// state clauses. Match still has the final say.
+func (q Query) filter() Filter {
+	var f Filter
+	for _, c := range q.clauses {
+		switch {
+		case c.key == "project" && !c.negate && f.Projects == nil:
+			f.Projects = c.values
+		case c.key == "state" && !c.negate && f.States == nil:
+			for _, v := range c.values {
+				f.States = append(f.States, TaskState(v))
+			}
+		case c.key == "state" && c.negate:
+			for _, v := range c.values {
+				f.ExcludeStates = append(f.ExcludeStates, TaskState(v))
+			}
+		}
+	}
+	if !q.wantsState(StateArchived) {
+		f.ExcludeStates = append(f.ExcludeStates, StateArchived)
+	}
+	return f
+}
+
+func (c clause) matchField(t Task) bool {
+	for _, v := range c.values {
+		switch c.key {
+		case "project":
+			if strings.EqualFold(t.Project, v) {
+				return true
+			}
+		case "label":
+			if containsString(t.Labels, v) {
+				return true
+			}
+		case "state":
+			if string(EffectiveState(t)) == v {
+				return true
+			}
+		case "priority":
+			if strings.EqualFold(t.Priority, v) {
+				return true
+			}
+		case "assignee":
+			if strings.EqualFold(t.Assignee, v) {
+				return true
+			}
+		case "id":
+			if id, _ := strconv.Atoi(strings.TrimPrefix(v, "#")); id == t.ID {
+				return true
+			}
+		case "parent":
+			if id, _ := strconv.Atoi(strings.TrimPrefix(v, "#")); id == t.ParentID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// searchText is the lowercased text free-text clauses are matched against.
+func searchText(t Task) string {
+	parts := []string{t.Description, t.FailReason, strings.Join(t.Labels, " ")}
+	if t.PlanFile != "" {
+		if data, err := os.ReadFile(t.PlanFile); err == nil {
+			parts = append(parts, string(data))
+		}
+	}
+	return strings.ToLower(strings.Join(parts, "\n"))
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Search returns the tasks matching q.
+func Search(q Query) ([]Task, error) {
+	tasks, err := repo().List(q.filter())
+	if err != nil {
+		return nil, err
+	}
+	var out []Task
+	for _, t := range tasks {
+		if q.Match(t) {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,180 @@
+package queue
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalizeLabels(t *testing.T) {
+	got := NormalizeLabels([]string{" Security ", "tech debt", "security", "", "a,b"})
+	want := []string{"a-b", "security", "tech-debt"}
+	if len(got) != len(want) {
+		t.Fatalf("NormalizeLabels = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("NormalizeLabels = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestParseQuery_Errors(t *testing.T) {
+	for _, s := range []string{`state:bogus`, `id:abc`, `label:`, `"unterminated`} {
+		if _, err := ParseQuery(s); err == nil {
+			t.Errorf("ParseQuery(%q) should fail", s)
+		}
+	}
+	q, err := ParseQuery(`url:http://x "two words"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(q.clauses) != 2 || q.clauses[0].key != "" || q.clauses[1].values[0] != "two words" {
+		t.Errorf("clauses = %+v", q.clauses)
+	}
+}
+
+func TestQueryMatch(t *testing.T) {
+	dir := t.TempDir()
+	planPath := filepath.Join(dir, "plan.md")
+	os.WriteFile(planPath, []byte("## Step 1\nRotate the TLS certificate"), 0644)
+	task := Task{
+		ID: 7, Project: "api", Description: "Fix login timeout", Priority: "high",
+		State: StateFailed, FailReason: "tests red", Labels: []string{"auth", "security"},
+		Assignee: "alice", PlanFile: planPath,
+	}
+
+	cases := []struct {
+		q    string
+		want bool
+	}{
+		{"", true},
+		{"project:api label:security state:failed", true},
+		{"project:API", true},
+		{"project:web", false},
+		{"label:ui,auth", true},
+		{"-label:security", false},
+		{"-label:wip timeout", true},
+		{"priority:high assignee:alice id:#7", true},
+		{"id:8", false},
+		{`"login timeout"`, true},
+		{"certificate", true},
+		{"red", true},
+		{"-timeout", false},
+		{"state:pending", false},
+	}
+	for _, c := range cases {
+		q, err := ParseQuery(c.q)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q): %v", c.q, err)
+		}
+		if got := q.Match(task); got != c.want {
+			t.Errorf("Match(%q) = %v, want %v", c.q, got, c.want)
+		}
+	}
+
+	task.State = StateArchived
+	if q, _ := ParseQuery("label:security"); q.Match(task) {
+		t.Error("archived task should not match without state:archived")
+	}
+	if q, _ := ParseQuery("state:archived,done"); !q.Match(task) {
+		t.Error("state:archived should match archived tasks")
+	}
+}
+
+func TestSearch(t *testing.T) {
+	setupTestEnv(t)
+	a, _ := Add("api", "Fix login timeout", "high")
+	Add("api", "Add dark mode", "low")
+	b, _ := Add("web", "Audit dependencies", "med")
+	if _, err := SetLabels(a.ID, []string{"Security"}); err != nil {
+		t.Fatal(err)
+	}
+	SetLabels(b.ID, []string{"security", "deps"})
+
+	q, _ := ParseQuery("label:security")
+	got, err := Search(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].ID != a.ID || got[1].ID != b.ID {
+		t.Errorf("Search(label:security) = %+v", got)
+	}
+	q, _ = ParseQuery("label:security -project:web")
+	if got, _ := Search(q); len(got) != 1 || got[0].ID != a.ID {
+		t.Errorf("Search with negation = %+v", got)
+	}
+}
+
+func TestSearch_FiltersInRepository(t *testing.T) {
+	for name, open := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			useRepo(t, open(t))
+			a, _ := Add("API", "Fix login", "")
+			b, _ := Add("api", "Fix logout", "")
+			c, _ := Add("web", "Fix login page", "")
+			MarkDone(b.ID)
+			Archive(c.ID)
+
+			for _, tt := range []struct {
+				query string
+				want  []int
+			}{
+				{"project:api", []int{a.ID, b.ID}},
+				{"project:api -state:done", []int{a.ID}},
+				{"state:done,archived", []int{b.ID, c.ID}},
+				{"fix", []int{a.ID, b.ID}},
+				{"login state:archived", []int{c.ID}},
+			} {
+				q, _ := ParseQuery(tt.query)
+				got, err := Search(q)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var ids []int
+				for _, t := range got {
+					ids = append(ids, t.ID)
+				}
+				if !equalInts(ids, tt.want) {
+					t.Errorf("Search(%q) = %v, want %v", tt.query, ids, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSavedFilters(t *testing.T) {
+	setupTestEnv(t)
+	if _, err := SaveFilter("broken", "state:nope"); err == nil {
+		t.Error("invalid query should not be saved")
+	}
+	if _, err := SaveFilter("  ", "label:x"); err == nil {
+		t.Error("empty name should not be saved")
+	}
+	SaveFilter("sec", "label:security")
+	SaveFilter("failed", "state:failed")
+	if _, err := SaveFilter("sec", " label:security project:api "); err != nil {
+		t.Fatal(err)
+	}
+
+	filters, err := ListFilters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filters) != 2 || filters[0].Name != "failed" || filters[1].Query != "label:security project:api" {
+		t.Errorf("filters = %+v", filters)
+	}
+	if f, err := GetFilter("sec"); err != nil || f.Query != "label:security project:api" {
+		t.Errorf("GetFilter = %+v, %v", f, err)
+	}
+
+	if err := DeleteFilter("sec"); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteFilter("sec"); err == nil {
+		t.Error("deleting a missing filter should fail")
+	}
+	if _, err := GetFilter("sec"); err == nil {
+		t.Error("deleted filter still found")
+	}
+}
@@ -0,0 +1,401 @@
+package queue
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS tasks (
+	id         INTEGER PRIMARY KEY,
+	project    TEXT NOT NULL DEFAULT '',
+	state      TEXT NOT NULL DEFAULT 'pending',
+	assignee   TEXT NOT NULL DEFAULT '',
+	auto_pilot INTEGER NOT NULL DEFAULT 0,
+	data       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_tasks_project_state ON tasks(project, state);
+CREATE INDEX IF NOT EXISTS idx_tasks_state ON tasks(state);
+CREATE TABLE IF NOT EXISTS meta (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);`
+
+func sqlitePath() string {
+	return filepath.Join(config.ConfigDir(), "tasks.db")
+}
+
+// sqliteRepository stores one row per task. The filterable fields live in
+// indexed columns; the full task is kept as a JSON document in data so new
+// Task fields need no schema change.
+type sqliteRepository struct {
+	db *sql.DB
+}
+
+func openSQLite(path string) (*sqliteRepository, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	dsn := "file:" + path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("sqlite schema: %w", err)
+	}
+	r := &sqliteRepository{db: db}
+	if err := r.migrateFromJSON(tasksPath()); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// migrateFromJSON imports tasks.json into an empty database once and renames
+// the source file so it is not imported again.
+func (r *sqliteRepository) migrateFromJSON(path string) error {
+	var n int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM tasks`).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	storeMu.Lock()
+	store, err := loadStore()
+	storeMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("migrate %s: %w", path, err)
+	}
+	if err := r.importStore(store); err != nil {
+		return fmt.Errorf("migrate %s: %w", path, err)
+	}
+	if err := os.Rename(path, path+".migrated"); err != nil {
+		return err
+	}
+	log.Printf("[queue] migrated %d tasks from %s to sqlite", len(store.Tasks), path)
+	return nil
+}
+
+func (r *sqliteRepository) importStore(store TaskStore) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, t := range store.Tasks {
+		if err := upsertTask(tx, t); err != nil {
+			return err
+		}
+		if t.ID >= store.NextID {
+			store.NextID = t.ID + 1
+		}
+	}
+	if err := setNextID(tx, store.NextID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func upsertTask(ex execer, t Task) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	_, err = ex.Exec(`INSERT INTO tasks (id, project, state, assignee, auto_pilot, data)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET project=excluded.project, state=excluded.state,
+			assignee=excluded.assignee, auto_pilot=excluded.auto_pilot, data=excluded.data`,
+		t.ID, t.Project, string(EffectiveState(t)), t.Assignee, t.AutoPilot, string(data))
+	return err
+}
+
+func nextID(q queryRower) (int, error) {
+	var v string
+	err := q.QueryRow(`SELECT value FROM meta WHERE key = 'next_id'`).Scan(&v)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(v)
+}
+
+func setNextID(ex execer, id int) error {
+	_, err := ex.Exec(`INSERT INTO meta (key, value) VALUES ('next_id', ?)
+		ON CONFLICT(key) DO UPDATE SET value=excluded.value`, strconv.Itoa(id))
+	return err
+}
+
+func scanTask(data string) (Task, error) {
+	var t Task
+	err := json.Unmarshal([]byte(data), &t)
+	return t, err
+}
+
+func (r *sqliteRepository) Create(t Task) (Task, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return Task{}, err
+	}
+	defer tx.Rollback()
+
+	id, err := nextID(tx)
+	if err != nil {
+		return Task{}, err
+	}
+	t.ID = id
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Now()
+	}
+	if err := upsertTask(tx, t); err != nil {
+		return Task{}, err
+	}
+	if err := setNextID(tx, id+1); err != nil {
+		return Task{}, err
+	}
+	return t, tx.Commit()
+}
+
+func (r *sqliteRepository) Get(id int) (Task, error) {
+	var data string
+	err := r.db.QueryRow(`SELECT data FROM tasks WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Task{}, notFound(id)
+	}
+	if err != nil {
+		return Task{}, err
+	}
+	return scanTask(data)
+}
+
+// where translates f into a WHERE clause over the indexed columns.
+func (f Filter) where() (string, []any) {
+	var conds []string
+	var args []any
+	if f.Project != "" {
+		conds = append(conds, "project = ?")
+		args = append(args, f.Project)
+	}
+	if len(f.Projects) > 0 {
+		conds = append(conds, "project COLLATE NOCASE IN ("+placeholders(len(f.Projects))+")")
+		for _, p := range f.Projects {
+			args = append(args, p)
+		}
+	}
+	if f.Assignee != "" {
+		conds = append(conds, "assignee = ?")
+		args = append(args, f.Assignee)
+	}
+	if f.AutoPilot {
+		conds = append(conds, "auto_pilot = 1")
+	}
+	if len(f.States) > 0 {
+		conds = append(conds, "state IN ("+placeholders(len(f.States))+")")
+		for _, s := range f.States {
+			args = append(args, string(s))
+		}
+	}
+	if len(f.ExcludeStates) > 0 {
+		conds = append(conds, "state NOT IN ("+placeholders(len(f.ExcludeStates))+")")
+		for _, s := range f.ExcludeStates {
+			args = append(args, string(s))
+		}
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+func (r *sqliteRepository) List(f Filter) ([]Task, error) {
+	where, args := f.where()
+	rows, err := r.db.Query(`SELECT data FROM tasks`+where+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []Task
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		t, err := scanTask(data)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, t)
+	}
+	return result, rows.Err()
+}
+
+func (r *sqliteRepository) Update(id int, fn func(*Task) error) (Task, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return Task{}, err
+	}
+	defer tx.Rollback()
+
+	var data string
+	err = tx.QueryRow(`SELECT data FROM tasks WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Task{}, notFound(id)
+	}
+	if err != nil {
+		return Task{}, err
+	}
+	t, err := scanTask(data)
+	if err != nil {
+		return Task{}, err
+	}
+	if err := fn(&t); err != nil {
+		return Task{}, err
+	}
+	if err := upsertTask(tx, t); err != nil {
+		return Task{}, err
+	}
+	return t, tx.Commit()
+}
+
+func (r *sqliteRepository) UpdateWithAll(id int, fn func(*Task, []Task) error) (Task, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return Task{}, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT data FROM tasks ORDER BY id`)
+	if err != nil {
+		return Task{}, err
+	}
+	var all []Task
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			rows.Close()
+			return Task{}, err
+		}
+		t, err := scanTask(data)
+		if err != nil {
+			rows.Close()
+			return Task{}, err
+		}
+		all = append(all, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return Task{}, err
+	}
+
+	for _, t := range all {
+		if t.ID != id {
+			continue
+		}
+		if err := fn(&t, all); err != nil {
+			return Task{}, err
+		}
+		if err := upsertTask(tx, t); err != nil {
+			return Task{}, err
+		}
+		return t, tx.Commit()
+	}
+	return Task{}, notFound(id)
+}
+
+func (r *sqliteRepository) UpdateWhere(f Filter, fn func(*Task) bool) ([]Task, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	where, args := f.where()
+	rows, err := tx.Query(`SELECT data FROM tasks`+where+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	var matched []Task
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		t, err := scanTask(data)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		matched = append(matched, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var changed []Task
+	for i := range matched {
+		if !fn(&matched[i]) {
+			continue
+		}
+		if err := upsertTask(tx, matched[i]); err != nil {
+			return nil, err
+		}
+		changed = append(changed, matched[i])
+	}
+	return changed, tx.Commit()
+}
+
+func (r *sqliteRepository) Close() error {
+	return r.db.Close()
+}
+
+// MigrateToSQLite imports tasks.json into tasks.db. It is a no-op when the
+// database already holds tasks or there is no JSON store.
+func MigrateToSQLite() (int, error) {
+	r, err := openSQLite(sqlitePath())
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	var n int
+	err = r.db.QueryRow(`SELECT COUNT(*) FROM tasks`).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,160 @@
+package queue
+
+import (
+	"fmt"
+	"log"
+)
+
+// States lists every task state in lifecycle order.
+var States = []TaskState{
+	StatePending, StatePlanning, StatePlanned, StateAwaitingApproval, StateRunning,
+	StateInReview, StateBlocked, StateFailed, StateDone, StateArchived,
+}
+
+// transitions is the task state machine: the states each state may move to.
+// Staying in the same state is always allowed.
+var transitions = map[TaskState][]TaskState{
+	StatePending:          {StatePlanning, StatePlanned, StateAwaitingApproval, StateRunning, StateBlocked, StateFailed, StateDone, StateArchived},
+	StatePlanning:         {StatePending, StatePlanned, StateAwaitingApproval, StateBlocked, StateFailed, StateDone, StateArchived},
+	StatePlanned:          {StatePending, StatePlanning, StateAwaitingApproval, StateRunning, StateBlocked, StateFailed, StateDone, StateArchived},
+	StateAwaitingApproval: {StatePending, StatePlanned, StateBlocked, StateFailed, StateDone, StateArchived},
+	StateRunning:          {StatePending, StatePlanned, StateInReview, StateFailed, StateDone, StateArchived},
+	StateInReview:         {StatePending, StateFailed, StateDone, StateArchived},
+	StateBlocked:          {StatePending, StatePlanned, StateFailed, StateDone, StateArchived},
+	StateFailed:           {StatePending, StatePlanned, StateDone, StateArchived},
+	StateDone:             {StatePending, StateArchived},
+	StateArchived:         {StatePending},
+}
+
+// ValidState reports whether s is a known task state.
+func ValidState(s TaskState) bool {
+	_, ok := transitions[s]
+	return ok
+}
+
+// CanTransition reports whether a task in state from may move to state to.
+func CanTransition(from, to TaskState) bool {
+	if from == to {
+		return ValidState(to)
+	}
+	return containsState(transitions[from], to)
+}
+
+// setState moves t to state to if the state machine allows it and returns
+// the state it left.
+func setState(t *Task, to TaskState) (TaskState, error) {
+	from := EffectiveState(*t)
+	if !CanTransition(from, to) {
+		return from, fmt.Errorf("task #%d cannot move from %s to %s", t.ID, from, to)
+	}
+	t.State = to
+	t.Done = to == StateDone || to == StateArchived
+	return from, nil
+}
+
+// moveTask transitions task id to state to, applies fn in the same update and
+// records the change in the task's event log. fn gets the state the task left
+// and may veto the move by returning an error. reason is kept with the event.
+func moveTask(id int, to TaskState, reason string, fn func(t *Task, from TaskState) error) (Task, error) {
+	var from TaskState
+	t, err := repo().Update(id, func(t *Task) error {
+		var err error
+		if from, err = setState(t, to); err != nil {
+			return err
+		}
+		if fn != nil {
+			return fn(t, from)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("[queue] task #%d: %v", id, err)
+		return t, err
+	}
+	if from != to {
+		log.Printf("[queue] task #%d state %s -> %s", id, from, to)
+		recordEvent(id, Event{Kind: EventState, From: from, To: to, Reason: reason})
+		if to == StateDone && t.ParentID != 0 {
+			completeParent(t.ParentID)
+		}
+	}
+	return t, nil
+}
+
+// Transition moves task id to state to, enforcing the state machine.
+func Transition(id int, to TaskState, reason string) (Task, error) {
+	return moveTask(id, to, reason, nil)
+}
+
+// Fail marks a task as failed for good: autopilot leaves it alone until
+// someone retries it.
+func Fail(id int, reason string) error {
+	return FailAfter(id, reason, 0)
+}
+
+// FailAfter is Fail for a task whose first lastDone steps are kept, as in its
+// own worktree: a retry resumes with step lastDone+1.
+func FailAfter(id int, reason string, lastDone int) error {
+	t, err := moveTask(id, StateFailed, reason, func(t *Task, _ TaskState) error {
+		t.FailReason = reason
+		t.SessionID = ""
+		t.CurrentStep = lastDone
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	notifyWebhook("task_failed", t)
+	return nil
+}
+
+// Retry sends a failed or blocked task back to the queue, to planned when it
+// still has a plan and to pending otherwise.
+func Retry(id int) (Task, error) {
+	t, err := GetTask(id)
+	if err != nil {
+		return t, err
+	}
+	switch EffectiveState(t) {
+	case StateFailed, StateBlocked:
+	default:
+		return t, fmt.Errorf("task #%d is %s, only failed or blocked tasks can be retried", id, EffectiveState(t))
+	}
+	to := StatePending
+	if t.PlanFile != "" {
+		to = StatePlanned
+	}
+	return moveTask(id, to, "retry", func(t *Task, _ TaskState) error {
+		t.FailReason = ""
+		t.HeldReason = ""
+		t.PlanAttempts = 0
+		return nil
+	})
+}
+
+// Block parks a task whose predecessor failed; reason says which one.
+func Block(id int, reason string) (Task, error) {
+	return moveTask(id, StateBlocked, reason, func(t *Task, _ TaskState) error {
+		t.HeldReason = reason
+		return nil
+	})
+}
+
+// Unblock returns a blocked task to planned when it has a plan, else pending.
+func Unblock(id int) (Task, error) {
+	t, err := GetTask(id)
+	if err != nil {
+		return t, err
+	}
+	if EffectiveState(t) != StateBlocked {
+		return t, nil
+	}
+	to := StatePending
+	if t.PlanFile != "" {
+		to = StatePlanned
+	}
+	return moveTask(id, to, "unblocked", func(t *Task, _ TaskState) error {
+		t.HeldReason = ""
+		return nil
+	})
+}
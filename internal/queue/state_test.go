@@ -0,0 +1,215 @@
+package queue
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+	cases := []struct {
+		from, to TaskState
+		want     bool
+	}{
+		{StatePending, StatePlanning, true},
+		{StatePlanning, StatePlanned, true},
+		{StatePlanned, StateRunning, true},
+		{StateRunning, StateInReview, true},
+		{StateRunning, StateFailed, true},
+		{StateFailed, StatePending, true},
+		{StateDone, StateArchived, true},
+		{StatePlanned, StatePlanned, true},
+		{StateDone, StateRunning, false},
+		{StateFailed, StateRunning, false},
+		{StateArchived, StateDone, false},
+		{StateBlocked, StateRunning, false},
+		{StatePending, StateInReview, false},
+		{"bogus", "bogus", false},
+		{StatePending, "bogus", false},
+	}
+	for _, c := range cases {
+		if got := CanTransition(c.from, c.to); got != c.want {
+			t.Errorf("CanTransition(%s, %s) = %v, want %v", c.from, c.to, got, c.want)
+		}
+	}
+	for _, s := range States {
+		if !ValidState(s) {
+			t.Errorf("ValidState(%s) = false", s)
+		}
+	}
+}
+
+func TestTransition_RejectsInvalidMove(t *testing.T) {
+	setupTestEnv(t)
+	task, _ := Add("proj", "task", "med")
+	if err := MarkDone(task.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Transition(task.ID, StateRunning, ""); err == nil {
+		t.Fatal("expected done -> running to be rejected")
+	}
+	got, _ := GetTask(task.ID)
+	if EffectiveState(got) != StateDone {
+		t.Errorf("rejected move changed state to %s", EffectiveState(got))
+	}
+}
+
+func TestTransition_RecordsEvents(t *testing.T) {
+	setupTestEnv(t)
+	task, _ := Add("proj", "task", "med")
+	UpdateState(task.ID, StatePlanning)
+	UpdateState(task.ID, StatePlanning) // no-op, no event
+	if _, err := Transition(task.ID, StatePlanned, "plan ready"); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := LoadEvents(task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		kind     string
+		from, to TaskState
+	}{
+		{EventCreated, "", StatePending},
+		{EventState, StatePending, StatePlanning},
+		{EventState, StatePlanning, StatePlanned},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), events)
+	}
+	for i, w := range want {
+		e := events[i]
+		if e.Kind != w.kind || e.From != w.from || e.To != w.to || e.Time.IsZero() {
+			t.Errorf("event %d = %+v, want %s %s -> %s", i, e, w.kind, w.from, w.to)
+		}
+	}
+	if events[2].Reason != "plan ready" {
+		t.Errorf("reason = %q", events[2].Reason)
+	}
+}
+
+func TestLoadEvents_SkipsBrokenLines(t *testing.T) {
+	setupTestEnv(t)
+	task, _ := Add("proj", "task", "med")
+	f, err := os.OpenFile(eventsPath(task.ID), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("{\"time\":\"2026-01-0\n")
+	f.Close()
+	UpdateState(task.ID, StatePlanned)
+
+	events, err := LoadEvents(task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Errorf("expected 2 events, got %d", len(events))
+	}
+	if ev, _ := LoadEvents(999); ev != nil {
+		t.Errorf("missing log should give no events, got %+v", ev)
+	}
+}
+
+func TestFailAndRetry(t *testing.T) {
+	setupTestEnv(t)
+	task, _ := Add("proj", "task", "med")
+	SetPlanFile(task.ID, "/tmp/plan.md")
+	UpdateState(task.ID, StateRunning)
+	repo().Update(task.ID, func(t *Task) error { t.CurrentStep = 2; t.SessionID = "s"; return nil })
+
+	if err := Fail(task.ID, "step 2 failed"); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := GetTask(task.ID)
+	if EffectiveState(got) != StateFailed || got.FailReason != "step 2 failed" {
+		t.Fatalf("got state=%s reason=%q", EffectiveState(got), got.FailReason)
+	}
+	if got.CurrentStep != 0 || got.SessionID != "" {
+		t.Errorf("Fail should clear progress, got step=%d session=%q", got.CurrentStep, got.SessionID)
+	}
+
+	// Failed tasks are not picked up by autopilot.
+	ToggleAutoPilot(task.ID)
+	pending, _ := ListAutopilotPending("proj")
+	if len(pending) != 0 {
+		t.Errorf("failed task should not be autopilot-pending, got %d", len(pending))
+	}
+
+	got, err := Retry(task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if EffectiveState(got) != StatePlanned || got.FailReason != "" {
+		t.Errorf("after retry: state=%s reason=%q", EffectiveState(got), got.FailReason)
+	}
+	if _, err := Retry(task.ID); err == nil {
+		t.Error("retrying a planned task should fail")
+	}
+}
+
+func TestBlockAndUnblock(t *testing.T) {
+	setupTestEnv(t)
+	task, _ := Add("proj", "task", "med")
+
+	if _, err := Block(task.ID, "waiting on failed #1"); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := GetTask(task.ID)
+	if EffectiveState(got) != StateBlocked || got.HeldReason != "waiting on failed #1" {
+		t.Fatalf("got state=%s held=%q", EffectiveState(got), got.HeldReason)
+	}
+	if _, err := Transition(task.ID, StateRunning, ""); err == nil {
+		t.Error("blocked task should not start running")
+	}
+
+	got, err := Unblock(task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if EffectiveState(got) != StatePending || got.HeldReason != "" {
+		t.Errorf("after unblock: state=%s held=%q", EffectiveState(got), got.HeldReason)
+	}
+}
+
+func TestLoadStore_KeepsFailedAndBlocked(t *testing.T) {
+	dir := setupTestEnv(t)
+	data := `{"next_id":3,"tasks":[` +
+		`{"id":1,"project":"p","description":"a","state":"failed","block_reason":"boom"},` +
+		`{"id":2,"project":"p","description":"b","state":"blocked"}]}`
+	if err := os.WriteFile(filepath.Join(dir, "tasks.json"), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := GetTask(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if EffectiveState(a) != StateFailed || a.FailReason != "boom" {
+		t.Errorf("task 1: state=%s reason=%q", EffectiveState(a), a.FailReason)
+	}
+	b, _ := GetTask(2)
+	if EffectiveState(b) != StateBlocked {
+		t.Errorf("task 2: state=%s", EffectiveState(b))
+	}
+}
+
+func TestRecoverRunning_ResetsPlanning(t *testing.T) {
+	setupTestEnv(t)
+	task, _ := Add("proj", "task", "med")
+	UpdateState(task.ID, StatePlanning)
+
+	changed, err := RecoverRunning()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) != 1 {
+		t.Fatalf("expected 1 recovered task, got %d", len(changed))
+	}
+	got, _ := GetTask(task.ID)
+	if EffectiveState(got) != StatePending {
+		t.Errorf("state = %s, want pending", EffectiveState(got))
+	}
+}
@@ -1,49 +1,62 @@
 package queue
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
 	"log"
-	"net/http"
-	"os"
-	"path/filepath"
 	"sort"
-	"sync"
+	"strings"
 	"time"
 
-	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/webhook"
 )
 
 type TaskState string
 
 const (
-	StatePending  TaskState = "pending"
-	StatePlanned  TaskState = "planned"
-	StateRunning  TaskState = "running"
-	StateDone     TaskState = "done"
-	StateArchived TaskState = "archived"
+	StatePending          TaskState = "pending"
+	StatePlanning         TaskState = "planning"
+	StatePlanned          TaskState = "planned"
+	StateAwaitingApproval TaskState = "awaiting_approval"
+	StateRunning          TaskState = "running"
+	StateInReview         TaskState = "in_review"
+	StateBlocked          TaskState = "blocked" // a predecessor failed
+	StateFailed           TaskState = "failed"  // gave up; waits for a retry
+	StateDone             TaskState = "done"
+	StateArchived         TaskState = "archived"
 )
 
 type Task struct {
-	ID          int       `json:"id"`
-	Project     string    `json:"project"`
-	Description string    `json:"description"`
-	Priority    string    `json:"priority"`
-	CreatedAt   time.Time `json:"created_at"`
-	State       TaskState `json:"state,omitempty"`
-	PlanFile    string    `json:"plan_file,omitempty"`
-	FailReason  string    `json:"fail_reason,omitempty"`
-	Done        bool      `json:"done"`
-	AutoPilot   bool      `json:"auto_pilot"`
-	Optional    bool      `json:"optional,omitempty"`
-	Assignee     string   `json:"assignee,omitempty"`
-	Attachments  []string `json:"attachments,omitempty"`
-	PlanAttempts int      `json:"plan_attempts,omitempty"`
-	SessionID    string   `json:"session_id,omitempty"`
-	CurrentStep  int      `json:"current_step,omitempty"`
-	TotalSteps   int      `json:"total_steps,omitempty"`
-	Wave         int      `json:"wave,omitempty"`
+	ID           int       `json:"id"`
+	Project      string    `json:"project"`
+	Description  string    `json:"description"`
+	Priority     string    `json:"priority"`
+	CreatedAt    time.Time `json:"created_at"`
+	State        TaskState `json:"state,omitempty"`
+	PlanFile     string    `json:"plan_file,omitempty"`
+	FailReason   string    `json:"fail_reason,omitempty"`
+	Done         bool      `json:"done"`
+	AutoPilot    bool      `json:"auto_pilot"`
+	Optional     bool      `json:"optional,omitempty"`
+	Assignee     string    `json:"assignee,omitempty"`
+	Attachments  []string  `json:"attachments,omitempty"`
+	PlanAttempts int       `json:"plan_attempts,omitempty"`
+	SessionID    string    `json:"session_id,omitempty"`
+	CurrentStep  int       `json:"current_step,omitempty"`
+	TotalSteps   int       `json:"total_steps,omitempty"`
+	Wave         int       `json:"wave,omitempty"`
+	DependsOn    []int     `json:"depends_on,omitempty"`
+	HeldReason   string    `json:"held_reason,omitempty"`
+	// RequirePlanApproval overrides the project/global approval setting when set.
+	RequirePlanApproval *bool  `json:"require_plan_approval,omitempty"`
+	ReviewFeedback      string `json:"review_feedback,omitempty"`
+	// PRNumber and PRURL identify the pull request a task was delivered as.
+	PRNumber int    `json:"pr_number,omitempty"`
+	PRURL    string `json:"pr_url,omitempty"`
+	// Labels are free-form tags, lowercase and sorted; see NormalizeLabels.
+	Labels []string `json:"labels,omitempty"`
+	// ParentID links a subtask to its epic. Epics are not run themselves and
+	// are marked done when their last subtask is; see RollupOf.
+	ParentID int `json:"parent_id,omitempty"`
 }
 
 func EffectiveState(t Task) TaskState {
@@ -56,372 +69,286 @@ func EffectiveState(t Task) TaskState {
 	return StatePending
 }
 
-type TaskStore struct {
-	NextID int    `json:"next_id"`
-	Tasks  []Task `json:"tasks"`
-}
-
-var storeMu sync.Mutex
-
-func tasksPath() string {
-	return filepath.Join(config.ConfigDir(), "tasks.json")
-}
-
-func loadStore() (TaskStore, error) {
-	store := TaskStore{NextID: 1}
-	data, err := os.ReadFile(tasksPath())
-	if err != nil {
-		if os.IsNotExist(err) {
-			return store, nil
-		}
-		return store, err
-	}
-	// Migrate legacy states from disk
-	data = bytes.ReplaceAll(data, []byte(`"state": "blocked"`), []byte(`"state": "pending"`))
-	data = bytes.ReplaceAll(data, []byte(`"state":"blocked"`), []byte(`"state":"pending"`))
-	data = bytes.ReplaceAll(data, []byte(`"state": "failed"`), []byte(`"state": "pending"`))
-	data = bytes.ReplaceAll(data, []byte(`"state":"failed"`), []byte(`"state":"pending"`))
-	data = bytes.ReplaceAll(data, []byte(`"block_reason"`), []byte(`"fail_reason"`))
-	err = json.Unmarshal(data, &store)
-	return store, err
-}
-
-func saveStore(store TaskStore) error {
-	dir := config.ConfigDir()
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
-	}
-	data, err := json.MarshalIndent(store, "", "  ")
-	if err != nil {
-		return err
-	}
-	return os.WriteFile(tasksPath(), data, 0644)
-}
-
 func Add(project, description, priority string) (Task, error) {
-	storeMu.Lock()
-	defer storeMu.Unlock()
-
-	store, err := loadStore()
-	if err != nil {
-		return Task{}, err
-	}
-
 	if priority == "" {
 		priority = "med"
 	}
 
-	task := Task{
-		ID:          store.NextID,
+	task, err := repo().Create(Task{
 		Project:     project,
 		Description: description,
 		Priority:    priority,
 		CreatedAt:   time.Now(),
 		State:       StatePending,
-	}
-	store.NextID++
-	store.Tasks = append(store.Tasks, task)
-
-	if err := saveStore(store); err != nil {
+	})
+	if err != nil {
 		return Task{}, err
 	}
 	log.Printf("[queue] task #%d created: project=%s desc=%q", task.ID, task.Project, task.Description)
+	recordEvent(task.ID, Event{Kind: EventCreated, To: StatePending})
 	notifyWebhook("task_created", task)
 	return task, nil
 }
 
 func MarkDone(id int) error {
-	storeMu.Lock()
-	defer storeMu.Unlock()
-
-	store, err := loadStore()
+	t, err := moveTask(id, StateDone, "", func(t *Task, _ TaskState) error {
+		t.SessionID = ""
+		t.CurrentStep = 0
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-
-	for i := range store.Tasks {
-		if store.Tasks[i].ID == id {
-			store.Tasks[i].Done = true
-			store.Tasks[i].State = StateDone
-			store.Tasks[i].SessionID = ""
-			store.Tasks[i].CurrentStep = 0
-			if err := saveStore(store); err != nil {
-				return err
-			}
-			log.Printf("[queue] task #%d marked done", id)
-			notifyWebhook("task_done", store.Tasks[i])
-			return nil
-		}
-	}
-	return fmt.Errorf("task #%d not found", id)
+	log.Printf("[queue] task #%d marked done", id)
+	notifyWebhook("task_done", t)
+	return nil
 }
 
 func ListPending() ([]Task, error) {
-	storeMu.Lock()
-	defer storeMu.Unlock()
-
-	store, err := loadStore()
-	if err != nil {
-		return nil, err
-	}
-
-	var pending []Task
-	for _, t := range store.Tasks {
-		if EffectiveState(t) != StateDone {
-			pending = append(pending, t)
-		}
-	}
-	return pending, nil
+	return repo().List(Filter{ExcludeStates: []TaskState{StateDone}})
 }
 
 func ListActive() ([]Task, error) {
-	storeMu.Lock()
-	defer storeMu.Unlock()
-
-	store, err := loadStore()
-	if err != nil {
-		return nil, err
-	}
-
-	var active []Task
-	for _, t := range store.Tasks {
-		if EffectiveState(t) != StateArchived {
-			active = append(active, t)
-		}
-	}
-	return active, nil
+	return repo().List(Filter{ExcludeStates: []TaskState{StateArchived}})
 }
 
+// Archive archives a task together with all of its subtasks.
 func Archive(id int) error {
-	storeMu.Lock()
-	defer storeMu.Unlock()
-
-	store, err := loadStore()
-	if err != nil {
-		return err
-	}
-	for i := range store.Tasks {
-		if store.Tasks[i].ID == id {
-			store.Tasks[i].State = StateArchived
-			store.Tasks[i].Done = true
-			store.Tasks[i].SessionID = ""
-			store.Tasks[i].CurrentStep = 0
-			log.Printf("[queue] task #%d archived", id)
-			return saveStore(store)
-		}
+	_, err := moveTask(id, StateArchived, "", func(t *Task, _ TaskState) error {
+		t.SessionID = ""
+		t.CurrentStep = 0
+		log.Printf("[queue] task #%d archived", id)
+		return nil
+	})
+	if err == nil {
+		archiveChildren(id)
 	}
-	return fmt.Errorf("task #%d not found", id)
+	return err
 }
 
 func ListAll() ([]Task, error) {
-	storeMu.Lock()
-	defer storeMu.Unlock()
+	return repo().List(Filter{})
+}
 
-	store, err := loadStore()
-	if err != nil {
-		return nil, err
-	}
-	return store.Tasks, nil
+// ListWhere returns the tasks matching f.
+func ListWhere(f Filter) ([]Task, error) {
+	return repo().List(f)
 }
 
+// UpdateState moves a task to state; see Transition.
 func UpdateState(id int, state TaskState) error {
-	storeMu.Lock()
-	defer storeMu.Unlock()
-
-	store, err := loadStore()
-	if err != nil {
-		return err
-	}
-	for i := range store.Tasks {
-		if store.Tasks[i].ID == id {
-			store.Tasks[i].State = state
-			if state == StateDone {
-				store.Tasks[i].Done = true
-			}
-			log.Printf("[queue] task #%d state -> %s", id, state)
-			return saveStore(store)
-		}
-	}
-	return fmt.Errorf("task #%d not found", id)
+	_, err := Transition(id, state, "")
+	return err
 }
 
 func SetPlanFile(id int, path string) error {
-	storeMu.Lock()
-	defer storeMu.Unlock()
-
-	store, err := loadStore()
-	if err != nil {
-		return err
-	}
-	for i := range store.Tasks {
-		if store.Tasks[i].ID == id {
-			store.Tasks[i].PlanFile = path
-			store.Tasks[i].State = StatePlanned
-			log.Printf("[queue] task #%d plan set: %s", id, path)
-			return saveStore(store)
-		}
+	t, err := moveTask(id, StatePlanned, "plan ready", func(t *Task, _ TaskState) error {
+		t.PlanFile = path
+		log.Printf("[queue] task #%d plan set: %s", id, path)
+		return nil
+	})
+	if err == nil {
+		notifyWebhook(webhook.EventPlanReady, t)
 	}
-	return fmt.Errorf("task #%d not found", id)
+	return err
 }
 
 func ResetPlan(id int) error {
-	storeMu.Lock()
-	defer storeMu.Unlock()
-
-	store, err := loadStore()
-	if err != nil {
-		return err
+	_, err := moveTask(id, StatePending, "replan", func(t *Task, _ TaskState) error {
+		t.PlanFile = ""
+		t.FailReason = ""
+		t.HeldReason = ""
+		t.PlanAttempts = 0
+		t.SessionID = ""
+		t.CurrentStep = 0
+		log.Printf("[queue] task #%d plan reset", id)
+		return nil
+	})
+	if err == nil {
+		recordEvent(id, Event{Kind: EventReplan})
 	}
-	for i := range store.Tasks {
-		if store.Tasks[i].ID == id {
-			store.Tasks[i].State = StatePending
-			store.Tasks[i].PlanFile = ""
-			store.Tasks[i].FailReason = ""
-			store.Tasks[i].Done = false
-			store.Tasks[i].PlanAttempts = 0
-			store.Tasks[i].SessionID = ""
-			store.Tasks[i].CurrentStep = 0
-			log.Printf("[queue] task #%d plan reset", id)
-			return saveStore(store)
+	return err
+}
+
+// ApprovePlan releases a task held for plan review so it can run.
+func ApprovePlan(id int) error {
+	_, err := moveTask(id, StatePlanned, "plan approved", func(t *Task, from TaskState) error {
+		if from != StateAwaitingApproval {
+			return fmt.Errorf("task #%d is not awaiting plan approval", id)
 		}
-	}
-	return fmt.Errorf("task #%d not found", id)
+		t.ReviewFeedback = ""
+		log.Printf("[queue] task #%d plan approved", id)
+		return nil
+	})
+	return err
+}
+
+// RejectPlan sends a task held for plan review back to planning. The feedback
+// is kept for the next plan prompt.
+func RejectPlan(id int, feedback string) error {
+	_, err := moveTask(id, StatePending, "plan rejected", func(t *Task, from TaskState) error {
+		if from != StateAwaitingApproval {
+			return fmt.Errorf("task #%d is not awaiting plan approval", id)
+		}
+		t.PlanFile = ""
+		t.FailReason = ""
+		t.PlanAttempts = 0
+		t.ReviewFeedback = feedback
+		log.Printf("[queue] task #%d plan rejected: %s", id, feedback)
+		return nil
+	})
+	return err
+}
+
+// SetRequirePlanApproval sets the task's approval override; nil inherits the
+// project/global setting.
+func SetRequirePlanApproval(id int, require *bool) error {
+	_, err := repo().Update(id, func(t *Task) error {
+		t.RequirePlanApproval = require
+		return nil
+	})
+	return err
 }
 
 // IncrementPlanAttempts atomically increments the plan attempt counter and returns the new value.
 func IncrementPlanAttempts(id int) (int, error) {
-	storeMu.Lock()
-	defer storeMu.Unlock()
-
-	store, err := loadStore()
+	t, err := repo().Update(id, func(t *Task) error {
+		t.PlanAttempts++
+		return nil
+	})
 	if err != nil {
 		return 0, err
 	}
-	for i := range store.Tasks {
-		if store.Tasks[i].ID == id {
-			store.Tasks[i].PlanAttempts++
-			count := store.Tasks[i].PlanAttempts
-			if err := saveStore(store); err != nil {
-				return 0, err
-			}
-			log.Printf("[queue] task #%d plan_attempts=%d", id, count)
-			return count, nil
-		}
-	}
-	return 0, fmt.Errorf("task #%d not found", id)
+	log.Printf("[queue] task #%d plan_attempts=%d", id, t.PlanAttempts)
+	recordEvent(id, Event{Kind: EventPlanAttempt, Attempt: t.PlanAttempts})
+	return t.PlanAttempts, nil
 }
 
+// SetFailReason records a failure that autopilot will retry: the task goes
+// back to pending. Use Fail when the task should stop being retried.
 func SetFailReason(id int, reason string) error {
-	storeMu.Lock()
-	defer storeMu.Unlock()
-
-	store, err := loadStore()
+	t, err := moveTask(id, StatePending, reason, func(t *Task, _ TaskState) error {
+		t.FailReason = reason
+		t.SessionID = ""
+		t.CurrentStep = 0
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-	for i := range store.Tasks {
-		if store.Tasks[i].ID == id {
-			store.Tasks[i].FailReason = reason
-			store.Tasks[i].State = StatePending
-			store.Tasks[i].SessionID = ""
-			store.Tasks[i].CurrentStep = 0
-			if err := saveStore(store); err != nil {
-				return err
-			}
-			log.Printf("[queue] task #%d back to pending: %s", id, reason)
-			notifyWebhook("task_retry", store.Tasks[i])
-			return nil
-		}
-	}
-	return fmt.Errorf("task #%d not found", id)
+	log.Printf("[queue] task #%d back to pending: %s", id, reason)
+	notifyWebhook("task_retry", t)
+	return nil
 }
 
-func ResetFailReason(id int) error {
-	storeMu.Lock()
-	defer storeMu.Unlock()
-
-	store, err := loadStore()
+// SetInReview parks a completed task until its pull request is merged or closed.
+func SetInReview(id, number int, url string) error {
+	t, err := moveTask(id, StateInReview, url, func(t *Task, _ TaskState) error {
+		t.PRNumber = number
+		t.PRURL = url
+		t.FailReason = ""
+		t.SessionID = ""
+		t.CurrentStep = 0
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-	for i := range store.Tasks {
-		if store.Tasks[i].ID == id {
-			store.Tasks[i].FailReason = ""
-			log.Printf("[queue] task #%d fail_reason cleared", id)
-			return saveStore(store)
-		}
-	}
-	return fmt.Errorf("task #%d not found", id)
+	log.Printf("[queue] task #%d in review: PR #%d", id, number)
+	notifyWebhook("task_in_review", t)
+	return nil
 }
 
-func ToggleAutoPilot(id int) error {
-	storeMu.Lock()
-	defer storeMu.Unlock()
+// ListInReview returns the tasks waiting on a pull request.
+func ListInReview() ([]Task, error) {
+	return repo().List(Filter{States: []TaskState{StateInReview}})
+}
 
-	store, err := loadStore()
+// FinishReview settles a task whose pull request left review: merged tasks
+// are done, closed ones fail so they are not delivered again unattended.
+func FinishReview(id int, merged bool) error {
+	to, reason := StateFailed, "PR closed without merging"
+	if merged {
+		to, reason = StateDone, "PR merged"
+	}
+	t, err := moveTask(id, to, reason, func(t *Task, from TaskState) error {
+		if from != StateInReview {
+			return fmt.Errorf("task #%d is not in review", id)
+		}
+		if !merged {
+			t.FailReason = fmt.Sprintf("PR #%d closed without merging", t.PRNumber)
+		}
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-	for i := range store.Tasks {
-		if store.Tasks[i].ID == id {
-			store.Tasks[i].AutoPilot = !store.Tasks[i].AutoPilot
-			log.Printf("[queue] task #%d autopilot=%v", id, store.Tasks[i].AutoPilot)
-			return saveStore(store)
-		}
+	if merged {
+		log.Printf("[queue] task #%d PR #%d merged", id, t.PRNumber)
+		notifyWebhook("task_done", t)
+		notifyWebhook(webhook.EventPRMerged, t)
+		return nil
 	}
-	return fmt.Errorf("task #%d not found", id)
+	log.Printf("[queue] task #%d PR #%d closed", id, t.PRNumber)
+	notifyWebhook("task_pr_closed", t)
+	return nil
 }
 
-func SetAllAutoPilot(on bool) error {
-	storeMu.Lock()
-	defer storeMu.Unlock()
+func ResetFailReason(id int) error {
+	_, err := repo().Update(id, func(t *Task) error {
+		t.FailReason = ""
+		log.Printf("[queue] task #%d fail_reason cleared", id)
+		return nil
+	})
+	return err
+}
 
-	store, err := loadStore()
-	if err != nil {
-		return err
-	}
-	for i := range store.Tasks {
-		if EffectiveState(store.Tasks[i]) != StateDone {
-			store.Tasks[i].AutoPilot = on
-		}
-	}
-	return saveStore(store)
+// SetAutoPilot turns autopilot on or off for a task. Unlike
+// ToggleAutoPilot, concurrent callers cannot undo each other.
+func SetAutoPilot(id int, on bool) error {
+	_, err := repo().Update(id, func(t *Task) error {
+		t.AutoPilot = on
+		log.Printf("[queue] task #%d autopilot=%v", id, on)
+		return nil
+	})
+	return err
 }
 
-func GetTask(id int) (Task, error) {
-	storeMu.Lock()
-	defer storeMu.Unlock()
+func ToggleAutoPilot(id int) error {
+	_, err := repo().Update(id, func(t *Task) error {
+		t.AutoPilot = !t.AutoPilot
+		log.Printf("[queue] task #%d autopilot=%v", id, t.AutoPilot)
+		return nil
+	})
+	return err
+}
 
-	store, err := loadStore()
-	if err != nil {
-		return Task{}, err
-	}
-	for _, t := range store.Tasks {
-		if t.ID == id {
-			return t, nil
+func SetAllAutoPilot(on bool) error {
+	_, err := repo().UpdateWhere(Filter{ExcludeStates: []TaskState{StateDone}}, func(t *Task) bool {
+		if t.AutoPilot == on {
+			return false
 		}
-	}
-	return Task{}, fmt.Errorf("task #%d not found", id)
+		t.AutoPilot = on
+		return true
+	})
+	return err
 }
 
-func ListAutopilotPending(project string) ([]Task, error) {
-	storeMu.Lock()
-	defer storeMu.Unlock()
+func GetTask(id int) (Task, error) {
+	return repo().Get(id)
+}
 
-	store, err := loadStore()
+func ListAutopilotPending(project string) ([]Task, error) {
+	result, err := repo().List(Filter{
+		Project:   project,
+		AutoPilot: true,
+		States:    []TaskState{StatePending, StatePlanned, StateAwaitingApproval, StateBlocked},
+	})
 	if err != nil {
 		return nil, err
 	}
-
-	var result []Task
-	for _, t := range store.Tasks {
-		if t.Project != project || !t.AutoPilot {
-			continue
-		}
-		s := EffectiveState(t)
-		if s == StatePending || s == StatePlanned {
-			result = append(result, t)
-		}
+	if result, err = withoutEpics(result); err != nil {
+		return nil, err
 	}
 
 	// Wave order: wave ascending (0 treated as max int = legacy sequential last),
@@ -445,30 +372,31 @@ func ListAutopilotPending(project string) ([]Task, error) {
 
 // ListAutopilotSystemPending returns system-assignee tasks with autopilot enabled.
 func ListAutopilotSystemPending() ([]Task, error) {
-	storeMu.Lock()
-	defer storeMu.Unlock()
-
-	store, err := loadStore()
+	result, err := repo().List(Filter{
+		Assignee:  "system",
+		AutoPilot: true,
+		States:    []TaskState{StatePending, StatePlanned},
+	})
 	if err != nil {
 		return nil, err
 	}
+	return withoutEpics(result)
+}
 
-	var result []Task
-	for _, t := range store.Tasks {
-		if t.Assignee != "system" || !t.AutoPilot {
-			continue
-		}
-		s := EffectiveState(t)
-		if s == StatePending || s == StatePlanned {
-			result = append(result, t)
+// withoutEpics drops tasks that have subtasks; their children do the work.
+func withoutEpics(tasks []Task) ([]Task, error) {
+	all, err := ListAll()
+	if err != nil {
+		return nil, err
+	}
+	children := ChildIndex(all)
+	kept := tasks[:0]
+	for _, t := range tasks {
+		if len(children[t.ID]) == 0 {
+			kept = append(kept, t)
 		}
 	}
-
-	sort.Slice(result, func(i, j int) bool {
-		return result[i].ID < result[j].ID
-	})
-
-	return result, nil
+	return kept, nil
 }
 
 func priorityRank(p string) int {
@@ -486,52 +414,42 @@ func priorityRank(p string) int {
 // Only resets tasks WITHOUT a SessionID (those can't be resumed).
 // Tasks with SessionID are left in running state for RecoverAndResume to handle.
 func RecoverRunning() ([]Task, error) {
-	storeMu.Lock()
-	defer storeMu.Unlock()
-
-	store, err := loadStore()
-	if err != nil {
-		return nil, err
-	}
-
-	var recovered []Task
-	for i := range store.Tasks {
-		if store.Tasks[i].State == StateRunning && store.Tasks[i].SessionID == "" {
-			if store.Tasks[i].PlanFile != "" {
-				store.Tasks[i].State = StatePlanned
-			} else {
-				store.Tasks[i].State = StatePending
-			}
-			recovered = append(recovered, store.Tasks[i])
+	froms := make(map[int]TaskState)
+	changed, err := repo().UpdateWhere(Filter{States: []TaskState{StateRunning, StatePlanning}}, func(t *Task) bool {
+		if t.State == StateRunning && t.SessionID != "" {
+			return false
 		}
-	}
-
-	if len(recovered) > 0 {
-		if err := saveStore(store); err != nil {
-			return nil, err
+		to := StatePending
+		if t.PlanFile != "" {
+			to = StatePlanned
+		}
+		from, err := setState(t, to)
+		if err != nil {
+			return false
 		}
+		froms[t.ID] = from
+		return true
+	})
+	for _, t := range changed {
+		recordEvent(t.ID, Event{Kind: EventState, From: froms[t.ID], To: t.State, Reason: "recovered after restart"})
 	}
-	return recovered, nil
+	return changed, err
 }
 
 // AutopilotProjects returns distinct projects with autopilot-eligible tasks.
 func AutopilotProjects() ([]string, error) {
-	storeMu.Lock()
-	defer storeMu.Unlock()
-
-	store, err := loadStore()
+	tasks, err := repo().List(Filter{
+		AutoPilot: true,
+		States:    []TaskState{StatePending, StatePlanned, StateAwaitingApproval},
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	seen := make(map[string]bool)
 	var projects []string
-	for _, t := range store.Tasks {
-		if !t.AutoPilot || seen[t.Project] {
-			continue
-		}
-		s := EffectiveState(t)
-		if s == StatePending || s == StatePlanned {
+	for _, t := range tasks {
+		if !seen[t.Project] {
 			seen[t.Project] = true
 			projects = append(projects, t.Project)
 		}
@@ -540,136 +458,177 @@ func AutopilotProjects() ([]string, error) {
 }
 
 func UpdateDescription(id int, description string) error {
-	storeMu.Lock()
-	defer storeMu.Unlock()
-
-	store, err := loadStore()
-	if err != nil {
-		return err
-	}
-	for i := range store.Tasks {
-		if store.Tasks[i].ID == id {
-			store.Tasks[i].Description = description
-			return saveStore(store)
-		}
-	}
-	return fmt.Errorf("task #%d not found", id)
+	_, err := repo().Update(id, func(t *Task) error {
+		t.Description = description
+		return nil
+	})
+	return err
 }
 
 func UpdateWave(id int, wave int) error {
-	storeMu.Lock()
-	defer storeMu.Unlock()
-
-	store, err := loadStore()
-	if err != nil {
-		return err
-	}
-	for i := range store.Tasks {
-		if store.Tasks[i].ID == id {
-			store.Tasks[i].Wave = wave
-			return saveStore(store)
-		}
-	}
-	return fmt.Errorf("task #%d not found", id)
+	_, err := repo().Update(id, func(t *Task) error {
+		t.Wave = wave
+		return nil
+	})
+	return err
 }
 
 func UpdateAssignee(id int, assignee string) error {
-	storeMu.Lock()
-	defer storeMu.Unlock()
+	_, err := repo().Update(id, func(t *Task) error {
+		t.Assignee = assignee
+		return nil
+	})
+	return err
+}
 
-	store, err := loadStore()
-	if err != nil {
-		return err
-	}
-	for i := range store.Tasks {
-		if store.Tasks[i].ID == id {
-			store.Tasks[i].Assignee = assignee
-			return saveStore(store)
-		}
-	}
-	return fmt.Errorf("task #%d not found", id)
+// TaskEdit lists task fields to change together; nil fields are left alone.
+type TaskEdit struct {
+	Description *string
+	Assignee    *string
+	Labels      *[]string
+	ParentID    *int // 0 detaches from the epic
+	DependsOn   *[]int
+	AutoPilot   *bool
 }
 
-func AttachToTask(id int, uploadID string) error {
-	storeMu.Lock()
-	defer storeMu.Unlock()
+// Edit applies e to task id in a single update. Every field is validated
+// first, parent and dependency changes against all tasks under the same
+// lock; if one is invalid nothing is written.
+func Edit(id int, e TaskEdit) (Task, error) {
+	var deps []int
+	if e.DependsOn != nil {
+		deps = uniqueSorted(*e.DependsOn)
+	}
+	t, err := repo().UpdateWithAll(id, func(t *Task, all []Task) error {
+		if e.Description != nil && strings.TrimSpace(*e.Description) == "" {
+			return fmt.Errorf("description cannot be empty")
+		}
+		if e.Labels != nil {
+			if err := ValidateLabels(*e.Labels); err != nil {
+				return err
+			}
+		}
+		if e.ParentID != nil {
+			if err := checkParent(id, *e.ParentID, all); err != nil {
+				return err
+			}
+		}
+		if e.DependsOn != nil {
+			if err := checkDependencies(id, deps, all); err != nil {
+				return err
+			}
+		}
 
-	store, err := loadStore()
+		if e.Description != nil {
+			t.Description = strings.TrimSpace(*e.Description)
+		}
+		if e.Assignee != nil {
+			t.Assignee = *e.Assignee
+		}
+		if e.Labels != nil {
+			t.Labels = NormalizeLabels(*e.Labels)
+		}
+		if e.ParentID != nil {
+			t.ParentID = *e.ParentID
+		}
+		if e.DependsOn != nil {
+			t.DependsOn = deps
+			if len(deps) == 0 {
+				t.HeldReason = ""
+			}
+		}
+		if e.AutoPilot != nil {
+			t.AutoPilot = *e.AutoPilot
+		}
+		return nil
+	})
 	if err != nil {
-		return err
+		return t, err
 	}
-	for i := range store.Tasks {
-		if store.Tasks[i].ID == id {
-			store.Tasks[i].Attachments = append(store.Tasks[i].Attachments, uploadID)
-			return saveStore(store)
-		}
+	log.Printf("[queue] task #%d edited", id)
+	if e.DependsOn != nil {
+		return unblockIfFree(id)
 	}
-	return fmt.Errorf("task #%d not found", id)
+	return t, nil
 }
 
-func SetSessionID(id int, sid string) error {
-	storeMu.Lock()
-	defer storeMu.Unlock()
+// SetLabels replaces a task's labels.
+func SetLabels(id int, labels []string) (Task, error) {
+	return repo().Update(id, func(t *Task) error {
+		t.Labels = NormalizeLabels(labels)
+		return nil
+	})
+}
 
-	store, err := loadStore()
-	if err != nil {
-		return err
-	}
-	for i := range store.Tasks {
-		if store.Tasks[i].ID == id {
-			store.Tasks[i].SessionID = sid
-			return saveStore(store)
+// ValidateLabels rejects labels that NormalizeLabels would drop as empty,
+// for callers that should refuse them rather than lose them silently.
+func ValidateLabels(labels []string) error {
+	for _, l := range labels {
+		if len(NormalizeLabels([]string{l})) == 0 {
+			return fmt.Errorf("label %q is empty", l)
 		}
 	}
-	return fmt.Errorf("task #%d not found", id)
+	return nil
 }
 
-func SetCurrentStep(id int, step int) error {
-	storeMu.Lock()
-	defer storeMu.Unlock()
-
-	store, err := loadStore()
-	if err != nil {
-		return err
-	}
-	for i := range store.Tasks {
-		if store.Tasks[i].ID == id {
-			store.Tasks[i].CurrentStep = step
-			return saveStore(store)
+// NormalizeLabels lowercases and trims labels, turns inner spaces and commas
+// into dashes, and drops empties and duplicates. The result is sorted.
+func NormalizeLabels(labels []string) []string {
+	seen := make(map[string]bool, len(labels))
+	var out []string
+	for _, l := range labels {
+		l = strings.ToLower(strings.TrimSpace(l))
+		l = strings.Join(strings.FieldsFunc(l, func(r rune) bool { return r == ' ' || r == ',' }), "-")
+		if l == "" || seen[l] {
+			continue
 		}
+		seen[l] = true
+		out = append(out, l)
 	}
-	return fmt.Errorf("task #%d not found", id)
+	sort.Strings(out)
+	return out
 }
 
-func SetTotalSteps(id int, total int) error {
-	storeMu.Lock()
-	defer storeMu.Unlock()
+func AttachToTask(id int, uploadID string) error {
+	_, err := repo().Update(id, func(t *Task) error {
+		t.Attachments = append(t.Attachments, uploadID)
+		return nil
+	})
+	return err
+}
 
-	store, err := loadStore()
-	if err != nil {
-		return err
-	}
-	for i := range store.Tasks {
-		if store.Tasks[i].ID == id {
-			store.Tasks[i].TotalSteps = total
-			return saveStore(store)
-		}
-	}
-	return fmt.Errorf("task #%d not found", id)
+func SetSessionID(id int, sid string) error {
+	_, err := repo().Update(id, func(t *Task) error {
+		t.SessionID = sid
+		return nil
+	})
+	return err
+}
+
+func SetCurrentStep(id int, step int) error {
+	_, err := repo().Update(id, func(t *Task) error {
+		t.CurrentStep = step
+		return nil
+	})
+	return err
+}
+
+func SetTotalSteps(id int, total int) error {
+	_, err := repo().Update(id, func(t *Task) error {
+		t.TotalSteps = total
+		return nil
+	})
+	return err
 }
 
 // ListResumable returns tasks in running state that have a SessionID (can be resumed after restart).
 func ListResumable() ([]Task, error) {
-	storeMu.Lock()
-	defer storeMu.Unlock()
-
-	store, err := loadStore()
+	tasks, err := repo().List(Filter{States: []TaskState{StateRunning}})
 	if err != nil {
 		return nil, err
 	}
-
 	var result []Task
-	for _, t := range store.Tasks {
+	for _, t := range tasks {
 		if t.State == StateRunning && t.SessionID != "" {
 			result = append(result, t)
 		}
@@ -678,16 +637,15 @@ func ListResumable() ([]Task, error) {
 }
 
 func notifyWebhook(event string, task Task) {
-	cfg, _ := config.Load()
-	if cfg.WebhookURL == "" {
-		return
+	NotifyEvent(event, task, nil)
+}
+
+// NotifyEvent queues event for the webhook endpoints subscribed to it.
+// fields are merged into the payload next to "event", "task" and "time".
+func NotifyEvent(event string, task Task, fields map[string]any) {
+	payload := map[string]any{"task": task}
+	for k, v := range fields {
+		payload[k] = v
 	}
-	go func() {
-		payload, _ := json.Marshal(map[string]any{
-			"event": event,
-			"task":  task,
-			"time":  time.Now(),
-		})
-		http.Post(cfg.WebhookURL, "application/json", bytes.NewReader(payload))
-	}()
+	webhook.Publish(event, payload)
 }
@@ -294,6 +294,44 @@ func TestSetFailReason(t *testing.T) {
 	}
 }
 
+func TestInReview_MergedAndClosed(t *testing.T) {
+	setupTestEnv(t)
+
+	merged, _ := Add("proj", "merged", "med")
+	closed, _ := Add("proj", "closed", "med")
+	for i, task := range []Task{merged, closed} {
+		UpdateState(task.ID, StateRunning)
+		if err := SetInReview(task.ID, 10+i, "https://github.com/o/r/pull/10"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	inReview, _ := ListInReview()
+	if len(inReview) != 2 || inReview[0].PRNumber != 10 {
+		t.Fatalf("in review = %+v", inReview)
+	}
+	if pending, _ := ListAutopilotPending("proj"); len(pending) != 0 {
+		t.Errorf("tasks in review must not be picked up by autopilot: %+v", pending)
+	}
+
+	if err := FinishReview(merged.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := FinishReview(closed.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := GetTask(merged.ID)
+	if got.State != StateDone || !got.Done {
+		t.Errorf("merged task state = %s, done = %v", got.State, got.Done)
+	}
+	got, _ = GetTask(closed.ID)
+	if got.State != StateFailed || got.FailReason != "PR #11 closed without merging" {
+		t.Errorf("closed task = %+v", got)
+	}
+	if err := FinishReview(closed.ID, true); err == nil {
+		t.Error("finishing a task that is not in review should fail")
+	}
+}
+
 func TestUpdateAssignee(t *testing.T) {
 	setupTestEnv(t)
 
@@ -575,3 +613,40 @@ func TestConfigDirUsesHome(t *testing.T) {
 		t.Errorf("ConfigDir() = %s, want %s", got, want)
 	}
 }
+
+func TestEdit_AllOrNothing(t *testing.T) {
+	setupTestEnv(t)
+	a, _ := Add("proj", "a", "med")
+	b, _ := Add("proj", "b", "med")
+	desc, labels, on := "renamed", []string{"Security"}, true
+
+	if _, err := Edit(a.ID, TaskEdit{Description: &desc, Labels: &labels, DependsOn: &[]int{a.ID}}); err == nil {
+		t.Fatal("expected self-dependency to reject the edit")
+	}
+	got, _ := GetTask(a.ID)
+	if got.Description != "a" || len(got.Labels) != 0 {
+		t.Errorf("rejected edit was partly written: %+v", got)
+	}
+
+	if _, err := Edit(a.ID, TaskEdit{Description: &desc, Labels: &[]string{"ok", "  "}}); err == nil {
+		t.Error("expected a blank label to reject the edit")
+	}
+
+	got, err := Edit(a.ID, TaskEdit{Description: &desc, Labels: &labels, DependsOn: &[]int{b.ID}, AutoPilot: &on})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Description != desc || got.Labels[0] != "security" || !equalInts(got.DependsOn, []int{b.ID}) || !got.AutoPilot {
+		t.Errorf("edit = %+v", got)
+	}
+}
+
+func TestSetAutoPilot_IsIdempotent(t *testing.T) {
+	setupTestEnv(t)
+	a, _ := Add("proj", "a", "med")
+	SetAutoPilot(a.ID, true)
+	SetAutoPilot(a.ID, true)
+	if got, _ := GetTask(a.ID); !got.AutoPilot {
+		t.Error("setting autopilot on twice turned it off")
+	}
+}
@@ -5,10 +5,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"sync"
 	"time"
 
 	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/persist"
 )
 
 type Template struct {
@@ -23,7 +23,7 @@ type templateStore struct {
 	Templates []Template `json:"templates"`
 }
 
-var storeMu sync.Mutex
+var storeMu = persist.NewMutex(templatesPath)
 
 func templatesPath() string {
 	return filepath.Join(config.ConfigDir(), "templates.json")
@@ -51,7 +51,7 @@ func saveStore(store templateStore) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(templatesPath(), data, 0644)
+	return persist.WriteFile(templatesPath(), data, 0644)
 }
 
 func List() ([]Template, error) {
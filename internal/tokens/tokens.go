@@ -0,0 +1,252 @@
+// Package tokens manages the personal API tokens accepted by the web server
+// as "Authorization: Bearer <token>". Only a SHA-256 hash of each token is
+// stored; the token itself is shown once, when it is created.
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/persist"
+)
+
+// Scopes, from least to most privileged. Each includes the ones before it.
+const (
+	ScopeRead       = "read"        // GET endpoints, except settings
+	ScopeTasksWrite = "tasks-write" // also create, edit and archive tasks
+	ScopeAdmin      = "admin"       // everything a logged-in browser can do
+)
+
+// Scopes lists the valid scopes, least privileged first.
+var Scopes = []string{ScopeRead, ScopeTasksWrite, ScopeAdmin}
+
+// secretPrefix starts every token so it is easy to spot in scripts and
+// secret scanners.
+const secretPrefix = "tmn_"
+
+// lastUsedEvery throttles last-used writes to one per token per minute.
+const lastUsedEvery = time.Minute
+
+// Token is an API token as shown to users; its hash stays on disk.
+type Token struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Scope      string     `json:"scope"`
+	Prefix     string     `json:"prefix"` // start of the secret, to tell tokens apart
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Expired reports whether t has an expiry that has passed at now.
+func (t Token) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+// Allows reports whether a token of this scope may do what need requires.
+func (t Token) Allows(need string) bool {
+	return rank(t.Scope) >= rank(need)
+}
+
+func rank(scope string) int {
+	for i, s := range Scopes {
+		if s == scope {
+			return i
+		}
+	}
+	return -1
+}
+
+// ValidScope reports whether s is a known scope.
+func ValidScope(s string) bool {
+	return rank(s) >= 0
+}
+
+type storedToken struct {
+	Token
+	Hash string `json:"hash"`
+}
+
+type tokenStore struct {
+	NextID int           `json:"next_id"`
+	Tokens []storedToken `json:"tokens"`
+}
+
+var storeMu = persist.NewMutex(tokensPath)
+
+func tokensPath() string {
+	return filepath.Join(config.ConfigDir(), "tokens.json")
+}
+
+func loadStore() (tokenStore, error) {
+	store := tokenStore{NextID: 1}
+	data, err := os.ReadFile(tokensPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return store, nil
+		}
+		return store, err
+	}
+	if err := json.Unmarshal(data, &store); err != nil {
+		return store, fmt.Errorf("parsing %s: %w", tokensPath(), err)
+	}
+	return store, nil
+}
+
+func saveStore(store tokenStore) error {
+	data, err := json.MarshalIndent(store, "", "  ")
+	if err != nil {
+		return err
+	}
+	return persist.WriteFile(tokensPath(), data, 0600)
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create stores a new token and returns it with its secret, which cannot
+// be recovered later. ttl 0 means the token does not expire.
+func Create(name, scope string, ttl time.Duration) (Token, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Token{}, "", fmt.Errorf("token name required")
+	}
+	if !ValidScope(scope) {
+		return Token{}, "", fmt.Errorf("unknown scope %q (want %s)", scope, strings.Join(Scopes, ", "))
+	}
+	if ttl < 0 {
+		return Token{}, "", fmt.Errorf("expiry must be in the future")
+	}
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return Token{}, "", err
+	}
+	secret := secretPrefix + hex.EncodeToString(b)
+
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	store, err := loadStore()
+	if err != nil {
+		return Token{}, "", err
+	}
+	for _, t := range store.Tokens {
+		if t.Name == name {
+			return Token{}, "", fmt.Errorf("a token named %q already exists", name)
+		}
+	}
+	t := Token{
+		ID:        store.NextID,
+		Name:      name,
+		Scope:     scope,
+		Prefix:    secret[:len(secretPrefix)+8],
+		CreatedAt: time.Now(),
+	}
+	if ttl > 0 {
+		exp := t.CreatedAt.Add(ttl)
+		t.ExpiresAt = &exp
+	}
+	store.NextID++
+	store.Tokens = append(store.Tokens, storedToken{Token: t, Hash: hash(secret)})
+	if err := saveStore(store); err != nil {
+		return Token{}, "", err
+	}
+	return t, secret, nil
+}
+
+// List returns the stored tokens, oldest first.
+func List() ([]Token, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	store, err := loadStore()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Token, len(store.Tokens))
+	for i, t := range store.Tokens {
+		out[i] = t.Token
+	}
+	return out, nil
+}
+
+// Revoke deletes the token whose name or ID is ref.
+func Revoke(ref string) (Token, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	store, err := loadStore()
+	if err != nil {
+		return Token{}, err
+	}
+	id, _ := strconv.Atoi(ref)
+	for i, t := range store.Tokens {
+		if t.Name == ref || (id != 0 && t.ID == id) {
+			store.Tokens = append(store.Tokens[:i], store.Tokens[i+1:]...)
+			return t.Token, saveStore(store)
+		}
+	}
+	return Token{}, fmt.Errorf("no token %q", ref)
+}
+
+// Authenticate returns the token whose secret is secret, recording when it
+// was last used. Unknown and expired tokens are rejected.
+func Authenticate(secret string) (Token, error) {
+	if !strings.HasPrefix(secret, secretPrefix) {
+		return Token{}, fmt.Errorf("invalid token")
+	}
+	h := []byte(hash(secret))
+
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	store, err := loadStore()
+	if err != nil {
+		return Token{}, err
+	}
+	now := time.Now()
+	for i, t := range store.Tokens {
+		if subtle.ConstantTimeCompare(h, []byte(t.Hash)) != 1 {
+			continue
+		}
+		if t.Expired(now) {
+			return Token{}, fmt.Errorf("token %q expired", t.Name)
+		}
+		if t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) >= lastUsedEvery {
+			store.Tokens[i].LastUsedAt = &now
+			saveStore(store)
+			t.LastUsedAt = &now
+		}
+		return t.Token, nil
+	}
+	return Token{}, fmt.Errorf("invalid token")
+}
+
+// ParseTTL parses a token lifetime: a number of days such as "30d", or a
+// Go duration such as "12h". An empty string means no expiry.
+func ParseTTL(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" || s == "never" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid expiry %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid expiry %q (use e.g. 30d or 12h)", s)
+	}
+	return d, nil
+}
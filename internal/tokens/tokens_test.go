@@ -0,0 +1,103 @@
+package tokens
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateAndAuthenticate(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	tok, secret, err := Create("ci", ScopeTasksWrite, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(secret, "tmn_") || !strings.HasPrefix(secret, tok.Prefix) || tok.ExpiresAt != nil {
+		t.Fatalf("created %+v with secret %q", tok, secret)
+	}
+	data, _ := os.ReadFile(tokensPath())
+	if strings.Contains(string(data), secret) {
+		t.Fatal("the secret is stored in clear")
+	}
+
+	got, err := Authenticate(secret)
+	if err != nil || got.Name != "ci" || got.LastUsedAt == nil {
+		t.Fatalf("authenticate = %+v, %v", got, err)
+	}
+	list, _ := List()
+	if len(list) != 1 || list[0].LastUsedAt == nil {
+		t.Errorf("list = %+v", list)
+	}
+
+	if _, err := Authenticate(secret + "x"); err == nil {
+		t.Error("a wrong secret was accepted")
+	}
+	if _, _, err := Create("ci", ScopeRead, 0); err == nil {
+		t.Error("duplicate name accepted")
+	}
+	if _, _, err := Create("bot", "root", 0); err == nil {
+		t.Error("unknown scope accepted")
+	}
+}
+
+func TestExpiryAndRevoke(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	_, short, _ := Create("short", ScopeRead, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if _, err := Authenticate(short); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("expired token: %v", err)
+	}
+
+	tok, secret, _ := Create("bot", ScopeAdmin, 24*time.Hour)
+	if _, err := Revoke("nope"); err == nil {
+		t.Error("revoking an unknown token should fail")
+	}
+	if _, err := Revoke(strconv.Itoa(tok.ID)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Authenticate(secret); err == nil {
+		t.Error("revoked token still accepted")
+	}
+	if _, err := Revoke("short"); err != nil {
+		t.Errorf("revoke by name: %v", err)
+	}
+	if list, _ := List(); len(list) != 0 {
+		t.Errorf("list = %+v", list)
+	}
+}
+
+func TestAllows(t *testing.T) {
+	cases := []struct {
+		scope, need string
+		want        bool
+	}{
+		{ScopeRead, ScopeRead, true},
+		{ScopeRead, ScopeTasksWrite, false},
+		{ScopeTasksWrite, ScopeRead, true},
+		{ScopeTasksWrite, ScopeAdmin, false},
+		{ScopeAdmin, ScopeTasksWrite, true},
+		{"bogus", ScopeRead, false},
+	}
+	for _, c := range cases {
+		if got := (Token{Scope: c.scope}).Allows(c.need); got != c.want {
+			t.Errorf("%s allows %s = %v", c.scope, c.need, got)
+		}
+	}
+}
+
+func TestParseTTL(t *testing.T) {
+	for in, want := range map[string]time.Duration{"": 0, "never": 0, "30d": 30 * 24 * time.Hour, "12h": 12 * time.Hour} {
+		if got, err := ParseTTL(in); err != nil || got != want {
+			t.Errorf("ParseTTL(%q) = %v, %v", in, got, err)
+		}
+	}
+	for _, in := range []string{"-1d", "xd", "soon", "-5m"} {
+		if _, err := ParseTTL(in); err == nil {
+			t.Errorf("ParseTTL(%q) should fail", in)
+		}
+	}
+}
@@ -9,10 +9,10 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/persist"
 )
 
 const MaxUploadSize = 10 << 20 // 10 MB
@@ -30,7 +30,7 @@ type store struct {
 	Attachments []Attachment `json:"attachments"`
 }
 
-var mu sync.Mutex
+var mu = persist.NewMutex(storePath)
 
 func uploadsDir() string {
 	return filepath.Join(config.ConfigDir(), "uploads")
@@ -62,7 +62,7 @@ func saveStore(s store) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(storePath(), data, 0644)
+	return persist.WriteFile(storePath(), data, 0644)
 }
 
 func genID() string {
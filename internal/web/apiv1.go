@@ -0,0 +1,674 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/JuanVilla424/teamoon/internal/engine"
+	"github.com/JuanVilla424/teamoon/internal/jobs"
+	"github.com/JuanVilla424/teamoon/internal/queue"
+	"github.com/JuanVilla424/teamoon/internal/tokens"
+)
+
+// apiPrefix is where the versioned, resource-oriented API is served. The
+// older /api/* routes stay for the web UI and existing scripts.
+const apiPrefix = "/api/v1"
+
+// Page sizes for list endpoints.
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// apiError is the body of every /api/v1 error response.
+type apiError struct {
+	Error apiErrorDetail `json:"error"`
+}
+
+type apiErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// errorCodes are the machine-readable codes sent for each status.
+var errorCodes = map[int]string{
+	http.StatusBadRequest:          "bad_request",
+	http.StatusUnauthorized:        "unauthorized",
+	http.StatusForbidden:           "forbidden",
+	http.StatusNotFound:            "not_found",
+	http.StatusMethodNotAllowed:    "method_not_allowed",
+	http.StatusConflict:            "conflict",
+	http.StatusInternalServerError: "internal",
+}
+
+func writeAPIErr(w http.ResponseWriter, status int, msg string) {
+	code, ok := errorCodes[status]
+	if !ok {
+		code = strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+	}
+	writeAPI(w, status, apiError{Error: apiErrorDetail{Code: code, Message: msg}})
+}
+
+func writeAPI(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// page is one slice of a list endpoint's results.
+type page[T any] struct {
+	Items  []T `json:"items"`
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+// paginate cuts items down to the ?limit= and ?offset= of r.
+func paginate[T any](r *http.Request, items []T) (page[T], error) {
+	p := page[T]{Limit: defaultPageSize, Total: len(items)}
+	q := r.URL.Query()
+	if raw := q.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			return p, fmt.Errorf("limit must be a positive integer")
+		}
+		p.Limit = min(n, maxPageSize)
+	}
+	if raw := q.Get("offset"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return p, fmt.Errorf("offset must be a non-negative integer")
+		}
+		p.Offset = n
+	}
+	start := min(p.Offset, len(items))
+	end := min(start+p.Limit, len(items))
+	p.Items = append([]T{}, items[start:end]...)
+	return p, nil
+}
+
+// writePage paginates items and writes the page, or a 400 for bad paging
+// parameters.
+func writePage[T any](w http.ResponseWriter, r *http.Request, items []T) {
+	p, err := paginate(r, items)
+	if err != nil {
+		writeAPIErr(w, 400, err.Error())
+		return
+	}
+	writeAPI(w, 200, p)
+}
+
+// apiRoute is one operation of the v1 API. The route table drives both the
+// mux and the OpenAPI document.
+type apiRoute struct {
+	method  string
+	path    string // under apiPrefix, with {name} parameters
+	op      string // OpenAPI operationId
+	tag     string
+	summary string
+	query   []apiParam
+	body    any  // zero value of the request body, nil when there is none
+	resp    any  // zero value of the response, nil when there is no body
+	status  int  // success status; 200 when zero
+	public  bool // served without authentication
+	handler http.HandlerFunc
+}
+
+// apiParam is a query parameter; typ is an OpenAPI type.
+type apiParam struct {
+	name string
+	typ  string
+	desc string
+}
+
+var pageParams = []apiParam{
+	{"limit", "integer", fmt.Sprintf("Page size, %d by default and at most %d.", defaultPageSize, maxPageSize)},
+	{"offset", "integer", "Number of items to skip."},
+}
+
+func (s *Server) apiRoutes() []apiRoute {
+	taskFilters := append([]apiParam{
+		{"project", "string", "Only tasks of this project."},
+		{"state", "string", "Comma-separated effective states. Archived tasks are only listed when asked for."},
+		{"label", "string", "Comma-separated labels; any of them matches."},
+		{"priority", "string", "Only tasks of this priority."},
+		{"assignee", "string", "Only tasks with this assignee."},
+		{"parent", "integer", "Only subtasks of this epic."},
+		{"q", "string", "Task query, in the language of the queue search."},
+	}, pageParams...)
+
+	return []apiRoute{
+		{method: "GET", path: "/openapi.json", op: "getOpenAPI", tag: "meta", summary: "This document", public: true, handler: s.apiOpenAPI},
+
+		{method: "GET", path: "/tasks", op: "listTasks", tag: "tasks", summary: "List tasks", query: taskFilters, resp: page[WebTask]{}, handler: s.apiTaskList},
+		{method: "POST", path: "/tasks", op: "createTask", tag: "tasks", summary: "Create a task", body: taskInput{}, resp: WebTask{}, status: 201, handler: s.apiTaskCreate},
+		{method: "GET", path: "/tasks/{id}", op: "getTask", tag: "tasks", summary: "Get a task", resp: WebTask{}, handler: s.apiTaskGet},
+		{method: "PATCH", path: "/tasks/{id}", op: "updateTask", tag: "tasks", summary: "Update a task", body: taskPatch{}, resp: WebTask{}, handler: s.apiTaskPatch},
+		{method: "DELETE", path: "/tasks/{id}", op: "archiveTask", tag: "tasks", summary: "Archive a task and its subtasks", status: 204, handler: s.apiTaskDelete},
+		{method: "POST", path: "/tasks/{id}/stop", op: "stopTask", tag: "tasks", summary: "Stop a task and its subtasks", resp: WebTask{}, handler: s.apiTaskStop},
+		{method: "GET", path: "/tasks/{id}/events", op: "listTaskEvents", tag: "tasks", summary: "List a task's activity timeline",
+			query: append([]apiParam{{"kind", "string", "Comma-separated event kinds."}}, pageParams...), resp: page[queue.Event]{}, handler: s.apiTaskEvents},
+
+		{method: "GET", path: "/projects", op: "listProjects", tag: "projects", summary: "List projects", query: pageParams, resp: page[WebProject]{}, handler: s.apiProjectList},
+		{method: "GET", path: "/projects/{name}", op: "getProject", tag: "projects", summary: "Get a project", resp: WebProject{}, handler: s.apiProjectGet},
+		{method: "GET", path: "/projects/{name}/autopilot", op: "getAutopilot", tag: "projects", summary: "Get a project's autopilot state", resp: autopilotStatus{}, handler: s.apiAutopilotGet},
+		{method: "PUT", path: "/projects/{name}/autopilot", op: "startAutopilot", tag: "projects", summary: "Start autopilot for a project", resp: autopilotStatus{}, handler: s.apiAutopilotStart},
+		{method: "DELETE", path: "/projects/{name}/autopilot", op: "stopAutopilot", tag: "projects", summary: "Stop autopilot for a project", status: 204, handler: s.apiAutopilotStop},
+
+		{method: "GET", path: "/jobs", op: "listJobs", tag: "jobs", summary: "List jobs", query: pageParams, resp: page[jobs.Job]{}, handler: s.apiJobList},
+		{method: "POST", path: "/jobs", op: "createJob", tag: "jobs", summary: "Create a job", body: jobInput{}, resp: jobs.Job{}, status: 201, handler: s.apiJobCreate},
+		{method: "GET", path: "/jobs/{id}", op: "getJob", tag: "jobs", summary: "Get a job", resp: jobs.Job{}, handler: s.apiJobGet},
+		{method: "PATCH", path: "/jobs/{id}", op: "updateJob", tag: "jobs", summary: "Update a job", body: jobPatch{}, resp: jobs.Job{}, handler: s.apiJobPatch},
+		{method: "DELETE", path: "/jobs/{id}", op: "deleteJob", tag: "jobs", summary: "Delete a job", status: 204, handler: s.apiJobDelete},
+		{method: "GET", path: "/jobs/{id}/runs", op: "listJobRuns", tag: "jobs", summary: "List a job's past runs, newest first", query: pageParams, resp: page[jobs.Run]{}, handler: s.apiJobRuns},
+		{method: "POST", path: "/jobs/{id}/runs", op: "runJob", tag: "jobs", summary: "Run a job now", resp: jobs.Job{}, status: 202, handler: s.apiJobRun},
+
+		{method: "GET", path: "/tokens", op: "listTokens", tag: "tokens", summary: "List API tokens", query: pageParams, resp: page[tokens.Token]{}, handler: s.apiTokenList},
+		{method: "POST", path: "/tokens", op: "createToken", tag: "tokens", summary: "Create an API token; the secret is only returned here", body: tokenInput{}, resp: createdToken{}, status: 201, handler: s.apiTokenCreate},
+		{method: "DELETE", path: "/tokens/{id}", op: "revokeToken", tag: "tokens", summary: "Revoke an API token", status: 204, handler: s.apiTokenRevoke},
+	}
+}
+
+// registerAPIv1 mounts the v1 routes. Unsupported methods on a known path
+// get a 405 with an Allow header, and unknown paths a 404, both in the
+// v1 error format.
+func (s *Server) registerAPIv1(mux *http.ServeMux) {
+	allow := make(map[string][]string)
+	var paths []string
+	for _, rt := range s.apiRoutes() {
+		h := rt.handler
+		if !rt.public {
+			h = s.apiAuth(h)
+		}
+		mux.HandleFunc(rt.method+" "+apiPrefix+rt.path, s.logRequest(h))
+		if _, seen := allow[rt.path]; !seen {
+			paths = append(paths, rt.path)
+		}
+		allow[rt.path] = append(allow[rt.path], rt.method)
+	}
+	for _, p := range paths {
+		methods := strings.Join(allow[p], ", ")
+		mux.HandleFunc(apiPrefix+p, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Allow", methods)
+			writeAPIErr(w, 405, r.Method+" not allowed, use "+methods)
+		})
+	}
+	mux.HandleFunc(apiPrefix+"/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIErr(w, 404, "no such endpoint: "+r.URL.Path)
+	})
+}
+
+func (s *Server) apiAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r, status, msg := s.checkAuth(r)
+		if status != 0 {
+			writeAPIErr(w, status, msg)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// decodeBody reads a JSON body into v, rejecting unknown fields.
+func decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeAPIErr(w, 400, "invalid body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// pathID parses the {id} segment of r.
+func pathID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		writeAPIErr(w, 400, "id must be a positive integer")
+		return 0, false
+	}
+	return id, true
+}
+
+// pathTask loads the task named by the {id} segment of r.
+func pathTask(w http.ResponseWriter, r *http.Request) (queue.Task, bool) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return queue.Task{}, false
+	}
+	t, err := queue.GetTask(id)
+	if err != nil {
+		writeAPIErr(w, 404, fmt.Sprintf("task #%d not found", id))
+		return t, false
+	}
+	return t, true
+}
+
+// --- Tasks ---
+
+// taskQuery turns the filter parameters of r into a task query.
+func taskQuery(r *http.Request) (queue.Query, error) {
+	params := r.URL.Query()
+	var clauses []string
+	for _, key := range []string{"project", "label", "state", "priority", "assignee", "parent"} {
+		if v := strings.TrimSpace(params.Get(key)); v != "" {
+			if strings.ContainsAny(v, " \t") {
+				v = `"` + v + `"`
+			}
+			clauses = append(clauses, key+":"+v)
+		}
+	}
+	if v := params.Get("q"); v != "" {
+		clauses = append(clauses, v)
+	}
+	return queue.ParseQuery(strings.Join(clauses, " "))
+}
+
+func (s *Server) apiTaskList(w http.ResponseWriter, r *http.Request) {
+	q, err := taskQuery(r)
+	if err != nil {
+		writeAPIErr(w, 400, err.Error())
+		return
+	}
+	tasks, err := queue.Search(q)
+	if err != nil {
+		writeAPIErr(w, 500, err.Error())
+		return
+	}
+	writePage(w, r, s.webTasks(tasks))
+}
+
+func (s *Server) apiTaskCreate(w http.ResponseWriter, r *http.Request) {
+	var req taskInput
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	req.Project = strings.TrimSpace(req.Project)
+	req.Description = strings.TrimSpace(req.Description)
+	if req.Project == "" || req.Description == "" {
+		writeAPIErr(w, 400, "project and description required")
+		return
+	}
+	if msg, denied := adminDenied(r, "assignee "+req.Assignee); denied && runsAgent(req.Assignee) {
+		writeAPIErr(w, 403, msg)
+		return
+	}
+	if err := checkTaskInput(req); err != nil {
+		writeAPIErr(w, 400, err.Error())
+		return
+	}
+	t, err := s.addTask(req, actorOf(r))
+	if err != nil {
+		writeAPIErr(w, 500, err.Error())
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s/tasks/%d", apiPrefix, t.ID))
+	writeAPI(w, 201, s.webTasks([]queue.Task{t})[0])
+}
+
+func (s *Server) apiTaskGet(w http.ResponseWriter, r *http.Request) {
+	t, ok := pathTask(w, r)
+	if !ok {
+		return
+	}
+	writeAPI(w, 200, s.webTasks([]queue.Task{t})[0])
+}
+
+// taskPatch is the body of a task update. Only the fields present change.
+type taskPatch struct {
+	Description *string   `json:"description,omitempty"`
+	Assignee    *string   `json:"assignee,omitempty"`
+	Labels      *[]string `json:"labels,omitempty"`
+	ParentID    *int      `json:"parent_id,omitempty"` // 0 detaches from the epic
+	DependsOn   *[]int    `json:"depends_on,omitempty"`
+	AutoPilot   *bool     `json:"auto_pilot,omitempty"`
+	// State moves the task to "done", or back to "pending" the way a retry
+	// does.
+	State *queue.TaskState `json:"state,omitempty"`
+}
+
+func (s *Server) apiTaskPatch(w http.ResponseWriter, r *http.Request) {
+	t, ok := pathTask(w, r)
+	if !ok {
+		return
+	}
+	var req taskPatch
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	es := queue.EffectiveState(t)
+	if req.Description != nil {
+		*req.Description = strings.TrimSpace(*req.Description)
+		if *req.Description == "" {
+			writeAPIErr(w, 400, "description cannot be empty")
+			return
+		}
+		if es == queue.StateRunning || es == queue.StateDone || es == queue.StateArchived {
+			writeAPIErr(w, 409, "cannot edit task in "+string(es)+" state")
+			return
+		}
+	}
+	if msg, denied := adminDenied(r, "auto_pilot"); denied && req.AutoPilot != nil {
+		writeAPIErr(w, 403, msg)
+		return
+	}
+	if req.State != nil && *req.State != queue.StateDone && *req.State != queue.StatePending {
+		writeAPIErr(w, 400, "state can only be set to done or pending")
+		return
+	}
+	if req.State != nil && *req.State == queue.StatePending && es != queue.StatePending && es != queue.StateFailed && es != queue.StateBlocked {
+		writeAPIErr(w, 409, fmt.Sprintf("task #%d is %s, only failed or blocked tasks can be retried", t.ID, es))
+		return
+	}
+	if req.State != nil && *req.State == queue.StateDone && !queue.CanTransition(es, queue.StateDone) {
+		writeAPIErr(w, 409, fmt.Sprintf("task #%d cannot move from %s to done", t.ID, es))
+		return
+	}
+
+	// The fields are written in one update, or none is. The state change
+	// follows as its own update, which is why it was checked above.
+	edited, err := queue.Edit(t.ID, queue.TaskEdit{
+		Description: req.Description,
+		Assignee:    req.Assignee,
+		Labels:      req.Labels,
+		ParentID:    req.ParentID,
+		DependsOn:   req.DependsOn,
+		AutoPilot:   req.AutoPilot,
+	})
+	if err != nil {
+		writeAPIErr(w, 400, err.Error())
+		return
+	}
+	if req.Description != nil {
+		queue.RecordAction(t.ID, actorOf(r), "description edited")
+	}
+	if req.Assignee != nil {
+		queue.RecordAction(t.ID, actorOf(r), "assignee "+*req.Assignee)
+	}
+	if req.Labels != nil {
+		queue.RecordAction(t.ID, actorOf(r), "labels "+strings.Join(edited.Labels, ","))
+	}
+	if req.ParentID != nil {
+		action := "detached from epic"
+		if *req.ParentID != 0 {
+			action = fmt.Sprintf("moved under #%d", *req.ParentID)
+		}
+		queue.RecordAction(t.ID, actorOf(r), action)
+	}
+	if req.DependsOn != nil {
+		queue.RecordAction(t.ID, actorOf(r), fmt.Sprintf("dependencies %v", edited.DependsOn))
+	}
+	if req.AutoPilot != nil && *req.AutoPilot != t.AutoPilot {
+		action := "autopilot off"
+		if *req.AutoPilot {
+			action = "autopilot on"
+		}
+		queue.RecordAction(t.ID, actorOf(r), action)
+	}
+	if req.State != nil && *req.State != es {
+		switch *req.State {
+		case queue.StateDone:
+			s.stopTree(t.ID)
+			if err := queue.MarkDone(t.ID); err != nil {
+				writeAPIErr(w, 500, err.Error())
+				return
+			}
+			queue.RecordAction(t.ID, actorOf(r), "marked done")
+		case queue.StatePending:
+			if _, err := queue.Retry(t.ID); err != nil {
+				writeAPIErr(w, 409, err.Error())
+				return
+			}
+			queue.RecordAction(t.ID, actorOf(r), "retry")
+		}
+	}
+
+	s.refreshAndBroadcast()
+	t, _ = queue.GetTask(t.ID)
+	writeAPI(w, 200, s.webTasks([]queue.Task{t})[0])
+}
+
+func (s *Server) apiTaskDelete(w http.ResponseWriter, r *http.Request) {
+	t, ok := pathTask(w, r)
+	if !ok {
+		return
+	}
+	s.stopTree(t.ID)
+	if err := queue.Archive(t.ID); err != nil {
+		writeAPIErr(w, 409, err.Error())
+		return
+	}
+	engine.DiscardWorkspaces(s.cfg, t.ID)
+	queue.RecordAction(t.ID, actorOf(r), "archived")
+	s.refreshAndBroadcast()
+	w.WriteHeader(204)
+}
+
+func (s *Server) apiTaskStop(w http.ResponseWriter, r *http.Request) {
+	t, ok := pathTask(w, r)
+	if !ok {
+		return
+	}
+	s.stopTree(t.ID)
+	queue.RecordAction(t.ID, actorOf(r), "stop")
+	s.refreshAndBroadcast()
+	t, _ = queue.GetTask(t.ID)
+	writeAPI(w, 200, s.webTasks([]queue.Task{t})[0])
+}
+
+func (s *Server) apiTaskEvents(w http.ResponseWriter, r *http.Request) {
+	t, ok := pathTask(w, r)
+	if !ok {
+		return
+	}
+	events, err := queue.LoadEvents(t.ID)
+	if err != nil {
+		writeAPIErr(w, 500, err.Error())
+		return
+	}
+	if raw := r.URL.Query().Get("kind"); raw != "" {
+		kinds := make(map[string]bool)
+		for _, k := range strings.Split(raw, ",") {
+			kinds[strings.TrimSpace(k)] = true
+		}
+		var kept []queue.Event
+		for _, e := range events {
+			if kinds[e.Kind] {
+				kept = append(kept, e)
+			}
+		}
+		events = kept
+	}
+	writePage(w, r, events)
+}
+
+// --- Projects ---
+
+// autopilotStatus is the autopilot resource of a project.
+type autopilotStatus struct {
+	Project string `json:"project"`
+	Running bool   `json:"running"`
+}
+
+func (s *Server) apiProjectList(w http.ResponseWriter, r *http.Request) {
+	writePage(w, r, s.store.Get().Projects)
+}
+
+func (s *Server) apiProjectGet(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	for _, p := range s.store.Get().Projects {
+		if p.Name == name {
+			writeAPI(w, 200, p)
+			return
+		}
+	}
+	writeAPIErr(w, 404, "project "+name+" not found")
+}
+
+func (s *Server) apiAutopilotGet(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	writeAPI(w, 200, autopilotStatus{Project: name, Running: s.store.engineMgr.IsProjectRunning(name)})
+}
+
+// apiAutopilotStart is idempotent: starting a running loop is not an error.
+func (s *Server) apiAutopilotStart(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !s.store.engineMgr.IsProjectRunning(name) && !s.startProjectAutopilot(name, actorOf(r)) {
+		writeAPIErr(w, 409, "max_concurrent reached")
+		return
+	}
+	writeAPI(w, 200, autopilotStatus{Project: name, Running: true})
+}
+
+func (s *Server) apiAutopilotStop(w http.ResponseWriter, r *http.Request) {
+	s.store.engineMgr.StopProject(r.PathValue("name"))
+	s.refreshAndBroadcast()
+	w.WriteHeader(204)
+}
+
+// --- Jobs ---
+
+// jobInput is the body of a job creation request.
+type jobInput struct {
+	Name        string `json:"name"`
+	Schedule    string `json:"schedule"`
+	Project     string `json:"project"`
+	Instruction string `json:"instruction"`
+}
+
+// jobPatch is the body of a job update. Only the fields present change.
+type jobPatch struct {
+	Name        *string `json:"name,omitempty"`
+	Schedule    *string `json:"schedule,omitempty"`
+	Project     *string `json:"project,omitempty"`
+	Instruction *string `json:"instruction,omitempty"`
+	Enabled     *bool   `json:"enabled,omitempty"`
+}
+
+func pathJob(w http.ResponseWriter, r *http.Request) (jobs.Job, bool) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return jobs.Job{}, false
+	}
+	job, found := jobs.GetByID(id)
+	if !found {
+		writeAPIErr(w, 404, fmt.Sprintf("job #%d not found", id))
+	}
+	return job, found
+}
+
+func (s *Server) apiJobList(w http.ResponseWriter, r *http.Request) {
+	list, err := jobs.ListAll()
+	if err != nil {
+		writeAPIErr(w, 500, err.Error())
+		return
+	}
+	writePage(w, r, list)
+}
+
+func (s *Server) apiJobCreate(w http.ResponseWriter, r *http.Request) {
+	var req jobInput
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if req.Name == "" || req.Schedule == "" || req.Instruction == "" {
+		writeAPIErr(w, 400, "name, schedule, and instruction required")
+		return
+	}
+	job, err := jobs.Add(req.Name, req.Schedule, req.Project, req.Instruction)
+	if err != nil {
+		writeAPIErr(w, 500, err.Error())
+		return
+	}
+	s.refreshAndBroadcast()
+	w.Header().Set("Location", fmt.Sprintf("%s/jobs/%d", apiPrefix, job.ID))
+	writeAPI(w, 201, job)
+}
+
+func (s *Server) apiJobGet(w http.ResponseWriter, r *http.Request) {
+	if job, ok := pathJob(w, r); ok {
+		writeAPI(w, 200, job)
+	}
+}
+
+func (s *Server) apiJobPatch(w http.ResponseWriter, r *http.Request) {
+	job, ok := pathJob(w, r)
+	if !ok {
+		return
+	}
+	var req jobPatch
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	for _, f := range []struct {
+		dst *string
+		src *string
+	}{{&job.Name, req.Name}, {&job.Schedule, req.Schedule}, {&job.Project, req.Project}, {&job.Instruction, req.Instruction}} {
+		if f.src != nil {
+			*f.dst = *f.src
+		}
+	}
+	if req.Enabled != nil {
+		job.Enabled = *req.Enabled
+	}
+	if job.Name == "" || job.Schedule == "" || job.Instruction == "" {
+		writeAPIErr(w, 400, "name, schedule, and instruction cannot be empty")
+		return
+	}
+	if err := jobs.Update(job.ID, job.Name, job.Schedule, job.Project, job.Instruction, job.Enabled); err != nil {
+		writeAPIErr(w, 500, err.Error())
+		return
+	}
+	s.refreshAndBroadcast()
+	job, _ = jobs.GetByID(job.ID)
+	writeAPI(w, 200, job)
+}
+
+func (s *Server) apiJobDelete(w http.ResponseWriter, r *http.Request) {
+	job, ok := pathJob(w, r)
+	if !ok {
+		return
+	}
+	if err := jobs.Delete(job.ID); err != nil {
+		writeAPIErr(w, 500, err.Error())
+		return
+	}
+	s.refreshAndBroadcast()
+	w.WriteHeader(204)
+}
+
+func (s *Server) apiJobRuns(w http.ResponseWriter, r *http.Request) {
+	job, ok := pathJob(w, r)
+	if !ok {
+		return
+	}
+	runs, err := jobs.ListRuns(job.ID)
+	if err != nil {
+		writeAPIErr(w, 500, err.Error())
+		return
+	}
+	writePage(w, r, runs)
+}
+
+// apiJobRun starts a run and answers before it finishes; the run shows up
+// under GET /jobs/{id}/runs once done.
+func (s *Server) apiJobRun(w http.ResponseWriter, r *http.Request) {
+	job, ok := pathJob(w, r)
+	if !ok {
+		return
+	}
+	if job.Status == jobs.StatusRunning {
+		writeAPIErr(w, 409, "job already running")
+		return
+	}
+	s.runJobNow(job)
+	job.Status = jobs.StatusRunning
+	writeAPI(w, 202, job)
+}
+
+func (s *Server) apiOpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeAPI(w, 200, s.openAPIDoc())
+}
@@ -0,0 +1,376 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/engine"
+	"github.com/JuanVilla424/teamoon/internal/logs"
+	"github.com/JuanVilla424/teamoon/internal/queue"
+	"github.com/JuanVilla424/teamoon/internal/tokens"
+)
+
+func newAPIServer(t *testing.T, password string) *httptest.Server {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	cfg := config.DefaultConfig()
+	cfg.ProjectsDir = t.TempDir()
+	cfg.ClaudeDir = t.TempDir()
+	cfg.WebPassword = password
+	s := NewServer(cfg, engine.NewManager(), logs.NewRingBuffer(1))
+	mux := http.NewServeMux()
+	s.registerAPIv1(mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// call sends a JSON request and decodes the response into out when set.
+func call(t *testing.T, srv *httptest.Server, method, path string, body any, out any) *http.Response {
+	t.Helper()
+	return callAs(t, srv, "", method, path, body, out)
+}
+
+// callAs is call with token sent as a bearer token, unless it is empty.
+func callAs(t *testing.T, srv *httptest.Server, token, method, path string, body any, out any) *http.Response {
+	t.Helper()
+	var rd io.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		rd = bytes.NewReader(data)
+	}
+	req, _ := http.NewRequest(method, srv.URL+path, rd)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decoding: %v", method, path, err)
+		}
+	}
+	return resp
+}
+
+func wantError(t *testing.T, srv *httptest.Server, method, path string, body any, status int, code string) {
+	t.Helper()
+	var e apiError
+	resp := call(t, srv, method, path, body, &e)
+	if resp.StatusCode != status || e.Error.Code != code || e.Error.Message == "" {
+		t.Errorf("%s %s = %d %+v, want %d %s", method, path, resp.StatusCode, e, status, code)
+	}
+}
+
+func TestAPIv1_TaskLifecycle(t *testing.T) {
+	srv := newAPIServer(t, "")
+
+	var created WebTask
+	resp := call(t, srv, "POST", "/api/v1/tasks", map[string]any{"project": "api", "description": "add login"}, &created)
+	if resp.StatusCode != 201 || created.ID == 0 || resp.Header.Get("Location") != "/api/v1/tasks/1" {
+		t.Fatalf("create = %d %+v %q", resp.StatusCode, created, resp.Header.Get("Location"))
+	}
+	call(t, srv, "POST", "/api/v1/tasks", map[string]any{"project": "web", "description": "dark mode"}, nil)
+
+	var patched WebTask
+	resp = call(t, srv, "PATCH", "/api/v1/tasks/1", map[string]any{"description": "add OAuth login", "labels": []string{"Security"}}, &patched)
+	if resp.StatusCode != 200 || patched.Description != "add OAuth login" || len(patched.Labels) != 1 || patched.Labels[0] != "security" {
+		t.Fatalf("patch = %d %+v", resp.StatusCode, patched)
+	}
+
+	var got WebTask
+	call(t, srv, "GET", "/api/v1/tasks/1", nil, &got)
+	if got.Description != "add OAuth login" || got.EffectiveState != "pending" {
+		t.Errorf("get = %+v", got)
+	}
+
+	var list page[WebTask]
+	call(t, srv, "GET", "/api/v1/tasks?label=security", nil, &list)
+	if list.Total != 1 || list.Items[0].ID != 1 {
+		t.Errorf("filtered list = %+v", list)
+	}
+	call(t, srv, "GET", "/api/v1/tasks?project=web&q=dark", nil, &list)
+	if list.Total != 1 || list.Items[0].Project != "web" {
+		t.Errorf("project list = %+v", list)
+	}
+
+	if resp := call(t, srv, "DELETE", "/api/v1/tasks/1", nil, nil); resp.StatusCode != 204 {
+		t.Fatalf("delete = %d", resp.StatusCode)
+	}
+	call(t, srv, "GET", "/api/v1/tasks", nil, &list)
+	if list.Total != 1 || list.Items[0].ID != 2 {
+		t.Errorf("archived task still listed: %+v", list)
+	}
+	call(t, srv, "GET", "/api/v1/tasks?state=archived", nil, &list)
+	if list.Total != 1 || list.Items[0].ID != 1 {
+		t.Errorf("archived list = %+v", list)
+	}
+
+	var events page[struct {
+		Kind string `json:"kind"`
+	}]
+	call(t, srv, "GET", "/api/v1/tasks/1/events?kind=created", nil, &events)
+	if events.Total != 1 || events.Items[0].Kind != "created" {
+		t.Errorf("events = %+v", events)
+	}
+}
+
+func TestAPIv1_Pagination(t *testing.T) {
+	srv := newAPIServer(t, "")
+	for i := 0; i < 5; i++ {
+		call(t, srv, "POST", "/api/v1/tasks", map[string]any{"project": "api", "description": "task"}, nil)
+	}
+
+	var list page[WebTask]
+	call(t, srv, "GET", "/api/v1/tasks?limit=2&offset=3", nil, &list)
+	if list.Total != 5 || list.Limit != 2 || list.Offset != 3 || len(list.Items) != 2 || list.Items[0].ID != 4 {
+		t.Errorf("page = %+v", list)
+	}
+	call(t, srv, "GET", "/api/v1/tasks?offset=10", nil, &list)
+	if list.Total != 5 || list.Items == nil || len(list.Items) != 0 {
+		t.Errorf("past the end = %+v", list)
+	}
+	call(t, srv, "GET", "/api/v1/tasks?limit=100000", nil, &list)
+	if list.Limit != maxPageSize {
+		t.Errorf("limit = %d, want it capped at %d", list.Limit, maxPageSize)
+	}
+	wantError(t, srv, "GET", "/api/v1/tasks?limit=0", nil, 400, "bad_request")
+}
+
+func TestAPIv1_Errors(t *testing.T) {
+	srv := newAPIServer(t, "")
+
+	wantError(t, srv, "GET", "/api/v1/tasks/42", nil, 404, "not_found")
+	wantError(t, srv, "GET", "/api/v1/tasks/abc", nil, 400, "bad_request")
+	wantError(t, srv, "GET", "/api/v1/nothing/here", nil, 404, "not_found")
+	wantError(t, srv, "GET", "/api/v1/tasks?state=bogus", nil, 400, "bad_request")
+	wantError(t, srv, "POST", "/api/v1/tasks", map[string]any{"project": "api"}, 400, "bad_request")
+	wantError(t, srv, "POST", "/api/v1/tasks", map[string]any{"project": "api", "description": "x", "colour": "red"}, 400, "bad_request")
+	wantError(t, srv, "GET", "/api/v1/jobs/7/runs", nil, 404, "not_found")
+	wantError(t, srv, "POST", "/api/v1/tasks", map[string]any{"project": "api", "description": "x", "parent_id": 9}, 400, "bad_request")
+	wantError(t, srv, "POST", "/api/v1/tasks", map[string]any{"project": "api", "description": "x", "labels": []string{"ok", " , "}}, 400, "bad_request")
+	var none page[WebTask]
+	if call(t, srv, "GET", "/api/v1/tasks", nil, &none); none.Total != 0 {
+		t.Errorf("rejected creates left %d tasks behind", none.Total)
+	}
+
+	resp := call(t, srv, "PUT", "/api/v1/tasks/1", nil, nil)
+	if resp.StatusCode != 405 || resp.Header.Get("Allow") != "GET, PATCH, DELETE" {
+		t.Errorf("PUT = %d, Allow %q", resp.StatusCode, resp.Header.Get("Allow"))
+	}
+
+	call(t, srv, "POST", "/api/v1/tasks", map[string]any{"project": "api", "description": "x"}, nil)
+	wantError(t, srv, "PATCH", "/api/v1/tasks/1", map[string]any{"state": "running"}, 400, "bad_request")
+	wantError(t, srv, "PATCH", "/api/v1/tasks/1", map[string]any{"parent_id": 1}, 400, "bad_request")
+
+	// A rejected field rejects the whole patch.
+	wantError(t, srv, "PATCH", "/api/v1/tasks/1", map[string]any{"description": "renamed", "labels": []string{"x"}, "depends_on": []int{1}}, 400, "bad_request")
+	var got WebTask
+	call(t, srv, "GET", "/api/v1/tasks/1", nil, &got)
+	if got.Description != "x" || len(got.Labels) != 0 {
+		t.Errorf("partially applied patch: %+v", got)
+	}
+	call(t, srv, "PATCH", "/api/v1/tasks/1", map[string]any{"state": "done"}, nil)
+	wantError(t, srv, "PATCH", "/api/v1/tasks/1", map[string]any{"state": "pending", "auto_pilot": true}, 409, "conflict")
+	call(t, srv, "GET", "/api/v1/tasks/1", nil, &got)
+	if got.AutoPilot {
+		t.Error("autopilot changed by a rejected patch")
+	}
+
+	call(t, srv, "POST", "/api/v1/tasks", map[string]any{"project": "api", "description": "y"}, nil)
+	call(t, srv, "DELETE", "/api/v1/tasks/2", nil, nil)
+	wantError(t, srv, "PATCH", "/api/v1/tasks/2", map[string]any{"labels": []string{"x"}, "assignee": "bob", "state": "done"}, 409, "conflict")
+	call(t, srv, "GET", "/api/v1/tasks/2", nil, &got)
+	if len(got.Labels) != 0 || got.Assignee != "" {
+		t.Errorf("fields applied by a patch with a rejected state change: %+v", got)
+	}
+}
+
+func TestAPIv1_RequiresAuth(t *testing.T) {
+	srv := newAPIServer(t, "secret")
+
+	wantError(t, srv, "GET", "/api/v1/tasks", nil, 401, "unauthorized")
+	if resp := call(t, srv, "GET", "/api/v1/openapi.json", nil, nil); resp.StatusCode != 200 {
+		t.Errorf("openapi.json = %d, want it public", resp.StatusCode)
+	}
+}
+
+func TestAPIv1_Tokens(t *testing.T) {
+	srv := newAPIServer(t, "secret")
+	_, read, _ := tokens.Create("dashboard", tokens.ScopeRead, 0)
+	_, writer, _ := tokens.Create("ci", tokens.ScopeTasksWrite, 0)
+	_, admin, _ := tokens.Create("ops", tokens.ScopeAdmin, 0)
+	task := map[string]any{"project": "api", "description": "from ci"}
+
+	if resp := callAs(t, srv, read, "GET", "/api/v1/tasks", nil, nil); resp.StatusCode != 200 {
+		t.Errorf("read GET = %d", resp.StatusCode)
+	}
+	if resp := callAs(t, srv, read, "POST", "/api/v1/tasks", task, nil); resp.StatusCode != 403 {
+		t.Errorf("read POST = %d, want 403", resp.StatusCode)
+	}
+	if resp := callAs(t, srv, writer, "POST", "/api/v1/tasks", task, nil); resp.StatusCode != 201 {
+		t.Errorf("tasks-write POST = %d", resp.StatusCode)
+	}
+	if resp := callAs(t, srv, writer, "POST", "/api/v1/jobs", map[string]any{"name": "x", "schedule": "0 3 * * *", "instruction": "y"}, nil); resp.StatusCode != 403 {
+		t.Errorf("tasks-write POST /jobs = %d, want 403", resp.StatusCode)
+	}
+	if resp := callAs(t, srv, writer, "GET", "/api/v1/tokens", nil, nil); resp.StatusCode != 403 {
+		t.Errorf("tasks-write GET /tokens = %d, want 403", resp.StatusCode)
+	}
+	var events page[queue.Event]
+	callAs(t, srv, read, "GET", "/api/v1/tasks/1/events", nil, &events)
+	if events.Total < 2 || events.Items[1].Actor != queue.ActorToken("ci") {
+		t.Errorf("events = %+v, want the creation recorded as token ci", events.Items)
+	}
+	if resp := callAs(t, srv, writer, "PATCH", "/api/v1/tasks/1", map[string]any{"auto_pilot": true}, nil); resp.StatusCode != 403 {
+		t.Errorf("tasks-write PATCH auto_pilot = %d, want 403", resp.StatusCode)
+	}
+	for _, assignee := range []string{"agent", "system"} {
+		body := map[string]any{"project": "api", "description": "run it", "assignee": assignee}
+		if resp := callAs(t, srv, writer, "POST", "/api/v1/tasks", body, nil); resp.StatusCode != 403 {
+			t.Errorf("tasks-write POST assignee %s = %d, want 403", assignee, resp.StatusCode)
+		}
+	}
+	if resp := callAs(t, srv, admin, "POST", "/api/v1/tasks", map[string]any{"project": "api", "description": "run it", "assignee": "agent"}, nil); resp.StatusCode != 201 {
+		t.Errorf("admin POST assignee agent = %d, want 201", resp.StatusCode)
+	}
+	if resp := callAs(t, srv, "tmn_bogus", "GET", "/api/v1/tasks", nil, nil); resp.StatusCode != 401 {
+		t.Errorf("bogus token = %d, want 401", resp.StatusCode)
+	}
+
+	var created createdToken
+	resp := callAs(t, srv, admin, "POST", "/api/v1/tokens", map[string]any{"name": "bot", "scope": "read", "expires_in": "30d"}, &created)
+	if resp.StatusCode != 201 || created.Secret == "" || created.ExpiresAt == nil {
+		t.Fatalf("create = %d %+v", resp.StatusCode, created)
+	}
+	var list page[map[string]any]
+	callAs(t, srv, admin, "GET", "/api/v1/tokens", nil, &list)
+	if list.Total != 4 || list.Items[0]["hash"] != nil || list.Items[0]["last_used_at"] == nil {
+		t.Errorf("list = %+v", list)
+	}
+	if resp := callAs(t, srv, admin, "DELETE", fmt.Sprintf("/api/v1/tokens/%d", created.ID), nil, nil); resp.StatusCode != 204 {
+		t.Errorf("revoke = %d", resp.StatusCode)
+	}
+	if resp := callAs(t, srv, created.Secret, "GET", "/api/v1/tasks", nil, nil); resp.StatusCode != 401 {
+		t.Errorf("revoked token = %d, want 401", resp.StatusCode)
+	}
+}
+
+func TestRequiredScope(t *testing.T) {
+	for _, c := range []struct{ method, path, want string }{
+		{"GET", "/api/v1/tasks", tokens.ScopeRead},
+		{"GET", "/api/data", tokens.ScopeRead},
+		{"POST", "/api/tasks/add", tokens.ScopeTasksWrite},
+		{"PATCH", "/api/v1/tasks/3", tokens.ScopeTasksWrite},
+		{"POST", "/api/v1/tasks/3/stop", tokens.ScopeTasksWrite},
+		{"POST", "/api/v1/tasks/3/replan", tokens.ScopeAdmin},
+		{"POST", "/api/tasks/autopilot", tokens.ScopeAdmin},
+		{"POST", "/api/tasks/plan/edit", tokens.ScopeAdmin},
+		{"POST", "/api/tasks/checkpoints/restore", tokens.ScopeAdmin},
+		{"POST", "/api/jobs/run", tokens.ScopeAdmin},
+		{"GET", "/api/config", tokens.ScopeAdmin},
+		{"GET", "/api/webhooks/deliveries", tokens.ScopeAdmin},
+		{"GET", "/api/v1/tokens", tokens.ScopeAdmin},
+	} {
+		r := httptest.NewRequest(c.method, c.path, nil)
+		if got := requiredScope(r); got != c.want {
+			t.Errorf("%s %s needs %s, want %s", c.method, c.path, got, c.want)
+		}
+	}
+}
+
+func TestAPIv1_Jobs(t *testing.T) {
+	srv := newAPIServer(t, "")
+
+	var job struct {
+		ID      int    `json:"id"`
+		Name    string `json:"name"`
+		Enabled bool   `json:"enabled"`
+	}
+	resp := call(t, srv, "POST", "/api/v1/jobs", map[string]any{"name": "nightly", "schedule": "0 3 * * *", "instruction": "tidy up"}, &job)
+	if resp.StatusCode != 201 || job.ID == 0 || !job.Enabled {
+		t.Fatalf("create = %d %+v", resp.StatusCode, job)
+	}
+	call(t, srv, "PATCH", "/api/v1/jobs/1", map[string]any{"enabled": false}, &job)
+	if job.Enabled || job.Name != "nightly" {
+		t.Errorf("patch = %+v", job)
+	}
+	var runs page[json.RawMessage]
+	if resp := call(t, srv, "GET", "/api/v1/jobs/1/runs", nil, &runs); resp.StatusCode != 200 || runs.Total != 0 {
+		t.Errorf("runs = %d %+v", resp.StatusCode, runs)
+	}
+	if resp := call(t, srv, "DELETE", "/api/v1/jobs/1", nil, nil); resp.StatusCode != 204 {
+		t.Errorf("delete = %d", resp.StatusCode)
+	}
+	wantError(t, srv, "GET", "/api/v1/jobs/1", nil, 404, "not_found")
+}
+
+func TestOpenAPIDoc(t *testing.T) {
+	srv := newAPIServer(t, "")
+	var doc struct {
+		OpenAPI string                               `json:"openapi"`
+		Paths   map[string]map[string]map[string]any `json:"paths"`
+		Comps   struct {
+			Schemas map[string]struct {
+				Properties map[string]any `json:"properties"`
+				Required   []string       `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	resp, err := http.Get(srv.URL + "/api/v1/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.OpenAPI != "3.0.3" {
+		t.Errorf("openapi = %q", doc.OpenAPI)
+	}
+	for path, methods := range map[string][]string{
+		"/tasks/{id}":                {"get", "patch", "delete"},
+		"/projects/{name}/autopilot": {"get", "put", "delete"},
+		"/jobs/{id}/runs":            {"get", "post"},
+	} {
+		for _, m := range methods {
+			if doc.Paths[path][m]["operationId"] == nil {
+				t.Errorf("missing %s %s", m, path)
+			}
+		}
+	}
+
+	task, ok := doc.Comps.Schemas["WebTask"]
+	if !ok || task.Properties["id"] == nil || task.Properties["effective_state"] == nil {
+		t.Errorf("WebTask schema = %+v", task)
+	}
+	if _, ok := doc.Comps.Schemas["WebTaskPage"]; !ok {
+		t.Error("missing WebTaskPage schema")
+	}
+	for _, ref := range schemaRefs(string(raw)) {
+		if _, ok := doc.Comps.Schemas[ref]; !ok {
+			t.Errorf("dangling $ref to %s", ref)
+		}
+	}
+}
+
+// schemaRefs returns the component names doc refers to.
+func schemaRefs(doc string) []string {
+	var refs []string
+	for _, part := range strings.Split(doc, `"#/components/schemas/`)[1:] {
+		refs = append(refs, part[:strings.Index(part, `"`)])
+	}
+	return refs
+}
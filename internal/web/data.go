@@ -19,27 +19,36 @@ var Version, BuildNum string
 
 type WebTask struct {
 	queue.Task
-	EffectiveState string `json:"effective_state"`
-	IsRunning      bool   `json:"is_running"`
-	HasPlan        bool   `json:"has_plan"`
+	EffectiveState string     `json:"effective_state"`
+	IsRunning      bool       `json:"is_running"`
+	HasPlan        bool       `json:"has_plan"`
+	CostUSD        float64    `json:"cost_usd,omitempty"`
+	Rollup         *WebRollup `json:"rollup,omitempty"`
+}
+
+// WebRollup is an epic's progress over its subtasks, with their total cost.
+type WebRollup struct {
+	queue.Rollup
+	CostUSD float64 `json:"cost_usd"`
 }
 
 type WebProject struct {
-	Name             string `json:"name"`
-	Path             string `json:"path"`
-	Branch           string `json:"branch"`
-	LastCommit       string `json:"last_commit"`
-	Modified         int    `json:"modified"`
-	Active           bool   `json:"active"`
-	Stale            bool   `json:"stale"`
-	HasGit           bool   `json:"has_git"`
-	GitHubRepo       string `json:"github_repo"`
-	StatusIcon       string `json:"status_icon"`
-	AutopilotRunning bool   `json:"autopilot_running"`
-	TaskTotal        int    `json:"task_total"`
-	TaskPending      int    `json:"task_pending"`
-	TaskRunning      int    `json:"task_running"`
-	TaskDone         int    `json:"task_done"`
+	Name             string              `json:"name"`
+	Path             string              `json:"path"`
+	Branch           string              `json:"branch"`
+	LastCommit       string              `json:"last_commit"`
+	Modified         int                 `json:"modified"`
+	Active           bool                `json:"active"`
+	Stale            bool                `json:"stale"`
+	HasGit           bool                `json:"has_git"`
+	GitHubRepo       string              `json:"github_repo"`
+	StatusIcon       string              `json:"status_icon"`
+	AutopilotRunning bool                `json:"autopilot_running"`
+	TaskTotal        int                 `json:"task_total"`
+	TaskPending      int                 `json:"task_pending"`
+	TaskRunning      int                 `json:"task_running"`
+	TaskDone         int                 `json:"task_done"`
+	Spend            metrics.SpendTotals `json:"spend"`
 }
 
 type LogEntryJSON struct {
@@ -91,6 +100,52 @@ func NewStore(cfg config.Config, mgr *engine.Manager, logBuf *logs.RingBuffer) *
 	}
 }
 
+// webTask wraps t with the state the UI should show, which also reflects plan
+// generation and engine runs that have not reached the queue yet.
+func (s *Store) webTask(t queue.Task, costUSD float64) WebTask {
+	effState := string(queue.EffectiveState(t))
+	isRunning := s.engineMgr.IsRunning(t.ID)
+	// Show "planning" as soon as plan generation is requested
+	generatingMu.Lock()
+	if effState == "pending" {
+		if _, genOk := generatingSet[t.ID]; genOk {
+			effState = "planning"
+		}
+	}
+	generatingMu.Unlock()
+	// Engine is authoritative: if running, override stale JSON state
+	if isRunning && (effState == "pending" || effState == "planned") {
+		effState = "running"
+	}
+	// Task was running (has step progress) but briefly went planned during gap — keep as running
+	if !isRunning && effState == "planned" && t.CurrentStep > 0 && s.engineMgr.IsProjectRunning(t.Project) {
+		effState = "running"
+	}
+	return WebTask{
+		Task:           t,
+		EffectiveState: effState,
+		IsRunning:      isRunning,
+		HasPlan:        plan.PlanExists(t.ID),
+		CostUSD:        costUSD,
+	}
+}
+
+// attachRollups fills in the rollup of every epic in out. all must hold the
+// epics' subtasks.
+func attachRollups(out []WebTask, all []queue.Task, taskSpend map[int]metrics.SpendTotals) {
+	children := queue.ChildIndex(all)
+	for i := range out {
+		if len(children[out[i].ID]) == 0 {
+			continue
+		}
+		r := &WebRollup{Rollup: queue.RollupOf(out[i].ID, children)}
+		for _, c := range queue.DescendantsIn(out[i].ID, children) {
+			r.CostUSD += taskSpend[c.ID].CostUSD
+		}
+		out[i].Rollup = r
+	}
+}
+
 func (s *Store) Refresh() {
 	today, week, month, _ := metrics.ScanTokens(s.cfg.ClaudeDir)
 	session := metrics.ScanActiveSession(s.cfg.ClaudeDir, s.cfg.ContextLimit)
@@ -98,34 +153,14 @@ func (s *Store) Refresh() {
 	usage := metrics.GetUsage()
 	projs := projects.Scan(s.cfg.ProjectsDir)
 	activeTasks, _ := queue.ListActive()
+	taskSpend, _ := metrics.SpendByTask()
+	projSpend, _ := metrics.SpendByProject()
 
 	webTasks := make([]WebTask, len(activeTasks))
 	for i, t := range activeTasks {
-		effState := string(queue.EffectiveState(t))
-		isRunning := s.engineMgr.IsRunning(t.ID)
-		// Show "generating" if plan generation is in progress
-		generatingMu.Lock()
-		if effState == "pending" {
-			if _, genOk := generatingSet[t.ID]; genOk {
-				effState = "generating"
-			}
-		}
-		generatingMu.Unlock()
-		// Engine is authoritative: if running, override stale JSON state
-		if isRunning && (effState == "pending" || effState == "planned") {
-			effState = "running"
-		}
-		// Task was running (has step progress) but briefly went planned during gap — keep as running
-		if !isRunning && effState == "planned" && t.CurrentStep > 0 && s.engineMgr.IsProjectRunning(t.Project) {
-			effState = "running"
-		}
-		webTasks[i] = WebTask{
-			Task:           t,
-			EffectiveState: effState,
-			IsRunning:      isRunning,
-			HasPlan:        plan.PlanExists(t.ID),
-		}
+		webTasks[i] = s.webTask(t, taskSpend[t.ID].CostUSD)
 	}
+	attachRollups(webTasks, activeTasks, taskSpend)
 
 	// Count tasks per project
 	type projCounts struct{ total, pending, running, done int }
@@ -138,7 +173,7 @@ func (s *Store) Refresh() {
 		}
 		pc.total++
 		switch wt.EffectiveState {
-		case "pending", "generating", "planned":
+		case "pending", "planning", "planned":
 			pc.pending++
 		case "running":
 			pc.running++
@@ -176,6 +211,7 @@ func (s *Store) Refresh() {
 			GitHubRepo:       p.GitHubRepo,
 			StatusIcon:       icon,
 			AutopilotRunning: activeLoopSet[p.Name],
+			Spend:            projSpend[p.Name],
 		}
 		if pc != nil {
 			wp.TaskTotal = pc.total
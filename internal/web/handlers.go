@@ -1,13 +1,13 @@
 package web
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -26,6 +26,7 @@ import (
 	"github.com/JuanVilla424/teamoon/internal/jobs"
 	"github.com/JuanVilla424/teamoon/internal/onboarding"
 	"github.com/JuanVilla424/teamoon/internal/logs"
+	"github.com/JuanVilla424/teamoon/internal/metrics"
 	"github.com/JuanVilla424/teamoon/internal/plan"
 	"github.com/JuanVilla424/teamoon/internal/plugins"
 	"github.com/JuanVilla424/teamoon/internal/plangen"
@@ -34,6 +35,7 @@ import (
 	"github.com/JuanVilla424/teamoon/internal/queue"
 	"github.com/JuanVilla424/teamoon/internal/templates"
 	"github.com/JuanVilla424/teamoon/internal/uploads"
+	"github.com/JuanVilla424/teamoon/internal/webhook"
 )
 
 func writeJSON(w http.ResponseWriter, v any) {
@@ -123,41 +125,94 @@ func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, map[string]bool{"ok": true})
 }
 
+// taskInput is the body of a task creation request.
+type taskInput struct {
+	Project     string   `json:"project"`
+	Description string   `json:"description"`
+	Priority    string   `json:"priority"`
+	Assignee    string   `json:"assignee"`
+	Attachments []string `json:"attachments,omitempty"`
+	Labels      []string `json:"labels,omitempty"`
+	ParentID    int      `json:"parent_id,omitempty"`
+}
+
 func (s *Server) handleTaskAdd(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeErr(w, 405, "method not allowed")
 		return
 	}
-	var req struct {
-		Project     string   `json:"project"`
-		Description string   `json:"description"`
-		Priority    string   `json:"priority"`
-		Assignee    string   `json:"assignee"`
-		Attachments []string `json:"attachments,omitempty"`
-	}
+	var req taskInput
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeErr(w, 400, err.Error())
 		return
 	}
-	t, err := queue.Add(req.Project, req.Description, req.Priority)
+	if msg, denied := adminDenied(r, "assignee "+req.Assignee); denied && runsAgent(req.Assignee) {
+		writeErr(w, 403, msg)
+		return
+	}
+	if err := checkTaskInput(req); err != nil {
+		writeErr(w, 400, err.Error())
+		return
+	}
+	t, err := s.addTask(req, actorOf(r))
 	if err != nil {
 		writeErr(w, 500, err.Error())
 		return
 	}
+	writeJSON(w, t)
+}
+
+// checkTaskInput validates the labels and parent of a new task before it is
+// created, so a request that would lose them is refused instead.
+func checkTaskInput(req taskInput) error {
+	if err := queue.ValidateLabels(req.Labels); err != nil {
+		return err
+	}
+	if req.ParentID != 0 {
+		if _, err := queue.GetTask(req.ParentID); err != nil {
+			return fmt.Errorf("parent task #%d not found", req.ParentID)
+		}
+	}
+	return nil
+}
+
+// addTask creates a task from req, assigning it and starting the system
+// loop when asked to. actor is recorded as the creator. req is expected to
+// have passed checkTaskInput.
+func (s *Server) addTask(req taskInput, actor string) (queue.Task, error) {
+	t, err := queue.Add(req.Project, req.Description, req.Priority)
+	if err != nil {
+		return t, err
+	}
+	queue.RecordAction(t.ID, actor, "created")
 	for _, uid := range req.Attachments {
 		queue.AttachToTask(t.ID, uid)
 	}
+	if len(req.Labels) > 0 || req.ParentID != 0 {
+		e := queue.TaskEdit{}
+		if len(req.Labels) > 0 {
+			e.Labels = &req.Labels
+		}
+		if req.ParentID != 0 {
+			e.ParentID = &req.ParentID
+		}
+		edited, err := queue.Edit(t.ID, e)
+		if err != nil {
+			return t, fmt.Errorf("task #%d created without labels or parent: %w", t.ID, err)
+		}
+		t = edited
+	}
 	if req.Assignee != "" {
 		queue.UpdateAssignee(t.ID, req.Assignee)
-		if req.Assignee == "agent" || req.Assignee == "system" {
-			queue.ToggleAutoPilot(t.ID)
+		if runsAgent(req.Assignee) {
+			queue.SetAutoPilot(t.ID, true)
 		}
 		if req.Assignee == "system" {
 			s.startSystemLoop()
 		}
 	}
 	s.refreshAndBroadcast()
-	writeJSON(w, t)
+	return t, nil
 }
 
 func (s *Server) handleTaskDone(w http.ResponseWriter, r *http.Request) {
@@ -180,6 +235,7 @@ func (s *Server) handleTaskDone(w http.ResponseWriter, r *http.Request) {
 		writeErr(w, 500, err.Error())
 		return
 	}
+	queue.RecordAction(req.ID, actorOf(r), "marked done")
 	s.refreshAndBroadcast()
 	writeJSON(w, map[string]bool{"ok": true})
 }
@@ -196,18 +252,190 @@ func (s *Server) handleTaskArchive(w http.ResponseWriter, r *http.Request) {
 		writeErr(w, 400, err.Error())
 		return
 	}
-	if s.store.engineMgr.IsRunning(req.ID) {
-		s.store.engineMgr.Stop(req.ID)
-	}
-	s.clearGenerating(req.ID)
+	s.stopTree(req.ID)
 	if err := queue.Archive(req.ID); err != nil {
 		writeErr(w, 500, err.Error())
 		return
 	}
+	engine.DiscardWorkspaces(s.cfg, req.ID)
+	queue.RecordAction(req.ID, actorOf(r), "archived")
+	s.refreshAndBroadcast()
+	writeJSON(w, map[string]bool{"ok": true})
+}
+
+// handleTaskList returns tasks filtered by ?state=a,b and ?project=name.
+// Without a state filter archived tasks are left out.
+func (s *Server) handleTaskList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErr(w, 405, "method not allowed")
+		return
+	}
+	f := queue.Filter{Project: r.URL.Query().Get("project")}
+	if raw := r.URL.Query().Get("state"); raw != "" {
+		for _, part := range strings.Split(raw, ",") {
+			st := queue.TaskState(strings.TrimSpace(part))
+			if !queue.ValidState(st) {
+				writeErr(w, 400, "unknown state: "+string(st))
+				return
+			}
+			f.States = append(f.States, st)
+		}
+	} else {
+		f.ExcludeStates = []queue.TaskState{queue.StateArchived}
+	}
+	tasks, err := queue.ListWhere(f)
+	if err != nil {
+		writeErr(w, 500, err.Error())
+		return
+	}
+	writeJSON(w, s.webTasks(tasks))
+}
+
+// handleTaskSearch runs a task query (?q=) or a saved filter (?filter=name).
+func (s *Server) handleTaskSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErr(w, 405, "method not allowed")
+		return
+	}
+	raw := r.URL.Query().Get("q")
+	if name := r.URL.Query().Get("filter"); name != "" {
+		f, err := queue.GetFilter(name)
+		if err != nil {
+			writeErr(w, 404, err.Error())
+			return
+		}
+		raw = f.Query
+	}
+	q, err := queue.ParseQuery(raw)
+	if err != nil {
+		writeErr(w, 400, err.Error())
+		return
+	}
+	tasks, err := queue.Search(q)
+	if err != nil {
+		writeErr(w, 500, err.Error())
+		return
+	}
+	writeJSON(w, s.webTasks(tasks))
+}
+
+// webTasks converts tasks for the API, with their cost and epic rollups.
+func (s *Server) webTasks(tasks []queue.Task) []WebTask {
+	taskSpend, _ := metrics.SpendByTask()
+	out := make([]WebTask, len(tasks))
+	for i, t := range tasks {
+		out[i] = s.store.webTask(t, taskSpend[t.ID].CostUSD)
+	}
+	all, _ := queue.ListActive()
+	attachRollups(out, all, taskSpend)
+	return out
+}
+
+func (s *Server) handleTaskLabels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErr(w, 405, "method not allowed")
+		return
+	}
+	var req struct {
+		ID     int      `json:"id"`
+		Labels []string `json:"labels"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, 400, err.Error())
+		return
+	}
+	t, err := queue.SetLabels(req.ID, req.Labels)
+	if err != nil {
+		writeErr(w, 500, err.Error())
+		return
+	}
+	queue.RecordAction(t.ID, actorOf(r), "labels "+strings.Join(t.Labels, ","))
 	s.refreshAndBroadcast()
+	writeJSON(w, t)
+}
+
+func (s *Server) handleFiltersList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErr(w, 405, "method not allowed")
+		return
+	}
+	filters, err := queue.ListFilters()
+	if err != nil {
+		writeErr(w, 500, err.Error())
+		return
+	}
+	if filters == nil {
+		filters = []queue.SavedFilter{}
+	}
+	writeJSON(w, filters)
+}
+
+func (s *Server) handleFilterSave(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErr(w, 405, "method not allowed")
+		return
+	}
+	var req queue.SavedFilter
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, 400, err.Error())
+		return
+	}
+	f, err := queue.SaveFilter(req.Name, req.Query)
+	if err != nil {
+		writeErr(w, 400, err.Error())
+		return
+	}
+	writeJSON(w, f)
+}
+
+func (s *Server) handleFilterDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErr(w, 405, "method not allowed")
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, 400, err.Error())
+		return
+	}
+	if err := queue.DeleteFilter(req.Name); err != nil {
+		writeErr(w, 404, err.Error())
+		return
+	}
 	writeJSON(w, map[string]bool{"ok": true})
 }
 
+func (s *Server) handleTaskRetry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErr(w, 405, "method not allowed")
+		return
+	}
+	var req struct {
+		ID int `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, 400, err.Error())
+		return
+	}
+	t, err := queue.Retry(req.ID)
+	if err != nil {
+		writeErr(w, 409, err.Error())
+		return
+	}
+	queue.RecordAction(t.ID, actorOf(r), "retry")
+	s.store.logBuf.Add(logs.LogEntry{
+		Time:    time.Now(),
+		TaskID:  t.ID,
+		Project: t.Project,
+		Message: fmt.Sprintf("Task #%d retried (%s)", t.ID, queue.EffectiveState(t)),
+		Level:   logs.LevelInfo,
+	})
+	s.refreshAndBroadcast()
+	writeJSON(w, map[string]any{"ok": true, "state": queue.EffectiveState(t)})
+}
+
 func (s *Server) handleTaskReplan(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeErr(w, 405, "method not allowed")
@@ -224,11 +452,15 @@ func (s *Server) handleTaskReplan(w http.ResponseWriter, r *http.Request) {
 		s.store.engineMgr.Stop(req.ID)
 	}
 	s.clearGenerating(req.ID)
-	os.Remove(plan.PlanPath(req.ID))
+	if err := plan.RetirePlan(req.ID, "replan requested"); err != nil {
+		writeErr(w, 500, err.Error())
+		return
+	}
 	if err := queue.ResetPlan(req.ID); err != nil {
 		writeErr(w, 500, err.Error())
 		return
 	}
+	queue.RecordAction(req.ID, actorOf(r), "replan")
 	s.refreshAndBroadcast()
 	writeJSON(w, map[string]bool{"ok": true})
 }
@@ -245,14 +477,57 @@ func (s *Server) handleTaskStop(w http.ResponseWriter, r *http.Request) {
 		writeErr(w, 400, err.Error())
 		return
 	}
-	if s.store.engineMgr.IsRunning(req.ID) {
-		s.store.engineMgr.Stop(req.ID)
-	}
-	s.clearGenerating(req.ID)
+	s.stopTree(req.ID)
+	queue.RecordAction(req.ID, actorOf(r), "stop")
 	s.refreshAndBroadcast()
 	writeJSON(w, map[string]bool{"ok": true})
 }
 
+// stopTree stops the engine and any plan generation for task id and all of
+// its subtasks.
+func (s *Server) stopTree(id int) {
+	ids := []int{id}
+	if below, err := queue.Descendants(id); err == nil {
+		for _, t := range below {
+			ids = append(ids, t.ID)
+		}
+	}
+	for _, tid := range ids {
+		if s.store.engineMgr.IsRunning(tid) {
+			s.store.engineMgr.Stop(tid)
+		}
+		s.clearGenerating(tid)
+	}
+}
+
+// handleTaskParent moves a task under an epic; parent_id 0 detaches it.
+func (s *Server) handleTaskParent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErr(w, 405, "method not allowed")
+		return
+	}
+	var req struct {
+		ID       int `json:"id"`
+		ParentID int `json:"parent_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, 400, err.Error())
+		return
+	}
+	t, err := queue.SetParent(req.ID, req.ParentID)
+	if err != nil {
+		writeErr(w, 400, err.Error())
+		return
+	}
+	action := "detached from epic"
+	if req.ParentID != 0 {
+		action = fmt.Sprintf("moved under #%d", req.ParentID)
+	}
+	queue.RecordAction(t.ID, actorOf(r), action)
+	s.refreshAndBroadcast()
+	writeJSON(w, t)
+}
+
 func (s *Server) handleTaskAutopilot(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeErr(w, 405, "method not allowed")
@@ -283,7 +558,7 @@ func (s *Server) handleTaskAutopilot(w http.ResponseWriter, r *http.Request) {
 	state := queue.EffectiveState(found)
 
 	// If currently generating, block duplicate calls
-	if state == queue.StatePending && s.isGenerating(found.ID) {
+	if state == queue.StatePlanning || (state == queue.StatePending && s.isGenerating(found.ID)) {
 		writeJSON(w, map[string]string{"status": "already_generating"})
 		return
 	}
@@ -292,6 +567,8 @@ func (s *Server) handleTaskAutopilot(w http.ResponseWriter, r *http.Request) {
 	case queue.StatePending:
 		autoRun := req.Run == nil || *req.Run
 		s.setGenerating(found.ID, nil) // cancel set inside generatePlanAsync
+		queue.RecordAction(found.ID, actorOf(r), "plan")
+		queue.UpdateState(found.ID, queue.StatePlanning)
 		s.refreshAndBroadcast()
 		go s.generatePlanAsync(found, autoRun)
 		writeJSON(w, map[string]string{"status": "generating"})
@@ -306,12 +583,14 @@ func (s *Server) handleTaskAutopilot(w http.ResponseWriter, r *http.Request) {
 			writeErr(w, 500, "plan parse error: "+err.Error())
 			return
 		}
+		queue.RecordAction(found.ID, actorOf(r), "run")
 		queue.UpdateState(found.ID, queue.StateRunning)
 		s.store.engineMgr.Start(found, p, s.cfg, s.webSend(found.ID))
 		s.refreshAndBroadcast()
 		writeJSON(w, map[string]string{"status": "running"})
 
 	case queue.StateRunning:
+		queue.RecordAction(found.ID, actorOf(r), "stop")
 		s.store.engineMgr.Stop(found.ID)
 		s.refreshAndBroadcast()
 		writeJSON(w, map[string]string{"status": "stopped"})
@@ -342,11 +621,19 @@ func (s *Server) setGenerating(id int, cancel context.CancelFunc) {
 
 func (s *Server) clearGenerating(id int) {
 	generatingMu.Lock()
-	if cancel, ok := generatingSet[id]; ok && cancel != nil {
+	cancel, ok := generatingSet[id]
+	if ok && cancel != nil {
 		cancel() // kill the Claude process
 	}
 	delete(generatingSet, id)
 	generatingMu.Unlock()
+	// A plan this server was generating that did not reach planned goes back
+	// to pending.
+	if ok && cancel != nil {
+		if t, err := queue.GetTask(id); err == nil && queue.EffectiveState(t) == queue.StatePlanning {
+			queue.UpdateState(id, queue.StatePending)
+		}
+	}
 }
 
 func (s *Server) webSend(taskID int) func(tea.Msg) {
@@ -359,7 +646,7 @@ func (s *Server) webSend(taskID int) func(tea.Msg) {
 		case engine.TaskStateMsg:
 			if m.Message == "planning" {
 				s.setGenerating(m.TaskID, nil) // autopilot path — cancel managed by engine
-			} else if m.State == queue.StatePlanned || m.State == queue.StatePending {
+			} else if m.State == queue.StatePlanned || m.State == queue.StatePending || m.State == queue.StateAwaitingApproval || m.State == queue.StateFailed {
 				s.clearGenerating(m.TaskID)
 			}
 			s.store.logBuf.Add(logs.LogEntry{
@@ -370,7 +657,7 @@ func (s *Server) webSend(taskID int) func(tea.Msg) {
 			})
 		case engine.PlanGeneratedMsg:
 			if m.Err == nil && m.Content != "" {
-				plan.SavePlan(m.TaskID, m.Content)
+				plan.SavePlanRevision(m.TaskID, m.Content, m.Meta)
 				queue.SetPlanFile(m.TaskID, plan.PlanPath(m.TaskID))
 			}
 		}
@@ -378,23 +665,315 @@ func (s *Server) webSend(taskID int) func(tea.Msg) {
 	}
 }
 
-func (s *Server) handleTaskPlan(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleTaskPlan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErr(w, 405, "method not allowed")
+		return
+	}
+	var id, rev int
+	fmt.Sscanf(r.URL.Query().Get("id"), "%d", &id)
+	fmt.Sscanf(r.URL.Query().Get("rev"), "%d", &rev)
+	var content string
+	if rev > 0 {
+		c, err := plan.LoadRevision(id, rev)
+		if err != nil {
+			writeErr(w, 404, err.Error())
+			return
+		}
+		content = c
+	} else {
+		if !plan.PlanExists(id) {
+			writeErr(w, 404, "no plan")
+			return
+		}
+		data, err := os.ReadFile(plan.PlanPath(id))
+		if err != nil {
+			writeErr(w, 500, err.Error())
+			return
+		}
+		content = string(data)
+	}
+	sk := s.cfg.Skeleton
+	if t, err := queue.GetTask(id); err == nil {
+		sk = config.SkeletonFor(s.cfg, t.Project)
+	}
+	writeJSON(w, map[string]any{
+		"content": content,
+		"lint":    plan.Validate(plan.ParseText(content), sk),
+	})
+}
+
+func (s *Server) handlePlanApprove(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErr(w, 405, "method not allowed")
+		return
+	}
+	var req struct {
+		ID int `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, 400, err.Error())
+		return
+	}
+	if err := engine.ApprovePlan(req.ID); err != nil {
+		writeErr(w, 409, err.Error())
+		return
+	}
+	queue.RecordAction(req.ID, actorOf(r), "plan approved")
+	s.store.logBuf.Add(logs.LogEntry{
+		Time: time.Now(), TaskID: req.ID, Message: "Plan approved", Level: logs.LevelSuccess,
+	})
+	s.refreshAndBroadcast()
+	writeJSON(w, map[string]bool{"ok": true})
+}
+
+func (s *Server) handlePlanReject(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErr(w, 405, "method not allowed")
+		return
+	}
+	var req struct {
+		ID       int    `json:"id"`
+		Feedback string `json:"feedback"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, 400, err.Error())
+		return
+	}
+	if err := engine.RejectPlan(req.ID, req.Feedback); err != nil {
+		writeErr(w, 409, err.Error())
+		return
+	}
+	queue.RecordAction(req.ID, actorOf(r), "plan rejected: "+req.Feedback)
+	s.store.logBuf.Add(logs.LogEntry{
+		Time: time.Now(), TaskID: req.ID, Message: "Plan rejected: " + req.Feedback, Level: logs.LevelWarn,
+	})
+	s.refreshAndBroadcast()
+	writeJSON(w, map[string]bool{"ok": true})
+}
+
+// handlePlanEdit replaces the plan of a task that has not started. An edit
+// that fails validation is refused with 422 and its lint report.
+func (s *Server) handlePlanEdit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErr(w, 405, "method not allowed")
+		return
+	}
+	var req struct {
+		ID      int    `json:"id"`
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, 400, err.Error())
+		return
+	}
+	report, err := engine.EditPlan(s.cfg, req.ID, req.Content)
+	if err != nil {
+		if !report.OK() {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(422)
+			json.NewEncoder(w).Encode(map[string]any{"error": err.Error(), "lint": report})
+			return
+		}
+		writeErr(w, 409, err.Error())
+		return
+	}
+	queue.RecordAction(req.ID, actorOf(r), "plan edited")
+	s.refreshAndBroadcast()
+	writeJSON(w, map[string]any{"ok": true, "lint": report})
+}
+
+// handleTaskApproval sets a task's plan-approval override. A null require
+// falls back to the project and global settings.
+func (s *Server) handleTaskApproval(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErr(w, 405, "method not allowed")
+		return
+	}
+	var req struct {
+		ID      int   `json:"id"`
+		Require *bool `json:"require"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, 400, err.Error())
+		return
+	}
+	if err := queue.SetRequirePlanApproval(req.ID, req.Require); err != nil {
+		writeErr(w, 500, err.Error())
+		return
+	}
+	approval := "inherit"
+	if req.Require != nil && *req.Require {
+		approval = "on"
+	} else if req.Require != nil {
+		approval = "off"
+	}
+	queue.RecordAction(req.ID, actorOf(r), "plan approval "+approval)
+	s.refreshAndBroadcast()
+	writeJSON(w, map[string]bool{"ok": true})
+}
+
+func (s *Server) handleTaskCheckpoints(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErr(w, 405, "method not allowed")
+		return
+	}
+	var id int
+	fmt.Sscanf(r.URL.Query().Get("id"), "%d", &id)
+	cps, err := engine.ListCheckpoints(s.cfg, id)
+	if err != nil {
+		writeErr(w, 500, err.Error())
+		return
+	}
+	if cps == nil {
+		cps = []engine.Checkpoint{}
+	}
+	writeJSON(w, cps)
+}
+
+// handleCheckpointRevert undoes a step and every step after it. Step 0 (or
+// /api/tasks/checkpoints/restore) returns the task to its pre-task state.
+func (s *Server) handleCheckpointRevert(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErr(w, 405, "method not allowed")
+		return
+	}
+	var req struct {
+		ID   int `json:"id"`
+		Step int `json:"step"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, 400, err.Error())
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/restore") {
+		req.Step = 0
+	}
+	if s.store.engineMgr.IsRunning(req.ID) {
+		writeErr(w, 409, "task is running; stop it before reverting")
+		return
+	}
+	if err := engine.RevertStep(s.cfg, req.ID, req.Step); err != nil {
+		writeErr(w, 400, err.Error())
+		return
+	}
+	msg := fmt.Sprintf("Reverted to checkpoint before step %d", req.Step)
+	if req.Step == 0 {
+		msg = "Restored pre-task state"
+	}
+	queue.RecordAction(req.ID, actorOf(r), msg)
+	s.store.logBuf.Add(logs.LogEntry{
+		Time: time.Now(), TaskID: req.ID, Message: msg, Level: logs.LevelWarn,
+	})
+	s.refreshAndBroadcast()
+	writeJSON(w, map[string]bool{"ok": true})
+}
+
+func (s *Server) handlePlanRevisions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErr(w, 405, "method not allowed")
+		return
+	}
+	var id int
+	fmt.Sscanf(r.URL.Query().Get("id"), "%d", &id)
+	h, err := plan.LoadHistory(id)
+	if err != nil {
+		writeErr(w, 500, err.Error())
+		return
+	}
+	if h.Revisions == nil {
+		h.Revisions = []plan.Revision{}
+	}
+	writeJSON(w, h)
+}
+
+// handlePlanDiff diffs revision a against revision b. b defaults to the
+// active revision and a to the one before b.
+func (s *Server) handlePlanDiff(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		writeErr(w, 405, "method not allowed")
 		return
 	}
-	var id int
-	fmt.Sscanf(r.URL.Query().Get("id"), "%d", &id)
-	if !plan.PlanExists(id) {
-		writeErr(w, 404, "no plan")
+	var id, a, b int
+	q := r.URL.Query()
+	fmt.Sscanf(q.Get("id"), "%d", &id)
+	fmt.Sscanf(q.Get("a"), "%d", &a)
+	fmt.Sscanf(q.Get("b"), "%d", &b)
+	h, err := plan.LoadHistory(id)
+	if err != nil {
+		writeErr(w, 500, err.Error())
+		return
+	}
+	if len(h.Revisions) == 0 {
+		writeErr(w, 404, "no plan revisions")
 		return
 	}
-	content, err := os.ReadFile(plan.PlanPath(id))
+	if b == 0 {
+		b = h.Active
+		if b == 0 {
+			b = h.Revisions[len(h.Revisions)-1].Number
+		}
+	}
+	if a == 0 {
+		a = b - 1
+	}
+	diff, err := plan.DiffRevisions(id, a, b)
 	if err != nil {
+		writeErr(w, 404, err.Error())
+		return
+	}
+	writeJSON(w, map[string]any{"a": a, "b": b, "diff": diff})
+}
+
+func (s *Server) handlePlanRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErr(w, 405, "method not allowed")
+		return
+	}
+	var req struct {
+		ID  int  `json:"id"`
+		Rev int  `json:"rev"`
+		Pin bool `json:"pin"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, 400, err.Error())
+		return
+	}
+	if s.store.engineMgr.IsRunning(req.ID) {
+		writeErr(w, 409, "task is running; stop it before restoring a plan")
+		return
+	}
+	if err := plan.RestoreRevision(req.ID, req.Rev, req.Pin); err != nil {
+		writeErr(w, 400, err.Error())
+		return
+	}
+	if err := queue.SetPlanFile(req.ID, plan.PlanPath(req.ID)); err != nil {
 		writeErr(w, 500, err.Error())
 		return
 	}
-	writeJSON(w, map[string]string{"content": string(content)})
+	queue.RecordAction(req.ID, actorOf(r), fmt.Sprintf("restored plan revision %d", req.Rev))
+	s.refreshAndBroadcast()
+	writeJSON(w, map[string]bool{"ok": true})
+}
+
+func (s *Server) handlePlanPin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErr(w, 405, "method not allowed")
+		return
+	}
+	var req struct {
+		ID     int  `json:"id"`
+		Pinned bool `json:"pinned"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, 400, err.Error())
+		return
+	}
+	if err := plan.SetPinned(req.ID, req.Pinned); err != nil {
+		writeErr(w, 400, err.Error())
+		return
+	}
+	writeJSON(w, map[string]bool{"ok": true})
 }
 
 func (s *Server) handleTaskDetail(w http.ResponseWriter, r *http.Request) {
@@ -430,7 +1009,65 @@ func (s *Server) handleTaskDetail(w http.ResponseWriter, r *http.Request) {
 	if len(task.Attachments) > 0 {
 		attMeta = uploads.ResolveIDs(task.Attachments)
 	}
-	writeJSON(w, map[string]any{"task_id": id, "logs": logJSON, "attachments": attMeta})
+	spend, _ := metrics.SpendForTask(id)
+	diffs, _ := queue.LoadStepDiffs(id)
+	if diffs == nil {
+		diffs = []queue.StepDiff{}
+	}
+	events, _ := queue.LoadEvents(id)
+	if events == nil {
+		events = []queue.Event{}
+	}
+	writeJSON(w, map[string]any{"task_id": id, "logs": logJSON, "attachments": attMeta, "spend": spend, "diffs": diffs, "events": events, "flow": queue.Flow(events)})
+}
+
+// handleTaskEvents returns a task's activity timeline, optionally only the
+// kinds listed in ?kind=a,b, with its lead and cycle time.
+func (s *Server) handleTaskEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErr(w, 405, "method not allowed")
+		return
+	}
+	var id int
+	fmt.Sscanf(r.URL.Query().Get("id"), "%d", &id)
+	events, err := queue.LoadEvents(id)
+	if err != nil {
+		writeErr(w, 500, err.Error())
+		return
+	}
+	flow := queue.Flow(events)
+	if raw := r.URL.Query().Get("kind"); raw != "" {
+		kinds := strings.Split(raw, ",")
+		kept := events[:0]
+		for _, e := range events {
+			for _, k := range kinds {
+				if e.Kind == strings.TrimSpace(k) {
+					kept = append(kept, e)
+					break
+				}
+			}
+		}
+		events = kept
+	}
+	if events == nil {
+		events = []queue.Event{}
+	}
+	writeJSON(w, map[string]any{"task_id": id, "events": events, "flow": flow})
+}
+
+// handleTaskFlow returns average lead and cycle time over finished tasks,
+// for one project when ?project= is set.
+func (s *Server) handleTaskFlow(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErr(w, 405, "method not allowed")
+		return
+	}
+	stats, err := queue.ProjectFlow(r.URL.Query().Get("project"))
+	if err != nil {
+		writeErr(w, 500, err.Error())
+		return
+	}
+	writeJSON(w, stats)
 }
 
 func (s *Server) handleProjectPRs(w http.ResponseWriter, r *http.Request) {
@@ -612,15 +1249,6 @@ func (s *Server) generatePlanAsync(t queue.Task, autoRun bool) {
 	})
 	s.refreshAndBroadcast()
 
-	env := filterEnvWeb(os.Environ(), "CLAUDECODE")
-	gitName := engine.GenerateName()
-	gitEmail := engine.GenerateEmail(gitName)
-	env = append(env,
-		"GIT_AUTHOR_NAME="+gitName,
-		"GIT_AUTHOR_EMAIL="+gitEmail,
-		"GIT_COMMITTER_NAME="+gitName,
-		"GIT_COMMITTER_EMAIL="+gitEmail,
-	)
 	// Resolve meta-model for plan generation phase
 	planCfg := s.cfg
 	planCfg.Spawn.MaxTurns = s.cfg.Spawn.PlanMaxTurns
@@ -628,17 +1256,6 @@ func (s *Server) generatePlanAsync(t queue.Task, autoRun bool) {
 	// No MCPs for plan gen — skeleton prompt already references MCP steps from full config.
 	// npx MCP startup adds minutes of overhead on this server.
 	planCfg.MCPServers = nil
-	args, spawnCleanup := engine.BuildSpawnArgs(planCfg, prompt, nil, "")
-	if spawnCleanup != nil {
-		defer spawnCleanup()
-	}
-	// Plan generation runs in plan mode — read-only, no edits.
-	// Disallow tools that cause Claude to "execute" instead of just planning.
-	args = append(args, "--permission-mode", "plan",
-		"--disallowedTools",
-		"ExitPlanMode,EnterPlanMode,TodoWrite,Skill,Task,NotebookEdit,AskUserQuestion",
-	)
-	// Note: --verbose is required by stream-json output format — do NOT strip it.
 	// Apply plan-specific timeout (defaults to 15 min — plan gen needs more time than step execution)
 	planTimeout := time.Duration(s.cfg.Spawn.PlanTimeoutMin) * time.Minute
 	if planTimeout <= 0 {
@@ -646,26 +1263,11 @@ func (s *Server) generatePlanAsync(t queue.Task, autoRun bool) {
 	}
 	planCtx, planCancel := context.WithTimeout(context.Background(), planTimeout)
 	defer planCancel()
-	// Store cancel func so Stop/Replan/Done/Archive can kill the Claude process
+	// Store cancel func so Stop/Replan/Done/Archive can kill the agent
 	s.setGenerating(t.ID, planCancel)
 
-	cmd := exec.CommandContext(planCtx, "claude", args...)
-	cmd.Env = env
-
-	// Stream plan generation — full console output to task logs
-	stdout, err := cmd.StdoutPipe()
+	rt, err := engine.RuntimeFor(s.cfg)
 	if err != nil {
-		s.store.logBuf.Add(logs.LogEntry{
-			Time: time.Now(), TaskID: t.ID, Project: t.Project,
-			Message: "Plan generation pipe error: " + err.Error(), Level: logs.LevelError,
-		})
-		s.clearGenerating(t.ID)
-		s.refreshAndBroadcast()
-		return
-	}
-	cmd.Stderr = io.Discard
-
-	if err := cmd.Start(); err != nil {
 		s.store.logBuf.Add(logs.LogEntry{
 			Time: time.Now(), TaskID: t.ID, Project: t.Project,
 			Message: "Plan generation start error: " + err.Error(), Level: logs.LevelError,
@@ -674,6 +1276,14 @@ func (s *Server) generatePlanAsync(t queue.Task, autoRun bool) {
 		s.refreshAndBroadcast()
 		return
 	}
+	req := engine.AgentRequest{
+		// Plan generation runs in plan mode — read-only, no edits.
+		// Disallow tools that cause Claude to "execute" instead of just planning.
+		DisallowedTools: []string{"ExitPlanMode", "EnterPlanMode", "TodoWrite", "Skill", "Task", "NotebookEdit", "AskUserQuestion"},
+		ExtraArgs:       []string{"--permission-mode", "plan"},
+		Env:             engine.GitIdentityEnv(),
+		Config:          planCfg,
+	}
 
 	planStart := time.Now()
 
@@ -685,80 +1295,82 @@ func (s *Server) generatePlanAsync(t queue.Task, autoRun bool) {
 		s.scheduleRefresh()
 	}
 
-	scanner := bufio.NewScanner(stdout)
-	scanner.Buffer(make([]byte, 256*1024), 256*1024)
-
-	var planResult string
-	var planText strings.Builder
-	var sessionID string
-	planCaptured := false
-	for scanner.Scan() {
-		line := scanner.Text()
-		var evt engine.StreamEvent
-		if json.Unmarshal([]byte(line), &evt) != nil {
-			continue
-		}
-
-		// Capture session_id from first event that has it
-		if evt.SessionID != "" && sessionID == "" {
-			sessionID = evt.SessionID
-		}
-
-		// Format and send to web UI as console output
-		if formatted := engine.FormatStreamEvent(evt); formatted != "" {
-			level := logs.LevelInfo
-			if evt.Type == "error" {
-				level = logs.LevelError
+	turn := func(prompt, sessionID string) (string, string, error) {
+		req.Prompt, req.SessionID = prompt, sessionID
+		sess, err := rt.Start(planCtx, req)
+		if err != nil {
+			return "", "", fmt.Errorf("start error: %w", err)
+		}
+		var planResult string
+		var planText strings.Builder
+		planCaptured := false
+		for evt := range sess.Events() {
+			// Format and send to web UI as console output
+			if formatted := engine.FormatStreamEvent(evt); formatted != "" {
+				level := logs.LevelInfo
+				if evt.Type == "error" {
+					level = logs.LevelError
+				}
+				addLog(formatted, level)
 			}
-			addLog(formatted, level)
-		}
 
-		// Capture plan text from assistant text events
-		if evt.Type == "assistant" && evt.Message != nil {
-			for _, c := range evt.Message.Content {
-				if c.Type == "text" && len(c.Text) > 0 {
-					planText.WriteString(c.Text)
-					txt := planText.String()
-					if strings.Contains(txt, "# Plan:") && strings.Contains(txt, "## Steps") && strings.Contains(txt, "## Constraints") {
-						planResult = txt
-						planCaptured = true
+			// Capture plan text from assistant text events
+			if evt.Type == "assistant" && evt.Message != nil {
+				for _, c := range evt.Message.Content {
+					if c.Type == "text" && len(c.Text) > 0 {
+						planText.WriteString(c.Text)
+						txt := planText.String()
+						if strings.Contains(txt, "# Plan:") && strings.Contains(txt, "## Steps") && strings.Contains(txt, "## Constraints") {
+							planResult = txt
+							planCaptured = true
+						}
 					}
 				}
+				if planCaptured {
+					sess.Cancel()
+					break
+				}
 			}
-			if planCaptured {
-				cmd.Process.Kill()
-				break
+			if evt.Type == "result" && !planCaptured {
+				planResult = evt.Result
 			}
 		}
-		if evt.Type == "result" && !planCaptured {
-			planResult = evt.Result
+		res, _ := sess.Wait()
+		engine.RecordSpend(metrics.SpendRecord{Kind: metrics.SpendPlan, TaskID: t.ID, Project: t.Project}, res, planCfg.Spawn.Model)
+		if planCtx.Err() == context.DeadlineExceeded {
+			return "", "", fmt.Errorf("timed out after %v", planTimeout)
 		}
+		if planResult == "" {
+			return "", "", fmt.Errorf("empty result")
+		}
+		return planResult, res.SessionID, nil
+	}
+
+	planResult, sessionID, err := turn(prompt, "")
+	if err == nil {
+		planResult, _, err = plangen.ValidateAndRepair(planResult, sessionID, prompt, sk, turn, func(msg string) {
+			addLog(msg, logs.LevelWarn)
+		})
 	}
-	cmd.Wait()
 
 	elapsed := time.Since(planStart).Round(time.Second)
 	addLog(fmt.Sprintf("Plan generation finished (%s)", elapsed), logs.LevelInfo)
 
-	if planCtx.Err() == context.DeadlineExceeded {
+	if err != nil {
 		s.store.logBuf.Add(logs.LogEntry{
 			Time: time.Now(), TaskID: t.ID, Project: t.Project,
-			Message: fmt.Sprintf("Plan generation timed out after %v", planTimeout), Level: logs.LevelError,
+			Message: "Plan generation failed: " + err.Error(), Level: logs.LevelError,
 		})
 		s.clearGenerating(t.ID)
 		s.refreshAndBroadcast()
 		return
 	}
-
-	if planResult == "" {
-		s.store.logBuf.Add(logs.LogEntry{
-			Time: time.Now(), TaskID: t.ID, Project: t.Project,
-			Message: "Plan generation returned empty result", Level: logs.LevelError,
-		})
+	if _, err := plan.SavePlanRevision(t.ID, planResult, plangen.RevisionMeta(t, planCfg.Spawn.Model)); err != nil {
+		addLog("Saving plan failed: "+err.Error(), logs.LevelError)
 		s.clearGenerating(t.ID)
 		s.refreshAndBroadcast()
 		return
 	}
-	plan.SavePlan(t.ID, planResult)
 	queue.SetPlanFile(t.ID, plan.PlanPath(t.ID))
 	queue.UpdateState(t.ID, queue.StatePlanned)
 	s.store.logBuf.Add(logs.LogEntry{
@@ -768,6 +1380,13 @@ func (s *Server) generatePlanAsync(t queue.Task, autoRun bool) {
 	s.clearGenerating(t.ID)
 	s.refreshAndBroadcast()
 
+	if autoRun && engine.RequiresApproval(s.cfg, t) {
+		queue.UpdateState(t.ID, queue.StateAwaitingApproval)
+		queue.NotifyEvent(engine.EventPlanAwaitingApproval, t, nil)
+		addLog("Plan awaiting approval", logs.LevelInfo)
+		s.refreshAndBroadcast()
+		return
+	}
 	if autoRun {
 		// Don't auto-run if another task in the same project is already running
 		if s.store.engineMgr.IsTaskRunningForProject(t.Project) {
@@ -895,14 +1514,25 @@ func (s *Server) handleProjectAutopilotStart(w http.ResponseWriter, r *http.Requ
 		writeErr(w, 400, "project required")
 		return
 	}
+	if !s.startProjectAutopilot(req.Project, actorOf(r)) {
+		writeErr(w, 409, "autopilot already running or max_concurrent reached")
+		return
+	}
+	writeJSON(w, map[string]bool{"ok": true})
+}
 
+// startProjectAutopilot turns autopilot on for the open tasks of project
+// and starts its loop. It reports false when the loop is already running
+// or max_concurrent is reached.
+func (s *Server) startProjectAutopilot(project, actor string) bool {
 	// Enable autopilot on all pending/planned tasks for this project
 	if allTasks, err := queue.ListAll(); err == nil {
 		for _, t := range allTasks {
-			if t.Project == req.Project && !t.AutoPilot && !t.Done {
+			if t.Project == project && !t.AutoPilot && !t.Done {
 				s := queue.EffectiveState(t)
 				if s == queue.StatePending || s == queue.StatePlanned {
-					queue.ToggleAutoPilot(t.ID)
+					queue.SetAutoPilot(t.ID, true)
+					queue.RecordAction(t.ID, actor, "autopilot on")
 				}
 			}
 		}
@@ -914,15 +1544,13 @@ func (s *Server) handleProjectAutopilotStart(w http.ResponseWriter, r *http.Requ
 	}
 	send := s.webSend(0)
 
-	ok := s.store.engineMgr.StartProject(req.Project, cfg.MaxConcurrent, func(ctx context.Context) {
-		engine.RunProjectLoop(ctx, req.Project, cfg, planFn, send, s.store.engineMgr)
+	ok := s.store.engineMgr.StartProject(project, cfg.MaxConcurrent, func(ctx context.Context) {
+		engine.RunProjectLoop(ctx, project, cfg, planFn, send, s.store.engineMgr)
 	})
-	if !ok {
-		writeErr(w, 409, "autopilot already running or max_concurrent reached")
-		return
+	if ok {
+		s.refreshAndBroadcast()
 	}
-	s.refreshAndBroadcast()
-	writeJSON(w, map[string]bool{"ok": true})
+	return ok
 }
 
 func (s *Server) handleProjectAutopilotStop(w http.ResponseWriter, r *http.Request) {
@@ -1003,17 +1631,6 @@ func (s *Server) handleProjectSkeleton(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func filterEnvWeb(env []string, key string) []string {
-	prefix := key + "="
-	result := make([]string, 0, len(env))
-	for _, e := range env {
-		if !strings.HasPrefix(e, prefix) {
-			result = append(result, e)
-		}
-	}
-	return result
-}
-
 // --- Chat handlers ---
 
 func (s *Server) handleChatHistory(w http.ResponseWriter, r *http.Request) {
@@ -1141,14 +1758,19 @@ func (s *Server) handleChatSend(w http.ResponseWriter, r *http.Request) {
 	promptBuf.WriteString("  \"acceptance\": \"VERIFICATION — numbered test steps with specific commands and expected outputs\",\n")
 	promptBuf.WriteString("  \"priority\": \"high|med|low\",\n")
 	promptBuf.WriteString("  \"assignee\": \"agent|human|system\",\n")
-	promptBuf.WriteString("  \"wave\": 1\n")
+	promptBuf.WriteString("  \"key\": \"short-unique-id\",\n")
+	promptBuf.WriteString("  \"depends_on\": [\"keys of tasks that must finish first\"]\n")
 	promptBuf.WriteString("}[/TASK_CREATE]\n\n")
-	promptBuf.WriteString("## Wave Execution (Parallel Task Groups)\n\n")
-	promptBuf.WriteString("Assign a \"wave\" number (1, 2, 3...) to each task for parallel execution.\n")
-	promptBuf.WriteString("Tasks in the SAME wave run IN PARALLEL — they MUST be fully independent (no shared files, no dependencies between them).\n")
-	promptBuf.WriteString("Wave 1 = foundation (init, setup, CLAUDE.md). Each subsequent wave depends on ALL previous waves completing first.\n")
-	promptBuf.WriteString("Group independent tasks in the same wave number. Sequential dependencies = different wave numbers.\n")
-	promptBuf.WriteString("Example: wave 1 = project init, wave 2 = independent components A/B/C, wave 3 = integration that needs A+B+C.\n\n")
+	promptBuf.WriteString("## Task Dependencies (Parallel Execution)\n\n")
+	promptBuf.WriteString("Give each task a short \"key\" and list in \"depends_on\" the keys of the tasks it needs.\n")
+	promptBuf.WriteString("A task starts as soon as ALL of its dependencies are done. Tasks with no pending dependencies run IN PARALLEL,\n")
+	promptBuf.WriteString("so only leave two tasks unrelated if they are fully independent (no shared files).\n")
+	promptBuf.WriteString("Never create circular dependencies. Only reference keys of tasks created in the same response.\n")
+	promptBuf.WriteString("Example: \"init\" has no dependencies, \"api\" and \"ui\" depend on [\"init\"], \"e2e\" depends on [\"api\", \"ui\"].\n\n")
+	promptBuf.WriteString("## Epics\n\n")
+	promptBuf.WriteString("When one request breaks down into several tasks, group them under an epic: emit one directive with \"epic\": true\n")
+	promptBuf.WriteString("describing the overall request, and give each subtask \"parent\": \"<the epic's key>\". The epic is never run itself;\n")
+	promptBuf.WriteString("it tracks its subtasks' progress and is done when they all are. Subtasks still use depends_on among themselves.\n\n")
 	promptBuf.WriteString("ALL FIELDS ARE MANDATORY. description+goal+context+acceptance are concatenated into the\n")
 	promptBuf.WriteString("Claude Code autopilot prompt. Empty fields = the agent works BLIND with no context.\n")
 	promptBuf.WriteString("Each directive creates one task. You can include multiple directives.\n")
@@ -1228,7 +1850,8 @@ func (s *Server) handleChatSend(w http.ResponseWriter, r *http.Request) {
 	promptBuf.WriteString("  \"acceptance\": \"(1) Register user via curl POST /api/auth/register with email+password, (2) login and verify JWT returned, (3) access protected route with Bearer token, (4) verify 401 on expired token, (5) verify refresh endpoint returns new token pair, (6) verify rate limit blocks after 5 failed logins\",\n")
 	promptBuf.WriteString("  \"priority\": \"high\",\n")
 	promptBuf.WriteString("  \"assignee\": \"agent\",\n")
-	promptBuf.WriteString("  \"wave\": 2\n")
+	promptBuf.WriteString("  \"key\": \"auth\",\n")
+	promptBuf.WriteString("  \"depends_on\": [\"init\"]\n")
 	promptBuf.WriteString("}[/TASK_CREATE]\n\n")
 	promptBuf.WriteString("EXAMPLE OF A BAD TASK (THE AGENT WILL FAIL WITH THIS):\n")
 	promptBuf.WriteString("[TASK_CREATE]{\"description\":\"Set up the backend\",\"priority\":\"high\",\"assignee\":\"agent\"}[/TASK_CREATE]\n")
@@ -1328,15 +1951,7 @@ func (s *Server) handleChatSend(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	env := filterEnvWeb(os.Environ(), "CLAUDECODE")
-	chatGitName := engine.GenerateName()
-	chatGitEmail := engine.GenerateEmail(chatGitName)
-	env = append(env,
-		"GIT_AUTHOR_NAME="+chatGitName,
-		"GIT_AUTHOR_EMAIL="+chatGitEmail,
-		"GIT_COMMITTER_NAME="+chatGitName,
-		"GIT_COMMITTER_EMAIL="+chatGitEmail,
-	)
+	env := engine.GitIdentityEnv()
 	env = append(env, "CLAUDE_CODE_MAX_OUTPUT_TOKENS=128000")
 	if s.cfg.SudoEnabled {
 		env = append(env, "TEAMOON_SUDO_ENABLED=true")
@@ -1348,50 +1963,38 @@ func (s *Server) handleChatSend(w http.ResponseWriter, r *http.Request) {
 	if chatCfg.MCPServers == nil {
 		config.InitMCPFromGlobal(&chatCfg)
 	}
-	chatArgs, chatCleanup := engine.BuildSpawnArgs(chatCfg, promptBuf.String(), nil, "")
-	if chatCleanup != nil {
-		defer chatCleanup()
+	chatReq := engine.AgentRequest{
+		Prompt: promptBuf.String(),
+		Dir:    projectPath,
+		Env:    env,
+		Config: chatCfg,
+		// Chat-specific: stream partial messages in real-time.
+		ExtraArgs: []string{"--include-partial-messages"},
 	}
-	// Chat-specific: stream partial messages in real-time.
-	// For normal chat (not system mode), disable hooks via empty setting-sources.
-	// System mode keeps hooks because they enforce sudo blocking.
-	chatArgs = append(chatArgs, "--include-partial-messages")
 	// Chat plans tasks — it must NOT execute code directly.
 	// System mode (/system) keeps full access for admin operations.
+	// For normal chat (not system mode), disable hooks via empty setting-sources.
+	// System mode keeps hooks because they enforce sudo blocking.
 	if !isSystemMode {
-		chatArgs = append(chatArgs, "--disallowedTools",
-			"Write,Edit,NotebookEdit,Bash,Agent,Task,TodoWrite,EnterPlanMode,ExitPlanMode,AskUserQuestion,Skill")
+		chatReq.DisallowedTools = []string{"Write", "Edit", "NotebookEdit", "Bash", "Agent", "Task", "TodoWrite", "EnterPlanMode", "ExitPlanMode", "AskUserQuestion", "Skill"}
 		// Disable hooks in non-system chat to prevent turn waste
 		// (hooks fire and model responds "ack"/"Done", eating max-turns budget)
-		chatArgs = append(chatArgs, "--setting-sources", "")
+		chatReq.ExtraArgs = append(chatReq.ExtraArgs, "--setting-sources", "")
 	}
 	// Ensure .bmad symlink for party-mode
 	projectinit.EnsureBMADLink(projectPath)
 
-	cmd := exec.Command("claude", chatArgs...)
-	cmd.Env = env
-	cmd.Dir = projectPath
-
-	devNull, _ := os.Open(os.DevNull)
-	if devNull != nil {
-		cmd.Stdin = devNull
-		defer devNull.Close()
+	rt, err := engine.RuntimeFor(s.cfg)
+	var sess engine.AgentSession
+	if err == nil {
+		sess, err = rt.Start(context.Background(), chatReq)
 	}
-
-	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		writeErr(w, 500, err.Error())
-		return
-	}
-	var stderrBuf strings.Builder
-	cmd.Stderr = &stderrBuf
-
-	if err := cmd.Start(); err != nil {
 		// Send SSE-formatted error so the frontend stream pump can handle it
 		w.Header().Set("Content-Type", "text/event-stream")
 		w.Header().Set("Cache-Control", "no-cache")
 		if f, ok := w.(http.Flusher); ok {
-			errData, _ := json.Marshal(map[string]any{"error": "Failed to start claude: " + err.Error()})
+			errData, _ := json.Marshal(map[string]any{"error": "Failed to start agent: " + err.Error()})
 			fmt.Fprintf(w, "data: %s\n\n", errData)
 			doneData, _ := json.Marshal(map[string]any{"done": true})
 			fmt.Fprintf(w, "data: %s\n\n", doneData)
@@ -1406,41 +2009,21 @@ func (s *Server) handleChatSend(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Connection", "keep-alive")
 	flusher, ok := w.(http.Flusher)
 	if !ok {
+		sess.Cancel()
+		sess.Wait()
 		writeErr(w, 500, "streaming not supported")
 		return
 	}
 
 	var fullResponse strings.Builder
-	scanner := bufio.NewScanner(stdout)
-	scanner.Buffer(make([]byte, 256*1024), 256*1024)
-
-	type streamEvt struct {
-		Type    string `json:"type"`
-		Message *struct {
-			Content []struct {
-				Type  string         `json:"type"`
-				Text  string         `json:"text,omitempty"`
-				Name  string         `json:"name,omitempty"`
-				Input map[string]any `json:"input,omitempty"`
-			} `json:"content"`
-		} `json:"message,omitempty"`
-		Result       string  `json:"result,omitempty"`
-		NumTurns     int     `json:"num_turns,omitempty"`
-		TotalCostUsd float64 `json:"total_cost_usd,omitempty"`
-	}
 
 	var displayResult string
 	var inDirective bool // suppress streaming while inside [TASK_CREATE]...[/TASK_CREATE] etc.
 	jobsSeen := make(map[string]bool) // dedup inline JOB_CREATE parsing
 	inlineJobRe := regexp.MustCompile(`(?s)\[JOB_CREATE\](.*?)\[/JOB_CREATE\]`)
-	for scanner.Scan() {
-		line := scanner.Text()
+	for evt := range sess.Events() {
 		if s.cfg.Debug {
-			log.Printf("[debug][chat] raw: %s", line)
-		}
-		var evt streamEvt
-		if err := json.Unmarshal([]byte(line), &evt); err != nil {
-			continue
+			log.Printf("[debug][chat] raw: %s", evt.Raw)
 		}
 		switch evt.Type {
 		case "assistant":
@@ -1520,7 +2103,7 @@ func (s *Server) handleChatSend(w http.ResponseWriter, r *http.Request) {
 					doneData, _ := json.Marshal(map[string]any{"done": true})
 					fmt.Fprintf(w, "data: %s\n\n", doneData)
 					flusher.Flush()
-					cmd.Process.Kill()
+					sess.Cancel()
 					displayResult = " "
 				}
 			}
@@ -1536,7 +2119,7 @@ func (s *Server) handleChatSend(w http.ResponseWriter, r *http.Request) {
 				"done":      true,
 				"result":    evt.Result,
 				"num_turns": evt.NumTurns,
-				"cost_usd":  evt.TotalCostUsd,
+				"cost_usd":  evt.TotalCostUSD,
 			})
 			fmt.Fprintf(w, "data: %s\n\n", doneData)
 			flusher.Flush()
@@ -1549,11 +2132,12 @@ func (s *Server) handleChatSend(w http.ResponseWriter, r *http.Request) {
 
 	// Wait for process exit in background — don't block directive parsing
 	go func() {
-		if waitErr := cmd.Wait(); waitErr != nil {
-			errMsg := stderrBuf.String()
-			log.Printf("[chat] claude exited with error: %v", waitErr)
-			if errMsg != "" {
-				log.Printf("[chat] claude stderr: %s", errMsg)
+		res, waitErr := sess.Wait()
+		engine.RecordSpend(metrics.SpendRecord{Kind: metrics.SpendChat, Project: req.Project}, res, chatCfg.Spawn.Model)
+		if waitErr != nil || res.ExitCode != 0 {
+			log.Printf("[chat] agent exited with error: %v (exit %d)", waitErr, res.ExitCode)
+			if res.Stderr != "" {
+				log.Printf("[chat] agent stderr: %s", res.Stderr)
 			}
 		}
 	}()
@@ -1635,14 +2219,22 @@ func (s *Server) handleChatSend(w http.ResponseWriter, r *http.Request) {
 
 	if len(matches) > 0 && req.Project != "" {
 		type taskDirective struct {
-			Description string `json:"description"`
-			Priority    string `json:"priority"`
-			Assignee    string `json:"assignee"`
-			Goal        string `json:"goal"`
-			Context     string `json:"context"`
-			Acceptance  string `json:"acceptance"`
-			Wave        int    `json:"wave"`
-		}
+			Description string   `json:"description"`
+			Priority    string   `json:"priority"`
+			Assignee    string   `json:"assignee"`
+			Goal        string   `json:"goal"`
+			Context     string   `json:"context"`
+			Acceptance  string   `json:"acceptance"`
+			Wave        int      `json:"wave"`
+			Key         string   `json:"key"`
+			DependsOn   []string `json:"depends_on"`
+			Labels      []string `json:"labels"`
+			Epic        bool     `json:"epic"`
+			Parent      string   `json:"parent"`
+		}
+		keyIDs := make(map[string]int)
+		pendingDeps := make(map[int][]string)
+		pendingParents := make(map[int]string)
 		for i, m := range matches {
 			if len(m) < 2 {
 				continue
@@ -1679,12 +2271,26 @@ func (s *Server) handleChatSend(w http.ResponseWriter, r *http.Request) {
 				log.Printf("[chat] [TASK_CREATE][%d] queue.Add error: %v", i, err)
 				continue
 			}
+			queue.RecordAction(t.ID, queue.ActorChat, "created")
+			if len(td.Labels) > 0 {
+				queue.SetLabels(t.ID, td.Labels)
+			}
 			if td.Wave > 0 {
 				queue.UpdateWave(t.ID, td.Wave)
 			}
+			if td.Key != "" {
+				keyIDs[td.Key] = t.ID
+			}
+			if len(td.DependsOn) > 0 {
+				pendingDeps[t.ID] = td.DependsOn
+			}
+			if td.Parent != "" {
+				pendingParents[t.ID] = td.Parent
+			}
 			queue.UpdateAssignee(t.ID, td.Assignee)
-			if td.Assignee == "agent" || td.Assignee == "system" {
-				queue.ToggleAutoPilot(t.ID)
+			// Epics only group their subtasks; autopilot runs the children.
+			if !td.Epic && (td.Assignee == "agent" || td.Assignee == "system") {
+				queue.SetAutoPilot(t.ID, true)
 			}
 			if td.Assignee == "system" {
 				s.startSystemLoop()
@@ -1695,9 +2301,37 @@ func (s *Server) handleChatSend(w http.ResponseWriter, r *http.Request) {
 				"priority":    td.Priority,
 				"assignee":    td.Assignee,
 				"wave":        td.Wave,
+				"epic":        td.Epic,
 			})
 		}
 
+		// Link subtasks to their epics the same way.
+		for id, key := range pendingParents {
+			parentID, ok := keyIDs[key]
+			if !ok {
+				log.Printf("[chat] task #%d has unknown parent key %q", id, key)
+				continue
+			}
+			if _, err := queue.SetParent(id, parentID); err != nil {
+				log.Printf("[chat] task #%d parent: %v", id, err)
+			}
+		}
+
+		// Resolve dependency keys once every task in the batch has an ID.
+		for id, keys := range pendingDeps {
+			var deps []int
+			for _, k := range keys {
+				if depID, ok := keyIDs[k]; ok {
+					deps = append(deps, depID)
+				} else {
+					log.Printf("[chat] task #%d depends on unknown key %q", id, k)
+				}
+			}
+			if err := queue.SetDependencies(id, deps); err != nil {
+				log.Printf("[chat] task #%d dependencies: %v", id, err)
+			}
+		}
+
 		log.Printf("[chat] directive result: %d task(s) created out of %d found, project=%q",
 			len(createdTasks), len(matches), req.Project)
 
@@ -1916,12 +2550,14 @@ func (s *Server) handleConfigGet(w http.ResponseWriter, r *http.Request) {
 		"web_host":            cfg.WebHost,
 		"web_password":        pw,
 		"webhook_url":         cfg.WebhookURL,
+		"webhooks":            maskWebhooks(cfg.Webhooks),
 		"spawn_model":         cfg.Spawn.Model,
 		"spawn_effort":        cfg.Spawn.Effort,
 		"spawn_max_turns":          cfg.Spawn.MaxTurns,
 		"spawn_step_timeout_min":   cfg.Spawn.StepTimeoutMin,
 		"spawn_plan_max_turns":     cfg.Spawn.PlanMaxTurns,
 		"spawn_max_plan_attempts":  cfg.Spawn.MaxPlanAttempts,
+		"spawn_retry":              retryPolicies(cfg),
 		"skeleton":            cfg.Skeleton,
 		"max_concurrent":      cfg.MaxConcurrent,
 		"autopilot_autostart": cfg.AutopilotAutostart,
@@ -1929,9 +2565,22 @@ func (s *Server) handleConfigGet(w http.ResponseWriter, r *http.Request) {
 		"source_dir":          cfg.SourceDir,
 		"mcp_servers":         cfg.MCPServers,
 		"sudo_enabled":        cfg.SudoEnabled,
+		"budget":              cfg.Budget,
+		"usage":               cfg.Usage,
+		"approval":            cfg.Approval,
+		"checkpoints":         cfg.Checkpoints,
 	})
 }
 
+// retryPolicies is the effective retry policy of every failure class.
+func retryPolicies(cfg config.Config) map[string]config.RetryPolicy {
+	out := config.DefaultRetryPolicies()
+	for class := range out {
+		out[class] = config.RetryPolicyFor(cfg, class)
+	}
+	return out
+}
+
 func (s *Server) handleConfigSave(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeErr(w, 405, "method not allowed")
@@ -1947,16 +2596,22 @@ func (s *Server) handleConfigSave(w http.ResponseWriter, r *http.Request) {
 		WebHost            string                `json:"web_host"`
 		WebPassword        string                `json:"web_password"`
 		WebhookURL         string                `json:"webhook_url"`
+		Webhooks           *config.WebhookConfig `json:"webhooks,omitempty"`
 		SpawnModel         *string               `json:"spawn_model,omitempty"`
 		SpawnEffort        *string               `json:"spawn_effort,omitempty"`
 		SpawnMaxTurns       *int                 `json:"spawn_max_turns,omitempty"`
 		SpawnStepTimeoutMin *int                 `json:"spawn_step_timeout_min,omitempty"`
 		SpawnPlanMaxTurns   *int                 `json:"spawn_plan_max_turns,omitempty"`
 		SpawnMaxPlanAttempts *int                `json:"spawn_max_plan_attempts,omitempty"`
+		SpawnRetry           map[string]config.RetryPolicy `json:"spawn_retry,omitempty"`
 		Skeleton           *config.SkeletonConfig `json:"skeleton,omitempty"`
 		MaxConcurrent      *int                   `json:"max_concurrent,omitempty"`
 		AutopilotAutostart *bool                  `json:"autopilot_autostart,omitempty"`
 		SudoEnabled        *bool                  `json:"sudo_enabled,omitempty"`
+		Budget             *config.BudgetConfig   `json:"budget,omitempty"`
+		Usage              *config.UsageConfig    `json:"usage,omitempty"`
+		Approval           *config.ApprovalConfig `json:"approval,omitempty"`
+		Checkpoints        *config.CheckpointConfig `json:"checkpoints,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeErr(w, 400, err.Error())
@@ -2022,6 +2677,15 @@ func (s *Server) handleConfigSave(w http.ResponseWriter, r *http.Request) {
 	if req.SpawnMaxPlanAttempts != nil && *req.SpawnMaxPlanAttempts >= 0 {
 		cfg.Spawn.MaxPlanAttempts = *req.SpawnMaxPlanAttempts
 	}
+	if req.SpawnRetry != nil {
+		defaults := config.DefaultRetryPolicies()
+		cfg.Spawn.Retry = make(map[string]config.RetryPolicy)
+		for class, p := range req.SpawnRetry {
+			if _, ok := defaults[class]; ok && p.MaxAttempts > 0 && p.BackoffSec >= 0 && p != defaults[class] {
+				cfg.Spawn.Retry[class] = p
+			}
+		}
+	}
 	if req.Skeleton != nil {
 		cfg.Skeleton = *req.Skeleton
 	}
@@ -2034,12 +2698,154 @@ func (s *Server) handleConfigSave(w http.ResponseWriter, r *http.Request) {
 	if req.SudoEnabled != nil {
 		cfg.SudoEnabled = *req.SudoEnabled
 	}
+	if req.Budget != nil {
+		cfg.Budget = *req.Budget
+	}
+	if req.Usage != nil {
+		cfg.Usage = *req.Usage
+	}
+	if req.Approval != nil {
+		cfg.Approval = *req.Approval
+	}
+	if req.Checkpoints != nil {
+		cfg.Checkpoints = *req.Checkpoints
+	}
+	if req.Webhooks != nil {
+		wh, err := mergeWebhooks(cfg.Webhooks, *req.Webhooks)
+		if err != nil {
+			writeErr(w, 400, err.Error())
+			return
+		}
+		cfg.Webhooks = wh
+	}
 
 	if err := config.Save(cfg); err != nil {
 		writeErr(w, 500, err.Error())
 		return
 	}
 	s.cfg = cfg
+	webhook.Configure(cfg)
+	writeJSON(w, map[string]bool{"ok": true})
+}
+
+// maskWebhooks hides endpoint secrets and tokens from the config response.
+func maskWebhooks(wh config.WebhookConfig) config.WebhookConfig {
+	wh.Endpoints = maskEndpoints(wh.Endpoints)
+	return wh
+}
+
+func maskEndpoints(in []config.WebhookEndpoint) []config.WebhookEndpoint {
+	eps := make([]config.WebhookEndpoint, len(in))
+	for i, ep := range in {
+		if ep.Secret != "" {
+			ep.Secret = "***"
+		}
+		if ep.Token != "" {
+			ep.Token = "***"
+		}
+		eps[i] = ep
+	}
+	return eps
+}
+
+// mergeWebhooks validates the submitted endpoints and keeps the stored
+// secret and token of any endpoint sent back masked.
+func mergeWebhooks(old, req config.WebhookConfig) (config.WebhookConfig, error) {
+	stored := make(map[string]config.WebhookEndpoint, len(old.Endpoints))
+	for _, ep := range old.Endpoints {
+		stored[ep.Name] = ep
+	}
+	seen := make(map[string]bool, len(req.Endpoints))
+	for i, ep := range req.Endpoints {
+		ep.Name = strings.TrimSpace(ep.Name)
+		if ep.Name == "" || seen[ep.Name] {
+			return req, fmt.Errorf("webhook endpoint names must be unique and non-empty")
+		}
+		seen[ep.Name] = true
+		if u, err := url.Parse(ep.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return req, fmt.Errorf("webhook %s: invalid url", ep.Name)
+		}
+		switch ep.Format {
+		case "", config.WebhookFormatJSON, config.WebhookFormatSlack, config.WebhookFormatDiscord, config.WebhookFormatMatrix, config.WebhookFormatNtfy:
+		default:
+			return req, fmt.Errorf("webhook %s: unknown format %q", ep.Name, ep.Format)
+		}
+		if ep.Secret == "***" {
+			ep.Secret = stored[ep.Name].Secret
+		}
+		if ep.Token == "***" {
+			ep.Token = stored[ep.Name].Token
+		}
+		req.Endpoints[i] = ep
+	}
+	return req, nil
+}
+
+// --- Webhook handlers ---
+
+// handleWebhooks lists the endpoints (secrets masked) with their queued deliveries.
+func (s *Server) handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErr(w, 405, "method not allowed")
+		return
+	}
+	pending, err := webhook.Pending()
+	if err != nil {
+		writeErr(w, 500, err.Error())
+		return
+	}
+	if pending == nil {
+		pending = []webhook.Delivery{}
+	}
+	eps := maskEndpoints(config.WebhookEndpoints(s.cfg))
+	writeJSON(w, map[string]any{"endpoints": eps, "pending": pending})
+}
+
+// handleWebhookDeliveries returns the delivery log, newest first, filtered
+// by ?endpoint=, ?event= and ?limit= (default 100).
+func (s *Server) handleWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErr(w, 405, "method not allowed")
+		return
+	}
+	q := r.URL.Query()
+	limit := 100
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			writeErr(w, 400, "invalid limit")
+			return
+		}
+		limit = n
+	}
+	entries, err := webhook.Log(q.Get("endpoint"), q.Get("event"), limit)
+	if err != nil {
+		writeErr(w, 500, err.Error())
+		return
+	}
+	if entries == nil {
+		entries = []webhook.Attempt{}
+	}
+	writeJSON(w, entries)
+}
+
+// handleWebhookTest queues a ping for one endpoint.
+func (s *Server) handleWebhookTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErr(w, 405, "method not allowed")
+		return
+	}
+	var req struct {
+		Endpoint string `json:"endpoint"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, 400, err.Error())
+		return
+	}
+	if err := webhook.Ping(req.Endpoint); err != nil {
+		writeErr(w, 404, err.Error())
+		return
+	}
 	writeJSON(w, map[string]bool{"ok": true})
 }
 
@@ -2078,6 +2884,7 @@ func (s *Server) handleTaskUpdate(w http.ResponseWriter, r *http.Request) {
 		writeErr(w, 500, err.Error())
 		return
 	}
+	queue.RecordAction(req.ID, actorOf(r), "description edited")
 	s.refreshAndBroadcast()
 	writeJSON(w, map[string]bool{"ok": true})
 }
@@ -2101,6 +2908,29 @@ func (s *Server) handleTaskAssignee(w http.ResponseWriter, r *http.Request) {
 		writeErr(w, 500, err.Error())
 		return
 	}
+	queue.RecordAction(req.ID, actorOf(r), "assignee "+req.Assignee)
+	s.refreshAndBroadcast()
+	writeJSON(w, map[string]bool{"ok": true})
+}
+
+func (s *Server) handleTaskDepends(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErr(w, 405, "method not allowed")
+		return
+	}
+	var req struct {
+		ID        int   `json:"id"`
+		DependsOn []int `json:"depends_on"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, 400, err.Error())
+		return
+	}
+	if err := queue.SetDependencies(req.ID, req.DependsOn); err != nil {
+		writeErr(w, 400, err.Error())
+		return
+	}
+	queue.RecordAction(req.ID, actorOf(r), fmt.Sprintf("dependencies %v", req.DependsOn))
 	s.refreshAndBroadcast()
 	writeJSON(w, map[string]bool{"ok": true})
 }
@@ -3087,13 +3917,18 @@ func (s *Server) handleJobRun(w http.ResponseWriter, r *http.Request) {
 		writeErr(w, 409, "job already running")
 		return
 	}
+	s.runJobNow(job)
+	writeJSON(w, map[string]any{"ok": true})
+}
+
+// runJobNow runs job in the background, outside its schedule.
+func (s *Server) runJobNow(job jobs.Job) {
 	cfg := s.cfg
 	go func() {
 		jobs.RunJob(context.Background(), job, cfg)
 		s.refreshAndBroadcast()
 	}()
 	s.refreshAndBroadcast()
-	writeJSON(w, map[string]any{"ok": true})
 }
 
 // ── Upload handlers ──
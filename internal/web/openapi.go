@@ -0,0 +1,240 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/JuanVilla424/teamoon/internal/queue"
+)
+
+var pathParamRe = regexp.MustCompile(`\{(\w+)\}`)
+
+// openAPIDoc builds the OpenAPI 3.0 description of the v1 API from its
+// route table, with schemas derived from the Go types it sends and takes.
+func (s *Server) openAPIDoc() map[string]any {
+	g := &schemaGen{defs: map[string]any{}, types: map[string]reflect.Type{}}
+	errResp := map[string]any{
+		"description": "Error",
+		"content":     jsonContent(g.schema(reflect.TypeOf(apiError{}))),
+	}
+
+	paths := map[string]any{}
+	for _, rt := range s.apiRoutes() {
+		op := map[string]any{
+			"operationId": rt.op,
+			"summary":     rt.summary,
+			"tags":        []string{rt.tag},
+		}
+		var params []any
+		for _, m := range pathParamRe.FindAllStringSubmatch(rt.path, -1) {
+			typ := "string"
+			if m[1] == "id" {
+				typ = "integer"
+			}
+			params = append(params, map[string]any{
+				"name": m[1], "in": "path", "required": true, "schema": map[string]any{"type": typ},
+			})
+		}
+		for _, p := range rt.query {
+			params = append(params, map[string]any{
+				"name": p.name, "in": "query", "description": p.desc, "schema": map[string]any{"type": p.typ},
+			})
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+		if rt.body != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content":  jsonContent(g.schema(reflect.TypeOf(rt.body))),
+			}
+		}
+		status := rt.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		ok := map[string]any{"description": http.StatusText(status)}
+		if rt.resp != nil {
+			ok["content"] = jsonContent(g.schema(reflect.TypeOf(rt.resp)))
+		}
+		op["responses"] = map[string]any{strconv.Itoa(status): ok, "default": errResp}
+		if rt.public {
+			op["security"] = []any{}
+		} else {
+			req := &http.Request{Method: rt.method, URL: &url.URL{Path: apiPrefix + rt.path}}
+			op["x-token-scope"] = requiredScope(req)
+		}
+
+		key := rt.path
+		item, _ := paths[key].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			paths[key] = item
+		}
+		item[strings.ToLower(rt.method)] = op
+	}
+
+	version := Version
+	if version == "" {
+		version = "dev"
+	}
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "teamoon API",
+			"version": version,
+			"description": "Resource-oriented API of the teamoon server. Errors share one body shape; list endpoints take limit and offset. " +
+				"API tokens are sent as bearer tokens; x-token-scope is the least token scope an operation needs.",
+		},
+		"servers":  []any{map[string]any{"url": apiPrefix}},
+		"security": []any{map[string]any{"session": []string{}}, map[string]any{"bearer": []string{}}},
+		"paths":    paths,
+		"components": map[string]any{
+			"schemas": g.defs,
+			"securitySchemes": map[string]any{
+				"session": map[string]any{"type": "apiKey", "in": "cookie", "name": sessionCookieName},
+				"bearer":  map[string]any{"type": "http", "scheme": "bearer", "description": "An API token, see teamoon token create."},
+			},
+		},
+	}
+}
+
+func jsonContent(schema map[string]any) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": schema}}
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	rawJSONType   = reflect.TypeOf(json.RawMessage{})
+	taskStateType = reflect.TypeOf(queue.TaskState(""))
+)
+
+// schemaGen turns Go types into JSON schemas the way encoding/json
+// marshals them. Named structs become components, referenced by name.
+type schemaGen struct {
+	defs  map[string]any
+	types map[string]reflect.Type // which type owns each name in defs
+}
+
+func (g *schemaGen) schema(t reflect.Type) map[string]any {
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case rawJSONType:
+		return map[string]any{}
+	case taskStateType:
+		return map[string]any{"type": "string", "enum": queue.States}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schema(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		name := schemaName(t)
+		if name == "" {
+			return g.object(t)
+		}
+		if owner, ok := g.types[name]; ok && owner != t {
+			name = upperFirst(path.Base(t.PkgPath())) + name
+		}
+		if _, ok := g.defs[name]; !ok {
+			g.types[name] = t
+			g.defs[name] = map[string]any{} // placeholder for recursive types
+			g.defs[name] = g.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]any{}
+}
+
+func (g *schemaGen) object(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var required []string
+	g.fields(t, props, &required)
+	out := map[string]any{"type": "object", "properties": props}
+	if required != nil {
+		out["required"] = required
+	}
+	return out
+}
+
+// fields adds the JSON fields of struct t, flattening embedded structs.
+// Fields without omitempty are always sent, so they are listed as required.
+func (g *schemaGen) fields(t reflect.Type, props map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.fields(ft, props, required)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schema(f.Type)
+		if !strings.Contains(","+opts+",", ",omitempty,") && f.Type.Kind() != reflect.Pointer {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// schemaName is the component name of t: its Go name capitalized, with a
+// generic page[T] named after T, e.g. WebTaskPage. Anonymous types have
+// none and are inlined.
+func schemaName(t reflect.Type) string {
+	name := t.Name()
+	if name == "" {
+		return ""
+	}
+	if i := strings.Index(name, "["); i >= 0 {
+		arg := strings.TrimSuffix(name[i+1:], "]")
+		arg = arg[strings.LastIndex(arg, ".")+1:]
+		return upperFirst(arg) + upperFirst(name[:i])
+	}
+	return upperFirst(name)
+}
+
+func upperFirst(s string) string {
+	r := []rune(s)
+	if len(r) > 0 {
+		r[0] = unicode.ToUpper(r[0])
+	}
+	return string(r)
+}
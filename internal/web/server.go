@@ -17,6 +17,7 @@ import (
 	"github.com/JuanVilla424/teamoon/internal/plan"
 	"github.com/JuanVilla424/teamoon/internal/plangen"
 	"github.com/JuanVilla424/teamoon/internal/queue"
+	"github.com/JuanVilla424/teamoon/internal/webhook"
 )
 
 type sseClient chan []byte
@@ -137,7 +138,8 @@ func (s *Server) startSystemLoop() {
 }
 
 func (s *Server) Start(ctx context.Context) {
-	metrics.StartUsageFetcher(s.cfg.ProjectsDir)
+	metrics.StartUsageFetcher(s.cfg)
+	webhook.Start(ctx, s.cfg)
 	s.store.Refresh()
 	s.RecoverAndResume()
 
@@ -149,6 +151,24 @@ func (s *Server) Start(ctx context.Context) {
 		s.refreshAndBroadcast()
 	})
 
+	// Settle tasks whose pull request was merged or closed.
+	engine.StartReviewPoller(ctx, s.cfg, func(t queue.Task, state queue.TaskState) {
+		msg := fmt.Sprintf("PR #%d merged, task done", t.PRNumber)
+		level := logs.LevelSuccess
+		if state != queue.StateDone {
+			msg = fmt.Sprintf("PR #%d closed without merging, task failed", t.PRNumber)
+			level = logs.LevelWarn
+		}
+		s.store.logBuf.Add(logs.LogEntry{
+			Time:    time.Now(),
+			TaskID:  t.ID,
+			Project: t.Project,
+			Message: msg,
+			Level:   level,
+		})
+		s.refreshAndBroadcast()
+	})
+
 	go func() {
 		interval := time.Duration(s.cfg.RefreshIntervalSec) * time.Second
 		if interval < 5*time.Second {
@@ -192,14 +212,35 @@ func (s *Server) Start(ctx context.Context) {
 	mux.HandleFunc("/", s.handleIndex)
 	mux.HandleFunc("/api/data", s.authWrap(s.handleData))
 	mux.HandleFunc("/api/sse", s.authWrap(s.handleSSE))
+	mux.HandleFunc("/api/tasks", s.logRequest(s.authWrap(s.handleTaskList)))
+	mux.HandleFunc("/api/tasks/search", s.logRequest(s.authWrap(s.handleTaskSearch)))
+	mux.HandleFunc("/api/tasks/labels", s.logRequest(s.authWrap(s.handleTaskLabels)))
+	mux.HandleFunc("/api/tasks/parent", s.logRequest(s.authWrap(s.handleTaskParent)))
+	mux.HandleFunc("/api/filters/list", s.logRequest(s.authWrap(s.handleFiltersList)))
+	mux.HandleFunc("/api/filters/save", s.logRequest(s.authWrap(s.handleFilterSave)))
+	mux.HandleFunc("/api/filters/delete", s.logRequest(s.authWrap(s.handleFilterDelete)))
 	mux.HandleFunc("/api/tasks/add", s.logRequest(s.authWrap(s.handleTaskAdd)))
 	mux.HandleFunc("/api/tasks/done", s.logRequest(s.authWrap(s.handleTaskDone)))
 	mux.HandleFunc("/api/tasks/archive", s.logRequest(s.authWrap(s.handleTaskArchive)))
 	mux.HandleFunc("/api/tasks/replan", s.logRequest(s.authWrap(s.handleTaskReplan)))
 	mux.HandleFunc("/api/tasks/autopilot", s.logRequest(s.authWrap(s.handleTaskAutopilot)))
 	mux.HandleFunc("/api/tasks/stop", s.logRequest(s.authWrap(s.handleTaskStop)))
+	mux.HandleFunc("/api/tasks/retry", s.logRequest(s.authWrap(s.handleTaskRetry)))
 	mux.HandleFunc("/api/tasks/plan", s.logRequest(s.authWrap(s.handleTaskPlan)))
+	mux.HandleFunc("/api/tasks/plan/revisions", s.logRequest(s.authWrap(s.handlePlanRevisions)))
+	mux.HandleFunc("/api/tasks/plan/diff", s.logRequest(s.authWrap(s.handlePlanDiff)))
+	mux.HandleFunc("/api/tasks/plan/restore", s.logRequest(s.authWrap(s.handlePlanRestore)))
+	mux.HandleFunc("/api/tasks/plan/pin", s.logRequest(s.authWrap(s.handlePlanPin)))
+	mux.HandleFunc("/api/tasks/plan/approve", s.logRequest(s.authWrap(s.handlePlanApprove)))
+	mux.HandleFunc("/api/tasks/plan/reject", s.logRequest(s.authWrap(s.handlePlanReject)))
+	mux.HandleFunc("/api/tasks/plan/edit", s.logRequest(s.authWrap(s.handlePlanEdit)))
+	mux.HandleFunc("/api/tasks/approval", s.logRequest(s.authWrap(s.handleTaskApproval)))
+	mux.HandleFunc("/api/tasks/checkpoints", s.logRequest(s.authWrap(s.handleTaskCheckpoints)))
+	mux.HandleFunc("/api/tasks/checkpoints/revert", s.logRequest(s.authWrap(s.handleCheckpointRevert)))
+	mux.HandleFunc("/api/tasks/checkpoints/restore", s.logRequest(s.authWrap(s.handleCheckpointRevert)))
 	mux.HandleFunc("/api/tasks/detail", s.logRequest(s.authWrap(s.handleTaskDetail)))
+	mux.HandleFunc("/api/tasks/events", s.logRequest(s.authWrap(s.handleTaskEvents)))
+	mux.HandleFunc("/api/tasks/flow", s.logRequest(s.authWrap(s.handleTaskFlow)))
 	mux.HandleFunc("/api/projects/prs", s.logRequest(s.authWrap(s.handleProjectPRs)))
 	mux.HandleFunc("/api/projects/pr-detail", s.logRequest(s.authWrap(s.handleProjectPRDetail)))
 	mux.HandleFunc("/api/projects/merge-dependabot", s.logRequest(s.authWrap(s.handleMergeDependabot)))
@@ -213,6 +254,7 @@ func (s *Server) Start(ctx context.Context) {
 	mux.HandleFunc("/api/templates/delete", s.logRequest(s.authWrap(s.handleTemplateDelete)))
 	mux.HandleFunc("/api/templates/update", s.logRequest(s.authWrap(s.handleTemplateUpdate)))
 	mux.HandleFunc("/api/tasks/assignee", s.logRequest(s.authWrap(s.handleTaskAssignee)))
+	mux.HandleFunc("/api/tasks/depends", s.logRequest(s.authWrap(s.handleTaskDepends)))
 	mux.HandleFunc("/api/tasks/update", s.logRequest(s.authWrap(s.handleTaskUpdate)))
 	mux.HandleFunc("/api/chat/send", s.logRequest(s.authWrap(s.handleChatSend)))
 	mux.HandleFunc("/api/chat/history", s.logRequest(s.authWrap(s.handleChatHistory)))
@@ -220,6 +262,12 @@ func (s *Server) Start(ctx context.Context) {
 	mux.HandleFunc("/api/projects/init", s.logRequest(s.authWrap(s.handleProjectInit)))
 	mux.HandleFunc("/api/config", s.logRequest(s.authWrap(s.handleConfigGet)))
 	mux.HandleFunc("/api/config/save", s.logRequest(s.authWrap(s.handleConfigSave)))
+	mux.HandleFunc("/api/webhooks", s.logRequest(s.authWrap(s.handleWebhooks)))
+	mux.HandleFunc("/api/webhooks/deliveries", s.logRequest(s.authWrap(s.handleWebhookDeliveries)))
+	mux.HandleFunc("/api/webhooks/test", s.logRequest(s.authWrap(s.handleWebhookTest)))
+	mux.HandleFunc("/api/tokens", s.logRequest(s.authWrap(s.handleTokens)))
+	mux.HandleFunc("/api/tokens/create", s.logRequest(s.authWrap(s.handleTokenCreate)))
+	mux.HandleFunc("/api/tokens/revoke", s.logRequest(s.authWrap(s.handleTokenRevoke)))
 	mux.HandleFunc("/api/mcp/list", s.logRequest(s.authWrap(s.handleMCPList)))
 	mux.HandleFunc("/api/mcp/toggle", s.logRequest(s.authWrap(s.handleMCPToggle)))
 	mux.HandleFunc("/api/mcp/init", s.logRequest(s.authWrap(s.handleMCPInit)))
@@ -244,6 +292,8 @@ func (s *Server) Start(ctx context.Context) {
 	mux.HandleFunc("/api/uploads/", s.logRequest(s.authWrap(s.handleUploadServe)))
 	mux.HandleFunc("/api/tasks/attach", s.logRequest(s.authWrap(s.handleTaskAttach)))
 
+	s.registerAPIv1(mux)
+
 	addr := fmt.Sprintf("%s:%d", s.cfg.WebHost, s.cfg.WebPort)
 	srv := &http.Server{Addr: addr, Handler: mux}
 
@@ -269,15 +319,9 @@ func (s *Server) logRequest(next http.HandlerFunc) http.HandlerFunc {
 
 func (s *Server) authWrap(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if s.cfg.WebPassword == "" {
-			next(w, r)
-			return
-		}
-		cookie, err := r.Cookie(sessionCookieName)
-		if err != nil || !s.sessions.validate(cookie.Value) {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+		r, status, msg := s.checkAuth(r)
+		if status != 0 {
+			writeErr(w, status, msg)
 			return
 		}
 		next(w, r)
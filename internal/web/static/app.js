@@ -149,6 +149,11 @@ var currentPRsRepo = "";
 var logAutoScroll = true;
 var queueFilterState = "";
 var queueFilterProject = "";
+var queueQuery = "";
+var queueQueryIDs = null;   // task id -> true for the active query, null when none
+var queueQueryFor = "";     // task snapshot the query results belong to
+var queueQueryErr = "";
+var queueSavedFilters = null;
 var queueViewMode = "list";
 var pdWaveView = false;
 var logFilterLevel = "";
@@ -166,6 +171,7 @@ var editingTemplateId = 0;
 var planCollapsed = true;
 var taskLogsCache = {};
 var planCache = {};
+var planLintCache = {};
 var prevContentKey = "";
 var prevLogCount = 0;
 var prevTaskLogCounts = {};
@@ -184,6 +190,9 @@ var configSubTab = "paths";
 var configEditing = null;
 var cfgEditingTemplate = null;
 var templatesLoading = false;
+var apiTokensCache = null;
+var apiTokensLoading = false;
+var apiTokenCreated = null;
 var chatProject = "";
 var chatSystemMode = false;
 var chatCounter = 0;
@@ -404,7 +413,7 @@ function hasActiveTask(){
   if(!D.tasks) return false;
   for(var i=0;i<D.tasks.length;i++){
     var s = D.tasks[i].effective_state;
-    if(s === "generating" || s === "running") return true;
+    if(s === "planning" || s === "running") return true;
   }
   return false;
 }
@@ -574,6 +583,13 @@ function showEnvVarsPrompt(srv, installBtn){
 /* ── Router ── */
 function getView(){
   var h = location.hash.replace("#","") || "dashboard";
+  // #queue/<id> deep-links to a task (used by notification links)
+  var deep = /^queue\/(\d+)$/.exec(h);
+  if(deep){
+    selectedTaskID = parseInt(deep[1], 10);
+    history.replaceState(null, "", "#queue");
+    h = "queue";
+  }
   if(["dashboard","queue","canvas","projects","logs","chat","jobs","config","setup","login"].indexOf(h) < 0) h = "dashboard";
   return h;
 }
@@ -627,13 +643,14 @@ function computeContentKey(v){
       var tk = "";
       for(var i=0;i<tasks.length;i++){
         var tki = tasks[i];
-        tk += tki.id + "," + tki.effective_state + "," + tki.is_running + "," + tki.has_plan + ";";
+        tk += tki.id + "," + tki.effective_state + "," + tki.is_running + "," + tki.has_plan + "," + (tki.parent_id||0) + "," + (tki.rollup ? tki.rollup.done + "/" + tki.rollup.total : "") + ";";
       }
       var selLogs = 0;
       for(var i=0;i<logs.length;i++){
         if(logs[i].task_id === selectedTaskID) selLogs++;
       }
-      return lp + "q:" + queueFilterState + ":" + queueFilterProject + ":" + queueViewMode + ":" + selectedTaskID + ":" + tk + ":" + selLogs;
+      var qk = queueQueryIDs ? Object.keys(queueQueryIDs).join(",") : "";
+      return lp + "q:" + queueFilterState + ":" + queueFilterProject + ":" + queueQuery + ":" + qk + ":" + queueQueryErr + ":" + (queueSavedFilters ? queueSavedFilters.length : "n") + ":" + queueViewMode + ":" + selectedTaskID + ":" + tk + ":" + selLogs;
     case "projects":
       var pk = "";
       for(var i=0;i<projs.length;i++){
@@ -647,7 +664,7 @@ function computeContentKey(v){
       return lp + "chat:" + chatCounter;
     case "canvas":
       var ck = canvasFilterAssignee + ":" + canvasFilterProject + ":";
-      for(var i=0;i<tasks.length;i++) ck += tasks[i].id + tasks[i].effective_state + (tasks[i].assignee||"") + ",";
+      for(var i=0;i<tasks.length;i++) ck += tasks[i].id + tasks[i].effective_state + (tasks[i].assignee||"") + (tasks[i].parent_id||0) + (tasks[i].rollup ? tasks[i].rollup.done + "/" + tasks[i].rollup.total : "") + ",";
       return lp + "cv:" + ck;
     case "jobs":
       var jbs = D ? (D.jobs || []) : [];
@@ -1088,7 +1105,13 @@ function renderDashboard(root){
   var todayCost = c.cost_today || 0;
   costCard.appendChild(mkValue(monthCost > 0 ? "$" + fmtCost(monthCost) : "$0.00"));
   costCard.appendChild(mkSub(t("dashboard.cost_month",{today:fmtCost(todayCost)})));
-  var weeklyUse = (D.usage && D.usage.week_all) ? D.usage.week_all.utilization : 0;
+  var usageKnown = D.usage && D.usage.known;
+  var weeklyUse = (usageKnown && D.usage.week_all) ? D.usage.week_all.utilization : 0;
+  if (!usageKnown) {
+    var uLabel = div("usage-bar-label");
+    uLabel.textContent = t("dashboard.usage_unknown");
+    costCard.appendChild(uLabel);
+  }
   if (weeklyUse > 0) {
     var wColor = weeklyUse >= 90 ? "red" : weeklyUse >= 60 ? "yellow" : "green";
     var wBar = div("progress");
@@ -1155,8 +1178,8 @@ function renderDashboard(root){
   for(var i=0;i<tasks.length;i++){
     var s=tasks[i].effective_state;
     if(s==="running")running++;
-    else if(s==="pending"||s==="generating")pendingC++;
-    else if(s==="planned")planned++;
+    else if(s==="pending"||s==="planning"||s==="blocked"||s==="failed")pendingC++;
+    else if(s==="planned"||s==="awaiting_approval"||s==="in_review")planned++;
     else if(s==="done")doneC++;
   }
   var activeCount = running + pendingC + planned;
@@ -1277,22 +1300,79 @@ function renderQueue(root){
   projSelect.onchange = function(){ queueFilterProject = this.value; render(); };
   toolbar.appendChild(projSelect);
 
+  var queryInput = el("input", "filter-input queue-query");
+  queryInput.type = "text";
+  queryInput.value = queueQuery;
+  queryInput.placeholder = t("queue.query_placeholder");
+  queryInput.title = t("queue.query_help");
+  queryInput.onkeydown = function(e){ if(e.key === "Enter") runQueueQuery(this.value.trim()); };
+  toolbar.appendChild(queryInput);
+
+  if(queueSavedFilters === null){
+    queueSavedFilters = [];
+    loadSavedFilters();
+  }
+  var savedSelect = el("select", "filter-select");
+  savedSelect.appendChild(mkOption("", t("queue.saved_filters")));
+  var activeSaved = null;
+  for(var i=0;i<queueSavedFilters.length;i++){
+    var sf = queueSavedFilters[i];
+    var isActive = queueQuery !== "" && sf.query === queueQuery;
+    if(isActive) activeSaved = sf;
+    savedSelect.appendChild(mkOption(sf.name, sf.name, isActive));
+  }
+  savedSelect.onchange = function(){
+    var name = this.value;
+    var q = "";
+    for(var i=0;i<queueSavedFilters.length;i++) if(queueSavedFilters[i].name === name) q = queueSavedFilters[i].query;
+    runQueueQuery(q);
+  };
+  toolbar.appendChild(savedSelect);
+  if(queueQuery && !activeSaved){
+    var saveFilterBtn = el("button", "btn btn-sm", [t("queue.filter_save")]);
+    saveFilterBtn.onclick = function(){
+      var name = prompt(t("queue.filter_name_prompt"));
+      if(name === null || !name.trim()) return;
+      api("POST", "/api/filters/save", {name: name.trim(), query: queueQuery}, function(d, ok){
+        if(!ok){ toast(t("common.error_unknown", {error: d.error || "unknown"}), "error"); return; }
+        loadSavedFilters();
+      });
+    };
+    toolbar.appendChild(saveFilterBtn);
+  }
+  if(activeSaved){
+    var delFilterBtn = el("button", "btn btn-sm", [t("queue.filter_delete")]);
+    delFilterBtn.onclick = function(){
+      if(!confirm(t("queue.filter_delete_confirm", {name: activeSaved.name}))) return;
+      api("POST", "/api/filters/delete", {name: activeSaved.name}, function(d, ok){
+        if(!ok){ toast(t("common.error_unknown", {error: d.error || "unknown"}), "error"); return; }
+        loadSavedFilters();
+      });
+    };
+    toolbar.appendChild(delFilterBtn);
+  }
+
   var waveBtn = el("button", "btn btn-sm" + (queueViewMode === "waves" ? " btn-primary" : ""), [t("queue.view_waves") || "Waves"]);
   waveBtn.title = t("queue.view_waves_title") || "Group by wave";
   waveBtn.onclick = function(){ queueViewMode = (queueViewMode === "waves") ? "list" : "waves"; render(); };
   toolbar.appendChild(waveBtn);
 
   root.appendChild(toolbar);
+  if(queueQueryErr) root.appendChild(div("queue-query-error", [queueQueryErr]));
+
+  // Query results go stale as tasks change; search again when they do.
+  if(queueQuery && queueQueryFor !== queueTaskSnapshot(tasks)) runQueueQuery(queueQuery);
 
   var filtered = tasks.filter(function(tsk){
     if(queueFilterState && tsk.effective_state !== queueFilterState) return false;
     if(queueFilterProject && tsk.project !== queueFilterProject) return false;
+    if(queueQueryIDs && !queueQueryIDs[tsk.id]) return false;
     return true;
   });
 
   if(filtered.length === 0){
     var emptyEl = div("empty");
-    emptyEl.textContent = (queueFilterState || queueFilterProject)
+    emptyEl.textContent = (queueFilterState || queueFilterProject || queueQuery)
       ? t("queue.empty_filtered")
       : t("queue.empty_no_tasks");
     root.appendChild(emptyEl);
@@ -1306,12 +1386,40 @@ function renderQueue(root){
   }
 }
 
+function queueTaskSnapshot(tasks){
+  var k = "";
+  for(var i=0;i<tasks.length;i++) k += tasks[i].id + "," + tasks[i].effective_state + "," + (tasks[i].labels || []).join(" ") + ";";
+  return k;
+}
+
+function runQueueQuery(q){
+  queueQuery = q;
+  queueQueryErr = "";
+  if(!q){ queueQueryIDs = null; render(); return; }
+  queueQueryFor = queueTaskSnapshot(D ? (D.tasks || []) : []);
+  api("GET", "/api/tasks/search?q=" + encodeURIComponent(q), null, function(d, ok){
+    if(q !== queueQuery) return;
+    if(!ok){ queueQueryIDs = {}; queueQueryErr = d.error || "search failed"; render(); return; }
+    var ids = {};
+    for(var i=0;i<(d || []).length;i++) ids[d[i].id] = true;
+    queueQueryIDs = ids;
+    render();
+  });
+}
+
+function loadSavedFilters(){
+  api("GET", "/api/filters/list", null, function(d, ok){
+    if(ok) queueSavedFilters = d || [];
+    render();
+  });
+}
+
 function renderTimelineNode(timeline, tsk){
   var st = safeState(tsk);
   var cls = "tl-node state-" + st;
   if(tsk.id === selectedTaskID) cls += " selected";
   if(tsk.is_running) cls += " has-running";
-  if(st === "generating") cls += " has-generating";
+  if(st === "planning") cls += " has-generating";
   var prev = prevTaskStates[tsk.id];
   if(prev && prev !== "done" && st === "done") cls += " task-just-done";
   prevTaskStates[tsk.id] = st;
@@ -1338,6 +1446,22 @@ function renderTimelineNode(timeline, tsk){
   badges.appendChild(span("task-state " + st, stateText));
   badges.appendChild(span("task-pri " + tsk.priority, (tsk.priority||"").toUpperCase()));
   if(tsk.wave > 0) badges.appendChild(span("task-wave", "W" + tsk.wave));
+  if(tsk.depends_on && tsk.depends_on.length) badges.appendChild(span("task-deps", "\u21b3 #" + tsk.depends_on.join(" #")));
+  if(tsk.held_reason) badges.appendChild(span("task-held", tsk.held_reason));
+  if(st === "failed" && tsk.fail_reason) badges.appendChild(span("task-fail", tsk.fail_reason));
+  var labels = tsk.labels || [];
+  for(var li=0;li<labels.length;li++) badges.appendChild(span("task-label", labels[li]));
+  if(tsk.rollup) badges.appendChild(span("task-epic", t("task.epic_progress", {done: tsk.rollup.done, total: tsk.rollup.total})));
+  if(tsk.parent_id) badges.appendChild(span("task-parent", "\u2191 #" + tsk.parent_id));
+  if(tsk.pr_url){
+    var prLink = el("a", "task-pr", ["PR #" + (tsk.pr_number || "?")]);
+    prLink.href = tsk.pr_url;
+    prLink.target = "_blank";
+    prLink.rel = "noopener";
+    prLink.title = t("task.pr_open");
+    prLink.onclick = function(e){ e.stopPropagation(); };
+    badges.appendChild(prLink);
+  }
   if(tsk.is_running) badges.appendChild(div("running-dot"));
   hdr.appendChild(badges);
   node.appendChild(hdr);
@@ -1358,7 +1482,7 @@ function renderQueueList(root, filtered){
   }
   root.appendChild(timeline);
 
-  var firstRunning = timeline.querySelector(".state-running, .state-generating");
+  var firstRunning = timeline.querySelector(".state-running, .state-planning");
   if(firstRunning && !selectedTaskID) firstRunning.scrollIntoView({behavior:"smooth", block:"nearest"});
 }
 
@@ -1485,6 +1609,45 @@ function renderTaskDetail(parent, tsk){
     propEngine.appendChild(engineVal);
     props.appendChild(propEngine);
   }
+  var propLabels = div("detail-prop");
+  propLabels.appendChild(span("detail-prop-label", t("task.labels")));
+  var labelsVal = div("detail-labels");
+  var tlabels = tsk.labels || [];
+  if(tlabels.length === 0) labelsVal.appendChild(span("detail-prop-value", "\u2014"));
+  for(var li=0;li<tlabels.length;li++) labelsVal.appendChild(span("task-label", tlabels[li]));
+  labelsVal.appendChild(iconBtn("pencil", t("task.labels_edit"), function(){
+    var input = prompt(t("task.labels_prompt"), tlabels.join(", "));
+    if(input === null) return;
+    api("POST", "/api/tasks/labels", {id: tsk.id, labels: input.split(",")}, function(d, ok){
+      if(!ok){ toast(t("task.error_save", {error: d.error || "unknown error"}), "error"); return; }
+      toast(t("task.labels_updated"), "success");
+    });
+  }));
+  propLabels.appendChild(labelsVal);
+  props.appendChild(propLabels);
+
+  var propParent = div("detail-prop");
+  propParent.appendChild(span("detail-prop-label", t("task.epic")));
+  var parentVal = div("detail-labels");
+  if(tsk.parent_id){
+    var parentLink = el("a", "task-parent", ["#" + tsk.parent_id]);
+    parentLink.href = "#queue";
+    parentLink.onclick = function(e){ e.preventDefault(); selectTask(tsk.parent_id); };
+    parentVal.appendChild(parentLink);
+  } else {
+    parentVal.appendChild(span("detail-prop-value", "\u2014"));
+  }
+  parentVal.appendChild(iconBtn("pencil", t("task.epic_edit"), function(){
+    var input = prompt(t("task.epic_prompt"), tsk.parent_id ? String(tsk.parent_id) : "");
+    if(input === null) return;
+    var pid = parseInt(input.replace("#", ""), 10) || 0;
+    api("POST", "/api/tasks/parent", {id: tsk.id, parent_id: pid}, function(d, ok){
+      if(!ok){ toast(t("task.error_save", {error: d.error || "unknown error"}), "error"); return; }
+      toast(t("task.epic_updated"), "success");
+    });
+  }));
+  propParent.appendChild(parentVal);
+  props.appendChild(propParent);
   if(tsk.wave > 0){
     var propWave = div("detail-prop");
     propWave.appendChild(span("detail-prop-label", t("task.wave")));
@@ -1495,7 +1658,7 @@ function renderTaskDetail(parent, tsk){
   parent.appendChild(headerCard);
 
   // ── Generating state ──
-  if(dst === "generating"){
+  if(dst === "planning"){
     var genSec = div("detail-card detail-generating");
     var genRow = div("detail-generating-inner");
     genRow.appendChild(div("spinner"));
@@ -1510,7 +1673,7 @@ function renderTaskDetail(parent, tsk){
   var apKey = "autopilot:" + tsk.id;
 
   // PLAN — enabled for pending only
-  var planLoading = (s === "generating") || (s === "pending" && loadingActions[apKey]);
+  var planLoading = (s === "planning") || (s === "pending" && loadingActions[apKey]);
   var planEnabled = (s === "pending") && !loadingActions[apKey];
   var planBtn = el("button", "btn" + (planEnabled ? " btn-primary" : ""));
   if(planLoading){
@@ -1524,6 +1687,23 @@ function renderTaskDetail(parent, tsk){
   }
   actions.appendChild(planBtn);
 
+  // APPROVE / REJECT — plan held for review
+  if(s === "awaiting_approval"){
+    var apvKey = "approve:" + tsk.id;
+    var approveBtn = el("button", "btn btn-success", [t("task.approve")]);
+    approveBtn.disabled = !!loadingActions[apvKey];
+    approveBtn.onclick = function(){ taskApprove(tsk.id, this); };
+    actions.appendChild(approveBtn);
+    var rejectBtn = el("button", "btn btn-danger", [t("task.reject")]);
+    rejectBtn.disabled = !!loadingActions[apvKey];
+    rejectBtn.onclick = function(){
+      var fb = prompt(t("task.reject_prompt"));
+      if(fb === null || !fb.trim()) return;
+      taskReject(tsk.id, fb.trim(), this);
+    };
+    actions.appendChild(rejectBtn);
+  }
+
   // Divider: PLAN | execution group
   actions.appendChild(div("detail-actions-divider"));
 
@@ -1555,7 +1735,7 @@ function renderTaskDetail(parent, tsk){
 
   // REPLAN — enabled when has_plan and not running/generating
   var rpKey = "replan:" + tsk.id;
-  var replanEnabled = tsk.has_plan && s !== "running" && s !== "generating" && !loadingActions[rpKey];
+  var replanEnabled = tsk.has_plan && s !== "running" && s !== "planning" && !loadingActions[rpKey];
   var replanBtn = el("button", "btn");
   if(loadingActions[rpKey]){
     replanBtn.disabled = true;
@@ -1567,6 +1747,20 @@ function renderTaskDetail(parent, tsk){
   }
   actions.appendChild(replanBtn);
 
+  // RETRY — enabled for failed/blocked
+  if(s === "failed" || s === "blocked"){
+    var rtKey = "retry:" + tsk.id;
+    var retryBtn = el("button", "btn btn-primary");
+    if(loadingActions[rtKey]){
+      retryBtn.disabled = true;
+      var rtsp = document.createElement("span"); rtsp.className = "btn-spinner"; retryBtn.appendChild(rtsp);
+    } else {
+      retryBtn.textContent = t("task.retry");
+      retryBtn.onclick = function(){ taskRetry(tsk.id, this); };
+    }
+    actions.appendChild(retryBtn);
+  }
+
   // Divider before destructive action
   actions.appendChild(div("detail-actions-divider"));
 
@@ -1629,6 +1823,132 @@ function renderTaskDetail(parent, tsk){
     parent.appendChild(attSec);
   }
 
+  // ── Cost section ──
+  if(tsk.cost_usd > 0){
+    var costSec = div("detail-card detail-section");
+    var costTitle = div("detail-section-title");
+    costTitle.appendChild(txt(t("task.cost")));
+    costSec.appendChild(costTitle);
+    var costTable = div("task-cost-table");
+    costTable.id = "task-cost-" + tsk.id;
+    api("GET","/api/tasks/detail?id="+tsk.id,null,function(d){
+      var area = document.getElementById("task-cost-" + tsk.id);
+      if(!area || !d.spend) return;
+      var rows = (d.spend.steps || []).slice();
+      rows.push({kind:"total", step:0, cost_usd:d.spend.total.cost_usd, input:d.spend.total.input, output:d.spend.total.output, cache_read:d.spend.total.cache_read, cache_create:d.spend.total.cache_create});
+      rows.forEach(function(r){
+        var label;
+        if(r.kind === "total") label = t("task.cost_total");
+        else if(r.step === 0) label = t("task.cost_planning");
+        else if(r.kind === "recovery") label = t("task.cost_recovery",{n:r.step});
+        else label = t("task.cost_step",{n:r.step});
+        var row = div("task-cost-row" + (r.kind === "total" ? " total" : ""));
+        row.appendChild(span("task-cost-label", label));
+        row.appendChild(span("task-cost-usd", "$" + r.cost_usd.toFixed(4)));
+        row.appendChild(span("task-cost-tokens", fmtNum(r.input) + " in / " + fmtNum(r.output) + " out / " + fmtNum(r.cache_read + r.cache_create) + " cache"));
+        area.appendChild(row);
+      });
+    });
+    costSec.appendChild(costTable);
+    parent.appendChild(costSec);
+  }
+
+  // ── Changes section (per-step diffs, hidden until one is recorded) ──
+  var chgSec = div("detail-card detail-section");
+  chgSec.id = "task-changes-" + tsk.id;
+  chgSec.style.display = "none";
+  var chgTitle = div("detail-section-title");
+  chgTitle.appendChild(txt(t("task.changes")));
+  chgSec.appendChild(chgTitle);
+  api("GET","/api/tasks/detail?id="+tsk.id,null,function(d){
+    var sec = document.getElementById("task-changes-" + tsk.id);
+    if(!sec || !d.diffs || d.diffs.length === 0) return;
+    sec.style.display = "";
+    d.diffs.forEach(function(sd){
+      var det = document.createElement("details");
+      det.className = "task-diff";
+      var sum = document.createElement("summary");
+      sum.textContent = t("task.changes_step",{n:sd.step, title:sd.title});
+      det.appendChild(sum);
+      if(!sd.patch){
+        det.appendChild(div("task-diff-stat", [t("task.changes_none")]));
+        sec.appendChild(det);
+        return;
+      }
+      var stat = document.createElement("pre");
+      stat.className = "task-diff-stat";
+      stat.textContent = sd.stat;
+      det.appendChild(stat);
+      var pre = document.createElement("pre");
+      pre.className = "task-diff-patch";
+      sd.patch.split("\n").forEach(function(line){
+        var cls = "";
+        if(line.indexOf("+++") === 0 || line.indexOf("---") === 0 || line.indexOf("diff ") === 0) cls = "hdr";
+        else if(line.indexOf("@@") === 0) cls = "hunk";
+        else if(line.charAt(0) === "+") cls = "add";
+        else if(line.charAt(0) === "-") cls = "del";
+        pre.appendChild(span(cls, line + "\n"));
+      });
+      det.appendChild(pre);
+      if(sd.truncated) det.appendChild(div("task-diff-stat", [t("task.changes_truncated")]));
+      sec.appendChild(det);
+    });
+  });
+  parent.appendChild(chgSec);
+
+  // ── Subtasks section (epics only) ──
+  if(tsk.rollup){
+    var subSec = div("detail-card detail-section");
+    var subTitle = div("detail-section-title");
+    subTitle.appendChild(txt(t("task.subtasks")));
+    subSec.appendChild(subTitle);
+    var roll = tsk.rollup;
+    var summary = t("task.epic_rollup", {done: roll.done, total: roll.total, state: stateLabel(roll.state || "pending")});
+    if(roll.cost_usd > 0) summary += " \u00b7 $" + fmtCost(roll.cost_usd);
+    subSec.appendChild(div("task-subtasks-summary", [summary]));
+    var epicBar = div("task-epic-bar");
+    var fill = div("task-epic-bar-fill");
+    fill.style.width = (roll.total ? Math.round(100 * roll.done / roll.total) : 0) + "%";
+    epicBar.appendChild(fill);
+    subSec.appendChild(epicBar);
+    var subs = (D.tasks || []).filter(function(x){ return x.parent_id === tsk.id; });
+    subs.forEach(function(c){
+      var row = div("task-subtask-row");
+      row.appendChild(span("task-state " + safeState(c), stateLabel(safeState(c))));
+      row.appendChild(span("task-subtask-id", "#" + c.id));
+      var subDesc = (c.description || "").split("\n")[0];
+      row.appendChild(span("task-subtask-desc", subDesc));
+      if(c.rollup) row.appendChild(span("task-epic", t("task.epic_progress", {done: c.rollup.done, total: c.rollup.total})));
+      row.onclick = function(){ selectTask(c.id); };
+      subSec.appendChild(row);
+    });
+    parent.appendChild(subSec);
+  }
+
+  // ── Activity section (event timeline, lead/cycle time once done) ──
+  var actSec = div("detail-card detail-section");
+  var actTitle = div("detail-section-title");
+  actTitle.appendChild(txt(t("task.activity")));
+  actSec.appendChild(actTitle);
+  var actList = div("task-activity");
+  actList.id = "task-activity-" + tsk.id;
+  actSec.appendChild(actList);
+  api("GET","/api/tasks/events?id="+tsk.id,null,function(d){
+    var area = document.getElementById("task-activity-" + tsk.id);
+    if(!area || !d.events) return;
+    if(d.flow && d.flow.lead_ns > 0){
+      area.appendChild(div("task-activity-flow", [t("task.activity_flow",{lead:fmtUptime(Math.round(d.flow.lead_ns/1e9)), cycle:fmtUptime(Math.round(d.flow.cycle_ns/1e9))})]));
+    }
+    d.events.slice().reverse().forEach(function(e){
+      var row = div("task-activity-row " + e.kind);
+      row.appendChild(span("task-activity-time", fmtDate(e.time)));
+      row.appendChild(span("task-activity-actor", e.actor || ""));
+      row.appendChild(span("task-activity-msg", eventLabel(e)));
+      area.appendChild(row);
+    });
+  });
+  parent.appendChild(actSec);
+
   // ── Plan section (collapsible) ──
   if(tsk.has_plan){
     var planSec = div("detail-card detail-section");
@@ -1651,8 +1971,7 @@ function renderTaskDetail(parent, tsk){
     var planEl = div("plan-content");
     planEl.id = "plan-content-" + tsk.id;
     if(planCache[tsk.id]){
-      planEl.className = "plan-content plan-md";
-      planEl.innerHTML = mdToHtml(planCache[tsk.id]);
+      fillPlan(planEl, tsk.id);
     } else {
       planEl.textContent = t("task.plan_loading");
       planEl.className = "plan-content loading-text";
@@ -1711,7 +2030,7 @@ function renderTaskDetail(parent, tsk){
     var emptyMsg = div("task-terminal-empty");
     if(tsk.effective_state === "pending"){
       emptyMsg.textContent = t("task.log_empty_pending");
-    } else if(tsk.effective_state === "generating"){
+    } else if(tsk.effective_state === "planning"){
       emptyMsg.textContent = t("task.log_empty_generating");
     } else {
       emptyMsg.textContent = t("task.log_empty_loading");
@@ -1962,6 +2281,7 @@ function renderProjectDetail(root){
   if(p.task_pending > 0) taskSummary.appendChild(span("pd-task-count pending", p.task_pending + " " + t("projects.detail.task_pending")));
   if(p.task_running > 0) taskSummary.appendChild(span("pd-task-count running", p.task_running + " " + t("projects.detail.task_running")));
   if(p.task_done > 0) taskSummary.appendChild(span("pd-task-count done", p.task_done + " " + t("projects.detail.task_done")));
+  if(p.spend && p.spend.cost_usd > 0) taskSummary.appendChild(span("pd-task-count", t("projects.detail.spent",{cost:"$" + fmtCost(p.spend.cost_usd)})));
   taskSec.appendChild(taskSummary);
 
   // Progress bar
@@ -1980,9 +2300,13 @@ function renderProjectDetail(root){
   function renderPdTaskGroup(container, tasks, openDefault){
     var groups = [
       {label:"Running", state:"running", open:true},
-      {label:"Generating", state:"generating", open:true},
+      {label:"Planning", state:"planning", open:true},
       {label:"Pending", state:"pending", open:openDefault},
+      {label:"Awaiting approval", state:"awaiting_approval", open:true},
       {label:"Planned", state:"planned", open:true},
+      {label:"In review", state:"in_review", open:true},
+      {label:"Blocked", state:"blocked", open:true},
+      {label:"Failed", state:"failed", open:true},
       {label:"Done", state:"done", open:false},
     ];
     for(var g=0;g<groups.length;g++){
@@ -2335,6 +2659,7 @@ function taskReplan(id, btn){
   loadingActions[key] = true;
   var restore = btnLoading(btn);
   delete planCache[id];
+  delete planLintCache[id];
   api("POST","/api/tasks/replan",{id:id}, function(d, ok){
     delete loadingActions[key];
     if(restore) restore();
@@ -2342,27 +2667,75 @@ function taskReplan(id, btn){
     scheduleActivePoll();
   });
 }
+function taskApprove(id, btn){
+  var key = "approve:" + id;
+  if(loadingActions[key]) return;
+  loadingActions[key] = true;
+  var restore = btnLoading(btn);
+  api("POST","/api/tasks/plan/approve",{id:id}, function(d, ok){
+    delete loadingActions[key];
+    if(restore) restore();
+    if(!ok){ toast(t("task.approve_failed", {error: d.error || "unknown error"}), "error"); return; }
+    scheduleActivePoll();
+  });
+}
+function taskReject(id, feedback, btn){
+  var key = "approve:" + id;
+  if(loadingActions[key]) return;
+  loadingActions[key] = true;
+  var restore = btnLoading(btn);
+  delete planCache[id];
+  delete planLintCache[id];
+  api("POST","/api/tasks/plan/reject",{id:id, feedback:feedback}, function(d, ok){
+    delete loadingActions[key];
+    if(restore) restore();
+    if(!ok){ toast(t("task.reject_failed", {error: d.error || "unknown error"}), "error"); return; }
+    scheduleActivePoll();
+  });
+}
+function taskRetry(id, btn){
+  var key = "retry:" + id;
+  if(loadingActions[key]) return;
+  loadingActions[key] = true;
+  var restore = btnLoading(btn);
+  api("POST","/api/tasks/retry",{id:id}, function(d, ok){
+    delete loadingActions[key];
+    if(restore) restore();
+    if(!ok){ toast(t("task.retry_failed", {error: d.error || "unknown error"}), "error"); return; }
+    scheduleActivePoll();
+  });
+}
 function taskStop(id){
   api("POST","/api/tasks/stop",{id:id}, function(){});
 }
 
+// fillPlan renders the cached plan markdown, preceded by any lint issues.
+function fillPlan(el, id){
+  el.className = "plan-content plan-md";
+  el.innerHTML = mdToHtml(planCache[id]);
+  var lint = planLintCache[id];
+  var issues = lint ? (lint.errors || []).concat(lint.warnings || []) : [];
+  if(!issues.length) return;
+  var box = div("plan-lint");
+  issues.forEach(function(is){
+    var row = div("plan-lint-item " + is.severity);
+    row.textContent = (is.step ? t("task.plan_lint_step", {step: is.step}) + " " : "") + is.message;
+    box.appendChild(row);
+  });
+  el.insertBefore(box, el.firstChild);
+}
+
 function loadPlan(id){
   if(planCache[id]){
     var el = document.getElementById("plan-content-"+id);
-    if(el){
-      el.className = "plan-content plan-md";
-      el.innerHTML = mdToHtml(planCache[id]);
-    }
+    if(el) fillPlan(el, id);
     return;
   }
   api("GET","/api/tasks/plan?id="+id, null, function(d){
-    var content = d.content || d.error || t("task.plan_no_content");
-    planCache[id] = content;
+    planCache[id] = d.content || d.error || t("task.plan_no_content");
+    planLintCache[id] = d.lint;
     var el = document.getElementById("plan-content-"+id);
-    if(el){
-      el.className = "plan-content plan-md";
-      el.innerHTML = mdToHtml(content);
-    }
+    if(el) fillPlan(el, id);
   });
 }
 
@@ -2956,8 +3329,8 @@ function buildPhaseRing(pct, size){
   return svg;
 }
 /* State rank — higher number = more advanced state (never go backwards) */
-var stateRanks = {"pending":0,"generating":1,"planned":2,"running":3,"done":4};
-var rankToState = ["pending","generating","planned","running","done"];
+var stateRanks = {"pending":0,"planning":1,"planned":2,"running":3,"done":4};
+var rankToState = ["pending","planning","planned","running","done"];
 /* Return monotonic state for a task — never goes backwards */
 function safeState(tsk){
   var s = tsk.effective_state || "pending";
@@ -3018,14 +3391,35 @@ function updateQueueStepBadges(){
 }
 function stateLabel(s){
   switch(s){
-    case "generating": return t("task.state.generating");
+    case "planning": return t("task.state.planning");
     case "pending": return t("task.state.pending");
     case "planned": return t("task.state.planned");
+    case "awaiting_approval": return t("task.state.awaiting_approval");
     case "running": return t("task.state.running");
+    case "in_review": return t("task.state.in_review");
+    case "blocked": return t("task.state.blocked");
+    case "failed": return t("task.state.failed");
     case "done": return t("task.state.done");
     default: return s ? s.toUpperCase().substring(0,4) : "\u2014";
   }
 }
+function eventLabel(e){
+  var msg;
+  switch(e.kind){
+    case "created": msg = t("task.event.created"); break;
+    case "state": msg = stateLabel(e.from) + " \u2192 " + stateLabel(e.to); break;
+    case "plan_attempt": msg = t("task.event.plan_attempt",{n:e.attempt}); break;
+    case "replan": msg = t("task.event.replan"); break;
+    case "step_start": msg = t("task.event.step_start",{n:e.step}); break;
+    case "step_retry": msg = t("task.event.step_retry",{n:e.step, a:e.attempt}); break;
+    case "step_end": msg = t(e.reason ? "task.event.step_failed" : "task.event.step_end",{n:e.step}); break;
+    case "guardrail": msg = t("task.event.guardrail"); break;
+    case "action": return e.reason;
+    default: msg = e.kind;
+  }
+  if(e.reason) msg += ": " + e.reason;
+  return msg;
+}
 function statusLabel(s){
   switch(s){
     case "active": return t("projects.status.active");
@@ -3687,10 +4081,11 @@ function renderCanvas(container){
   // Bucket into 4 columns
   var backlog=[], ready=[], inprogress=[], done=[];
   for(var i=0;i<filtered.length;i++){
-    var s = filtered[i].effective_state;
-    if(s === "pending") backlog.push(filtered[i]);
-    else if(s === "planned" || s === "generating") ready.push(filtered[i]);
-    else if(s === "running") inprogress.push(filtered[i]);
+    // Epics sit in the column their subtasks have reached.
+    var s = filtered[i].rollup ? (filtered[i].rollup.state || "pending") : filtered[i].effective_state;
+    if(s === "pending" || s === "blocked" || s === "failed") backlog.push(filtered[i]);
+    else if(s === "planned" || s === "planning" || s === "awaiting_approval") ready.push(filtered[i]);
+    else if(s === "running" || s === "in_review") inprogress.push(filtered[i]);
     else done.push(filtered[i]);
   }
 
@@ -3745,10 +4140,10 @@ function makeCanvasCol(title, colId, tasks){
 
 function makeCanvasCard(tsk, colId){
   var priClass = "pri-" + (tsk.priority || "med");
-  var card = el("div","canvas-card " + priClass);
+  var card = el("div","canvas-card " + priClass + (tsk.rollup ? " canvas-card-epic" : ""));
 
-  // Draggable
-  card.setAttribute("draggable","true");
+  // Draggable; epics move with their subtasks instead
+  card.setAttribute("draggable", tsk.rollup ? "false" : "true");
   card.addEventListener("dragstart",function(e){
     canvasDragTaskId = tsk.id;
     canvasDragFromCol = colId;
@@ -3773,6 +4168,8 @@ function makeCanvasCard(tsk, colId){
     labels.appendChild(span("canvas-label canvas-label-"+tsk.assignee, asnText));
   }
   if(tsk.auto_pilot) labels.appendChild(span("canvas-label canvas-label-ap","AP"));
+  if(tsk.rollup) labels.appendChild(span("canvas-label canvas-label-epic", t("task.epic")));
+  if(tsk.parent_id) labels.appendChild(span("canvas-label canvas-label-parent", "\u2191 #" + tsk.parent_id));
   if(labels.children.length > 0) inner.appendChild(labels);
 
   // Title + description
@@ -3786,11 +4183,19 @@ function makeCanvasCard(tsk, colId){
 
   inner.appendChild(el("div","canvas-card-title",[titleText]));
   if(descText) inner.appendChild(el("div","canvas-card-desc",[descText]));
+  if(tsk.rollup){
+    var ebar = div("task-epic-bar");
+    var efill = div("task-epic-bar-fill");
+    efill.style.width = (tsk.rollup.total ? Math.round(100 * tsk.rollup.done / tsk.rollup.total) : 0) + "%";
+    ebar.appendChild(efill);
+    inner.appendChild(ebar);
+  }
 
   // Footer
   var footer = el("div","canvas-card-footer");
   footer.appendChild(span("canvas-card-id","#"+tsk.id));
   footer.appendChild(span("canvas-card-date",fmtRelDate(tsk.created_at)));
+  if(tsk.rollup) footer.appendChild(span("canvas-card-epic-count", t("task.epic_progress", {done: tsk.rollup.done, total: tsk.rollup.total})));
   if(tsk.has_plan){
     var planIcon = span("canvas-card-plan-icon","\u2713");
     planIcon.title = t("task.has_plan");
@@ -6508,6 +6913,105 @@ function renderConfigServer(root){
   if(editing) sec.appendChild(configEditActions("server"));
   root.appendChild(sec);
 
+  renderConfigTokens(root);
+}
+
+function renderConfigTokens(root){
+  var sec = div("config-section");
+  var hdr = div("section-header");
+  hdr.appendChild(el("h3","config-section-title",[t("config.tokens.title")]));
+  sec.appendChild(hdr);
+  sec.appendChild(el("div","config-field-desc",[t("config.tokens.description")]));
+  root.appendChild(sec);
+
+  if(apiTokensCache === null){
+    if(!apiTokensLoading){
+      apiTokensLoading = true;
+      api("GET","/api/tokens",null,function(d){
+        apiTokensLoading = false;
+        apiTokensCache = d.tokens || [];
+        render();
+      });
+    }
+    sec.appendChild(el("div","config-empty",[t("config.tokens.loading")]));
+    return;
+  }
+
+  // The secret of a new token is only returned once, so keep it on screen
+  // until it is dismissed.
+  if(apiTokenCreated){
+    var box = div("token-secret");
+    box.appendChild(el("div","config-field-desc",[t("config.tokens.created", {name: apiTokenCreated.name})]));
+    box.appendChild(el("code","token-secret-value",[apiTokenCreated.secret]));
+    var boxActs = div("config-actions");
+    var copyBtn = el("button","btn",[t("config.tokens.copy")]);
+    copyBtn.onclick = (function(secret){
+      return function(){
+        navigator.clipboard.writeText(secret).then(function(){ toast(t("config.tokens.copied"),"success"); });
+      };
+    })(apiTokenCreated.secret);
+    boxActs.appendChild(copyBtn);
+    var doneBtn = el("button","btn btn-primary",[t("config.tokens.done")]);
+    doneBtn.onclick = function(){ apiTokenCreated = null; render(); };
+    boxActs.appendChild(doneBtn);
+    box.appendChild(boxActs);
+    sec.appendChild(box);
+  }
+
+  if(apiTokensCache.length === 0){
+    sec.appendChild(el("div","config-empty",[t("config.tokens.empty")]));
+  }
+  apiTokensCache.forEach(function(tok){
+    var row = div("tmpl-row");
+    var info = div("tmpl-row-info");
+    info.appendChild(span("tmpl-row-name", tok.name));
+    var meta = [t("config.tokens.scope." + tok.scope), tok.prefix + "\u2026"];
+    if(tok.expires_at){
+      meta.push(new Date(tok.expires_at) <= new Date() ? t("config.tokens.expired") : t("config.tokens.expires_at", {time: fmtDate(tok.expires_at)}));
+    }
+    meta.push(tok.last_used_at ? t("config.tokens.last_used", {time: fmtDate(tok.last_used_at)}) : t("config.tokens.never_used"));
+    info.appendChild(span("tmpl-row-preview", meta.join(" \u00b7 ")));
+    row.appendChild(info);
+    var acts = div("tmpl-row-actions");
+    acts.appendChild(iconBtn("trash", t("config.tokens.revoke"), function(){
+      if(!confirm(t("config.tokens.revoke_confirm", {name: tok.name}))) return;
+      api("POST","/api/tokens/revoke",{id:tok.id},function(d){
+        if(d.error){ toast(t("common.error", {error: d.error}),"error"); return; }
+        apiTokensCache = apiTokensCache.filter(function(x){ return x.id !== tok.id; });
+        toast(t("config.tokens.revoked"),"success");
+        render();
+      });
+    }));
+    row.appendChild(acts);
+    sec.appendChild(row);
+  });
+
+  var grid = div("config-grid");
+  grid.appendChild(configInput("token_name", t("config.tokens.name"), ""));
+  var scopeField = div("config-field");
+  scopeField.appendChild(el("label","config-label",[t("config.tokens.scope")]));
+  var scopeSel = document.createElement("select"); scopeSel.className = "config-input"; scopeSel.id = "cfg-token_scope";
+  ["read","tasks-write","admin"].forEach(function(v){ var o = document.createElement("option"); o.value = v; o.textContent = t("config.tokens.scope." + v); scopeSel.appendChild(o); });
+  scopeField.appendChild(scopeSel);
+  grid.appendChild(scopeField);
+  grid.appendChild(configInput("token_expires", t("config.tokens.expires"), ""));
+  grid.querySelector("#cfg-token_expires").placeholder = t("config.tokens.expires_placeholder");
+  sec.appendChild(grid);
+  var formActs = div("config-actions");
+  var createBtn = el("button","btn btn-primary",[t("config.tokens.create")]);
+  createBtn.onclick = function(){
+    var name = document.getElementById("cfg-token_name").value.trim();
+    if(!name){ toast(t("config.tokens.name_required"),"error"); return; }
+    var body = {name: name, scope: scopeSel.value, expires_in: document.getElementById("cfg-token_expires").value.trim()};
+    api("POST","/api/tokens/create",body,function(d){
+      if(d.error){ toast(t("common.error", {error: d.error}),"error"); return; }
+      apiTokenCreated = d;
+      apiTokensCache = null;
+      render();
+    });
+  };
+  formActs.appendChild(createBtn);
+  sec.appendChild(formActs);
 }
 
 function renderConfigLimits(root){
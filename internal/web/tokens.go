@@ -0,0 +1,238 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/JuanVilla424/teamoon/internal/queue"
+	"github.com/JuanVilla424/teamoon/internal/tokens"
+)
+
+// adminPaths need an admin token even to read, as they expose settings.
+var adminPaths = []string{"/api/config", "/api/webhooks", "/api/tokens", apiPrefix + "/tokens", "/api/update"}
+
+// taskWriteRoutes are the writes a tasks-write token may make: creating,
+// editing, stopping and archiving tasks. Anything that rewrites the
+// repository or a plan, or runs an agent, such as checkpoint restores,
+// plan edits and the autopilot toggle, stays admin only.
+var taskWriteRoutes = map[string]bool{
+	"POST /api/tasks/add":                    true,
+	"POST /api/tasks/update":                 true,
+	"POST /api/tasks/labels":                 true,
+	"POST /api/tasks/parent":                 true,
+	"POST /api/tasks/assignee":               true,
+	"POST /api/tasks/depends":                true,
+	"POST /api/tasks/attach":                 true,
+	"POST /api/tasks/done":                   true,
+	"POST /api/tasks/retry":                  true,
+	"POST /api/tasks/stop":                   true,
+	"POST /api/tasks/archive":                true,
+	"POST /api/tasks/search":                 true,
+	"POST /api/filters/save":                 true,
+	"POST /api/filters/delete":               true,
+	"POST /api/upload":                       true,
+	"POST " + apiPrefix + "/tasks":           true,
+	"PATCH " + apiPrefix + "/tasks/{id}":     true,
+	"DELETE " + apiPrefix + "/tasks/{id}":    true,
+	"POST " + apiPrefix + "/tasks/{id}/stop": true,
+}
+
+var taskIDSegment = regexp.MustCompile(`^(` + regexp.QuoteMeta(apiPrefix) + `/tasks/)[^/]+`)
+
+func underPath(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// requiredScope is the token scope r needs: read for reads, tasks-write for
+// the routes in taskWriteRoutes, and admin for everything else.
+func requiredScope(r *http.Request) string {
+	for _, p := range adminPaths {
+		if underPath(r.URL.Path, p) {
+			return tokens.ScopeAdmin
+		}
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return tokens.ScopeRead
+	}
+	route := r.Method + " " + taskIDSegment.ReplaceAllString(r.URL.Path, "${1}{id}")
+	if taskWriteRoutes[route] {
+		return tokens.ScopeTasksWrite
+	}
+	return tokens.ScopeAdmin
+}
+
+type tokenKey struct{}
+
+// requestToken returns the API token r was authenticated with, if any.
+func requestToken(r *http.Request) (tokens.Token, bool) {
+	tok, ok := r.Context().Value(tokenKey{}).(tokens.Token)
+	return tok, ok
+}
+
+// actorOf is who to record in the task timeline for r: the API token it
+// carried, or the web UI.
+func actorOf(r *http.Request) string {
+	if tok, ok := requestToken(r); ok {
+		return queue.ActorToken(tok.Name)
+	}
+	return queue.ActorWeb
+}
+
+// adminDenied returns the message to refuse r with when it was made with a
+// token below admin scope and asks for what, an admin-only effect of a route
+// that is otherwise open to tasks-write tokens.
+func adminDenied(r *http.Request, what string) (string, bool) {
+	tok, ok := requestToken(r)
+	if !ok || tok.Allows(tokens.ScopeAdmin) {
+		return "", false
+	}
+	return fmt.Sprintf("token %q has scope %s, %s needs %s", tok.Name, tok.Scope, what, tokens.ScopeAdmin), true
+}
+
+// runsAgent reports whether creating a task for assignee starts it on
+// autopilot.
+func runsAgent(assignee string) bool {
+	return assignee == "agent" || assignee == "system"
+}
+
+// checkAuth decides whether r may go through. It returns r, carrying its
+// API token if it was sent with one, or the status and message to refuse it
+// with: 401 without valid credentials, 403 when a token's scope does not
+// cover the request. A browser session may do anything; without a password,
+// so may anonymous requests.
+func (s *Server) checkAuth(r *http.Request) (*http.Request, int, string) {
+	if h := r.Header.Get("Authorization"); h != "" {
+		secret, ok := strings.CutPrefix(h, "Bearer ")
+		if !ok {
+			return r, http.StatusUnauthorized, "unsupported authorization scheme, use Bearer"
+		}
+		tok, err := tokens.Authenticate(strings.TrimSpace(secret))
+		if err != nil {
+			return r, http.StatusUnauthorized, err.Error()
+		}
+		if need := requiredScope(r); !tok.Allows(need) {
+			return r, http.StatusForbidden, fmt.Sprintf("token %q has scope %s, this needs %s", tok.Name, tok.Scope, need)
+		}
+		return r.WithContext(context.WithValue(r.Context(), tokenKey{}, tok)), 0, ""
+	}
+	if s.cfg.WebPassword == "" {
+		return r, 0, ""
+	}
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil || !s.sessions.validate(cookie.Value) {
+		return r, http.StatusUnauthorized, "unauthorized"
+	}
+	return r, 0, ""
+}
+
+// tokenInput is the body of a token creation request.
+type tokenInput struct {
+	Name      string `json:"name"`
+	Scope     string `json:"scope"`
+	ExpiresIn string `json:"expires_in,omitempty"` // e.g. "30d" or "12h"; empty never expires
+}
+
+// createdToken is a new token with its secret, which is only shown once.
+type createdToken struct {
+	tokens.Token
+	Secret string `json:"secret"`
+}
+
+func createToken(req tokenInput) (createdToken, error) {
+	ttl, err := tokens.ParseTTL(req.ExpiresIn)
+	if err != nil {
+		return createdToken{}, err
+	}
+	t, secret, err := tokens.Create(req.Name, req.Scope, ttl)
+	return createdToken{Token: t, Secret: secret}, err
+}
+
+func (s *Server) handleTokens(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErr(w, 405, "method not allowed")
+		return
+	}
+	list, err := tokens.List()
+	if err != nil {
+		writeErr(w, 500, err.Error())
+		return
+	}
+	writeJSON(w, map[string]any{"tokens": list, "scopes": tokens.Scopes})
+}
+
+func (s *Server) handleTokenCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErr(w, 405, "method not allowed")
+		return
+	}
+	var req tokenInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, 400, err.Error())
+		return
+	}
+	t, err := createToken(req)
+	if err != nil {
+		writeErr(w, 400, err.Error())
+		return
+	}
+	writeJSON(w, t)
+}
+
+func (s *Server) handleTokenRevoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErr(w, 405, "method not allowed")
+		return
+	}
+	var req struct {
+		ID int `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, 400, err.Error())
+		return
+	}
+	if _, err := tokens.Revoke(strconv.Itoa(req.ID)); err != nil {
+		writeErr(w, 404, err.Error())
+		return
+	}
+	writeJSON(w, map[string]bool{"ok": true})
+}
+
+func (s *Server) apiTokenList(w http.ResponseWriter, r *http.Request) {
+	list, err := tokens.List()
+	if err != nil {
+		writeAPIErr(w, 500, err.Error())
+		return
+	}
+	writePage(w, r, list)
+}
+
+func (s *Server) apiTokenCreate(w http.ResponseWriter, r *http.Request) {
+	var req tokenInput
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	t, err := createToken(req)
+	if err != nil {
+		writeAPIErr(w, 400, err.Error())
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s/tokens/%d", apiPrefix, t.ID))
+	writeAPI(w, 201, t)
+}
+
+func (s *Server) apiTokenRevoke(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if _, err := tokens.Revoke(strconv.Itoa(id)); err != nil {
+		writeAPIErr(w, 404, fmt.Sprintf("token #%d not found", id))
+		return
+	}
+	w.WriteHeader(204)
+}
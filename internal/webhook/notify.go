@@ -0,0 +1,359 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+)
+
+// Levels of a message, mapped to colours, tags and priorities by the formats.
+const (
+	levelInfo    = "info"
+	levelSuccess = "success"
+	levelWarn    = "warn"
+	levelError   = "error"
+)
+
+// message is the human-readable form of an event used by the chat formats.
+type message struct {
+	Title  string
+	Text   string
+	URL    string
+	Level  string
+	Fields [][2]string // name, value
+	Time   time.Time
+}
+
+// eventPayload is the subset of a published payload the chat formats read.
+type eventPayload struct {
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+	Task  *struct {
+		ID          int    `json:"id"`
+		Project     string `json:"project"`
+		Description string `json:"description"`
+		State       string `json:"state"`
+		FailReason  string `json:"fail_reason"`
+		PRURL       string `json:"pr_url"`
+	} `json:"task"`
+	Job *struct {
+		ID      int    `json:"id"`
+		Name    string `json:"name"`
+		Project string `json:"project"`
+	} `json:"job"`
+	Project string `json:"project"`
+	Reason  string `json:"reason"`
+	Step    int    `json:"step"`
+	Title   string `json:"title"`
+	Class   string `json:"class"`
+	Status  string `json:"status"`
+	Result  string `json:"result"`
+}
+
+// projectOf returns the project an event belongs to, for endpoint routing.
+func projectOf(fields map[string]any) string {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return ""
+	}
+	var p eventPayload
+	json.Unmarshal(data, &p)
+	switch {
+	case p.Task != nil:
+		return p.Task.Project
+	case p.Job != nil:
+		return p.Job.Project
+	}
+	return p.Project
+}
+
+// describe turns an event body into a message linking back to the web UI.
+func describe(body []byte, baseURL string) (message, error) {
+	var p eventPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return message{}, err
+	}
+	m := message{Level: levelInfo, Time: p.Time, URL: baseURL + "/#dashboard"}
+	if p.Task != nil {
+		t := p.Task
+		m.URL = fmt.Sprintf("%s/#queue/%d", baseURL, t.ID)
+		m.Text = truncate(t.Description, 300)
+		m.Fields = append(m.Fields, [2]string{"Project", t.Project})
+		if t.State != "" {
+			m.Fields = append(m.Fields, [2]string{"State", t.State})
+		}
+		if t.PRURL != "" {
+			m.Fields = append(m.Fields, [2]string{"Pull request", t.PRURL})
+		}
+	}
+	id := 0
+	if p.Task != nil {
+		id = p.Task.ID
+	}
+	switch p.Event {
+	case "task_created":
+		m.Title = fmt.Sprintf("Task #%d created", id)
+	case EventPlanReady:
+		m.Title = fmt.Sprintf("Plan ready for task #%d", id)
+	case "plan_awaiting_approval":
+		m.Title, m.Level = fmt.Sprintf("Task #%d plan awaits approval", id), levelWarn
+	case EventStepFailed:
+		m.Title, m.Level = fmt.Sprintf("Task #%d step %d failed (%s)", id, p.Step, p.Class), levelWarn
+		if p.Title != "" {
+			m.Fields = append(m.Fields, [2]string{"Step", p.Title})
+		}
+	case "task_retry":
+		m.Title = fmt.Sprintf("Task #%d queued for retry", id)
+	case "task_in_review":
+		m.Title = fmt.Sprintf("Task #%d is in review", id)
+	case EventPRMerged:
+		m.Title, m.Level = fmt.Sprintf("Task #%d pull request merged", id), levelSuccess
+	case "task_pr_closed":
+		m.Title, m.Level = fmt.Sprintf("Task #%d pull request closed", id), levelError
+	case "task_done":
+		m.Title, m.Level = fmt.Sprintf("Task #%d done", id), levelSuccess
+	case "task_failed":
+		m.Title, m.Level = fmt.Sprintf("Task #%d failed", id), levelError
+		if p.Task != nil && p.Task.FailReason != "" {
+			m.Text += "\n" + truncate(p.Task.FailReason, 300)
+		}
+	case EventBudgetExceeded:
+		m.Title, m.Level = "Budget exceeded", levelWarn
+		m.Text = p.Reason
+	case EventGuardrailPaused:
+		m.Title, m.Level = fmt.Sprintf("Autopilot paused for %s", p.Project), levelWarn
+		m.Text = p.Reason
+		m.URL = baseURL + "/#projects"
+	case EventJobFinished:
+		m.URL = baseURL + "/#jobs"
+		if p.Job != nil {
+			m.Title = fmt.Sprintf("Job %q finished", p.Job.Name)
+			m.Fields = append(m.Fields, [2]string{"Project", p.Job.Project})
+		}
+		m.Text = truncate(p.Result, 300)
+		m.Level = levelSuccess
+		if p.Status == "error" {
+			m.Level = levelError
+		}
+		m.Fields = append(m.Fields, [2]string{"Status", p.Status})
+	case EventPing:
+		m.Title = "Ping from teamoon"
+		m.Text = "This endpoint is set up to receive notifications."
+	default:
+		m.Title = p.Event
+		if id != 0 {
+			m.Title = fmt.Sprintf("%s: task #%d", p.Event, id)
+		}
+	}
+	return m, nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// request is a rendered delivery.
+type request struct {
+	method      string
+	url         string
+	contentType string
+	body        []byte
+	headers     map[string]string
+}
+
+// render builds the request ep expects for d.
+func render(ep config.WebhookEndpoint, d Delivery, baseURL string) (request, error) {
+	out := request{method: http.MethodPost, url: ep.URL, contentType: "application/json"}
+	if ep.Format == "" || ep.Format == config.WebhookFormatJSON {
+		out.body = d.Body
+		return out, nil
+	}
+	m, err := describe(d.Body, baseURL)
+	if err != nil {
+		return out, err
+	}
+	var v any
+	switch ep.Format {
+	case config.WebhookFormatSlack:
+		v = slackMessage(m)
+	case config.WebhookFormatDiscord:
+		v = discordMessage(m)
+	case config.WebhookFormatMatrix:
+		// The delivery ID is the transaction ID, so a retried send is not
+		// posted twice.
+		out.method = http.MethodPut
+		out.url = strings.TrimRight(ep.URL, "/") + "/" + url.PathEscape(d.ID)
+		out.headers = bearer(ep.Token)
+		v = matrixMessage(m)
+	case config.WebhookFormatNtfy:
+		out.contentType = "text/plain; charset=utf-8"
+		out.body = []byte(plainText(m))
+		out.headers = bearer(ep.Token)
+		if out.headers == nil {
+			out.headers = map[string]string{}
+		}
+		out.headers["Title"] = m.Title
+		out.headers["Click"] = m.URL
+		out.headers["Tags"] = ntfyTags[m.Level]
+		out.headers["Priority"] = "3"
+		if m.Level == levelError {
+			out.headers["Priority"] = "4"
+		}
+		return out, nil
+	default:
+		return out, fmt.Errorf("unknown webhook format %q", ep.Format)
+	}
+	out.body, err = json.Marshal(v)
+	return out, err
+}
+
+func bearer(token string) map[string]string {
+	if token == "" {
+		return nil
+	}
+	return map[string]string{"Authorization": "Bearer " + token}
+}
+
+var ntfyTags = map[string]string{
+	levelInfo:    "information_source",
+	levelSuccess: "white_check_mark",
+	levelWarn:    "warning",
+	levelError:   "x",
+}
+
+var colors = map[string]int{
+	levelInfo:    0x3498db,
+	levelSuccess: 0x2ecc71,
+	levelWarn:    0xf1c40f,
+	levelError:   0xe74c3c,
+}
+
+func plainText(m message) string {
+	var b strings.Builder
+	if m.Text != "" {
+		b.WriteString(m.Text + "\n")
+	}
+	for _, f := range m.Fields {
+		b.WriteString(f[0] + ": " + f[1] + "\n")
+	}
+	b.WriteString(m.URL)
+	return b.String()
+}
+
+// slackMessage is a Slack incoming-webhook body in Block Kit.
+func slackMessage(m message) map[string]any {
+	text := fmt.Sprintf("*<%s|%s>*", m.URL, slackEscape(m.Title))
+	if m.Text != "" {
+		text += "\n" + slackEscape(m.Text)
+	}
+	blocks := []any{map[string]any{
+		"type": "section",
+		"text": map[string]any{"type": "mrkdwn", "text": text},
+	}}
+	if len(m.Fields) > 0 {
+		var ctx []any
+		for _, f := range m.Fields {
+			ctx = append(ctx, map[string]any{"type": "mrkdwn", "text": "*" + f[0] + ":* " + slackEscape(f[1])})
+		}
+		blocks = append(blocks, map[string]any{"type": "context", "elements": ctx})
+	}
+	return map[string]any{"text": m.Title, "blocks": blocks}
+}
+
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// discordMessage is a Discord webhook body with a single embed.
+func discordMessage(m message) map[string]any {
+	embed := map[string]any{
+		"title":       m.Title,
+		"description": m.Text,
+		"url":         m.URL,
+		"color":       colors[m.Level],
+	}
+	if !m.Time.IsZero() {
+		embed["timestamp"] = m.Time.UTC().Format(time.RFC3339)
+	}
+	var fields []any
+	for _, f := range m.Fields {
+		fields = append(fields, map[string]any{"name": f[0], "value": f[1], "inline": true})
+	}
+	if fields != nil {
+		embed["fields"] = fields
+	}
+	return map[string]any{"username": "teamoon", "embeds": []any{embed}}
+}
+
+// matrixMessage is an m.room.message notice with an HTML rendering.
+func matrixMessage(m message) map[string]any {
+	var h strings.Builder
+	fmt.Fprintf(&h, `<b><a href="%s">%s</a></b>`, html.EscapeString(m.URL), html.EscapeString(m.Title))
+	if m.Text != "" {
+		h.WriteString("<br>" + strings.ReplaceAll(html.EscapeString(m.Text), "\n", "<br>"))
+	}
+	for _, f := range m.Fields {
+		h.WriteString("<br><i>" + html.EscapeString(f[0]) + ":</i> " + html.EscapeString(f[1]))
+	}
+	return map[string]any{
+		"msgtype":        "m.notice",
+		"body":           m.Title + "\n" + plainText(m),
+		"format":         "org.matrix.custom.html",
+		"formatted_body": h.String(),
+	}
+}
+
+// quietUntil reports whether event falls in q's window at now and, if so,
+// when the window ends.
+func quietUntil(q *config.QuietHours, event string, now time.Time) (time.Time, bool) {
+	if q == nil || event == EventPing {
+		return time.Time{}, false
+	}
+	for _, u := range q.Urgent {
+		if u == event {
+			return time.Time{}, false
+		}
+	}
+	start, ok1 := clockMinutes(q.Start)
+	end, ok2 := clockMinutes(q.End)
+	if !ok1 || !ok2 || start == end {
+		return time.Time{}, false
+	}
+	cur := now.Hour()*60 + now.Minute()
+	in := cur >= start && cur < end
+	if end < start {
+		in = cur >= start || cur < end
+	}
+	if !in {
+		return time.Time{}, false
+	}
+	until := time.Date(now.Year(), now.Month(), now.Day(), end/60, end%60, 0, 0, now.Location())
+	if !until.After(now) {
+		until = until.AddDate(0, 0, 1)
+	}
+	return until, true
+}
+
+// clockMinutes parses "HH:MM" into minutes after midnight.
+func clockMinutes(s string) (int, bool) {
+	h, m, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok {
+		return 0, false
+	}
+	hh, err1 := strconv.Atoi(h)
+	mm, err2 := strconv.Atoi(m)
+	if err1 != nil || err2 != nil || hh < 0 || hh > 23 || mm < 0 || mm > 59 {
+		return 0, false
+	}
+	return hh*60 + mm, true
+}
@@ -0,0 +1,182 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+)
+
+func taskFields(id int, project string) map[string]any {
+	return map[string]any{"task": map[string]any{
+		"id": id, "project": project, "description": "fix the <login> page", "state": "failed",
+		"fail_reason": "step 2 failed",
+	}}
+}
+
+// deliverAs publishes event to a stand-in endpoint of format and returns
+// what the stand-in received.
+func deliverAs(t *testing.T, format, event string, fields map[string]any) (*receiver, []byte) {
+	t.Helper()
+	rc := &receiver{status: 200}
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+	t.Setenv("HOME", t.TempDir())
+	cfg := config.DefaultConfig()
+	cfg.Webhooks.BaseURL = "https://teamoon.example/"
+	cfg.Webhooks.Endpoints = []config.WebhookEndpoint{{Name: format, URL: srv.URL + "/hook", Format: format, Token: "tok"}}
+	Configure(cfg)
+
+	Publish(event, fields)
+	Flush(context.Background())
+	if len(rc.requests) != 1 {
+		t.Fatalf("%s: expected one request, got %d", format, len(rc.requests))
+	}
+	return rc, rc.bodies[0]
+}
+
+func TestFormat_Slack(t *testing.T) {
+	_, body := deliverAs(t, config.WebhookFormatSlack, "task_failed", taskFields(12, "api"))
+	var msg struct {
+		Text   string `json:"text"`
+		Blocks []struct {
+			Type string `json:"type"`
+			Text struct {
+				Text string `json:"text"`
+			} `json:"text"`
+		} `json:"blocks"`
+	}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Text != "Task #12 failed" || len(msg.Blocks) != 2 || msg.Blocks[0].Type != "section" {
+		t.Fatalf("slack body = %s", body)
+	}
+	section := msg.Blocks[0].Text.Text
+	if !strings.Contains(section, "<https://teamoon.example/#queue/12|Task #12 failed>") || !strings.Contains(section, "&lt;login&gt;") {
+		t.Errorf("section = %q", section)
+	}
+}
+
+func TestFormat_Discord(t *testing.T) {
+	_, body := deliverAs(t, config.WebhookFormatDiscord, "task_done", taskFields(3, "web"))
+	var msg struct {
+		Embeds []struct {
+			Title  string `json:"title"`
+			URL    string `json:"url"`
+			Color  int    `json:"color"`
+			Fields []struct {
+				Name  string `json:"name"`
+				Value string `json:"value"`
+			} `json:"fields"`
+		} `json:"embeds"`
+	}
+	if err := json.Unmarshal(body, &msg); err != nil || len(msg.Embeds) != 1 {
+		t.Fatalf("discord body = %s", body)
+	}
+	e := msg.Embeds[0]
+	if e.Title != "Task #3 done" || e.URL != "https://teamoon.example/#queue/3" || e.Color != colors[levelSuccess] {
+		t.Errorf("embed = %+v", e)
+	}
+	if len(e.Fields) == 0 || e.Fields[0].Name != "Project" || e.Fields[0].Value != "web" {
+		t.Errorf("fields = %+v", e.Fields)
+	}
+}
+
+func TestFormat_Matrix(t *testing.T) {
+	rc, body := deliverAs(t, config.WebhookFormatMatrix, EventPlanReady, taskFields(5, "api"))
+	req := rc.requests[0]
+	if req.Method != "PUT" || !strings.HasPrefix(req.URL.Path, "/hook/") || len(req.URL.Path) <= len("/hook/") {
+		t.Errorf("matrix request = %s %s", req.Method, req.URL.Path)
+	}
+	if req.Header.Get("Authorization") != "Bearer tok" {
+		t.Errorf("authorization = %q", req.Header.Get("Authorization"))
+	}
+	var msg map[string]string
+	json.Unmarshal(body, &msg)
+	if msg["msgtype"] != "m.notice" || !strings.Contains(msg["formatted_body"], `href="https://teamoon.example/#queue/5"`) {
+		t.Errorf("matrix body = %s", body)
+	}
+}
+
+func TestFormat_Ntfy(t *testing.T) {
+	rc, body := deliverAs(t, config.WebhookFormatNtfy, "task_failed", taskFields(8, "api"))
+	h := rc.requests[0].Header
+	if h.Get("Title") != "Task #8 failed" || h.Get("Click") != "https://teamoon.example/#queue/8" || h.Get("Priority") != "4" || h.Get("Tags") != "x" {
+		t.Errorf("ntfy headers = %v", h)
+	}
+	if !strings.Contains(string(body), "step 2 failed") {
+		t.Errorf("ntfy body = %q", body)
+	}
+}
+
+func TestPublish_RoutesByProject(t *testing.T) {
+	rc := &receiver{status: 200}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	setup(t, config.WebhookEndpoint{Name: "api-team", URL: srv.URL, Projects: []string{"api"}})
+
+	Publish("task_done", taskFields(1, "web"))
+	Publish("task_done", taskFields(2, "api"))
+	Publish(EventJobFinished, map[string]any{"job": map[string]any{"id": 1, "project": "web"}})
+	Publish(EventGuardrailPaused, map[string]any{"project": "api"})
+	Flush(context.Background())
+
+	if len(rc.requests) != 2 {
+		t.Fatalf("expected the api events only, got %d", len(rc.requests))
+	}
+}
+
+func TestQuietHours(t *testing.T) {
+	q := &config.QuietHours{Start: "22:00", End: "07:00", Urgent: []string{"task_failed"}}
+	day := func(h, m int) time.Time { return time.Date(2026, 3, 1, h, m, 0, 0, time.UTC) }
+
+	if until, quiet := quietUntil(q, "task_done", day(23, 30)); !quiet || !until.Equal(time.Date(2026, 3, 2, 7, 0, 0, 0, time.UTC)) {
+		t.Errorf("23:30 = %v %v", until, quiet)
+	}
+	if until, quiet := quietUntil(q, "task_done", day(3, 0)); !quiet || !until.Equal(day(7, 0)) {
+		t.Errorf("03:00 = %v %v", until, quiet)
+	}
+	if _, quiet := quietUntil(q, "task_done", day(12, 0)); quiet {
+		t.Error("noon should not be quiet")
+	}
+	if _, quiet := quietUntil(q, "task_failed", day(23, 0)); quiet {
+		t.Error("urgent events should go through")
+	}
+	if _, quiet := quietUntil(&config.QuietHours{Start: "9", End: "17:00"}, "task_done", day(12, 0)); quiet {
+		t.Error("a malformed window should be ignored")
+	}
+}
+
+func TestQuietHours_HoldDelivery(t *testing.T) {
+	rc := &receiver{status: 200}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	t.Setenv("HOME", t.TempDir())
+	now := time.Now()
+	cfg := config.DefaultConfig()
+	cfg.Webhooks.QuietHours = &config.QuietHours{
+		Start: now.Add(-time.Hour).Format("15:04"),
+		End:   now.Add(time.Hour).Format("15:04"),
+	}
+	cfg.Webhooks.Endpoints = []config.WebhookEndpoint{
+		{Name: "chat", URL: srv.URL, Format: config.WebhookFormatSlack},
+		{Name: "machine", URL: srv.URL},
+	}
+	Configure(cfg)
+
+	Publish("task_done", taskFields(1, "api"))
+	Flush(context.Background())
+
+	if len(rc.requests) != 1 || rc.requests[0].Header.Get(HeaderEvent) != "task_done" {
+		t.Fatalf("expected only the json endpoint served, got %d requests", len(rc.requests))
+	}
+	pending, _ := Pending()
+	if len(pending) != 1 || pending[0].Endpoint != "chat" || !pending[0].NextAt.After(now) {
+		t.Errorf("pending = %+v", pending)
+	}
+}
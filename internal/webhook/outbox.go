@@ -0,0 +1,213 @@
+package webhook
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+	"github.com/JuanVilla424/teamoon/internal/persist"
+)
+
+// Delivery is one event queued for one endpoint.
+type Delivery struct {
+	ID        string          `json:"id"`
+	Endpoint  string          `json:"endpoint"`
+	Event     string          `json:"event"`
+	Body      json.RawMessage `json:"body"`
+	Attempts  int             `json:"attempts"`
+	CreatedAt time.Time       `json:"created_at"`
+	NextAt    time.Time       `json:"next_at"`
+	LastError string          `json:"last_error,omitempty"`
+}
+
+// Values for Attempt.Outcome.
+const (
+	OutcomeDelivered = "delivered"
+	OutcomeRetrying  = "retrying"
+	OutcomeFailed    = "failed"
+)
+
+// Attempt is one entry of the delivery log.
+type Attempt struct {
+	Delivery   string    `json:"delivery"`
+	Endpoint   string    `json:"endpoint"`
+	Event      string    `json:"event"`
+	Attempt    int       `json:"attempt"`
+	Status     int       `json:"status,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	Outcome    string    `json:"outcome"`
+	Time       time.Time `json:"time"`
+}
+
+// OK reports whether the receiver accepted the delivery.
+func (a Attempt) OK() bool {
+	return a.Error == "" && a.Status >= 200 && a.Status < 300
+}
+
+// maxLogEntries bounds the delivery log; older attempts are dropped.
+const maxLogEntries = 500
+
+// leaseFor keeps a delivery being sent from being picked up by another
+// dispatcher. A crash mid-send retries it once the lease runs out.
+const leaseFor = time.Minute
+
+var (
+	outboxMu = persist.NewMutex(outboxPath)
+	logMu    = persist.NewMutex(logPath)
+)
+
+func outboxPath() string {
+	return filepath.Join(config.ConfigDir(), "webhooks", "outbox.json")
+}
+
+func logPath() string {
+	return filepath.Join(config.ConfigDir(), "webhooks", "deliveries.json")
+}
+
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return persist.WriteFile(path, data, 0600)
+}
+
+func enqueue(ds ...Delivery) error {
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+	var box []Delivery
+	if err := readJSON(outboxPath(), &box); err != nil {
+		return err
+	}
+	return writeJSON(outboxPath(), append(box, ds...))
+}
+
+// takeDue returns the deliveries due at now and leases them.
+func takeDue(now time.Time) ([]Delivery, error) {
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+	var box []Delivery
+	if err := readJSON(outboxPath(), &box); err != nil {
+		return nil, err
+	}
+	var due []Delivery
+	for i := range box {
+		if !box[i].NextAt.After(now) {
+			due = append(due, box[i])
+			box[i].NextAt = now.Add(leaseFor)
+		}
+	}
+	if len(due) == 0 {
+		return nil, nil
+	}
+	return due, writeJSON(outboxPath(), box)
+}
+
+// requeue stores d's retry state and logs the failed attempt.
+func requeue(d Delivery, a Attempt) error {
+	a.Outcome = OutcomeRetrying
+	appendLog(a)
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+	var box []Delivery
+	if err := readJSON(outboxPath(), &box); err != nil {
+		return err
+	}
+	for i := range box {
+		if box[i].ID == d.ID {
+			box[i] = d
+		}
+	}
+	return writeJSON(outboxPath(), box)
+}
+
+// finish drops d from the outbox and logs its last attempt.
+func finish(d Delivery, a Attempt, delivered bool) {
+	a.Delivery, a.Endpoint, a.Event = d.ID, d.Endpoint, d.Event
+	if a.Attempt == 0 {
+		a.Attempt = d.Attempts
+	}
+	if a.Time.IsZero() {
+		a.Time = time.Now()
+	}
+	a.Outcome = OutcomeFailed
+	if delivered {
+		a.Outcome = OutcomeDelivered
+	}
+	appendLog(a)
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+	var box []Delivery
+	if err := readJSON(outboxPath(), &box); err != nil {
+		return
+	}
+	kept := box[:0]
+	for _, b := range box {
+		if b.ID != d.ID {
+			kept = append(kept, b)
+		}
+	}
+	writeJSON(outboxPath(), kept)
+}
+
+func appendLog(a Attempt) {
+	logMu.Lock()
+	defer logMu.Unlock()
+	var entries []Attempt
+	readJSON(logPath(), &entries)
+	entries = append(entries, a)
+	if len(entries) > maxLogEntries {
+		entries = entries[len(entries)-maxLogEntries:]
+	}
+	writeJSON(logPath(), entries)
+}
+
+// Pending returns the deliveries waiting in the outbox, oldest first.
+func Pending() ([]Delivery, error) {
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+	var box []Delivery
+	if err := readJSON(outboxPath(), &box); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(box, func(i, j int) bool { return box[i].CreatedAt.Before(box[j].CreatedAt) })
+	return box, nil
+}
+
+// Log returns up to limit delivery attempts, newest first. endpoint and
+// event filter the log when set; limit <= 0 returns everything.
+func Log(endpoint, event string, limit int) ([]Attempt, error) {
+	logMu.Lock()
+	defer logMu.Unlock()
+	var entries []Attempt
+	if err := readJSON(logPath(), &entries); err != nil {
+		return nil, err
+	}
+	var out []Attempt
+	for i := len(entries) - 1; i >= 0; i-- {
+		a := entries[i]
+		if (endpoint != "" && a.Endpoint != endpoint) || (event != "" && a.Event != event) {
+			continue
+		}
+		out = append(out, a)
+		if limit > 0 && len(out) == limit {
+			break
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,292 @@
+// Package webhook delivers teamoon events to the configured HTTP endpoints.
+// Events are written to a persistent outbox first and sent by a background
+// dispatcher, so a receiver that is down or a restart does not lose them.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+)
+
+// Events fired besides the task lifecycle ones sent by the queue.
+const (
+	EventPing            = "ping"
+	EventPlanReady       = "plan_ready"
+	EventStepFailed      = "step_failed"
+	EventGuardrailPaused = "guardrail_paused"
+	EventJobFinished     = "job_finished"
+	EventPRMerged        = "task_pr_merged"
+	EventBudgetExceeded  = "budget_exceeded"
+)
+
+// Headers set on every delivery. The signature is the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the endpoint secret.
+const (
+	HeaderEvent     = "X-Teamoon-Event"
+	HeaderDelivery  = "X-Teamoon-Delivery"
+	HeaderTimestamp = "X-Teamoon-Timestamp"
+	HeaderSignature = "X-Teamoon-Signature"
+)
+
+const defaultMaxAttempts = 8
+
+// settings is the webhook part of the config, resolved once per Configure.
+type settings struct {
+	endpoints []config.WebhookEndpoint
+	maxTries  int
+	baseURL   string
+	quiet     map[string]*config.QuietHours // by endpoint name
+}
+
+var (
+	mu     sync.Mutex
+	cur    settings
+	loaded bool
+	kick   = make(chan struct{}, 1)
+	client = &http.Client{Timeout: 10 * time.Second}
+)
+
+// Configure replaces the endpoint set. Processes that never call it load
+// the config once, on their first event.
+func Configure(cfg config.Config) {
+	st := settings{
+		endpoints: config.WebhookEndpoints(cfg),
+		maxTries:  cfg.Webhooks.MaxAttempts,
+		baseURL:   config.WebBaseURL(cfg),
+		quiet:     make(map[string]*config.QuietHours),
+	}
+	if st.maxTries <= 0 {
+		st.maxTries = defaultMaxAttempts
+	}
+	for _, ep := range st.endpoints {
+		st.quiet[ep.Name] = config.QuietHoursFor(cfg, ep)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	cur = st
+	loaded = true
+}
+
+func current() settings {
+	mu.Lock()
+	if !loaded {
+		mu.Unlock()
+		cfg, _ := config.Load()
+		Configure(cfg)
+		mu.Lock()
+	}
+	defer mu.Unlock()
+	return cur
+}
+
+// Publish queues event for every endpoint subscribed to it. fields are
+// merged into the payload next to "event" and "time".
+func Publish(event string, fields map[string]any) {
+	st := current()
+	publishTo(st, st.endpoints, event, fields)
+}
+
+// Ping queues a ping event for the named endpoint only, ignoring its
+// filters and quiet hours.
+func Ping(name string) error {
+	st := current()
+	for _, ep := range st.endpoints {
+		if ep.Name == name {
+			ep.Events, ep.Projects = nil, nil
+			st.quiet = nil
+			publishTo(st, []config.WebhookEndpoint{ep}, EventPing, nil)
+			return nil
+		}
+	}
+	return fmt.Errorf("no webhook endpoint named %q", name)
+}
+
+func publishTo(st settings, eps []config.WebhookEndpoint, event string, fields map[string]any) {
+	project := projectOf(fields)
+	var targets []config.WebhookEndpoint
+	for _, ep := range eps {
+		if ep.Wants(event) && ep.ForProject(project) {
+			targets = append(targets, ep)
+		}
+	}
+	if len(targets) == 0 {
+		return
+	}
+	payload := map[string]any{
+		"event": event,
+		"time":  time.Now(),
+	}
+	for k, v := range fields {
+		payload[k] = v
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("[webhook] %s: %v", event, err)
+		return
+	}
+	now := time.Now()
+	var ds []Delivery
+	for _, ep := range targets {
+		next := now
+		if until, quiet := quietUntil(st.quiet[ep.Name], event, now); quiet {
+			next = until
+		}
+		ds = append(ds, Delivery{
+			ID:        newID(),
+			Endpoint:  ep.Name,
+			Event:     event,
+			Body:      body,
+			CreatedAt: now,
+			NextAt:    next,
+		})
+	}
+	if err := enqueue(ds...); err != nil {
+		log.Printf("[webhook] queueing %s: %v", event, err)
+		return
+	}
+	select {
+	case kick <- struct{}{}:
+	default:
+	}
+}
+
+// Start runs the dispatcher until ctx is done. Due deliveries are sent
+// as soon as they are queued, and retries are checked every few seconds.
+func Start(ctx context.Context, cfg config.Config) {
+	Configure(cfg)
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			Flush(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-kick:
+			}
+		}
+	}()
+}
+
+// Flush sends every due delivery in the outbox once.
+func Flush(ctx context.Context) {
+	st := current()
+	byName := make(map[string]config.WebhookEndpoint, len(st.endpoints))
+	for _, ep := range st.endpoints {
+		byName[ep.Name] = ep
+	}
+	due, err := takeDue(time.Now())
+	if err != nil {
+		log.Printf("[webhook] outbox: %v", err)
+		return
+	}
+	for _, d := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		ep, ok := byName[d.Endpoint]
+		if !ok {
+			finish(d, Attempt{Error: "endpoint removed"}, false)
+			continue
+		}
+		a := send(ctx, ep, d, st.baseURL)
+		d.Attempts++
+		if a.OK() {
+			finish(d, a, true)
+			continue
+		}
+		d.LastError = a.Error
+		if a.Error == "" {
+			d.LastError = "HTTP " + strconv.Itoa(a.Status)
+		}
+		if d.Attempts >= st.maxTries {
+			log.Printf("[webhook] %s to %s: giving up after %d attempts: %s", d.Event, d.Endpoint, d.Attempts, d.LastError)
+			finish(d, a, false)
+			continue
+		}
+		d.NextAt = time.Now().Add(backoff(d.Attempts))
+		if err := requeue(d, a); err != nil {
+			log.Printf("[webhook] outbox: %v", err)
+		}
+	}
+}
+
+// backoff is the wait before retry n: 10s doubling up to an hour.
+func backoff(n int) time.Duration {
+	d := 10 * time.Second
+	for i := 1; i < n && d < time.Hour; i++ {
+		d *= 2
+	}
+	if d > time.Hour {
+		d = time.Hour
+	}
+	return d
+}
+
+func send(ctx context.Context, ep config.WebhookEndpoint, d Delivery, baseURL string) Attempt {
+	start := time.Now()
+	a := Attempt{Delivery: d.ID, Endpoint: d.Endpoint, Event: d.Event, Attempt: d.Attempts + 1, Time: start}
+	out, err := render(ep, d, baseURL)
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+	req, err := http.NewRequestWithContext(ctx, out.method, out.url, bytes.NewReader(out.body))
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+	ts := strconv.FormatInt(start.Unix(), 10)
+	req.Header.Set("Content-Type", out.contentType)
+	req.Header.Set("User-Agent", "teamoon-webhook")
+	for k, v := range out.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set(HeaderEvent, d.Event)
+	req.Header.Set(HeaderDelivery, d.ID)
+	req.Header.Set(HeaderTimestamp, ts)
+	if ep.Secret != "" {
+		req.Header.Set(HeaderSignature, "sha256="+Sign(ep.Secret, ts, out.body))
+	}
+	resp, err := client.Do(req)
+	a.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	a.Status = resp.StatusCode
+	return a
+}
+
+// Sign returns the hex HMAC-SHA256 of "<timestamp>.<body>" keyed by secret.
+// Receivers recompute it to check a delivery came from this server.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,157 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JuanVilla424/teamoon/internal/config"
+)
+
+type receiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+	w.WriteHeader(rc.status)
+}
+
+func setup(t *testing.T, eps ...config.WebhookEndpoint) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	cfg := config.DefaultConfig()
+	cfg.Webhooks.Endpoints = eps
+	cfg.Webhooks.MaxAttempts = 2
+	Configure(cfg)
+}
+
+func TestPublish_SignsAndDelivers(t *testing.T) {
+	rc := &receiver{status: 200}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	setup(t,
+		config.WebhookEndpoint{Name: "ci", URL: srv.URL, Secret: "s3cret", Events: []string{"task_*"}},
+		config.WebhookEndpoint{Name: "jobs", URL: srv.URL, Events: []string{EventJobFinished}},
+	)
+
+	Publish("task_done", map[string]any{"task": map[string]any{"id": 7}})
+	Flush(context.Background())
+
+	if len(rc.requests) != 1 {
+		t.Fatalf("expected one delivery, got %d", len(rc.requests))
+	}
+	req, body := rc.requests[0], rc.bodies[0]
+	if req.Header.Get(HeaderEvent) != "task_done" {
+		t.Errorf("event header = %q", req.Header.Get(HeaderEvent))
+	}
+	want := "sha256=" + Sign("s3cret", req.Header.Get(HeaderTimestamp), body)
+	if got := req.Header.Get(HeaderSignature); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(body, &payload); err != nil || payload["event"] != "task_done" || payload["task"] == nil {
+		t.Errorf("payload = %s", body)
+	}
+
+	if pending, _ := Pending(); len(pending) != 0 {
+		t.Errorf("outbox not drained: %+v", pending)
+	}
+	entries, _ := Log("", "", 0)
+	if len(entries) != 1 || entries[0].Outcome != OutcomeDelivered || entries[0].Status != 200 {
+		t.Errorf("log = %+v", entries)
+	}
+}
+
+func TestFlush_RetriesThenGivesUp(t *testing.T) {
+	rc := &receiver{status: 500}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	setup(t, config.WebhookEndpoint{Name: "flaky", URL: srv.URL})
+
+	Publish(EventPlanReady, nil)
+	Flush(context.Background())
+
+	pending, _ := Pending()
+	if len(pending) != 1 || pending[0].Attempts != 1 || pending[0].LastError != "HTTP 500" {
+		t.Fatalf("pending = %+v", pending)
+	}
+	if !pending[0].NextAt.After(time.Now()) {
+		t.Error("retry should be backed off")
+	}
+
+	// Not due yet: nothing is sent.
+	Flush(context.Background())
+	if len(rc.requests) != 1 {
+		t.Fatalf("sent %d times before the backoff expired", len(rc.requests))
+	}
+
+	outboxMu.Lock()
+	box := pending
+	box[0].NextAt = time.Now().Add(-time.Second)
+	writeJSON(outboxPath(), box)
+	outboxMu.Unlock()
+	Flush(context.Background())
+
+	if pending, _ := Pending(); len(pending) != 0 {
+		t.Errorf("expected the delivery dropped after max attempts, got %+v", pending)
+	}
+	entries, _ := Log("flaky", "", 0)
+	if len(entries) != 2 || entries[0].Outcome != OutcomeFailed || entries[1].Outcome != OutcomeRetrying {
+		t.Errorf("log = %+v", entries)
+	}
+}
+
+func TestOutbox_SurvivesRestart(t *testing.T) {
+	setup(t, config.WebhookEndpoint{Name: "later", URL: "http://127.0.0.1:1"})
+	Publish(EventGuardrailPaused, map[string]any{"project": "api"})
+
+	// A new process reads the same outbox.
+	rc := &receiver{status: 204}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	cfg := config.DefaultConfig()
+	cfg.Webhooks.Endpoints = []config.WebhookEndpoint{{Name: "later", URL: srv.URL}}
+	Configure(cfg)
+	Flush(context.Background())
+
+	if len(rc.requests) != 1 {
+		t.Fatalf("expected the queued event delivered, got %d requests", len(rc.requests))
+	}
+}
+
+func TestPing(t *testing.T) {
+	rc := &receiver{status: 200}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	setup(t, config.WebhookEndpoint{Name: "ci", URL: srv.URL, Events: []string{"task_done"}})
+
+	if err := Ping("nope"); err == nil {
+		t.Error("expected unknown endpoint error")
+	}
+	if err := Ping("ci"); err != nil {
+		t.Fatal(err)
+	}
+	Flush(context.Background())
+	if len(rc.requests) != 1 || rc.requests[0].Header.Get(HeaderEvent) != EventPing {
+		t.Errorf("ping not delivered")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	if backoff(1) != 10*time.Second || backoff(3) != 40*time.Second || backoff(20) != time.Hour {
+		t.Errorf("backoff = %s %s %s", backoff(1), backoff(3), backoff(20))
+	}
+}